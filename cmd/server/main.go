@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"math"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,6 +20,7 @@ import (
 	"github.com/tphummel/lab_gear/internal/db"
 	"github.com/tphummel/lab_gear/internal/handlers"
 	"github.com/tphummel/lab_gear/internal/middleware"
+	"github.com/tphummel/lab_gear/internal/models"
 )
 
 // version and commit are injected at build time via -ldflags.
@@ -24,40 +29,291 @@ var (
 	commit  = "none"
 )
 
+// config is the service configuration read from the environment.
+type config struct {
+	token  string
+	dbPath string
+	port   string
+	// trashRetention is how long deleted machines stay in the trash before
+	// the sweeper purges them. Zero disables the sweeper.
+	trashRetention time.Duration
+	// oidc configures JWT authentication; nil unless OIDC_ISSUER is set.
+	oidc *oidcConfig
+	// tlsCertFile and tlsKeyFile enable HTTPS when set. tlsClientCAFile
+	// additionally verifies client certificates, and clientCertScopes maps
+	// their names to the scope each is granted.
+	tlsCertFile      string
+	tlsKeyFile       string
+	tlsClientCAFile  string
+	clientCertScopes map[string]string
+	// rateLimit is the requests per second allowed per client, with bursts
+	// of rateLimitBurst; zero disables rate limiting. maxAuthFailures failed
+	// authentications from one IP lock it out for authLockout; zero
+	// disables lockout. trustedProxies are believed about X-Forwarded-For.
+	// Lockout is on by default. Rate limiting is opt-in, since a plan over
+	// many resources or a load test legitimately bursts on one token.
+	rateLimit       float64
+	rateLimitBurst  int
+	maxAuthFailures int
+	authLockout     time.Duration
+	trustedProxies  []netip.Prefix
+	// publicRackElevations serves rack elevation SVGs without
+	// authentication, so a wiki can embed them with an <img> tag.
+	publicRackElevations bool
+}
+
+// oidcConfig describes the OpenID Connect provider whose JWTs are accepted.
+type oidcConfig struct {
+	issuer     string
+	audience   string
+	jwks       string // URL or file path
+	rolesClaim string
+	readRoles  []string
+	writeRoles []string
+}
+
+// defaultOIDCRolesClaim is used when OIDC_ROLES_CLAIM is unset.
+const defaultOIDCRolesClaim = "groups"
+
+const (
+	// defaultRateLimitBurst is used when RATE_LIMIT_BURST is unset.
+	defaultRateLimitBurst = 20
+	// defaultMaxAuthFailures is used when AUTH_MAX_FAILURES is unset.
+	defaultMaxAuthFailures = 10
+	// defaultAuthLockout is used when AUTH_LOCKOUT is unset.
+	defaultAuthLockout = 15 * time.Minute
+	// defaultTrustedProxies is used when TRUSTED_PROXIES is unset: a
+	// reverse proxy on the same host, as in the Caddy setup.
+	defaultTrustedProxies = "127.0.0.1,::1"
+)
+
+// defaultTrashRetention is used when TRASH_RETENTION is unset.
+const defaultTrashRetention = 30 * 24 * time.Hour
+
 // loadConfig reads service configuration from environment variables and
-// applies defaults. It returns an error when a required variable is absent.
-func loadConfig() (token, dbPath, port string, err error) {
-	token = os.Getenv("API_TOKEN")
-	if token == "" {
-		err = fmt.Errorf("API_TOKEN environment variable is required")
-		return
-	}
-	dbPath = os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./lab_gear.db"
-	}
-	port = os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	return
+// applies defaults. It returns an error when a required variable is absent
+// or malformed.
+func loadConfig() (config, error) {
+	cfg := config{
+		token:           os.Getenv("API_TOKEN"),
+		dbPath:          os.Getenv("DB_PATH"),
+		port:            os.Getenv("PORT"),
+		trashRetention:  defaultTrashRetention,
+		rateLimitBurst:  defaultRateLimitBurst,
+		maxAuthFailures: defaultMaxAuthFailures,
+		authLockout:     defaultAuthLockout,
+	}
+	if cfg.token == "" {
+		return cfg, fmt.Errorf("API_TOKEN environment variable is required")
+	}
+	if cfg.dbPath == "" {
+		cfg.dbPath = "./lab_gear.db"
+	}
+	if cfg.port == "" {
+		cfg.port = "8080"
+	}
+	if v := os.Getenv("TRASH_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("TRASH_RETENTION must be a non-negative duration such as 720h, got %q", v)
+		}
+		cfg.trashRetention = d
+	}
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		oidc := &oidcConfig{
+			issuer:     issuer,
+			audience:   os.Getenv("OIDC_AUDIENCE"),
+			jwks:       os.Getenv("OIDC_JWKS"),
+			rolesClaim: os.Getenv("OIDC_ROLES_CLAIM"),
+			readRoles:  splitList(os.Getenv("OIDC_READ_ROLES")),
+			writeRoles: splitList(os.Getenv("OIDC_WRITE_ROLES")),
+		}
+		if oidc.audience == "" || oidc.jwks == "" {
+			return cfg, fmt.Errorf("OIDC_AUDIENCE and OIDC_JWKS are required when OIDC_ISSUER is set")
+		}
+		if len(oidc.readRoles) == 0 && len(oidc.writeRoles) == 0 {
+			return cfg, fmt.Errorf("OIDC_READ_ROLES or OIDC_WRITE_ROLES is required when OIDC_ISSUER is set")
+		}
+		if oidc.rolesClaim == "" {
+			oidc.rolesClaim = defaultOIDCRolesClaim
+		}
+		cfg.oidc = oidc
+	}
+	cfg.tlsCertFile, cfg.tlsKeyFile = os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	cfg.tlsClientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
+	if (cfg.tlsCertFile == "") != (cfg.tlsKeyFile == "") {
+		return cfg, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.tlsClientCAFile != "" && cfg.tlsCertFile == "" {
+		return cfg, fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if v := os.Getenv("TLS_CLIENT_SCOPES"); v != "" {
+		if cfg.tlsClientCAFile == "" {
+			return cfg, fmt.Errorf("TLS_CLIENT_SCOPES requires TLS_CLIENT_CA_FILE")
+		}
+		cfg.clientCertScopes = make(map[string]string)
+		for _, entry := range splitList(v) {
+			name, scope, ok := strings.Cut(entry, "=")
+			name, scope = strings.TrimSpace(name), strings.TrimSpace(scope)
+			if !ok || name == "" || !models.ValidScopes[scope] {
+				return cfg, fmt.Errorf("TLS_CLIENT_SCOPES entries must look like name=machines:read, got %q", entry)
+			}
+			cfg.clientCertScopes[name] = scope
+		}
+	}
+	if v := os.Getenv("RATE_LIMIT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(f >= 0) || math.IsInf(f, 0) {
+			return cfg, fmt.Errorf("RATE_LIMIT must be a non-negative number of requests per second, got %q", v)
+		}
+		cfg.rateLimit = f
+	}
+	if v := os.Getenv("RATE_LIMIT_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("RATE_LIMIT_BURST must be a positive integer, got %q", v)
+		}
+		cfg.rateLimitBurst = n
+	}
+	if v := os.Getenv("AUTH_MAX_FAILURES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("AUTH_MAX_FAILURES must be a non-negative integer, got %q", v)
+		}
+		cfg.maxAuthFailures = n
+	}
+	if v := os.Getenv("AUTH_LOCKOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("AUTH_LOCKOUT must be a positive duration such as 15m, got %q", v)
+		}
+		cfg.authLockout = d
+	}
+	// An empty TRUSTED_PROXIES trusts no proxy at all.
+	trusted, ok := os.LookupEnv("TRUSTED_PROXIES")
+	if !ok {
+		trusted = defaultTrustedProxies
+	}
+	proxies, err := middleware.ParseTrustedProxies(trusted)
+	if err != nil {
+		return cfg, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	cfg.trustedProxies = proxies
+	if v := os.Getenv("PUBLIC_RACK_ELEVATIONS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("PUBLIC_RACK_ELEVATIONS must be true or false, got %q", v)
+		}
+		cfg.publicRackElevations = b
+	}
+	return cfg, nil
+}
+
+// splitList splits a comma-separated list, dropping blank entries.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+const (
+	// trashSweepInterval is how often the sweeper looks for expired trash.
+	trashSweepInterval = time.Hour
+	// trashSweepActor is recorded as the actor on purges made by the sweeper.
+	trashSweepActor = "system:trash-retention"
+)
+
+// sweepTrash purges machines that have been in the trash for longer than
+// retention, once immediately and then every interval, until ctx is done.
+func sweepTrash(ctx context.Context, database *db.DB, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := database.PurgeDeletedBefore(time.Now().Add(-retention), trashSweepActor)
+		if err != nil {
+			slog.Error("trash sweep failed", "error", err)
+		} else if n > 0 {
+			slog.Info("purged expired machines from trash", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rackElevationHandler serves rack elevation SVGs, behind auth unless public
+// is set so that they can be embedded with an <img> tag.
+func rackElevationHandler(h *handlers.Handler, auth *middleware.Authenticator, public bool) http.Handler {
+	if public {
+		return http.HandlerFunc(h.RackElevation)
+	}
+	return auth.Require(http.HandlerFunc(h.RackElevation))
 }
 
 func main() {
-	token, dbPath, port, err := loadConfig()
+	cfg, err := loadConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
 
-	database, err := db.New(dbPath)
+	database, err := db.New(cfg.dbPath)
 	if err != nil {
 		log.Fatalf("failed to open database: %v", err)
 	}
 
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	sweepDone := make(chan struct{})
+	if cfg.trashRetention > 0 {
+		go func() {
+			defer close(sweepDone)
+			sweepTrash(sweepCtx, database, cfg.trashRetention, trashSweepInterval)
+		}()
+	} else {
+		close(sweepDone)
+	}
+
 	h := &handlers.Handler{DB: database, Version: version, Commit: commit}
 
+	// Requests authenticate with the static API_TOKEN, a token issued
+	// through /api/v1/tokens, or, if configured, a JWT from the OIDC
+	// provider. Reads need machines:read and writes machines:write, except
+	// for the routes in handlers.RoutePolicy.
+	auth := &middleware.Authenticator{Token: cfg.token, Store: database, Policy: handlers.RoutePolicy}
+	if cfg.oidc != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		keys, err := middleware.NewKeySet(ctx, cfg.oidc.jwks)
+		cancel()
+		if err != nil {
+			log.Fatalf("failed to load OIDC keys: %v", err)
+		}
+		auth.JWT = &middleware.JWTVerifier{
+			Issuer:     cfg.oidc.issuer,
+			Audience:   cfg.oidc.audience,
+			Keys:       keys,
+			RolesClaim: cfg.oidc.rolesClaim,
+			ReadRoles:  cfg.oidc.readRoles,
+			WriteRoles: cfg.oidc.writeRoles,
+		}
+	}
+	auth.ClientCerts = cfg.clientCertScopes
+	if cfg.rateLimit > 0 || cfg.maxAuthFailures > 0 {
+		auth.Limiter = &middleware.RateLimiter{
+			Rate:           cfg.rateLimit,
+			Burst:          cfg.rateLimitBurst,
+			MaxFailures:    cfg.maxAuthFailures,
+			Lockout:        cfg.authLockout,
+			TrustedProxies: cfg.trustedProxies,
+		}
+	}
+
 	mux := http.NewServeMux()
 
 	// Health check — no auth
@@ -71,11 +327,84 @@ func main() {
 	mux.HandleFunc("GET /docs", handlers.Docs)
 
 	// Machine CRUD — Bearer token auth required
-	mux.Handle("POST /api/v1/machines", middleware.Auth(token, http.HandlerFunc(h.CreateMachine)))
-	mux.Handle("GET /api/v1/machines", middleware.Auth(token, http.HandlerFunc(h.ListMachines)))
-	mux.Handle("GET /api/v1/machines/{id}", middleware.Auth(token, http.HandlerFunc(h.GetMachine)))
-	mux.Handle("PUT /api/v1/machines/{id}", middleware.Auth(token, http.HandlerFunc(h.UpdateMachine)))
-	mux.Handle("DELETE /api/v1/machines/{id}", middleware.Auth(token, http.HandlerFunc(h.DeleteMachine)))
+	mux.Handle("POST /api/v1/machines", auth.Require(http.HandlerFunc(h.CreateMachine)))
+	mux.Handle("GET /api/v1/machines", auth.Require(http.HandlerFunc(h.ListMachines)))
+	mux.Handle("GET /api/v1/machines/search", auth.Require(http.HandlerFunc(h.SearchMachines)))
+	mux.Handle("GET /api/v1/machines/{id}", auth.Require(http.HandlerFunc(h.GetMachine)))
+	mux.Handle("PUT /api/v1/machines/{id}", auth.Require(http.HandlerFunc(h.UpdateMachine)))
+	mux.Handle("PATCH /api/v1/machines/{id}", auth.Require(http.HandlerFunc(h.PatchMachine)))
+	mux.Handle("DELETE /api/v1/machines/{id}", auth.Require(http.HandlerFunc(h.DeleteMachine)))
+	mux.Handle("GET /api/v1/machines/{id}/history", auth.Require(http.HandlerFunc(h.MachineHistory)))
+	mux.Handle("POST /api/v1/machines/{id}/restore", auth.Require(http.HandlerFunc(h.RestoreMachine)))
+	mux.Handle("GET /api/v1/machines/{id}/children", auth.Require(http.HandlerFunc(h.ListChildren)))
+	mux.Handle("GET /api/v1/machines/{id}/tree", auth.Require(http.HandlerFunc(h.MachineTree)))
+
+	// Network interfaces — Bearer token auth required
+	mux.Handle("GET /api/v1/machines/{id}/interfaces", auth.Require(http.HandlerFunc(h.ListInterfaces)))
+	mux.Handle("POST /api/v1/machines/{id}/interfaces", auth.Require(http.HandlerFunc(h.CreateInterface)))
+	mux.Handle("GET /api/v1/machines/{id}/interfaces/{iface}", auth.Require(http.HandlerFunc(h.GetInterface)))
+	mux.Handle("PUT /api/v1/machines/{id}/interfaces/{iface}", auth.Require(http.HandlerFunc(h.UpdateInterface)))
+	mux.Handle("DELETE /api/v1/machines/{id}/interfaces/{iface}", auth.Require(http.HandlerFunc(h.DeleteInterface)))
+	mux.Handle("GET /api/v1/interfaces", auth.Require(http.HandlerFunc(h.LookupInterfaces)))
+
+	// Hardware components — Bearer token auth required
+	mux.Handle("GET /api/v1/machines/{id}/components", auth.Require(http.HandlerFunc(h.ListComponents)))
+	mux.Handle("POST /api/v1/machines/{id}/components", auth.Require(http.HandlerFunc(h.CreateComponent)))
+	mux.Handle("GET /api/v1/machines/{id}/components/{component}", auth.Require(http.HandlerFunc(h.GetComponent)))
+	mux.Handle("PUT /api/v1/machines/{id}/components/{component}", auth.Require(http.HandlerFunc(h.UpdateComponent)))
+	mux.Handle("DELETE /api/v1/machines/{id}/components/{component}", auth.Require(http.HandlerFunc(h.DeleteComponent)))
+	mux.Handle("POST /api/v1/machines/{id}/components/{component}/move", auth.Require(http.HandlerFunc(h.MoveComponent)))
+
+	// Maintenance log — Bearer token auth required
+	mux.Handle("GET /api/v1/machines/{id}/maintenance", auth.Require(http.HandlerFunc(h.ListMaintenance)))
+	mux.Handle("POST /api/v1/machines/{id}/maintenance", auth.Require(http.HandlerFunc(h.CreateMaintenance)))
+	mux.Handle("GET /api/v1/machines/{id}/maintenance/{event}", auth.Require(http.HandlerFunc(h.GetMaintenance)))
+	mux.Handle("PUT /api/v1/machines/{id}/maintenance/{event}", auth.Require(http.HandlerFunc(h.UpdateMaintenance)))
+	mux.Handle("DELETE /api/v1/machines/{id}/maintenance/{event}", auth.Require(http.HandlerFunc(h.DeleteMaintenance)))
+
+	// Locations — Bearer token auth required
+	mux.Handle("GET /api/v1/locations", auth.Require(http.HandlerFunc(h.ListLocations)))
+	mux.Handle("POST /api/v1/locations", auth.Require(http.HandlerFunc(h.CreateLocation)))
+	mux.Handle("GET /api/v1/locations/{id}", auth.Require(http.HandlerFunc(h.GetLocation)))
+	mux.Handle("PUT /api/v1/locations/{id}", auth.Require(http.HandlerFunc(h.UpdateLocation)))
+	mux.Handle("DELETE /api/v1/locations/{id}", auth.Require(http.HandlerFunc(h.DeleteLocation)))
+	// Rack elevations — Bearer token auth required unless made public
+	mux.Handle("GET /api/v1/racks/{name}/elevation.svg", rackElevationHandler(h, auth, cfg.publicRackElevations))
+
+	// Network and power assets — Bearer token auth required
+	for _, t := range models.AssetTypes {
+		base := "/api/v1/" + t.Path
+		mux.Handle("GET "+base, auth.Require(h.ListAssets(t)))
+		mux.Handle("POST "+base, auth.Require(h.CreateAsset(t)))
+		mux.Handle("GET "+base+"/{id}", auth.Require(h.GetAsset(t)))
+		mux.Handle("PUT "+base+"/{id}", auth.Require(h.UpdateAsset(t)))
+		mux.Handle("DELETE "+base+"/{id}", auth.Require(h.DeleteAsset(t)))
+	}
+
+	// Guests — Bearer token auth required
+	mux.Handle("GET /api/v1/guests", auth.Require(http.HandlerFunc(h.ListGuests)))
+	mux.Handle("POST /api/v1/guests", auth.Require(http.HandlerFunc(h.CreateGuest)))
+	mux.Handle("GET /api/v1/guests/{id}", auth.Require(http.HandlerFunc(h.GetGuest)))
+	mux.Handle("PUT /api/v1/guests/{id}", auth.Require(http.HandlerFunc(h.UpdateGuest)))
+	mux.Handle("DELETE /api/v1/guests/{id}", auth.Require(http.HandlerFunc(h.DeleteGuest)))
+
+	// Trash — Bearer token auth required; purging needs the admin scope
+	mux.Handle("GET /api/v1/trash", auth.Require(http.HandlerFunc(h.ListTrash)))
+	mux.Handle("DELETE /api/v1/trash/{id}", auth.Require(http.HandlerFunc(h.PurgeMachine)))
+
+	// Audit log — Bearer token auth required
+	mux.Handle("GET /api/v1/audit", auth.Require(http.HandlerFunc(h.Audit)))
+
+	// API tokens — Bearer token auth with the admin scope required
+	mux.Handle("GET /api/v1/tokens", auth.Require(http.HandlerFunc(h.ListTokens)))
+	mux.Handle("POST /api/v1/tokens", auth.Require(http.HandlerFunc(h.CreateToken)))
+	mux.Handle("DELETE /api/v1/tokens/{id}", auth.Require(http.HandlerFunc(h.DeleteToken)))
+
+	// Reports — Bearer token auth required
+	mux.Handle("GET /api/v1/reports/warranty", auth.Require(http.HandlerFunc(h.WarrantyReport)))
+	mux.Handle("GET /api/v1/reports/cost", auth.Require(http.HandlerFunc(h.CostReport)))
+	mux.Handle("GET /api/v1/reports/power", auth.Require(http.HandlerFunc(h.PowerReport)))
+	mux.Handle("GET /api/v1/reports/capacity", auth.Require(http.HandlerFunc(h.CapacityReport)))
 
 	skip := func(r *http.Request) bool {
 		return r.URL.Path == "/healthz" || r.URL.Path == "/metrics"
@@ -83,7 +412,7 @@ func main() {
 	handler := middleware.RequestLogger(slog.Default(), skip, mux)
 
 	srv := &http.Server{
-		Addr:              fmt.Sprintf(":%s", port),
+		Addr:              fmt.Sprintf(":%s", cfg.port),
 		Handler:           handler,
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       10 * time.Second,
@@ -91,9 +420,38 @@ func main() {
 		IdleTimeout:       120 * time.Second,
 	}
 
+	// With TLS_CERT_FILE set, serve HTTPS and reload the certificate (and
+	// client CA) on SIGHUP, e.g. from a renewal hook.
+	var certs *certReloader
+	if cfg.tlsCertFile != "" {
+		certs, err = newCertReloader(cfg.tlsCertFile, cfg.tlsKeyFile, cfg.tlsClientCAFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv.TLSConfig = certs.serverConfig()
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := certs.reload(); err != nil {
+					slog.Error("TLS reload failed; keeping the current certificate", "error", err)
+				} else {
+					slog.Info("reloaded TLS certificate")
+				}
+			}
+		}()
+	}
+
 	go func() {
-		log.Printf("listening on :%s", port)
-		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if certs != nil {
+			log.Printf("listening on :%s (TLS)", cfg.port)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("listening on :%s", cfg.port)
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("server error: %v", err)
 		}
 	}()
@@ -109,6 +467,8 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("graceful shutdown failed: %v", err)
 	}
+	stopSweep()
+	<-sweepDone
 	if err := database.Close(); err != nil {
 		log.Printf("database close error: %v", err)
 	}
@@ -1,14 +1,27 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/handlers"
+	"github.com/tphummel/lab_gear/internal/middleware"
+	"github.com/tphummel/lab_gear/internal/models"
 )
 
-// helper that clears the three config env vars and restores them after the test.
+// helper that clears the config env vars and restores them after the test.
 func clearConfigEnv(t *testing.T) {
 	t.Helper()
-	vars := []string{"API_TOKEN", "DB_PATH", "PORT"}
+	vars := []string{"API_TOKEN", "DB_PATH", "PORT", "TRASH_RETENTION",
+		"OIDC_ISSUER", "OIDC_AUDIENCE", "OIDC_JWKS", "OIDC_ROLES_CLAIM", "OIDC_READ_ROLES", "OIDC_WRITE_ROLES",
+		"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_CLIENT_CA_FILE", "TLS_CLIENT_SCOPES",
+		"RATE_LIMIT", "RATE_LIMIT_BURST", "AUTH_MAX_FAILURES", "AUTH_LOCKOUT", "TRUSTED_PROXIES",
+		"PUBLIC_RACK_ELEVATIONS"}
 	saved := make(map[string]string, len(vars))
 	for _, v := range vars {
 		saved[v] = os.Getenv(v)
@@ -28,7 +41,7 @@ func clearConfigEnv(t *testing.T) {
 func TestLoadConfig_MissingToken(t *testing.T) {
 	clearConfigEnv(t)
 
-	_, _, _, err := loadConfig()
+	_, err := loadConfig()
 	if err == nil {
 		t.Fatal("expected error when API_TOKEN is unset, got nil")
 	}
@@ -38,12 +51,12 @@ func TestLoadConfig_DefaultDBPath(t *testing.T) {
 	clearConfigEnv(t)
 	os.Setenv("API_TOKEN", "my-token")
 
-	_, dbPath, _, err := loadConfig()
+	cfg, err := loadConfig()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if dbPath != "./lab_gear.db" {
-		t.Errorf("DB_PATH default: got %q, want ./lab_gear.db", dbPath)
+	if cfg.dbPath != "./lab_gear.db" {
+		t.Errorf("DB_PATH default: got %q, want ./lab_gear.db", cfg.dbPath)
 	}
 }
 
@@ -51,12 +64,12 @@ func TestLoadConfig_DefaultPort(t *testing.T) {
 	clearConfigEnv(t)
 	os.Setenv("API_TOKEN", "my-token")
 
-	_, _, port, err := loadConfig()
+	cfg, err := loadConfig()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if port != "8080" {
-		t.Errorf("PORT default: got %q, want 8080", port)
+	if cfg.port != "8080" {
+		t.Errorf("PORT default: got %q, want 8080", cfg.port)
 	}
 }
 
@@ -66,17 +79,301 @@ func TestLoadConfig_CustomValues(t *testing.T) {
 	os.Setenv("DB_PATH", "/data/lab.db")
 	os.Setenv("PORT", "9090")
 
-	token, dbPath, port, err := loadConfig()
+	os.Setenv("TRASH_RETENTION", "168h")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.token != "secret" {
+		t.Errorf("token: got %q, want secret", cfg.token)
+	}
+	if cfg.dbPath != "/data/lab.db" {
+		t.Errorf("dbPath: got %q, want /data/lab.db", cfg.dbPath)
+	}
+	if cfg.port != "9090" {
+		t.Errorf("port: got %q, want 9090", cfg.port)
+	}
+	if cfg.trashRetention != 168*time.Hour {
+		t.Errorf("trashRetention: got %v, want 168h", cfg.trashRetention)
+	}
+}
+
+func TestLoadConfig_DefaultTrashRetention(t *testing.T) {
+	clearConfigEnv(t)
+	os.Setenv("API_TOKEN", "my-token")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.trashRetention != defaultTrashRetention {
+		t.Errorf("TRASH_RETENTION default: got %v, want %v", cfg.trashRetention, defaultTrashRetention)
+	}
+}
+
+func TestLoadConfig_InvalidTrashRetention(t *testing.T) {
+	for _, v := range []string{"30 days", "-1h"} {
+		clearConfigEnv(t)
+		os.Setenv("API_TOKEN", "my-token")
+		os.Setenv("TRASH_RETENTION", v)
+
+		if _, err := loadConfig(); err == nil {
+			t.Errorf("TRASH_RETENTION=%q: expected error, got nil", v)
+		}
+	}
+}
+
+func TestLoadConfig_OIDC(t *testing.T) {
+	clearConfigEnv(t)
+	os.Setenv("API_TOKEN", "my-token")
+
+	cfg, err := loadConfig()
+	if err != nil || cfg.oidc != nil {
+		t.Fatalf("without OIDC_ISSUER: got %+v, %v; want no OIDC config", cfg.oidc, err)
+	}
+
+	os.Setenv("OIDC_ISSUER", "https://auth.lab.example")
+	os.Setenv("OIDC_AUDIENCE", "lab_gear")
+	os.Setenv("OIDC_JWKS", "/etc/lab_gear/jwks.json")
+	os.Setenv("OIDC_WRITE_ROLES", "lab-admins, ops,")
+	cfg, err = loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.oidc.rolesClaim != defaultOIDCRolesClaim {
+		t.Errorf("rolesClaim default: got %q, want %q", cfg.oidc.rolesClaim, defaultOIDCRolesClaim)
+	}
+	if got := cfg.oidc.writeRoles; len(got) != 2 || got[0] != "lab-admins" || got[1] != "ops" {
+		t.Errorf("writeRoles: got %q, want [lab-admins ops]", got)
+	}
+
+	for _, unset := range []string{"OIDC_AUDIENCE", "OIDC_JWKS", "OIDC_WRITE_ROLES"} {
+		v := os.Getenv(unset)
+		os.Unsetenv(unset)
+		if _, err := loadConfig(); err == nil {
+			t.Errorf("without %s: expected error, got nil", unset)
+		}
+		os.Setenv(unset, v)
+	}
+}
+
+func TestLoadConfig_TLS(t *testing.T) {
+	clearConfigEnv(t)
+	os.Setenv("API_TOKEN", "my-token")
+	os.Setenv("TLS_CERT_FILE", "/etc/lab_gear/tls.crt")
+	os.Setenv("TLS_KEY_FILE", "/etc/lab_gear/tls.key")
+	os.Setenv("TLS_CLIENT_CA_FILE", "/etc/lab_gear/ca.crt")
+	os.Setenv("TLS_CLIENT_SCOPES", "atlantis.lab=machines:write, grafana.lab=machines:read")
+
+	cfg, err := loadConfig()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if token != "secret" {
-		t.Errorf("token: got %q, want secret", token)
+	if cfg.tlsCertFile != "/etc/lab_gear/tls.crt" || cfg.tlsKeyFile != "/etc/lab_gear/tls.key" || cfg.tlsClientCAFile != "/etc/lab_gear/ca.crt" {
+		t.Errorf("TLS files: got %q %q %q", cfg.tlsCertFile, cfg.tlsKeyFile, cfg.tlsClientCAFile)
+	}
+	if len(cfg.clientCertScopes) != 2 || cfg.clientCertScopes["grafana.lab"] != models.ScopeMachinesRead {
+		t.Errorf("clientCertScopes: got %v", cfg.clientCertScopes)
+	}
+}
+
+func TestLoadConfig_InvalidTLS(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"cert without key", map[string]string{"TLS_CERT_FILE": "tls.crt"}},
+		{"key without cert", map[string]string{"TLS_KEY_FILE": "tls.key"}},
+		{"client CA without cert", map[string]string{"TLS_CLIENT_CA_FILE": "ca.crt"}},
+		{"scopes without client CA", map[string]string{"TLS_CERT_FILE": "tls.crt", "TLS_KEY_FILE": "tls.key",
+			"TLS_CLIENT_SCOPES": "atlantis.lab=machines:write"}},
+		{"invalid scope", map[string]string{"TLS_CERT_FILE": "tls.crt", "TLS_KEY_FILE": "tls.key",
+			"TLS_CLIENT_CA_FILE": "ca.crt", "TLS_CLIENT_SCOPES": "atlantis.lab=write"}},
+	}
+	for _, tt := range tests {
+		clearConfigEnv(t)
+		os.Setenv("API_TOKEN", "my-token")
+		for k, v := range tt.env {
+			os.Setenv(k, v)
+		}
+		if _, err := loadConfig(); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		}
 	}
-	if dbPath != "/data/lab.db" {
-		t.Errorf("dbPath: got %q, want /data/lab.db", dbPath)
+}
+
+func TestLoadConfig_RateLimits(t *testing.T) {
+	clearConfigEnv(t)
+	os.Setenv("API_TOKEN", "my-token")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.rateLimit != 0 || cfg.maxAuthFailures != defaultMaxAuthFailures || cfg.rateLimitBurst != defaultRateLimitBurst ||
+		cfg.authLockout != defaultAuthLockout || len(cfg.trustedProxies) != 2 {
+		t.Errorf("defaults: got rate %v burst %d failures %d lockout %v proxies %v",
+			cfg.rateLimit, cfg.rateLimitBurst, cfg.maxAuthFailures, cfg.authLockout, cfg.trustedProxies)
+	}
+
+	os.Setenv("RATE_LIMIT", "2.5")
+	os.Setenv("RATE_LIMIT_BURST", "10")
+	os.Setenv("AUTH_MAX_FAILURES", "5")
+	os.Setenv("AUTH_LOCKOUT", "1h")
+	os.Setenv("TRUSTED_PROXIES", "127.0.0.1, 10.0.0.0/8")
+	cfg, err = loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.rateLimit != 2.5 || cfg.rateLimitBurst != 10 || cfg.maxAuthFailures != 5 || cfg.authLockout != time.Hour || len(cfg.trustedProxies) != 2 {
+		t.Errorf("got rate %v burst %d failures %d lockout %v proxies %v",
+			cfg.rateLimit, cfg.rateLimitBurst, cfg.maxAuthFailures, cfg.authLockout, cfg.trustedProxies)
+	}
+
+	// Zero turns each off, and an empty TRUSTED_PROXIES trusts no proxy.
+	os.Setenv("RATE_LIMIT", "0")
+	os.Setenv("AUTH_MAX_FAILURES", "0")
+	os.Setenv("TRUSTED_PROXIES", "")
+	cfg, err = loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.rateLimit != 0 || cfg.maxAuthFailures != 0 || len(cfg.trustedProxies) != 0 {
+		t.Errorf("disabled: got rate %v failures %d proxies %v", cfg.rateLimit, cfg.maxAuthFailures, cfg.trustedProxies)
+	}
+}
+
+func TestLoadConfig_PublicRackElevations(t *testing.T) {
+	clearConfigEnv(t)
+	os.Setenv("API_TOKEN", "my-token")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.publicRackElevations {
+		t.Error("default: rack elevations are public")
+	}
+
+	os.Setenv("PUBLIC_RACK_ELEVATIONS", "true")
+	if cfg, err = loadConfig(); err != nil || !cfg.publicRackElevations {
+		t.Errorf("true: got %v, %v", cfg.publicRackElevations, err)
+	}
+
+	os.Setenv("PUBLIC_RACK_ELEVATIONS", "sometimes")
+	if _, err := loadConfig(); err == nil {
+		t.Error("invalid value: expected error, got nil")
+	}
+}
+
+func TestRackElevationHandler(t *testing.T) {
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("db.New: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, l := range []*models.Location{
+		{ID: "site", Name: "home", Kind: models.LocationSite},
+		{ID: "room", Name: "office", Kind: models.LocationRoom, ParentID: "site"},
+		{ID: "rack", Name: "rack1", Kind: models.LocationRack, ParentID: "room", HeightU: 12},
+	} {
+		l.CreatedAt, l.UpdatedAt = now, now
+		if err := database.CreateLocation(l); err != nil {
+			t.Fatalf("CreateLocation %s: %v", l.ID, err)
+		}
+	}
+	h := &handlers.Handler{DB: database}
+	auth := &middleware.Authenticator{Token: "secret", Store: database, Policy: handlers.RoutePolicy}
+
+	for _, tt := range []struct {
+		public bool
+		token  string
+		want   int
+	}{
+		{false, "", http.StatusUnauthorized},
+		{false, "secret", http.StatusOK},
+		{true, "", http.StatusOK},
+	} {
+		mux := http.NewServeMux()
+		mux.Handle("GET /api/v1/racks/{name}/elevation.svg", rackElevationHandler(h, auth, tt.public))
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/racks/rack1/elevation.svg", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("public %v, token %q: got %d, want %d", tt.public, tt.token, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidRateLimits(t *testing.T) {
+	for k, v := range map[string]string{
+		"RATE_LIMIT":        "-1",
+		"RATE_LIMIT_BURST":  "0",
+		"AUTH_MAX_FAILURES": "many",
+		"AUTH_LOCKOUT":      "0s",
+		"TRUSTED_PROXIES":   "caddy.lab",
+	} {
+		clearConfigEnv(t)
+		os.Setenv("API_TOKEN", "my-token")
+		os.Setenv(k, v)
+		if _, err := loadConfig(); err == nil {
+			t.Errorf("%s=%q: expected error, got nil", k, v)
+		}
+	}
+}
+
+func TestSweepTrash(t *testing.T) {
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("db.New: %v", err)
+	}
+	defer database.Close()
+
+	now := time.Now().UTC()
+	m := &models.Machine{ID: "old", Name: "pve1", Kind: "proxmox", Make: "Dell", Model: "R720", CreatedAt: now, UpdatedAt: now}
+	if err := database.Create(m, "test"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := database.Delete("old", 0, false, "test"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// A negative retention puts the cutoff in the future, so the machine
+	// deleted just now is already expired.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sweepTrash(ctx, database, -time.Hour, time.Millisecond)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		trash, _, err := database.List(db.ListOptions{Trashed: true})
+		if err != nil {
+			t.Fatalf("List trash: %v", err)
+		}
+		if len(trash) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("sweeper did not purge the expired machine")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	events, err := database.History("old")
+	if err != nil {
+		t.Fatalf("History: %v", err)
 	}
-	if port != "9090" {
-		t.Errorf("port: got %q, want 9090", port)
+	if last := events[len(events)-1]; last.Operation != models.OpPurge || last.Actor != trashSweepActor {
+		t.Errorf("last event: got %s by %s, want purge by %s", last.Operation, last.Actor, trashSweepActor)
 	}
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// certReloader serves the TLS configuration built from the certificate,
+// key, and optional client CA files, and rebuilds it from the files on
+// reload so that renewed certificates are picked up without a restart.
+type certReloader struct {
+	certFile, keyFile, clientCAFile string
+
+	mu     sync.RWMutex
+	config *tls.Config
+}
+
+// newCertReloader loads the files, failing if any cannot be used.
+func newCertReloader(certFile, keyFile, clientCAFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload rereads the files. If any cannot be used, the current
+// configuration is kept and the error returned.
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("read TLS client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("read TLS client CA: no certificates in %s", r.clientCAFile)
+		}
+		// Clients without a certificate may still use a bearer token.
+		cfg.ClientCAs, cfg.ClientAuth = pool, tls.VerifyClientCertIfGiven
+	}
+	r.mu.Lock()
+	r.config = cfg
+	r.mu.Unlock()
+	return nil
+}
+
+// serverConfig returns a configuration for http.Server that hands each new
+// connection the most recently loaded one.
+func (r *certReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.config, nil
+		},
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/middleware"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "lab CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert, key, pool}
+}
+
+// issue returns the PEM certificate and key for a leaf with the given serial
+// and common name, valid for the given extended key usage.
+func (ca *testCA) issue(t *testing.T, serial int64, cn string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS serves h with the reloader's configuration on a local port and
+// returns the address.
+func serveTLS(t *testing.T, certs *certReloader, h http.Handler) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", certs.serverConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: h}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+// servedSerial connects to addr and returns the serial number of the
+// server's certificate.
+func servedSerial(t *testing.T, addr string, roots *x509.CertPool) int64 {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "lab-gear.lab"})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	certPEM, keyPEM := ca.issue(t, 100, "lab-gear.lab", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	certs, err := newCertReloader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	addr := serveTLS(t, certs, http.NotFoundHandler())
+	if got := servedSerial(t, addr, ca.pool); got != 100 {
+		t.Fatalf("serial: got %d, want 100", got)
+	}
+
+	// A renewed certificate is served once reloaded.
+	certPEM, keyPEM = ca.issue(t, 101, "lab-gear.lab", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	if err := certs.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := servedSerial(t, addr, ca.pool); got != 101 {
+		t.Errorf("serial after reload: got %d, want 101", got)
+	}
+
+	// A broken renewal leaves the current certificate in place.
+	writeFile(t, keyFile, []byte("not a key"))
+	if err := certs.reload(); err == nil {
+		t.Error("reload of a broken key: got nil error")
+	}
+	if got := servedSerial(t, addr, ca.pool); got != 101 {
+		t.Errorf("serial after failed reload: got %d, want 101", got)
+	}
+}
+
+func TestCertReloader_ClientCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	certPEM, keyPEM := ca.issue(t, 100, "lab-gear.lab", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+
+	certs, err := newCertReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	auth := &middleware.Authenticator{Token: "secret", ClientCerts: map[string]string{
+		"atlantis.lab": models.ScopeMachinesWrite,
+	}}
+	addr := serveTLS(t, certs, auth.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Identity", middleware.Identity(r.Context()))
+	})))
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs: ca.pool, ServerName: "lab-gear.lab", Certificates: certs,
+		}}}
+	}
+	atlantisPEM, atlantisKey := ca.issue(t, 200, "atlantis.lab", x509.ExtKeyUsageClientAuth)
+	atlantis, err := tls.X509KeyPair(atlantisPEM, atlantisKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strangerPEM, strangerKey := ca.issue(t, 201, "laptop.lab", x509.ExtKeyUsageClientAuth)
+	stranger, err := tls.X509KeyPair(strangerPEM, strangerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		client       *http.Client
+		want         int
+		wantIdentity string
+	}{
+		{"mapped certificate", client(atlantis), http.StatusOK, "cert:atlantis.lab"},
+		{"unmapped certificate", client(stranger), http.StatusUnauthorized, ""},
+		{"no certificate", client(), http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get("https://" + addr + "/")
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want || resp.Header.Get("X-Identity") != tt.wantIdentity {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, resp.Header.Get("X-Identity"), tt.want, tt.wantIdentity)
+			}
+		})
+	}
+}
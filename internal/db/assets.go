@@ -0,0 +1,206 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// migrateAssets creates the assets table, which holds every asset type in
+// models.AssetTypes. Type-specific columns are zero for the other types.
+// Radio bands are stored as a JSON array.
+func migrateAssets(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS assets (
+			id              TEXT PRIMARY KEY,
+			type            TEXT NOT NULL,
+			name            TEXT NOT NULL,
+			make            TEXT NOT NULL DEFAULT '',
+			model           TEXT NOT NULL DEFAULT '',
+			serial          TEXT NOT NULL DEFAULT '',
+			location_id     TEXT REFERENCES locations(id),
+			notes           TEXT NOT NULL DEFAULT '',
+			port_count      INTEGER NOT NULL DEFAULT 0,
+			va_rating       INTEGER NOT NULL DEFAULT 0,
+			watt_rating     INTEGER NOT NULL DEFAULT 0,
+			runtime_minutes INTEGER NOT NULL DEFAULT 0,
+			radio_bands     TEXT NOT NULL DEFAULT '[]',
+			created_at      DATETIME NOT NULL,
+			updated_at      DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_assets_type_name ON assets(type, name);
+		CREATE INDEX IF NOT EXISTS idx_assets_location_id ON assets(location_id) WHERE location_id IS NOT NULL;
+	`)
+	return err
+}
+
+const assetColumns = `id, type, name, make, model, serial, location_id, notes,
+	port_count, va_rating, watt_rating, runtime_minutes, radio_bands, created_at, updated_at`
+
+func scanAsset(row rowScanner) (*models.Asset, error) {
+	var a models.Asset
+	var locationID sql.NullString
+	var bands, createdAt, updatedAt string
+	if err := row.Scan(&a.ID, &a.Type, &a.Name, &a.Make, &a.Model, &a.Serial, &locationID, &a.Notes,
+		&a.PortCount, &a.VARating, &a.WattRating, &a.RuntimeMinutes, &bands, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	a.LocationID = locationID.String
+	if err := json.Unmarshal([]byte(bands), &a.RadioBands); err != nil {
+		return nil, fmt.Errorf("parse radio_bands of asset %q: %w", a.ID, err)
+	}
+	if len(a.RadioBands) == 0 {
+		a.RadioBands = nil
+	}
+	var err error
+	a.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
+	}
+	a.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse updated_at %q: %w", updatedAt, err)
+	}
+	return &a, nil
+}
+
+// ListAssets returns the assets of the given type, ordered by name.
+func (d *DB) ListAssets(typ string) ([]*models.Asset, error) {
+	rows, err := d.conn.Query(`SELECT `+assetColumns+` FROM assets WHERE type = ? ORDER BY name, id`, typ)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*models.Asset{}
+	for rows.Next() {
+		a, err := scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// GetAsset returns the asset of the given type and ID, or sql.ErrNoRows if
+// there is none. An asset of another type with the ID is not found.
+func (d *DB) GetAsset(typ, id string) (*models.Asset, error) {
+	return getAsset(d.conn, typ, id)
+}
+
+func getAsset(q querier, typ, id string) (*models.Asset, error) {
+	return scanAsset(q.QueryRow(`SELECT `+assetColumns+` FROM assets WHERE type = ? AND id = ?`, typ, id))
+}
+
+// checkAssetLocation returns ErrLocationNotFound if a's location_id is set
+// but does not name an existing location.
+func checkAssetLocation(q querier, a *models.Asset) error {
+	if a.LocationID == "" {
+		return nil
+	}
+	if _, err := getLocation(q, a.LocationID); errors.Is(err, sql.ErrNoRows) {
+		return ErrLocationNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func marshalBands(bands []string) (string, error) {
+	if bands == nil {
+		bands = []string{}
+	}
+	b, err := json.Marshal(bands)
+	return string(b), err
+}
+
+// CreateAsset inserts a new asset. It returns ErrLocationNotFound if its
+// location does not exist.
+func (d *DB) CreateAsset(a *models.Asset) error {
+	bands, err := marshalBands(a.RadioBands)
+	if err != nil {
+		return err
+	}
+	return d.inTx(func(tx *sql.Tx) error {
+		if err := checkAssetLocation(tx, a); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO assets (id, type, name, make, model, serial, location_id, notes,
+				port_count, va_rating, watt_rating, runtime_minutes, radio_bands, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			a.ID, a.Type, a.Name, a.Make, a.Model, a.Serial, nullString(a.LocationID), a.Notes,
+			a.PortCount, a.VARating, a.WattRating, a.RuntimeMinutes, bands,
+			a.CreatedAt.UTC().Format(time.RFC3339),
+			a.UpdatedAt.UTC().Format(time.RFC3339),
+		)
+		return err
+	})
+}
+
+// UpdateAsset replaces every client-supplied field of an existing asset of
+// type a.Type; the type itself cannot change. CreatedAt is taken from the
+// stored row and written back to a. Returns sql.ErrNoRows if there is no such
+// asset, ErrLocationNotFound if its new location does not exist, and
+// ErrUPSOverCapacity if a UPS would no longer carry the machines on it.
+func (d *DB) UpdateAsset(a *models.Asset) error {
+	bands, err := marshalBands(a.RadioBands)
+	if err != nil {
+		return err
+	}
+	return d.inTx(func(tx *sql.Tx) error {
+		existing, err := getAsset(tx, a.Type, a.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkAssetLocation(tx, a); err != nil {
+			return err
+		}
+		if a.Type == models.AssetUPS {
+			load, err := upsLoad(tx, a.ID, "")
+			if err != nil {
+				return err
+			}
+			if err := checkCapacity(a, load); err != nil {
+				return err
+			}
+		}
+		a.CreatedAt = existing.CreatedAt
+		_, err = tx.Exec(`
+			UPDATE assets
+			SET name = ?, make = ?, model = ?, serial = ?, location_id = ?, notes = ?,
+			    port_count = ?, va_rating = ?, watt_rating = ?, runtime_minutes = ?, radio_bands = ?, updated_at = ?
+			WHERE id = ?`,
+			a.Name, a.Make, a.Model, a.Serial, nullString(a.LocationID), a.Notes,
+			a.PortCount, a.VARating, a.WattRating, a.RuntimeMinutes, bands,
+			a.UpdatedAt.UTC().Format(time.RFC3339),
+			a.ID,
+		)
+		return err
+	})
+}
+
+// DeleteAsset removes the asset of the given type and ID. Returns
+// sql.ErrNoRows if there is none, and ErrAssetInUse if it is a UPS that
+// machines, including machines in the trash, are plugged into.
+func (d *DB) DeleteAsset(typ, id string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if _, err := getAsset(tx, typ, id); err != nil {
+			return err
+		}
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM machines WHERE ups_id = ?`, id).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrAssetInUse
+		}
+		_, err := tx.Exec(`DELETE FROM assets WHERE id = ?`, id)
+		return err
+	})
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// migrateAudit creates the machine_events table. Events are append-only:
+// triggers reject any UPDATE or DELETE so the history cannot be rewritten
+// through the database layer. Events are not tied to machines by a foreign
+// key, so a machine's history outlives the machine.
+func migrateAudit(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS machine_events (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			machine_id TEXT NOT NULL,
+			actor      TEXT NOT NULL,
+			operation  TEXT NOT NULL,
+			changes    TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_machine_events_machine_id ON machine_events(machine_id, id);
+		CREATE INDEX IF NOT EXISTS idx_machine_events_created_at ON machine_events(created_at, id);
+		CREATE TRIGGER IF NOT EXISTS machine_events_no_update BEFORE UPDATE ON machine_events BEGIN
+			SELECT RAISE(ABORT, 'machine_events is append-only');
+		END;
+		CREATE TRIGGER IF NOT EXISTS machine_events_no_delete BEFORE DELETE ON machine_events BEGIN
+			SELECT RAISE(ABORT, 'machine_events is append-only');
+		END;
+	`)
+	return err
+}
+
+// auditIgnored are fields the server maintains itself. They are left out of
+// event diffs so each event lists only what the caller changed.
+var auditIgnored = map[string]bool{
+	"id":                true,
+	"created_at":        true,
+	"updated_at":        true,
+	"revision":          true,
+	"status_changed_at": true,
+}
+
+// machineFields returns m in its JSON object form, keyed by API field name,
+// or nil if m is nil.
+func machineFields(m *models.Machine) (map[string]any, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]any
+	return out, json.Unmarshal(b, &out)
+}
+
+// diffMachines returns the fields that differ between before and after. A
+// nil before (create) or after (delete) yields every field.
+func diffMachines(before, after *models.Machine) (map[string]models.FieldChange, error) {
+	b, err := machineFields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := machineFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]models.FieldChange)
+	for k, av := range a {
+		if bv, ok := b[k]; !auditIgnored[k] && (!ok || !reflect.DeepEqual(av, bv)) {
+			changes[k] = models.FieldChange{Before: bv, After: av}
+		}
+	}
+	for k, bv := range b {
+		if _, ok := a[k]; !auditIgnored[k] && !ok {
+			changes[k] = models.FieldChange{Before: bv, After: nil}
+		}
+	}
+	return changes, nil
+}
+
+// recordEvent appends an event describing the change from before to after.
+// It must run in the same transaction as the write it describes.
+func recordEvent(q querier, actor, op string, before, after *models.Machine) error {
+	id := ""
+	switch {
+	case after != nil:
+		id = after.ID
+	case before != nil:
+		id = before.ID
+	}
+	changes, err := diffMachines(before, after)
+	if err != nil {
+		return err
+	}
+	return insertEvent(q, id, actor, op, changes)
+}
+
+// insertEvent appends one event for machineID with the given changes.
+func insertEvent(q querier, machineID, actor, op string, changes map[string]models.FieldChange) error {
+	b, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`
+		INSERT INTO machine_events (machine_id, actor, operation, changes, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		machineID, actor, op, string(b), time.Now().UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+const eventColumns = `id, machine_id, actor, operation, changes, created_at`
+
+func scanEvent(row rowScanner) (*models.MachineEvent, error) {
+	var e models.MachineEvent
+	var changes, createdAt string
+	if err := row.Scan(&e.ID, &e.MachineID, &e.Actor, &e.Operation, &changes, &createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(changes), &e.Changes); err != nil {
+		return nil, fmt.Errorf("parse changes of event %d: %w", e.ID, err)
+	}
+	var err error
+	e.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
+	}
+	return &e, nil
+}
+
+func (d *DB) queryEvents(query string, args ...any) ([]*models.MachineEvent, error) {
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.MachineEvent{}
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// History returns every event recorded for the machine with the given ID,
+// oldest first. It still returns the history of a deleted machine.
+func (d *DB) History(machineID string) ([]*models.MachineEvent, error) {
+	return d.queryEvents(`SELECT `+eventColumns+` FROM machine_events WHERE machine_id = ? ORDER BY id`, machineID)
+}
+
+// AuditOptions controls the time range and pagination for Audit.
+type AuditOptions struct {
+	// Since and Until bound the event timestamp to [Since, Until). A zero
+	// value leaves that end of the range open.
+	Since time.Time
+	Until time.Time
+	// Limit is the maximum number of events to return. Zero means
+	// DefaultListLimit; values above MaxListLimit are clamped.
+	Limit int
+	// Cursor is the opaque next_cursor value from a previous page.
+	Cursor string
+}
+
+// auditCursorSort tags cursors issued by Audit so they cannot be replayed
+// against List.
+const auditCursorSort = "audit"
+
+// Audit returns one page of events across all machines, oldest first, along
+// with the cursor for the next page. The returned cursor is empty when there
+// are no more results.
+func (d *DB) Audit(opts AuditOptions) ([]*models.MachineEvent, string, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+	if !opts.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, opts.Since.UTC().Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, opts.Until.UTC().Format(time.RFC3339))
+	}
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after, err := strconv.ParseInt(c.ID, 10, 64)
+		if c.Sort != auditCursorSort || err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		where = append(where, "id > ?")
+		args = append(args, after)
+	}
+
+	query := `SELECT ` + eventColumns + ` FROM machine_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, limit+1)
+
+	events, err := d.queryEvents(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	var next string
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[limit-1]
+		next = encodeCursor(cursor{Sort: auditCursorSort, ID: strconv.FormatInt(last.ID, 10)})
+	}
+	return events, next, nil
+}
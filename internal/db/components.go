@@ -0,0 +1,292 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+var (
+	// ErrComponentSerialInUse is returned when a component's serial number
+	// already belongs to another component.
+	ErrComponentSerialInUse = errors.New("component serial already in use")
+	// ErrSlotInUse is returned when the machine already has another
+	// component in the same slot.
+	ErrSlotInUse = errors.New("slot already in use")
+	// ErrMoveTargetNotFound is returned by MoveComponent when the machine a
+	// component is moving to does not exist or is in the trash.
+	ErrMoveTargetNotFound = errors.New("target machine not found")
+)
+
+// migrateComponents creates the components table. Serial numbers are unique
+// across the inventory and slots unique per machine, but both may be left
+// empty, so the unique indexes are partial.
+func migrateComponents(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS components (
+			id          TEXT PRIMARY KEY,
+			machine_id  TEXT NOT NULL REFERENCES machines(id) ON DELETE CASCADE,
+			type        TEXT NOT NULL,
+			make        TEXT NOT NULL DEFAULT '',
+			model       TEXT NOT NULL DEFAULT '',
+			serial      TEXT NOT NULL DEFAULT '',
+			capacity_gb INTEGER NOT NULL DEFAULT 0,
+			slot        TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL,
+			updated_at  DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_components_machine_id ON components(machine_id, type);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_components_serial ON components(serial) WHERE serial != '';
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_components_slot ON components(machine_id, slot) WHERE slot != '';
+	`)
+	return err
+}
+
+const componentColumns = `c.id, c.machine_id, c.type, c.make, c.model, c.serial, c.capacity_gb, c.slot, c.created_at, c.updated_at`
+
+// liveComponents selects components joined to their machine, excluding
+// machines in the trash. Callers append further conditions with AND.
+const liveComponents = `SELECT ` + componentColumns + ` FROM components c
+	JOIN machines m ON m.id = c.machine_id
+	WHERE m.deleted_at IS NULL`
+
+func scanComponent(row rowScanner) (*models.Component, error) {
+	var c models.Component
+	var createdAt, updatedAt string
+	if err := row.Scan(&c.ID, &c.MachineID, &c.Type, &c.Make, &c.Model, &c.Serial, &c.CapacityGB, &c.Slot, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	var err error
+	c.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
+	}
+	c.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse updated_at %q: %w", updatedAt, err)
+	}
+	return &c, nil
+}
+
+// ListComponents returns the components of the machine with the given ID,
+// ordered by type and slot. Returns sql.ErrNoRows if the machine does not
+// exist or is in the trash.
+func (d *DB) ListComponents(machineID string) ([]*models.Component, error) {
+	if _, err := getMachine(d.conn, machineID, false); err != nil {
+		return nil, err
+	}
+	rows, err := d.conn.Query(liveComponents+` AND c.machine_id = ? ORDER BY c.type, c.slot, c.id`, machineID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*models.Component{}
+	for rows.Next() {
+		c, err := scanComponent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// GetComponent returns one component of a machine, or sql.ErrNoRows if the
+// machine has no such component or is in the trash.
+func (d *DB) GetComponent(machineID, id string) (*models.Component, error) {
+	return getComponent(d.conn, machineID, id)
+}
+
+func getComponent(q querier, machineID, id string) (*models.Component, error) {
+	return scanComponent(q.QueryRow(liveComponents+` AND c.machine_id = ? AND c.id = ?`, machineID, id))
+}
+
+// checkComponentConflicts returns ErrComponentSerialInUse or ErrSlotInUse if
+// another component already has c's serial or, in the same machine, its slot.
+func checkComponentConflicts(q querier, c *models.Component) error {
+	var n int
+	if c.Serial != "" {
+		if err := q.QueryRow(`SELECT COUNT(*) FROM components WHERE serial = ? AND id != ?`, c.Serial, c.ID).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrComponentSerialInUse
+		}
+	}
+	if c.Slot != "" {
+		if err := q.QueryRow(`SELECT COUNT(*) FROM components WHERE machine_id = ? AND slot = ? AND id != ?`,
+			c.MachineID, c.Slot, c.ID).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrSlotInUse
+		}
+	}
+	return nil
+}
+
+// CreateComponent adds a component to the machine c.MachineID. If the
+// machine derives its capacity, the change is recorded as an update event
+// for actor. Returns sql.ErrNoRows if the machine does not exist or is in
+// the trash, and ErrComponentSerialInUse or ErrSlotInUse on a conflict.
+func (d *DB) CreateComponent(c *models.Component, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if _, err := getMachine(tx, c.MachineID, false); err != nil {
+			return err
+		}
+		if err := checkComponentConflicts(tx, c); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO components (id, machine_id, type, make, model, serial, capacity_gb, slot, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.ID, c.MachineID, c.Type, c.Make, c.Model, c.Serial, c.CapacityGB, c.Slot,
+			c.CreatedAt.UTC().Format(time.RFC3339),
+			c.UpdatedAt.UTC().Format(time.RFC3339),
+		)
+		if err != nil {
+			return err
+		}
+		return refreshCapacity(tx, c.MachineID, actor)
+	})
+}
+
+// UpdateComponent replaces every client-supplied field of an existing
+// component. It cannot change the machine; see MoveComponent. CreatedAt is
+// taken from the stored row and written back to c. Returns sql.ErrNoRows if
+// the component does not exist on a live machine, and
+// ErrComponentSerialInUse or ErrSlotInUse on a conflict.
+func (d *DB) UpdateComponent(c *models.Component, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		existing, err := getComponent(tx, c.MachineID, c.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkComponentConflicts(tx, c); err != nil {
+			return err
+		}
+		c.CreatedAt = existing.CreatedAt
+		_, err = tx.Exec(`
+			UPDATE components
+			SET type = ?, make = ?, model = ?, serial = ?, capacity_gb = ?, slot = ?, updated_at = ?
+			WHERE id = ?`,
+			c.Type, c.Make, c.Model, c.Serial, c.CapacityGB, c.Slot,
+			c.UpdatedAt.UTC().Format(time.RFC3339),
+			c.ID,
+		)
+		if err != nil {
+			return err
+		}
+		return refreshCapacity(tx, c.MachineID, actor)
+	})
+}
+
+// DeleteComponent removes a component from a machine. Returns sql.ErrNoRows
+// if the component does not exist on a live machine.
+func (d *DB) DeleteComponent(machineID, id, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if _, err := getComponent(tx, machineID, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM components WHERE id = ?`, id); err != nil {
+			return err
+		}
+		return refreshCapacity(tx, machineID, actor)
+	})
+}
+
+// MoveComponent moves the component c.ID from the machine fromID to the
+// machine c.MachineID, into c.Slot, and stamps it with c.UpdatedAt. The
+// other fields of c are filled in from the stored component. The move is
+// recorded as one component_move event on each machine, both holding the
+// component as it was before and after. Returns sql.ErrNoRows if fromID has
+// no such component, ErrMoveTargetNotFound if the target is not a live
+// machine, and ErrSlotInUse if the target slot is taken.
+func (d *DB) MoveComponent(fromID string, c *models.Component, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		before, err := getComponent(tx, fromID, c.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := getMachine(tx, c.MachineID, false); errors.Is(err, sql.ErrNoRows) {
+			return ErrMoveTargetNotFound
+		} else if err != nil {
+			return err
+		}
+		moved := *before
+		moved.MachineID, moved.Slot, moved.UpdatedAt = c.MachineID, c.Slot, c.UpdatedAt
+		*c = moved
+		if err := checkComponentConflicts(tx, c); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE components SET machine_id = ?, slot = ?, updated_at = ? WHERE id = ?`,
+			c.MachineID, c.Slot, c.UpdatedAt.UTC().Format(time.RFC3339), c.ID); err != nil {
+			return err
+		}
+		changes := map[string]models.FieldChange{"component": {Before: before, After: c}}
+		for _, id := range []string{fromID, c.MachineID} {
+			if err := insertEvent(tx, id, actor, models.OpComponentMove, changes); err != nil {
+				return err
+			}
+			if err := refreshCapacity(tx, id, actor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deriveCapacity sets m.RAMGB and m.StorageTB from m's DIMM and disk
+// components if m.DeriveCapacity is set, and does nothing otherwise.
+// Storage is summed in gigabytes and converted to decimal terabytes.
+func deriveCapacity(q querier, m *models.Machine) error {
+	if !m.DeriveCapacity {
+		return nil
+	}
+	var ramGB, diskGB int
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN type = ? THEN capacity_gb END), 0),
+		       COALESCE(SUM(CASE WHEN type = ? THEN capacity_gb END), 0)
+		FROM components WHERE machine_id = ?`,
+		models.ComponentDIMM, models.ComponentDisk, m.ID).Scan(&ramGB, &diskGB)
+	if err != nil {
+		return err
+	}
+	m.RAMGB = ramGB
+	m.StorageTB = float64(diskGB) / 1000
+	return nil
+}
+
+// refreshCapacity rewrites the derived capacity of the live machine with the
+// given ID after its components changed, recording an update event for actor
+// if the values moved. Machines that do not derive their capacity are left
+// alone. Only the capacity columns are written, so the machine's placement,
+// parent, and power are not checked again.
+func refreshCapacity(q querier, machineID, actor string) error {
+	before, err := getMachine(q, machineID, false)
+	if err != nil {
+		return err
+	}
+	m := *before
+	if err := deriveCapacity(q, &m); err != nil {
+		return err
+	}
+	if m.RAMGB == before.RAMGB && m.StorageTB == before.StorageTB {
+		return nil
+	}
+	m.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	err = q.QueryRow(`
+		UPDATE machines SET ram_gb = ?, storage_tb = ?, updated_at = ?, revision = revision + 1
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING revision`,
+		m.RAMGB, m.StorageTB, m.UpdatedAt.Format(time.RFC3339), m.ID,
+	).Scan(&m.Revision)
+	if err != nil {
+		return err
+	}
+	return recordEvent(q, actor, models.OpUpdate, before, &m)
+}
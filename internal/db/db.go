@@ -2,7 +2,11 @@ package db
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/tphummel/lab_gear/internal/models"
@@ -20,10 +24,17 @@ func New(path string) (*DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
+	// SQLite allows a single writer, and each connection to ":memory:" is a
+	// separate database, so serialize everything through one connection.
+	// This also makes read-modify-write transactions (see Modify) safe.
+	conn.SetMaxOpenConns(1)
 
 	if _, err := conn.Exec("PRAGMA journal_mode=WAL"); err != nil {
 		return nil, fmt.Errorf("enable WAL: %w", err)
 	}
+	if _, err := conn.Exec("PRAGMA foreign_keys=ON"); err != nil {
+		return nil, fmt.Errorf("enable foreign keys: %w", err)
+	}
 
 	if err := migrate(conn); err != nil {
 		return nil, fmt.Errorf("migrate: %w", err)
@@ -33,7 +44,7 @@ func New(path string) (*DB, error) {
 }
 
 func migrate(conn *sql.DB) error {
-	_, err := conn.Exec(`
+	if _, err := conn.Exec(`
 		CREATE TABLE IF NOT EXISTS machines (
 			id         TEXT PRIMARY KEY,
 			name       TEXT NOT NULL,
@@ -50,9 +61,177 @@ func migrate(conn *sql.DB) error {
 			updated_at DATETIME NOT NULL
 		);
 		CREATE INDEX IF NOT EXISTS idx_machines_kind ON machines(kind);
-		CREATE INDEX IF NOT EXISTS idx_machines_name ON machines(name);
-	`)
-	return err
+		-- idx_machines_name covered only (name), which left the id tie-breaker
+		-- of keyset pagination unindexed.
+		DROP INDEX IF EXISTS idx_machines_name;
+		CREATE INDEX IF NOT EXISTS idx_machines_name_id ON machines(name, id);
+		CREATE INDEX IF NOT EXISTS idx_machines_created_at ON machines(created_at, id);
+		CREATE INDEX IF NOT EXISTS idx_machines_updated_at ON machines(updated_at, id);
+		CREATE INDEX IF NOT EXISTS idx_machines_ram_gb ON machines(ram_gb, id);
+		CREATE INDEX IF NOT EXISTS idx_machines_storage_tb ON machines(storage_tb, id);
+	`); err != nil {
+		return err
+	}
+	if err := addColumns(conn, "machines", machineAddedColumns); err != nil {
+		return err
+	}
+	if _, err := conn.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_machines_deleted_at ON machines(deleted_at, id);
+		CREATE INDEX IF NOT EXISTS idx_machines_status ON machines(status, id);
+		CREATE INDEX IF NOT EXISTS idx_machines_parent_id ON machines(parent_id, name);
+		CREATE INDEX IF NOT EXISTS idx_machines_location_id ON machines(location_id, rack_u);
+		CREATE INDEX IF NOT EXISTS idx_machines_warranty_end ON machines(warranty_end) WHERE warranty_end IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_machines_ups_id ON machines(ups_id) WHERE ups_id IS NOT NULL;
+		UPDATE machines SET status_changed_at = created_at WHERE status_changed_at IS NULL;
+	`); err != nil {
+		return err
+	}
+	if err := migrateLocations(conn); err != nil {
+		return err
+	}
+	if err := migrateTags(conn); err != nil {
+		return err
+	}
+	if err := migrateInterfaces(conn); err != nil {
+		return err
+	}
+	if err := migrateComponents(conn); err != nil {
+		return err
+	}
+	if err := migrateAssets(conn); err != nil {
+		return err
+	}
+	if err := migrateGuests(conn); err != nil {
+		return err
+	}
+	if err := migrateMaintenance(conn); err != nil {
+		return err
+	}
+	if err := migrateTokens(conn); err != nil {
+		return err
+	}
+	if err := migrateAudit(conn); err != nil {
+		return err
+	}
+	return migrateSearch(conn)
+}
+
+// column is a column definition added to a table after its original
+// CREATE TABLE statement.
+type column struct {
+	name string
+	decl string
+}
+
+// machineAddedColumns are machines columns introduced after the first
+// release. Databases created before a column existed gain it on startup.
+var machineAddedColumns = []column{
+	{"revision", "INTEGER NOT NULL DEFAULT 1"},
+	{"deleted_at", "DATETIME"},
+	{"status", "TEXT NOT NULL DEFAULT 'active'"},
+	// Backfilled from created_at in migrate; ADD COLUMN cannot default to
+	// another column.
+	{"status_changed_at", "DATETIME"},
+	// Purging a machine detaches anything still in the trash that was
+	// placed in it; live machines cannot have a trashed parent.
+	{"parent_id", "TEXT REFERENCES machines(id) ON DELETE SET NULL"},
+	{"location_id", "TEXT REFERENCES locations(id)"},
+	{"rack_u", "INTEGER NOT NULL DEFAULT 0"},
+	{"u_height", "INTEGER NOT NULL DEFAULT 0"},
+	{"derive_capacity", "INTEGER NOT NULL DEFAULT 0"},
+	// The two dates are NULL when unknown so that range filters and the
+	// warranty report skip them.
+	{"purchase_date", "TEXT"},
+	{"vendor", "TEXT NOT NULL DEFAULT ''"},
+	{"price", "REAL NOT NULL DEFAULT 0"},
+	{"currency", "TEXT NOT NULL DEFAULT ''"},
+	{"warranty_end", "TEXT"},
+	{"lifetime_years", "INTEGER NOT NULL DEFAULT 0"},
+	{"rated_watts", "INTEGER NOT NULL DEFAULT 0"},
+	{"idle_watts", "INTEGER NOT NULL DEFAULT 0"},
+	{"peak_watts", "INTEGER NOT NULL DEFAULT 0"},
+	{"ups_id", "TEXT REFERENCES assets(id)"},
+	{"circuit", "TEXT NOT NULL DEFAULT ''"},
+	{"cpu_cores", "INTEGER NOT NULL DEFAULT 0"},
+	{"reserved_cores", "INTEGER NOT NULL DEFAULT 0"},
+	{"reserved_ram_gb", "INTEGER NOT NULL DEFAULT 0"},
+	{"reserved_storage_tb", "REAL NOT NULL DEFAULT 0"},
+}
+
+// addColumns adds any of cols that table does not already have. SQLite has
+// no ADD COLUMN IF NOT EXISTS, so the existing columns are read from
+// PRAGMA table_info first.
+func addColumns(conn *sql.DB, table string, cols []column) error {
+	rows, err := conn.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		have[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range cols {
+		if have[c.name] {
+			continue
+		}
+		if _, err := conn.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, c.name, c.decl)); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", table, c.name, err)
+		}
+	}
+	return nil
+}
+
+// migrateSearch creates the machines_fts full-text index and the triggers that
+// keep it in sync with the machines table. machines_fts is an external-content
+// FTS5 table, so it stores only the index and reads column values from
+// machines. When the index is first created on an existing database it is
+// rebuilt from the current rows.
+func migrateSearch(conn *sql.DB) error {
+	var exists int
+	if err := conn.QueryRow(
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'machines_fts'`,
+	).Scan(&exists); err != nil {
+		return err
+	}
+
+	if _, err := conn.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS machines_fts USING fts5(
+			name, make, model, cpu, serial, location, notes,
+			content='machines', content_rowid='rowid'
+		);
+		CREATE TRIGGER IF NOT EXISTS machines_fts_ai AFTER INSERT ON machines BEGIN
+			INSERT INTO machines_fts(rowid, name, make, model, cpu, serial, location, notes)
+			VALUES (new.rowid, new.name, new.make, new.model, new.cpu, new.serial, new.location, new.notes);
+		END;
+		CREATE TRIGGER IF NOT EXISTS machines_fts_ad AFTER DELETE ON machines BEGIN
+			INSERT INTO machines_fts(machines_fts, rowid, name, make, model, cpu, serial, location, notes)
+			VALUES ('delete', old.rowid, old.name, old.make, old.model, old.cpu, old.serial, old.location, old.notes);
+		END;
+		CREATE TRIGGER IF NOT EXISTS machines_fts_au AFTER UPDATE ON machines BEGIN
+			INSERT INTO machines_fts(machines_fts, rowid, name, make, model, cpu, serial, location, notes)
+			VALUES ('delete', old.rowid, old.name, old.make, old.model, old.cpu, old.serial, old.location, old.notes);
+			INSERT INTO machines_fts(rowid, name, make, model, cpu, serial, location, notes)
+			VALUES (new.rowid, new.name, new.make, new.model, new.cpu, new.serial, new.location, new.notes);
+		END;
+	`); err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		_, err := conn.Exec(`INSERT INTO machines_fts(machines_fts) VALUES ('rebuild')`)
+		return err
+	}
+	return nil
 }
 
 // Close closes the underlying database connection.
@@ -65,135 +244,467 @@ func (d *DB) Ping() error {
 	return d.conn.Ping()
 }
 
-// Create inserts a new machine record.
-func (d *DB) Create(m *models.Machine) error {
-	_, err := d.conn.Exec(`
-		INSERT INTO machines (id, name, kind, make, model, cpu, ram_gb, storage_tb, location, serial, notes, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		m.ID, m.Name, m.Kind, m.Make, m.Model, m.CPU, m.RAMGB, m.StorageTB,
-		m.Location, m.Serial, m.Notes,
-		m.CreatedAt.UTC().Format(time.RFC3339),
-		m.UpdatedAt.UTC().Format(time.RFC3339),
-	)
-	return err
+// ErrRevisionMismatch is returned by Update and Delete when the caller's
+// expected revision no longer matches the stored row.
+var ErrRevisionMismatch = errors.New("revision mismatch")
+
+// inTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise.
+func (d *DB) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Create inserts a new machine record and records a create event for actor.
+// New machines start at revision 1, which is written back to m.Revision.
+// Returns ErrParentNotFound if m.ParentID does not name a live machine, one
+// of the location errors if m cannot be placed where it says (see
+// checkPlacement), and ErrUPSNotFound or ErrUPSOverCapacity if its UPS is
+// missing or cannot carry it (see checkPower). If m.DeriveCapacity is set
+// its RAMGB and StorageTB are replaced with the derived values, which are
+// zero for a new machine.
+func (d *DB) Create(m *models.Machine, actor string) error {
+	m.Revision = 1
+	return d.inTx(func(tx *sql.Tx) error {
+		if err := checkParent(tx, m); err != nil {
+			return err
+		}
+		if err := checkPlacement(tx, m); err != nil {
+			return err
+		}
+		if err := checkPower(tx, m); err != nil {
+			return err
+		}
+		if err := deriveCapacity(tx, m); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO machines (id, name, kind, make, model, cpu, cpu_cores, ram_gb, storage_tb, location, serial, notes, parent_id,
+			                      location_id, rack_u, u_height, derive_capacity, purchase_date, vendor, price, currency,
+			                      warranty_end, lifetime_years, rated_watts, idle_watts, peak_watts, ups_id, circuit,
+			                      reserved_cores, reserved_ram_gb, reserved_storage_tb,
+			                      status, status_changed_at, created_at, updated_at, revision)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.ID, m.Name, m.Kind, m.Make, m.Model, m.CPU, m.CPUCores, m.RAMGB, m.StorageTB,
+			m.Location, m.Serial, m.Notes, nullString(m.ParentID),
+			nullString(m.LocationID), m.RackU, m.UHeight, m.DeriveCapacity,
+			nullString(m.PurchaseDate), m.Vendor, m.Price, m.Currency,
+			nullString(m.WarrantyEnd), m.LifetimeYears,
+			m.RatedWatts, m.IdleWatts, m.PeakWatts, nullString(m.UPSID), m.Circuit,
+			m.ReservedCores, m.ReservedRAMGB, m.ReservedStorageTB,
+			m.Status, m.StatusChangedAt.UTC().Format(time.RFC3339),
+			m.CreatedAt.UTC().Format(time.RFC3339),
+			m.UpdatedAt.UTC().Format(time.RFC3339),
+			m.Revision,
+		)
+		if err != nil {
+			return err
+		}
+		if err := writeTagsLabels(tx, m); err != nil {
+			return err
+		}
+		return recordEvent(tx, actor, models.OpCreate, nil, m)
+	})
 }
 
-// GetByID returns the machine with the given ID, or sql.ErrNoRows if not found.
+// GetByID returns the machine with the given ID, or sql.ErrNoRows if not
+// found or in the trash.
 func (d *DB) GetByID(id string) (*models.Machine, error) {
-	row := d.conn.QueryRow(`
-		SELECT id, name, kind, make, model, cpu, ram_gb, storage_tb, location, serial, notes, created_at, updated_at
-		FROM machines WHERE id = ?`, id)
-	return scanRow(row)
-}
-
-// List returns all machines, optionally filtered by kind.
-func (d *DB) List(kind string) ([]*models.Machine, error) {
-	var (
-		rows *sql.Rows
-		err  error
-	)
-	if kind != "" {
-		rows, err = d.conn.Query(`
-			SELECT id, name, kind, make, model, cpu, ram_gb, storage_tb, location, serial, notes, created_at, updated_at
-			FROM machines WHERE kind = ?`, kind)
-	} else {
-		rows, err = d.conn.Query(`
-			SELECT id, name, kind, make, model, cpu, ram_gb, storage_tb, location, serial, notes, created_at, updated_at
-			FROM machines`)
+	return getMachine(d.conn, id, false)
+}
+
+// getMachine returns the machine with the given ID if it is live, or if it
+// is in the trash when trashed is true. Otherwise it returns sql.ErrNoRows.
+func getMachine(q querier, id string, trashed bool) (*models.Machine, error) {
+	cond := "deleted_at IS NULL"
+	if trashed {
+		cond = "deleted_at IS NOT NULL"
 	}
+	m, err := scanMachine(q.QueryRow(`SELECT `+machineColumns+` FROM machines WHERE id = ? AND `+cond, id))
 	if err != nil {
 		return nil, err
 	}
+	return m, loadTagsLabels(q, m)
+}
+
+const (
+	// DefaultListLimit is the page size used when ListOptions.Limit is unset.
+	DefaultListLimit = 100
+	// MaxListLimit is the largest page size List will return.
+	MaxListLimit = 1000
+)
+
+var (
+	// ErrInvalidSort is returned by List for an unsupported sort key.
+	ErrInvalidSort = errors.New("invalid sort")
+	// ErrInvalidCursor is returned by List when the cursor cannot be decoded
+	// or was issued for a different sort order.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// sortColumns maps the sort keys accepted by List to their column names. Each
+// column has a (column, id) index so keyset pagination stays indexed.
+var sortColumns = map[string]string{
+	"name":       "name",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"ram_gb":     "ram_gb",
+	"storage_tb": "storage_tb",
+	"deleted_at": "deleted_at",
+}
+
+// ListOptions controls filtering, ordering, and pagination for List.
+type ListOptions struct {
+	// Filters are ANDed together to restrict the results.
+	Filters []Filter
+	// Sort is a key from sortColumns, optionally prefixed with "-" for
+	// descending order. Defaults to "created_at".
+	Sort string
+	// Limit is the maximum number of machines to return. Zero means
+	// DefaultListLimit; values above MaxListLimit are clamped.
+	Limit int
+	// Cursor is the opaque next_cursor value from a previous page.
+	Cursor string
+	// Trashed lists machines in the trash instead of live machines. The
+	// deleted_at sort key is only valid for the trash.
+	Trashed bool
+}
+
+// cursor is the decoded form of the opaque pagination token. It records the
+// sort order it was issued for plus the sort value and ID of the last row on
+// the page, which together form the keyset for the next query.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value any    `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// sortValue returns the value of m's sort column in the form it is stored in
+// SQLite, so it can be compared against the column in a keyset predicate.
+func sortValue(m *models.Machine, column string) any {
+	switch column {
+	case "name":
+		return m.Name
+	case "created_at":
+		return m.CreatedAt.UTC().Format(time.RFC3339)
+	case "updated_at":
+		return m.UpdatedAt.UTC().Format(time.RFC3339)
+	case "ram_gb":
+		return m.RAMGB
+	case "storage_tb":
+		return m.StorageTB
+	case "deleted_at":
+		return m.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+// List returns one page of machines matching opts along with the cursor for
+// the next page. The returned cursor is empty when there are no more results.
+// Rows are ordered by the sort column with id as a tie-breaker, so paging is
+// stable even when many machines share a sort value.
+func (d *DB) List(opts ListOptions) ([]*models.Machine, string, error) {
+	sortKey := opts.Sort
+	if sortKey == "" {
+		sortKey = "created_at"
+	}
+	desc := strings.HasPrefix(sortKey, "-")
+	column, ok := sortColumns[strings.TrimPrefix(sortKey, "-")]
+	if !ok || (column == "deleted_at" && !opts.Trashed) {
+		return nil, "", fmt.Errorf("%w %q", ErrInvalidSort, sortKey)
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	where := []string{"deleted_at IS NULL"}
+	if opts.Trashed {
+		where[0] = "deleted_at IS NOT NULL"
+	}
+	var args []any
+	for _, f := range opts.Filters {
+		clause, vals := f.sql()
+		where = append(where, clause)
+		args = append(args, vals...)
+	}
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if c.Sort != sortKey {
+			return nil, "", ErrInvalidCursor
+		}
+		cmp := ">"
+		if desc {
+			cmp = "<"
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (?, ?)", column, cmp))
+		args = append(args, c.Value, c.ID)
+	}
+
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	query := `SELECT ` + machineColumns + ` FROM machines WHERE ` + strings.Join(where, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ?", column, dir, dir)
+	// Fetch one extra row to learn whether another page exists.
+	args = append(args, limit+1)
+
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
 	defer rows.Close()
 
 	var machines []*models.Machine
 	for rows.Next() {
-		m, err := scanRows(rows)
+		m, err := scanMachine(rows)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		machines = append(machines, m)
 	}
-	return machines, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(machines) > limit {
+		machines = machines[:limit]
+		last := machines[limit-1]
+		next = encodeCursor(cursor{Sort: sortKey, Value: sortValue(last, column), ID: last.ID})
+	}
+	if err := loadTagsLabels(d.conn, machines...); err != nil {
+		return nil, "", err
+	}
+	return machines, next, nil
 }
 
-// Update replaces all mutable fields for the machine with m.ID.
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Update replaces all mutable fields for the machine with m.ID, bumps its
+// revision, and records an update event for actor. If m.Revision is non-zero
+// the write only happens when it matches the stored revision, otherwise
+// ErrRevisionMismatch is returned. On success m.Revision holds the new
+// revision. ParentID, the location fields, the UPS, and DeriveCapacity are
+// handled as for Create, and ErrParentCycle is returned if the parent would
+// place the machine inside itself.
 // Returns sql.ErrNoRows if no such machine exists.
-func (d *DB) Update(m *models.Machine) error {
-	res, err := d.conn.Exec(`
-		UPDATE machines
-		SET name=?, kind=?, make=?, model=?, cpu=?, ram_gb=?, storage_tb=?, location=?, serial=?, notes=?, updated_at=?
-		WHERE id=?`,
-		m.Name, m.Kind, m.Make, m.Model, m.CPU, m.RAMGB, m.StorageTB,
-		m.Location, m.Serial, m.Notes,
-		m.UpdatedAt.UTC().Format(time.RFC3339),
-		m.ID,
-	)
-	if err != nil {
+func (d *DB) Update(m *models.Machine, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		before, err := getMachine(tx, m.ID, false)
+		if err != nil {
+			return err
+		}
+		if err := updateMachine(tx, m); err != nil {
+			return err
+		}
+		return recordEvent(tx, actor, models.OpUpdate, before, m)
+	})
+}
+
+func updateMachine(q querier, m *models.Machine) error {
+	if err := checkParent(q, m); err != nil {
 		return err
 	}
-	n, err := res.RowsAffected()
-	if err != nil {
+	if err := checkPlacement(q, m); err != nil {
 		return err
 	}
-	if n == 0 {
-		return sql.ErrNoRows
+	if err := checkPower(q, m); err != nil {
+		return err
 	}
-	return nil
-}
-
-// Delete removes the machine with the given ID.
-// Returns sql.ErrNoRows if no such machine exists.
-func (d *DB) Delete(id string) error {
-	res, err := d.conn.Exec(`DELETE FROM machines WHERE id = ?`, id)
-	if err != nil {
+	if err := deriveCapacity(q, m); err != nil {
 		return err
 	}
-	n, err := res.RowsAffected()
+	err := q.QueryRow(`
+		UPDATE machines
+		SET name=?, kind=?, make=?, model=?, cpu=?, cpu_cores=?, ram_gb=?, storage_tb=?, location=?, serial=?, notes=?,
+		    parent_id=?, location_id=?, rack_u=?, u_height=?, derive_capacity=?,
+		    purchase_date=?, vendor=?, price=?, currency=?, warranty_end=?, lifetime_years=?,
+		    rated_watts=?, idle_watts=?, peak_watts=?, ups_id=?, circuit=?,
+		    reserved_cores=?, reserved_ram_gb=?, reserved_storage_tb=?,
+		    status=?, status_changed_at=?, updated_at=?, revision = revision + 1
+		WHERE id=? AND deleted_at IS NULL AND (? = 0 OR revision = ?)
+		RETURNING revision`,
+		m.Name, m.Kind, m.Make, m.Model, m.CPU, m.CPUCores, m.RAMGB, m.StorageTB,
+		m.Location, m.Serial, m.Notes, nullString(m.ParentID),
+		nullString(m.LocationID), m.RackU, m.UHeight, m.DeriveCapacity,
+		nullString(m.PurchaseDate), m.Vendor, m.Price, m.Currency,
+		nullString(m.WarrantyEnd), m.LifetimeYears,
+		m.RatedWatts, m.IdleWatts, m.PeakWatts, nullString(m.UPSID), m.Circuit,
+		m.ReservedCores, m.ReservedRAMGB, m.ReservedStorageTB,
+		m.Status, m.StatusChangedAt.UTC().Format(time.RFC3339),
+		m.UpdatedAt.UTC().Format(time.RFC3339),
+		m.ID, m.Revision, m.Revision,
+	).Scan(&m.Revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return missingOrStale(q, m.ID)
+	}
 	if err != nil {
 		return err
 	}
-	if n == 0 {
-		return sql.ErrNoRows
-	}
-	return nil
+	return writeTagsLabels(q, m)
 }
 
-func scanRow(row *sql.Row) (*models.Machine, error) {
-	var m models.Machine
-	var createdAt, updatedAt string
-	if err := row.Scan(
-		&m.ID, &m.Name, &m.Kind, &m.Make, &m.Model,
-		&m.CPU, &m.RAMGB, &m.StorageTB,
-		&m.Location, &m.Serial, &m.Notes,
-		&createdAt, &updatedAt,
-	); err != nil {
-		return nil, err
-	}
-	var err error
-	m.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+// missingOrStale explains why a conditional write to id matched no rows:
+// sql.ErrNoRows if the machine does not exist or is in the trash,
+// ErrRevisionMismatch if it is live but has moved on to another revision.
+func missingOrStale(q querier, id string) error {
+	var rev int64
+	err := q.QueryRow(`SELECT revision FROM machines WHERE id = ? AND deleted_at IS NULL`, id).Scan(&rev)
 	if err != nil {
-		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
+		return err
 	}
-	m.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+	return ErrRevisionMismatch
+}
+
+// Modify reads the machine with the given ID, passes it to fn, and writes
+// back whatever fn leaves in it, all within one transaction so concurrent
+// writers cannot interleave. The write is recorded as an update event for
+// actor. If fn returns an error nothing is written and the error is returned
+// unchanged. Returns sql.ErrNoRows if no such machine exists.
+func (d *DB) Modify(id, actor string, fn func(m *models.Machine) error) (*models.Machine, error) {
+	var m *models.Machine
+	err := d.inTx(func(tx *sql.Tx) error {
+		before, err := getMachine(tx, id, false)
+		if err != nil {
+			return err
+		}
+		next := *before
+		m = &next
+		if err := fn(m); err != nil {
+			return err
+		}
+		// The ID is the row key; fn must not be able to redirect the write.
+		// The revision is pinned to the one read above, which the
+		// transaction holds.
+		m.ID = id
+		m.Revision = before.Revision
+		if err := updateMachine(tx, m); err != nil {
+			return err
+		}
+		return recordEvent(tx, actor, models.OpUpdate, before, m)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("parse updated_at %q: %w", updatedAt, err)
+		return nil, err
 	}
-	return &m, nil
+	return m, nil
+}
+
+// Delete moves the machine with the given ID to the trash and records a
+// delete event for actor. Trashed machines are hidden from GetByID, List, and
+// Search until they are restored or purged. If revision is non-zero the
+// machine is only deleted when it is still at that revision, otherwise
+// ErrRevisionMismatch is returned. A machine that live machines are placed
+// in cannot be deleted and returns ErrHasChildren. A machine that guests run
+// on returns ErrHasGuests unless force is set. The guests themselves are not
+// changed or recorded: they are hidden while their host is in the trash only
+// because guest reads join on a live host, and reappear if it is restored.
+// Returns sql.ErrNoRows if no such machine exists.
+func (d *DB) Delete(id string, revision int64, force bool, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		before, err := getMachine(tx, id, false)
+		if err != nil {
+			return err
+		}
+		if revision != 0 && before.Revision != revision {
+			return ErrRevisionMismatch
+		}
+		if err := checkNoChildren(tx, id); err != nil {
+			return err
+		}
+		if !force {
+			if err := checkNoGuests(tx, id); err != nil {
+				return err
+			}
+		}
+		after := *before
+		now := time.Now().UTC().Truncate(time.Second)
+		after.DeletedAt = &now
+		after.Revision++
+		if _, err := tx.Exec(`UPDATE machines SET deleted_at = ?, revision = ? WHERE id = ?`,
+			now.Format(time.RFC3339), after.Revision, id); err != nil {
+			return err
+		}
+		return recordEvent(tx, actor, models.OpDelete, before, &after)
+	})
+}
+
+// machineColumns is the column list shared by every machine SELECT, in the
+// order expected by scanMachine.
+const machineColumns = `id, name, kind, make, model, cpu, cpu_cores, ram_gb, storage_tb, location, serial, notes, parent_id, location_id, rack_u, u_height, derive_capacity, purchase_date, vendor, price, currency, warranty_end, lifetime_years, rated_watts, idle_watts, peak_watts, ups_id, circuit, reserved_cores, reserved_ram_gb, reserved_storage_tb, status, status_changed_at, created_at, updated_at, revision, deleted_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-func scanRows(rows *sql.Rows) (*models.Machine, error) {
+// scanMachine scans the machineColumns of row into a Machine. Any extra
+// destinations receive columns selected after machineColumns.
+func scanMachine(row rowScanner, extra ...any) (*models.Machine, error) {
 	var m models.Machine
-	var createdAt, updatedAt string
-	if err := rows.Scan(
+	var statusChangedAt, createdAt, updatedAt string
+	var parentID, locationID, purchaseDate, warrantyEnd, upsID, deletedAt sql.NullString
+	dest := []any{
 		&m.ID, &m.Name, &m.Kind, &m.Make, &m.Model,
-		&m.CPU, &m.RAMGB, &m.StorageTB,
-		&m.Location, &m.Serial, &m.Notes,
-		&createdAt, &updatedAt,
-	); err != nil {
+		&m.CPU, &m.CPUCores, &m.RAMGB, &m.StorageTB,
+		&m.Location, &m.Serial, &m.Notes, &parentID,
+		&locationID, &m.RackU, &m.UHeight, &m.DeriveCapacity,
+		&purchaseDate, &m.Vendor, &m.Price, &m.Currency, &warrantyEnd, &m.LifetimeYears,
+		&m.RatedWatts, &m.IdleWatts, &m.PeakWatts, &upsID, &m.Circuit,
+		&m.ReservedCores, &m.ReservedRAMGB, &m.ReservedStorageTB,
+		&m.Status, &statusChangedAt,
+		&createdAt, &updatedAt, &m.Revision, &deletedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
+	m.ParentID = parentID.String
+	m.LocationID = locationID.String
+	m.PurchaseDate = purchaseDate.String
+	m.WarrantyEnd = warrantyEnd.String
+	m.UPSID = upsID.String
 	var err error
+	m.StatusChangedAt, err = time.Parse(time.RFC3339, statusChangedAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse status_changed_at %q: %w", statusChangedAt, err)
+	}
 	m.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
 	if err != nil {
 		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
@@ -202,5 +713,12 @@ func scanRows(rows *sql.Rows) (*models.Machine, error) {
 	if err != nil {
 		return nil, fmt.Errorf("parse updated_at %q: %w", updatedAt, err)
 	}
+	if deletedAt.Valid {
+		t, err := time.Parse(time.RFC3339, deletedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("parse deleted_at %q: %w", deletedAt.String, err)
+		}
+		m.DeletedAt = &t
+	}
 	return &m, nil
 }
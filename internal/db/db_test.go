@@ -2,6 +2,12 @@ package db_test
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,6 +15,9 @@ import (
 	"github.com/tphummel/lab_gear/internal/models"
 )
 
+// testActor is the identity recorded on events written by these tests.
+const testActor = "test"
+
 // newTestDB opens a fresh in-memory SQLite database for each test.
 func newTestDB(t *testing.T) *db.DB {
 	t.Helper()
@@ -24,19 +33,21 @@ func newTestDB(t *testing.T) *db.DB {
 func sampleMachine(id string) *models.Machine {
 	now := time.Now().UTC().Truncate(time.Second)
 	return &models.Machine{
-		ID:        id,
-		Name:      "pve2",
-		Kind:      "proxmox",
-		Make:      "Dell",
-		Model:     "OptiPlex 7050",
-		CPU:       "i7-7700",
-		RAMGB:     32,
-		StorageTB: 1.0,
-		Location:  "office rack",
-		Serial:    "SN-001",
-		Notes:     "primary hypervisor",
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:              id,
+		Name:            "pve2",
+		Kind:            "proxmox",
+		Make:            "Dell",
+		Model:           "OptiPlex 7050",
+		CPU:             "i7-7700",
+		RAMGB:           32,
+		StorageTB:       1.0,
+		Location:        "office rack",
+		Serial:          "SN-001",
+		Notes:           "primary hypervisor",
+		Status:          models.StatusActive,
+		StatusChangedAt: now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
 	}
 }
 
@@ -52,7 +63,7 @@ func TestCreate_GetByID(t *testing.T) {
 	d := newTestDB(t)
 	m := sampleMachine("abc-123")
 
-	if err := d.Create(m); err != nil {
+	if err := d.Create(m, testActor); err != nil {
 		t.Fatalf("Create: %v", err)
 	}
 
@@ -115,7 +126,7 @@ func TestCreate_OptionalFieldsDefault(t *testing.T) {
 		UpdatedAt: now,
 	}
 
-	if err := d.Create(m); err != nil {
+	if err := d.Create(m, testActor); err != nil {
 		t.Fatalf("Create: %v", err)
 	}
 
@@ -144,7 +155,7 @@ func TestGetByID_NotFound(t *testing.T) {
 
 func TestList_Empty(t *testing.T) {
 	d := newTestDB(t)
-	machines, err := d.List("")
+	machines, _, err := d.List(db.ListOptions{})
 	if err != nil {
 		t.Fatalf("List: %v", err)
 	}
@@ -165,12 +176,12 @@ func TestList_All(t *testing.T) {
 	m2.Kind = "nas"
 
 	for _, m := range []*models.Machine{m1, m2} {
-		if err := d.Create(m); err != nil {
+		if err := d.Create(m, testActor); err != nil {
 			t.Fatalf("Create %q: %v", m.ID, err)
 		}
 	}
 
-	machines, err := d.List("")
+	machines, _, err := d.List(db.ListOptions{})
 	if err != nil {
 		t.Fatalf("List: %v", err)
 	}
@@ -194,7 +205,7 @@ func TestList_KindFilter(t *testing.T) {
 	for _, k := range kinds {
 		m := sampleMachine(k.id)
 		m.Kind = k.kind
-		if err := d.Create(m); err != nil {
+		if err := d.Create(m, testActor); err != nil {
 			t.Fatalf("Create %q: %v", k.id, err)
 		}
 	}
@@ -210,7 +221,11 @@ func TestList_KindFilter(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.kind, func(t *testing.T) {
-			got, err := d.List(tt.kind)
+			f, err := db.ParseFilter("kind", tt.kind)
+			if err != nil {
+				t.Fatalf("ParseFilter: %v", err)
+			}
+			got, _, err := d.List(db.ListOptions{Filters: []db.Filter{f}})
 			if err != nil {
 				t.Fatalf("List(%q): %v", tt.kind, err)
 			}
@@ -221,10 +236,523 @@ func TestList_KindFilter(t *testing.T) {
 	}
 }
 
+func TestList_Pagination(t *testing.T) {
+	d := newTestDB(t)
+
+	base := time.Now().UTC().Truncate(time.Second)
+	for i := range 5 {
+		m := sampleMachine(fmt.Sprintf("id-%d", i))
+		m.Name = fmt.Sprintf("node%d", i)
+		// Two machines share each timestamp so the id tie-breaker is exercised.
+		m.CreatedAt = base.Add(time.Duration(i/2) * time.Minute)
+		if err := d.Create(m, testActor); err != nil {
+			t.Fatalf("Create %q: %v", m.ID, err)
+		}
+	}
+
+	var (
+		seen   []string
+		cursor string
+		pages  int
+	)
+	for {
+		page, next, err := d.List(db.ListOptions{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("List page %d: %v", pages, err)
+		}
+		pages++
+		for _, m := range page {
+			seen = append(seen, m.ID)
+		}
+		if next == "" {
+			break
+		}
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		cursor = next
+	}
+
+	want := []string{"id-0", "id-1", "id-2", "id-3", "id-4"}
+	if pages != 3 {
+		t.Errorf("pages: got %d, want 3", pages)
+	}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("order: got %v, want %v", seen, want)
+	}
+}
+
+func TestList_Sort(t *testing.T) {
+	d := newTestDB(t)
+
+	machines := []struct {
+		id   string
+		name string
+		ram  int
+	}{
+		{"id-1", "bravo", 16},
+		{"id-2", "alpha", 64},
+		{"id-3", "charlie", 32},
+	}
+	for _, mm := range machines {
+		m := sampleMachine(mm.id)
+		m.Name = mm.name
+		m.RAMGB = mm.ram
+		if err := d.Create(m, testActor); err != nil {
+			t.Fatalf("Create %q: %v", mm.id, err)
+		}
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"name", []string{"alpha", "bravo", "charlie"}},
+		{"-name", []string{"charlie", "bravo", "alpha"}},
+		{"ram_gb", []string{"bravo", "charlie", "alpha"}},
+		{"-ram_gb", []string{"alpha", "charlie", "bravo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			// A page size of 1 forces the cursor through every row.
+			var got []string
+			cursor := ""
+			for {
+				page, next, err := d.List(db.ListOptions{Sort: tt.sort, Limit: 1, Cursor: cursor})
+				if err != nil {
+					t.Fatalf("List(%q): %v", tt.sort, err)
+				}
+				for _, m := range page {
+					got = append(got, m.Name)
+				}
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("sort %q: got %v, want %v", tt.sort, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_InvalidSort(t *testing.T) {
+	d := newTestDB(t)
+	_, _, err := d.List(db.ListOptions{Sort: "serial"})
+	if !errors.Is(err, db.ErrInvalidSort) {
+		t.Errorf("expected ErrInvalidSort, got %v", err)
+	}
+}
+
+func TestList_InvalidCursor(t *testing.T) {
+	d := newTestDB(t)
+	for i := range 2 {
+		if err := d.Create(sampleMachine(fmt.Sprintf("id-%d", i)), testActor); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	_, _, err := d.List(db.ListOptions{Cursor: "not-a-cursor"})
+	if !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("garbage cursor: expected ErrInvalidCursor, got %v", err)
+	}
+
+	// A cursor issued for one sort order must not be reused with another.
+	_, next, err := d.List(db.ListOptions{Sort: "name", Limit: 1})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	_, _, err = d.List(db.ListOptions{Sort: "-ram_gb", Limit: 1, Cursor: next})
+	if !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("mismatched sort: expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestList_Filters(t *testing.T) {
+	d := newTestDB(t)
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	seed := []struct {
+		id       string
+		kind     string
+		make     string
+		ram      int
+		storage  float64
+		location string
+		created  time.Time
+	}{
+		{"pve1", "proxmox", "Dell", 32, 1.0, "office rack", base},
+		{"pve2", "proxmox", "HP", 128, 4.0, "office rack", base.AddDate(0, 1, 0)},
+		{"pve3", "proxmox", "Lenovo", 16, 0.5, "closet", base.AddDate(0, 2, 0)},
+		{"nas1", "nas", "Synology", 8, 40.0, "Office shelf", base.AddDate(0, 3, 0)},
+		{"pi_1", "sbc", "Raspberry Pi", 8, 0.1, "office_50%", base.AddDate(0, 4, 0)},
+	}
+	for _, s := range seed {
+		m := sampleMachine(s.id)
+		m.Name = s.id
+		m.Kind = s.kind
+		m.Make = s.make
+		m.RAMGB = s.ram
+		m.StorageTB = s.storage
+		m.Location = s.location
+		m.CreatedAt = s.created
+		m.UpdatedAt = s.created
+		if err := d.Create(m, testActor); err != nil {
+			t.Fatalf("Create %q: %v", s.id, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		params [][2]string
+		want   []string
+	}{
+		{"equality", [][2]string{{"kind", "proxmox"}}, []string{"pve1", "pve2", "pve3"}},
+		{"not equal", [][2]string{{"kind[ne]", "proxmox"}}, []string{"nas1", "pi_1"}},
+		{"int gte", [][2]string{{"ram_gb[gte]", "32"}}, []string{"pve1", "pve2"}},
+		// Symbolic spellings, split at the first '=' as a query string would be.
+		{"symbol >=", [][2]string{{"ram_gb>", "32"}}, []string{"pve1", "pve2"}},
+		{"symbol <=", [][2]string{{"storage_tb<", "1"}}, []string{"pve1", "pve3", "pi_1"}},
+		{"symbol !=", [][2]string{{"kind!", "proxmox"}}, []string{"nas1", "pi_1"}},
+		{"symbol >", [][2]string{{"ram_gb>32", ""}}, []string{"pve2"}},
+		{"symbol <", [][2]string{{"storage_tb<2", ""}}, []string{"pve1", "pve3", "pi_1"}},
+		{"float lt", [][2]string{{"storage_tb[lt]", "2"}}, []string{"pve1", "pve3", "pi_1"}},
+		{"prefix is case-insensitive", [][2]string{{"location[prefix]", "office"}}, []string{"pve1", "pve2", "nas1", "pi_1"}},
+		{"prefix escapes wildcards", [][2]string{{"location[prefix]", "office_5"}}, []string{"pi_1"}},
+		{"in list", [][2]string{{"make[in]", "Dell, Lenovo"}}, []string{"pve1", "pve3"}},
+		{"date range", [][2]string{{"created_at[gte]", "2025-02-01"}, {"created_at[lte]", "2025-04-01T00:00:00Z"}}, []string{"pve2", "pve3", "nas1"}},
+		{
+			"combined",
+			[][2]string{{"kind", "proxmox"}, {"location[prefix]", "office rack"}, {"ram_gb[lt]", "64"}},
+			[]string{"pve1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filters []db.Filter
+			for _, p := range tt.params {
+				f, err := db.ParseFilter(p[0], p[1])
+				if err != nil {
+					t.Fatalf("ParseFilter(%q, %q): %v", p[0], p[1], err)
+				}
+				filters = append(filters, f)
+			}
+			got, _, err := d.List(db.ListOptions{Filters: filters})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var ids []string
+			for _, m := range got {
+				ids = append(ids, m.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagsLabels(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("tl-1")
+	m.Tags = []string{"nvme", "10gbe", "nvme"}
+	m.Labels = map[string]string{"env": "prod", "owner": "tom"}
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := d.GetByID("tl-1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if want := []string{"10gbe", "nvme"}; !reflect.DeepEqual(got.Tags, want) {
+		t.Errorf("Tags: got %v, want %v", got.Tags, want)
+	}
+	if !reflect.DeepEqual(got.Labels, m.Labels) {
+		t.Errorf("Labels: got %v, want %v", got.Labels, m.Labels)
+	}
+
+	got.Tags = []string{"gpu-passthrough"}
+	got.Labels = nil
+	if err := d.Update(got, testActor); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err = d.GetByID("tl-1")
+	if err != nil {
+		t.Fatalf("GetByID after update: %v", err)
+	}
+	if want := []string{"gpu-passthrough"}; !reflect.DeepEqual(got.Tags, want) {
+		t.Errorf("Tags after update: got %v, want %v", got.Tags, want)
+	}
+	if got.Labels == nil || len(got.Labels) != 0 {
+		t.Errorf("Labels after update: got %#v, want empty map", got.Labels)
+	}
+
+	bare := sampleMachine("tl-2")
+	if err := d.Create(bare, testActor); err != nil {
+		t.Fatalf("Create bare: %v", err)
+	}
+	got, err = d.GetByID("tl-2")
+	if err != nil {
+		t.Fatalf("GetByID bare: %v", err)
+	}
+	if got.Tags == nil || got.Labels == nil {
+		t.Errorf("bare machine: got Tags %#v, Labels %#v; want empty, not nil", got.Tags, got.Labels)
+	}
+}
+
+func TestList_TagLabelFilters(t *testing.T) {
+	d := newTestDB(t)
+	seed := []struct {
+		id     string
+		tags   []string
+		labels map[string]string
+	}{
+		{"a", []string{"gpu", "nvme"}, map[string]string{"env": "prod"}},
+		{"b", []string{"nvme"}, map[string]string{"env": "dev"}},
+		{"c", []string{"10gbe"}, nil},
+		{"d", nil, map[string]string{"owner": "tom"}},
+	}
+	for _, s := range seed {
+		m := sampleMachine(s.id)
+		m.Tags = s.tags
+		m.Labels = s.labels
+		if err := d.Create(m, testActor); err != nil {
+			t.Fatalf("Create %q: %v", s.id, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		params [][2]string
+		want   []string
+	}{
+		{"tag", [][2]string{{"tag", "nvme"}}, []string{"a", "b"}},
+		{"tag in", [][2]string{{"tag[in]", "gpu, 10gbe"}}, []string{"a", "c"}},
+		{"label value", [][2]string{{"label", "env=prod"}}, []string{"a"}},
+		{"label exists", [][2]string{{"label", "env"}}, []string{"a", "b"}},
+		{"label empty value", [][2]string{{"label", "owner="}}, nil},
+		{"tags are ANDed", [][2]string{{"tag", "nvme"}, {"tag", "gpu"}}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filters []db.Filter
+			for _, p := range tt.params {
+				f, err := db.ParseFilter(p[0], p[1])
+				if err != nil {
+					t.Fatalf("ParseFilter(%q, %q): %v", p[0], p[1], err)
+				}
+				filters = append(filters, f)
+			}
+			got, _, err := d.List(db.ListOptions{Filters: filters})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var ids []string
+			for _, m := range got {
+				ids = append(ids, m.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilter_Invalid(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{"colour", "red"},
+		{"ram_gb[between]", "1"},
+		{"ram_gb[gte", "1"},
+		{"ram_gb", "lots"},
+		{"storage_tb[lt]", "two"},
+		{"ram_gb[prefix]", "3"},
+		{"created_at[gte]", "last tuesday"},
+		{"ram_gb[in]", "8,sixteen"},
+		{"tag[prefix]", "gpu"},
+		{"label[ne]", "env=prod"},
+		{"label", "=prod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			_, err := db.ParseFilter(tt.key, tt.value)
+			if !errors.Is(err, db.ErrInvalidFilter) {
+				t.Errorf("expected ErrInvalidFilter, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	d := newTestDB(t)
+
+	pve := sampleMachine("id-pve")
+	pve.Name = "pve2"
+	pve.Notes = "replaced the PSU in 2024; runs the gitea and atlantis containers"
+	nas := sampleMachine("id-nas")
+	nas.Name = "nas01"
+	nas.Kind = "nas"
+	nas.Make = "Synology"
+	nas.Notes = "backup target for pve2"
+	pi := sampleMachine("id-pi")
+	pi.Name = "pi01"
+	pi.Make = "Raspberry Pi"
+	pi.Notes = ""
+	for _, m := range []*models.Machine{pve, nas, pi} {
+		if err := d.Create(m, testActor); err != nil {
+			t.Fatalf("Create %q: %v", m.ID, err)
+		}
+	}
+
+	results, err := d.Search("pve2", 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results: got %d, want 2", len(results))
+	}
+	// A name match outranks a mention in another machine's notes.
+	if results[0].Machine.ID != "id-pve" {
+		t.Errorf("top result: got %q, want id-pve", results[0].Machine.ID)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("scores not descending: %f then %f", results[0].Score, results[1].Score)
+	}
+	if !strings.Contains(results[1].Snippet, "<mark>pve2</mark>") {
+		t.Errorf("snippet: got %q, want highlighted pve2", results[1].Snippet)
+	}
+
+	// Terms are prefix-matched and ANDed.
+	results, err = d.Search("atlan PSU", 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 || results[0].Machine.ID != "id-pve" {
+		t.Errorf("multi-term search: got %d results", len(results))
+	}
+}
+
+func TestSearch_SnippetIsEscaped(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("id-1")
+	m.Notes = `swap the <script>alert("psu")</script> & fans`
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	results, err := d.Search("psu", 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("results: got %d, want 1", len(results))
+	}
+	want := `swap the &lt;script&gt;alert(&#34;<mark>psu</mark>&#34;)&lt;/script&gt; &amp; fans`
+	if results[0].Snippet != want {
+		t.Errorf("snippet: got %q, want %q", results[0].Snippet, want)
+	}
+}
+
+func TestSearch_TracksUpdatesAndDeletes(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("id-1")
+	m.Notes = "original chassis"
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	m.Notes = "moved to new chassis"
+	m.Location = "garage"
+	if err := d.Update(m, testActor); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, _ := d.Search("original", 0); len(got) != 0 {
+		t.Errorf("stale term after update: got %d results, want 0", len(got))
+	}
+	if got, _ := d.Search("garage", 0); len(got) != 1 {
+		t.Errorf("new term after update: got %d results, want 1", len(got))
+	}
+
+	if err := d.Delete("id-1", 0, false, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got, _ := d.Search("garage", 0); len(got) != 0 {
+		t.Errorf("after delete: got %d results, want 0", len(got))
+	}
+}
+
+func TestSearch_QuerySyntaxIsLiteral(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("id-1")
+	m.Notes = `disk "sdb" failing (SMART)`
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	for _, q := range []string{`"sdb`, `(SMART)`, `AND`, `notes:sdb`, `*`} {
+		if _, err := d.Search(q, 0); err != nil {
+			t.Errorf("Search(%q): %v", q, err)
+		}
+	}
+}
+
+func TestSearch_Empty(t *testing.T) {
+	d := newTestDB(t)
+	if _, err := d.Search("   ", 0); !errors.Is(err, db.ErrEmptySearch) {
+		t.Errorf("expected ErrEmptySearch, got %v", err)
+	}
+}
+
+// Opening a database created before the search index existed must index the
+// machines that are already there.
+func TestNew_RebuildsSearchIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lab_gear.db")
+	d, err := db.New(path)
+	if err != nil {
+		t.Fatalf("db.New: %v", err)
+	}
+	if err := d.Create(sampleMachine("id-1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	d.Close()
+
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	if _, err := raw.Exec(`
+		DROP TRIGGER machines_fts_ai;
+		DROP TRIGGER machines_fts_ad;
+		DROP TRIGGER machines_fts_au;
+		DROP TABLE machines_fts;
+	`); err != nil {
+		t.Fatalf("drop search index: %v", err)
+	}
+	raw.Close()
+
+	d, err = db.New(path)
+	if err != nil {
+		t.Fatalf("db.New (reopen): %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	results, err := d.Search("hypervisor", 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("results after rebuild: got %d, want 1", len(results))
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	d := newTestDB(t)
 	m := sampleMachine("upd-1")
-	if err := d.Create(m); err != nil {
+	if err := d.Create(m, testActor); err != nil {
 		t.Fatalf("Create: %v", err)
 	}
 
@@ -234,7 +762,7 @@ func TestUpdate(t *testing.T) {
 	m.Notes = "upgraded"
 	m.UpdatedAt = time.Now().UTC().Truncate(time.Second).Add(time.Minute)
 
-	if err := d.Update(m); err != nil {
+	if err := d.Update(m, testActor); err != nil {
 		t.Fatalf("Update: %v", err)
 	}
 
@@ -263,44 +791,1554 @@ func TestUpdate(t *testing.T) {
 func TestUpdate_NotFound(t *testing.T) {
 	d := newTestDB(t)
 	m := sampleMachine("ghost")
-	err := d.Update(m)
+	err := d.Update(m, testActor)
 	if err != sql.ErrNoRows {
 		t.Errorf("expected sql.ErrNoRows, got %v", err)
 	}
 }
 
-func TestDelete(t *testing.T) {
+func TestUpdate_Revision(t *testing.T) {
 	d := newTestDB(t)
-	m := sampleMachine("del-1")
-	if err := d.Create(m); err != nil {
+	m := sampleMachine("rev-1")
+	if err := d.Create(m, testActor); err != nil {
 		t.Fatalf("Create: %v", err)
 	}
+	if m.Revision != 1 {
+		t.Fatalf("Revision after Create: got %d, want 1", m.Revision)
+	}
 
-	if err := d.Delete("del-1"); err != nil {
-		t.Fatalf("Delete: %v", err)
+	if err := d.Update(m, testActor); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if m.Revision != 2 {
+		t.Errorf("Revision after Update: got %d, want 2", m.Revision)
 	}
 
-	_, err := d.GetByID("del-1")
-	if err != sql.ErrNoRows {
-		t.Errorf("expected sql.ErrNoRows after delete, got %v", err)
+	stale := sampleMachine("rev-1")
+	stale.Revision = 1
+	stale.Notes = "lost update"
+	if err := d.Update(stale, testActor); !errors.Is(err, db.ErrRevisionMismatch) {
+		t.Fatalf("stale Update: got %v, want ErrRevisionMismatch", err)
+	}
+
+	unconditional := sampleMachine("rev-1")
+	if err := d.Update(unconditional, testActor); err != nil {
+		t.Fatalf("unconditional Update: %v", err)
+	}
+	got, err := d.GetByID("rev-1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Revision != 3 || got.Notes == "lost update" {
+		t.Errorf("got revision %d notes %q, want revision 3 without the stale write", got.Revision, got.Notes)
 	}
 }
 
-func TestDelete_NotFound(t *testing.T) {
+func TestModify(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("mod-1")
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := d.Modify("mod-1", testActor, func(m *models.Machine) error {
+		m.Location = "garage"
+		m.ID = "someone-else" // must be ignored
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Modify: %v", err)
+	}
+	if got.ID != "mod-1" || got.Location != "garage" {
+		t.Errorf("returned machine: got ID %q Location %q", got.ID, got.Location)
+	}
+
+	stored, err := d.GetByID("mod-1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Location != "garage" {
+		t.Errorf("Location: got %q, want garage", stored.Location)
+	}
+	if stored.Notes != m.Notes {
+		t.Errorf("Notes changed: got %q, want %q", stored.Notes, m.Notes)
+	}
+}
+
+func TestModify_CallbackErrorWritesNothing(t *testing.T) {
+	d := newTestDB(t)
+	if err := d.Create(sampleMachine("mod-1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	wantErr := errors.New("rejected")
+	_, err := d.Modify("mod-1", testActor, func(m *models.Machine) error {
+		m.Location = "garage"
+		return wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("Modify: got %v, want %v", err, wantErr)
+	}
+
+	stored, err := d.GetByID("mod-1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Location != "office rack" {
+		t.Errorf("Location: got %q, want unchanged", stored.Location)
+	}
+}
+
+func TestModify_NotFound(t *testing.T) {
 	d := newTestDB(t)
-	err := d.Delete("nonexistent")
+	called := false
+	_, err := d.Modify("ghost", testActor, func(m *models.Machine) error {
+		called = true
+		return nil
+	})
 	if err != sql.ErrNoRows {
 		t.Errorf("expected sql.ErrNoRows, got %v", err)
 	}
+	if called {
+		t.Error("callback should not run for a missing machine")
+	}
 }
 
-func TestCreate_DuplicateID(t *testing.T) {
-	d := newTestDB(t)
-	m := sampleMachine("dup-1")
-	if err := d.Create(m); err != nil {
-		t.Fatalf("first Create: %v", err)
+func TestNew_AddsColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lab_gear.db")
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
 	}
-	if err := d.Create(m); err == nil {
-		t.Error("expected error on duplicate ID, got nil")
+	// The machines table as it was created before revisions existed.
+	if _, err := raw.Exec(`
+		CREATE TABLE machines (
+			id         TEXT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			kind       TEXT NOT NULL,
+			make       TEXT NOT NULL,
+			model      TEXT NOT NULL,
+			cpu        TEXT NOT NULL DEFAULT '',
+			ram_gb     INTEGER NOT NULL DEFAULT 0,
+			storage_tb REAL NOT NULL DEFAULT 0,
+			location   TEXT NOT NULL DEFAULT '',
+			serial     TEXT NOT NULL DEFAULT '',
+			notes      TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		INSERT INTO machines (id, name, kind, make, model, created_at, updated_at)
+		VALUES ('old-1', 'pve1', 'proxmox', 'Dell', 'R720', '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z');
+	`); err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+	raw.Close()
+
+	d, err := db.New(path)
+	if err != nil {
+		t.Fatalf("db.New: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	got, err := d.GetByID("old-1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Revision != 1 {
+		t.Errorf("Revision of pre-existing row: got %d, want 1", got.Revision)
+	}
+	if got.Status != models.StatusActive {
+		t.Errorf("Status of pre-existing row: got %q, want active", got.Status)
+	}
+	if !got.StatusChangedAt.Equal(got.CreatedAt) {
+		t.Errorf("StatusChangedAt of pre-existing row: got %v, want created_at %v", got.StatusChangedAt, got.CreatedAt)
+	}
+}
+
+func TestEvents_RecordedForEachWrite(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("ev-1")
+	if err := d.Create(m, "alice"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	m.RAMGB = 64
+	m.Notes = "upgraded"
+	if err := d.Update(m, "bob"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := d.Modify("ev-1", "carol", func(m *models.Machine) error {
+		m.Location = "closet"
+		return nil
+	}); err != nil {
+		t.Fatalf("Modify: %v", err)
+	}
+	if err := d.Delete("ev-1", 0, false, "dave"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := d.Restore("ev-1", "erin"); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if err := d.Delete("ev-1", 0, false, "frank"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := d.Purge("ev-1", "grace"); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+
+	events, err := d.History("ev-1")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+
+	want := []struct {
+		actor, op string
+		changes   map[string]models.FieldChange
+	}{
+		{"alice", models.OpCreate, nil},
+		{"bob", models.OpUpdate, map[string]models.FieldChange{
+			"ram_gb": {Before: 32.0, After: 64.0},
+			"notes":  {Before: "primary hypervisor", After: "upgraded"},
+		}},
+		{"carol", models.OpUpdate, map[string]models.FieldChange{
+			"location": {Before: "office rack", After: "closet"},
+		}},
+		{"dave", models.OpDelete, nil},
+		{"erin", models.OpRestore, nil},
+		{"frank", models.OpDelete, nil},
+		{"grace", models.OpPurge, nil},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events: got %d, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.MachineID != "ev-1" || e.Actor != w.actor || e.Operation != w.op {
+			t.Errorf("event %d: got %s/%s/%s, want ev-1/%s/%s", i, e.MachineID, e.Actor, e.Operation, w.actor, w.op)
+		}
+		if w.changes != nil && !reflect.DeepEqual(e.Changes, w.changes) {
+			t.Errorf("event %d changes: got %v, want %v", i, e.Changes, w.changes)
+		}
+	}
+
+	// Create records every field as added and purge every field as removed.
+	// Delete and restore only move deleted_at. None include server-managed
+	// fields.
+	if c := events[0].Changes["name"]; c.Before != nil || c.After != "pve2" {
+		t.Errorf("create name change: got %+v", c)
+	}
+	if c, ok := events[3].Changes["deleted_at"]; len(events[3].Changes) != 1 || !ok || c.Before != nil || c.After == nil {
+		t.Errorf("delete changes: got %v, want only deleted_at set", events[3].Changes)
+	}
+	if c, ok := events[4].Changes["deleted_at"]; len(events[4].Changes) != 1 || !ok || c.Before == nil || c.After != nil {
+		t.Errorf("restore changes: got %v, want only deleted_at cleared", events[4].Changes)
+	}
+	if c := events[6].Changes["location"]; c.Before != "closet" || c.After != nil {
+		t.Errorf("purge location change: got %+v", c)
+	}
+	for _, e := range events {
+		for _, f := range []string{"id", "created_at", "updated_at", "revision"} {
+			if _, ok := e.Changes[f]; ok {
+				t.Errorf("%s event includes server-managed field %q", e.Operation, f)
+			}
+		}
+	}
+}
+
+func TestEvents_NotRecordedForFailedWrite(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("ev-fail")
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	stale := sampleMachine("ev-fail")
+	stale.Revision = 7
+	if err := d.Update(stale, testActor); !errors.Is(err, db.ErrRevisionMismatch) {
+		t.Fatalf("stale Update: got %v", err)
+	}
+	if _, err := d.Modify("ev-fail", testActor, func(m *models.Machine) error {
+		return errors.New("rejected")
+	}); err == nil {
+		t.Fatal("Modify: expected callback error")
+	}
+	if err := d.Delete("ev-fail", 7, false, testActor); !errors.Is(err, db.ErrRevisionMismatch) {
+		t.Fatalf("stale Delete: got %v", err)
+	}
+
+	events, err := d.History("ev-fail")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(events) != 1 || events[0].Operation != models.OpCreate {
+		t.Errorf("events after failed writes: got %d, want only the create", len(events))
+	}
+}
+
+func TestEvents_AppendOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lab_gear.db")
+	d, err := db.New(path)
+	if err != nil {
+		t.Fatalf("db.New: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if err := d.Create(sampleMachine("ev-1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec(`UPDATE machine_events SET actor = 'mallory'`); err == nil {
+		t.Error("UPDATE machine_events succeeded, want error")
+	}
+	if _, err := raw.Exec(`DELETE FROM machine_events`); err == nil {
+		t.Error("DELETE FROM machine_events succeeded, want error")
+	}
+}
+
+func TestAudit(t *testing.T) {
+	d := newTestDB(t)
+	for i := range 5 {
+		if err := d.Create(sampleMachine(fmt.Sprintf("id-%d", i)), testActor); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	// Page through everything two at a time.
+	var got []string
+	cursor := ""
+	for {
+		events, next, err := d.Audit(db.AuditOptions{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Audit: %v", err)
+		}
+		for _, e := range events {
+			got = append(got, e.MachineID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if want := "id-0,id-1,id-2,id-3,id-4"; strings.Join(got, ",") != want {
+		t.Errorf("paged events: got %s, want %s", strings.Join(got, ","), want)
+	}
+
+	now := time.Now().UTC()
+	tests := []struct {
+		name string
+		opts db.AuditOptions
+		want int
+	}{
+		{"open range", db.AuditOptions{}, 5},
+		{"since past", db.AuditOptions{Since: now.Add(-time.Hour)}, 5},
+		{"since future", db.AuditOptions{Since: now.Add(time.Hour)}, 0},
+		{"until past", db.AuditOptions{Until: now.Add(-time.Hour)}, 0},
+		{"window", db.AuditOptions{Since: now.Add(-time.Hour), Until: now.Add(time.Hour)}, 5},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			events, _, err := d.Audit(tc.opts)
+			if err != nil {
+				t.Fatalf("Audit: %v", err)
+			}
+			if len(events) != tc.want {
+				t.Errorf("events: got %d, want %d", len(events), tc.want)
+			}
+		})
+	}
+
+	_, listCursor, err := d.List(db.ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if _, _, err := d.Audit(db.AuditOptions{Cursor: listCursor}); !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("Audit with list cursor: got %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("del-1")
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := d.Delete("del-1", 0, false, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	_, err := d.GetByID("del-1")
+	if err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows after delete, got %v", err)
+	}
+}
+
+func TestDelete_MovesToTrash(t *testing.T) {
+	d := newTestDB(t)
+	for _, id := range []string{"live", "trashed"} {
+		if err := d.Create(sampleMachine(id), testActor); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := d.Delete("trashed", 0, false, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	live, _, err := d.List(db.ListOptions{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(live) != 1 || live[0].ID != "live" {
+		t.Errorf("List: got %v, want only the live machine", live)
+	}
+	results, err := d.Search("pve2", 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 || results[0].Machine.ID != "live" {
+		t.Errorf("Search: got %d results, want only the live machine", len(results))
+	}
+
+	trash, _, err := d.List(db.ListOptions{Trashed: true, Sort: "-deleted_at"})
+	if err != nil {
+		t.Fatalf("List trash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != "trashed" || trash[0].DeletedAt == nil {
+		t.Fatalf("List trash: got %v, want the trashed machine with deleted_at", trash)
+	}
+	if trash[0].Serial != "SN-001" || trash[0].Notes != "primary hypervisor" {
+		t.Errorf("trashed machine lost data: %+v", trash[0])
+	}
+
+	// A trashed machine cannot be modified until it is restored.
+	if err := d.Update(sampleMachine("trashed"), testActor); err != sql.ErrNoRows {
+		t.Errorf("Update trashed: got %v, want sql.ErrNoRows", err)
+	}
+	if _, _, err := d.List(db.ListOptions{Sort: "deleted_at"}); !errors.Is(err, db.ErrInvalidSort) {
+		t.Errorf("deleted_at sort on live list: got %v, want ErrInvalidSort", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("res-1")
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := d.Restore("res-1", testActor); err != sql.ErrNoRows {
+		t.Errorf("Restore live machine: got %v, want sql.ErrNoRows", err)
+	}
+	if err := d.Delete("res-1", 0, false, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	restored, err := d.Restore("res-1", testActor)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Revision != 3 {
+		t.Errorf("restored: deleted_at %v revision %d, want nil and 3", restored.DeletedAt, restored.Revision)
+	}
+	got, err := d.GetByID("res-1")
+	if err != nil {
+		t.Fatalf("GetByID after restore: %v", err)
+	}
+	if got.Serial != m.Serial || got.Revision != 3 {
+		t.Errorf("GetByID after restore: got %+v", got)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	d := newTestDB(t)
+	if err := d.Create(sampleMachine("pur-1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := d.Purge("pur-1", testActor); err != sql.ErrNoRows {
+		t.Errorf("Purge live machine: got %v, want sql.ErrNoRows", err)
+	}
+	if err := d.Delete("pur-1", 0, false, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := d.Purge("pur-1", testActor); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if _, err := d.Restore("pur-1", testActor); err != sql.ErrNoRows {
+		t.Errorf("Restore after purge: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPurgeDeletedBefore(t *testing.T) {
+	d := newTestDB(t)
+	for _, id := range []string{"live", "old", "older"} {
+		if err := d.Create(sampleMachine(id), testActor); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	for _, id := range []string{"old", "older"} {
+		if err := d.Delete(id, 0, false, testActor); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+
+	n, err := d.PurgeDeletedBefore(time.Now().Add(-time.Hour), "retention")
+	if err != nil || n != 0 {
+		t.Fatalf("PurgeDeletedBefore (past cutoff): got %d, %v; want 0", n, err)
+	}
+	n, err = d.PurgeDeletedBefore(time.Now().Add(time.Hour), "retention")
+	if err != nil || n != 2 {
+		t.Fatalf("PurgeDeletedBefore: got %d, %v; want 2", n, err)
+	}
+
+	trash, _, err := d.List(db.ListOptions{Trashed: true})
+	if err != nil {
+		t.Fatalf("List trash: %v", err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("trash after sweep: got %d machines, want 0", len(trash))
+	}
+	if _, err := d.GetByID("live"); err != nil {
+		t.Errorf("live machine was purged: %v", err)
+	}
+	events, err := d.History("older")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if last := events[len(events)-1]; last.Operation != models.OpPurge || last.Actor != "retention" {
+		t.Errorf("last event: got %s by %s, want purge by retention", last.Operation, last.Actor)
+	}
+}
+
+func TestDelete_Revision(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("del-rev")
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := d.Update(m, testActor); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if err := d.Delete("del-rev", 1, false, testActor); !errors.Is(err, db.ErrRevisionMismatch) {
+		t.Fatalf("stale Delete: got %v, want ErrRevisionMismatch", err)
+	}
+	if err := d.Delete("del-rev", 2, false, testActor); err != nil {
+		t.Fatalf("Delete at current revision: %v", err)
+	}
+	if err := d.Delete("del-rev", 2, false, testActor); err != sql.ErrNoRows {
+		t.Errorf("Delete after delete: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestDelete_NotFound(t *testing.T) {
+	d := newTestDB(t)
+	err := d.Delete("nonexistent", 0, false, testActor)
+	if err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestCreate_DuplicateID(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("dup-1")
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("first Create: %v", err)
+	}
+	if err := d.Create(m, testActor); err == nil {
+		t.Error("expected error on duplicate ID, got nil")
+	}
+}
+
+func sampleInterface(id, machineID, mac string) *models.NetworkInterface {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &models.NetworkInterface{
+		ID:        id,
+		MachineID: machineID,
+		Name:      "eno1",
+		MAC:       mac,
+		Addresses: []string{"10.0.0.5", "fd00::5"},
+		SpeedMbps: 1000,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	d := newTestDB(t)
+	if err := d.Create(sampleMachine("m1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	n := sampleInterface("nic-1", "m1", "aa:bb:cc:00:11:22")
+	if err := d.CreateInterface(n); err != nil {
+		t.Fatalf("CreateInterface: %v", err)
+	}
+
+	got, err := d.GetInterface("m1", "nic-1")
+	if err != nil {
+		t.Fatalf("GetInterface: %v", err)
+	}
+	if !reflect.DeepEqual(got, n) {
+		t.Errorf("GetInterface: got %+v, want %+v", got, n)
+	}
+	if _, err := d.GetInterface("other", "nic-1"); err != sql.ErrNoRows {
+		t.Errorf("GetInterface on wrong machine: got %v, want sql.ErrNoRows", err)
+	}
+
+	byIP, err := d.InterfacesByAddress("fd00::5")
+	if err != nil || len(byIP) != 1 || byIP[0].ID != "nic-1" {
+		t.Errorf("InterfacesByAddress: got %v, %v", byIP, err)
+	}
+	byMAC, err := d.InterfacesByMAC("aa:bb:cc:00:11:22")
+	if err != nil || len(byMAC) != 1 || byMAC[0].ID != "nic-1" {
+		t.Errorf("InterfacesByMAC: got %v, %v", byMAC, err)
+	}
+
+	n.Addresses = nil
+	if err := d.UpdateInterface(n); err != nil {
+		t.Fatalf("UpdateInterface: %v", err)
+	}
+	byIP, err = d.InterfacesByAddress("10.0.0.5")
+	if err != nil || len(byIP) != 0 {
+		t.Errorf("InterfacesByAddress after update: got %v, %v", byIP, err)
+	}
+
+	if err := d.DeleteInterface("m1", "nic-1"); err != nil {
+		t.Fatalf("DeleteInterface: %v", err)
+	}
+	if err := d.DeleteInterface("m1", "nic-1"); err != sql.ErrNoRows {
+		t.Errorf("DeleteInterface twice: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestInterfaces_Conflicts(t *testing.T) {
+	d := newTestDB(t)
+	for _, id := range []string{"m1", "m2"} {
+		if err := d.Create(sampleMachine(id), testActor); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := d.CreateInterface(sampleInterface("nic-1", "m1", "aa:bb:cc:00:11:22")); err != nil {
+		t.Fatalf("CreateInterface: %v", err)
+	}
+
+	if err := d.CreateInterface(sampleInterface("nic-2", "m2", "aa:bb:cc:00:11:22")); !errors.Is(err, db.ErrMACInUse) {
+		t.Errorf("duplicate MAC: got %v, want ErrMACInUse", err)
+	}
+	if err := d.CreateInterface(sampleInterface("nic-2", "m1", "aa:bb:cc:00:11:33")); !errors.Is(err, db.ErrInterfaceNameInUse) {
+		t.Errorf("duplicate name: got %v, want ErrInterfaceNameInUse", err)
+	}
+	if err := d.CreateInterface(sampleInterface("nic-2", "missing", "aa:bb:cc:00:11:33")); err != sql.ErrNoRows {
+		t.Errorf("missing machine: got %v, want sql.ErrNoRows", err)
+	}
+	// Updating an interface without changing its MAC is not a conflict.
+	if err := d.UpdateInterface(sampleInterface("nic-1", "m1", "aa:bb:cc:00:11:22")); err != nil {
+		t.Errorf("UpdateInterface: %v", err)
+	}
+}
+
+func TestInterfaces_TrashAndPurge(t *testing.T) {
+	d := newTestDB(t)
+	if err := d.Create(sampleMachine("m1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := d.CreateInterface(sampleInterface("nic-1", "m1", "aa:bb:cc:00:11:22")); err != nil {
+		t.Fatalf("CreateInterface: %v", err)
+	}
+	if err := d.Delete("m1", 0, false, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := d.ListInterfaces("m1"); err != sql.ErrNoRows {
+		t.Errorf("ListInterfaces on trashed machine: got %v, want sql.ErrNoRows", err)
+	}
+	if got, err := d.InterfacesByMAC("aa:bb:cc:00:11:22"); err != nil || len(got) != 0 {
+		t.Errorf("InterfacesByMAC on trashed machine: got %v, %v", got, err)
+	}
+
+	// Purging the machine removes its interfaces, freeing the MAC.
+	if err := d.Purge("m1", testActor); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if err := d.Create(sampleMachine("m2"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := d.CreateInterface(sampleInterface("nic-2", "m2", "aa:bb:cc:00:11:22")); err != nil {
+		t.Errorf("reuse MAC after purge: %v", err)
+	}
+}
+
+func TestParent_CyclesAndTree(t *testing.T) {
+	d := newTestDB(t)
+	root := sampleMachine("root")
+	if err := d.Create(root, testActor); err != nil {
+		t.Fatalf("Create root: %v", err)
+	}
+	for _, id := range []string{"mid", "leaf"} {
+		m := sampleMachine(id)
+		m.Name = id
+		m.ParentID = map[string]string{"mid": "root", "leaf": "mid"}[id]
+		if err := d.Create(m, testActor); err != nil {
+			t.Fatalf("Create %s: %v", id, err)
+		}
+	}
+
+	orphan := sampleMachine("orphan")
+	orphan.ParentID = "missing"
+	if err := d.Create(orphan, testActor); !errors.Is(err, db.ErrParentNotFound) {
+		t.Errorf("Create with unknown parent: got %v, want ErrParentNotFound", err)
+	}
+
+	// root -> mid -> leaf: making root a child of leaf closes a loop.
+	root.ParentID = "leaf"
+	root.UpdatedAt = time.Now().UTC()
+	if err := d.Update(root, testActor); !errors.Is(err, db.ErrParentCycle) {
+		t.Errorf("Update into own descendant: got %v, want ErrParentCycle", err)
+	}
+	_, err := d.Modify("mid", testActor, func(m *models.Machine) error {
+		m.ParentID = "mid"
+		return nil
+	})
+	if !errors.Is(err, db.ErrParentCycle) {
+		t.Errorf("Modify into itself: got %v, want ErrParentCycle", err)
+	}
+
+	tree, err := d.Tree("root")
+	if err != nil {
+		t.Fatalf("Tree: %v", err)
+	}
+	if len(tree.Children) != 1 || tree.Children[0].Machine.ID != "mid" ||
+		len(tree.Children[0].Children) != 1 || tree.Children[0].Children[0].Machine.ID != "leaf" {
+		t.Errorf("Tree: got %+v", tree)
+	}
+	if got := tree.Children[0].Children[0].Machine; got.ParentID != "mid" || got.Tags == nil {
+		t.Errorf("Tree leaf: got %+v", got)
+	}
+	if _, err := d.Tree("missing"); err != sql.ErrNoRows {
+		t.Errorf("Tree of unknown machine: got %v, want sql.ErrNoRows", err)
+	}
+
+	children, _, err := d.List(db.ListOptions{Filters: []db.Filter{db.ChildrenFilter("root")}})
+	if err != nil {
+		t.Fatalf("List children: %v", err)
+	}
+	if len(children) != 1 || children[0].ID != "mid" {
+		t.Errorf("List children: got %v", children)
+	}
+}
+
+func TestParent_DeleteRestorePurge(t *testing.T) {
+	d := newTestDB(t)
+	if err := d.Create(sampleMachine("parent"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	child := sampleMachine("child")
+	child.ParentID = "parent"
+	if err := d.Create(child, testActor); err != nil {
+		t.Fatalf("Create child: %v", err)
+	}
+
+	if err := d.Delete("parent", 0, false, testActor); !errors.Is(err, db.ErrHasChildren) {
+		t.Fatalf("Delete parent with live child: got %v, want ErrHasChildren", err)
+	}
+	for _, id := range []string{"child", "parent"} {
+		if err := d.Delete(id, 0, false, testActor); err != nil {
+			t.Fatalf("Delete %s: %v", id, err)
+		}
+	}
+	if _, err := d.Restore("child", testActor); !errors.Is(err, db.ErrParentNotFound) {
+		t.Errorf("Restore child of trashed parent: got %v, want ErrParentNotFound", err)
+	}
+
+	// Purging the parent detaches the trashed child, which can then be
+	// restored on its own.
+	if err := d.Purge("parent", testActor); err != nil {
+		t.Fatalf("Purge parent: %v", err)
+	}
+	restored, err := d.Restore("child", testActor)
+	if err != nil {
+		t.Fatalf("Restore child after parent purge: %v", err)
+	}
+	if restored.ParentID != "" {
+		t.Errorf("restored child: parent_id %q, want empty", restored.ParentID)
+	}
+}
+
+// sampleRack creates a site, room, and rack of heightU units and returns the
+// rack's ID.
+func sampleRack(t *testing.T, d *db.DB, heightU int) string {
+	t.Helper()
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, l := range []*models.Location{
+		{ID: "site", Name: "home", Kind: models.LocationSite},
+		{ID: "room", Name: "office", Kind: models.LocationRoom, ParentID: "site"},
+		{ID: "rack", Name: "rack1", Kind: models.LocationRack, ParentID: "room", HeightU: heightU},
+	} {
+		l.CreatedAt, l.UpdatedAt = now, now
+		if err := d.CreateLocation(l); err != nil {
+			t.Fatalf("CreateLocation %s: %v", l.ID, err)
+		}
+	}
+	return "rack"
+}
+
+func TestLocations(t *testing.T) {
+	d := newTestDB(t)
+	sampleRack(t, d, 42)
+
+	dup := &models.Location{ID: "dup", Name: "Office", Kind: models.LocationRoom, ParentID: "site"}
+	if err := d.CreateLocation(dup); !errors.Is(err, db.ErrLocationNameInUse) {
+		t.Errorf("CreateLocation with sibling name in other case: got %v, want ErrLocationNameInUse", err)
+	}
+	// The same name is fine under a different parent.
+	other := &models.Location{ID: "site2", Name: "cabin", Kind: models.LocationSite}
+	if err := d.CreateLocation(other); err != nil {
+		t.Fatalf("CreateLocation site2: %v", err)
+	}
+	dup.ParentID = "site2"
+	if err := d.CreateLocation(dup); err != nil {
+		t.Errorf("CreateLocation same name under another site: %v", err)
+	}
+
+	bad := &models.Location{ID: "bad", Name: "r", Kind: models.LocationRack, ParentID: "site", HeightU: 4}
+	if err := d.CreateLocation(bad); !errors.Is(err, db.ErrInvalidLocationParent) {
+		t.Errorf("CreateLocation rack in site: got %v, want ErrInvalidLocationParent", err)
+	}
+
+	racks, err := d.ListLocations(db.LocationFilter{Kind: models.LocationRack})
+	if err != nil {
+		t.Fatalf("ListLocations: %v", err)
+	}
+	if len(racks) != 1 || racks[0].HeightU != 42 || racks[0].ParentID != "room" {
+		t.Errorf("ListLocations racks: got %+v", racks)
+	}
+
+	// Changing the kind of a location with children is refused.
+	site, _ := d.GetLocation("site")
+	site.Kind = models.LocationRoom
+	site.ParentID = "site2"
+	if err := d.UpdateLocation(site); !errors.Is(err, db.ErrLocationInUse) {
+		t.Errorf("UpdateLocation kind with children: got %v, want ErrLocationInUse", err)
+	}
+	if err := d.DeleteLocation("missing"); err != sql.ErrNoRows {
+		t.Errorf("DeleteLocation missing: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestRackPlacement(t *testing.T) {
+	d := newTestDB(t)
+	rack := sampleRack(t, d, 10)
+
+	a := sampleMachine("a")
+	a.LocationID, a.RackU, a.UHeight = rack, 1, 4
+	if err := d.Create(a, testActor); err != nil {
+		t.Fatalf("Create a: %v", err)
+	}
+	b := sampleMachine("b")
+	b.LocationID, b.RackU = rack, 4
+	if err := d.Create(b, testActor); !errors.Is(err, db.ErrRackPositionTaken) {
+		t.Errorf("Create overlapping: got %v, want ErrRackPositionTaken", err)
+	}
+	b.RackU = 10
+	if err := d.Create(b, testActor); err != nil {
+		t.Fatalf("Create at top unit: %v", err)
+	}
+	if b.UHeight != 1 {
+		t.Errorf("UHeight default: got %d, want 1", b.UHeight)
+	}
+	got, err := d.GetByID("a")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.LocationID != rack || got.RackU != 1 || got.UHeight != 4 {
+		t.Errorf("stored placement: %+v", got)
+	}
+
+	// A trashed machine frees its units, and cannot be restored once they
+	// are taken.
+	if err := d.Delete("a", 0, false, testActor); err != nil {
+		t.Fatalf("Delete a: %v", err)
+	}
+	c := sampleMachine("c")
+	c.LocationID, c.RackU, c.UHeight = rack, 2, 2
+	if err := d.Create(c, testActor); err != nil {
+		t.Fatalf("Create in freed units: %v", err)
+	}
+	if _, err := d.Restore("a", testActor); !errors.Is(err, db.ErrRackPositionTaken) {
+		t.Errorf("Restore into taken units: got %v, want ErrRackPositionTaken", err)
+	}
+
+	// The rack cannot be shortened below the machines in it, and cannot be
+	// deleted while machines (even trashed ones) refer to it.
+	l, _ := d.GetLocation(rack)
+	l.HeightU = 3
+	if err := d.UpdateLocation(l); !errors.Is(err, db.ErrRackPositionOutOfRange) {
+		t.Errorf("UpdateLocation below placed machine: got %v, want ErrRackPositionOutOfRange", err)
+	}
+	if err := d.DeleteLocation(rack); !errors.Is(err, db.ErrLocationInUse) {
+		t.Errorf("DeleteLocation in use: got %v, want ErrLocationInUse", err)
+	}
+}
+
+func TestRackMachines(t *testing.T) {
+	d := newTestDB(t)
+	rack := sampleRack(t, d, 10)
+	for _, p := range []struct {
+		id    string
+		rackU int
+	}{{"top", 9}, {"bottom", 1}, {"trashed", 5}} {
+		m := sampleMachine(p.id)
+		m.LocationID, m.RackU = rack, p.rackU
+		if err := d.Create(m, testActor); err != nil {
+			t.Fatalf("Create %s: %v", p.id, err)
+		}
+	}
+	loose := sampleMachine("loose")
+	loose.LocationID = rack
+	if err := d.Create(loose, testActor); err != nil {
+		t.Fatalf("Create loose: %v", err)
+	}
+	if err := d.Delete("trashed", 0, false, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	got, err := d.RackMachines(rack)
+	if err != nil {
+		t.Fatalf("RackMachines: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "bottom" || got[1].ID != "top" {
+		t.Errorf("RackMachines: got %+v, want bottom then top", got)
+	}
+
+	if l, err := d.RackByName("RACK1"); err != nil || l.ID != rack {
+		t.Errorf("RackByName ignoring case: got %+v, %v", l, err)
+	}
+	if _, err := d.RackByName("office"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("RackByName of a room: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func sampleComponent(id, machineID, typ string, capacityGB int) *models.Component {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &models.Component{
+		ID:         id,
+		MachineID:  machineID,
+		Type:       typ,
+		CapacityGB: capacityGB,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+func TestComponents_MoveAndDerive(t *testing.T) {
+	d := newTestDB(t)
+	nas := sampleMachine("nas01")
+	nas.DeriveCapacity = true
+	pve := sampleMachine("pve2")
+	pve.DeriveCapacity = true
+	for _, m := range []*models.Machine{nas, pve} {
+		if err := d.Create(m, testActor); err != nil {
+			t.Fatalf("Create %s: %v", m.ID, err)
+		}
+	}
+	if nas.RAMGB != 0 || nas.StorageTB != 0 {
+		t.Errorf("derived capacity with no components: ram_gb %d storage_tb %v", nas.RAMGB, nas.StorageTB)
+	}
+
+	drive := sampleComponent("drive", "nas01", models.ComponentDisk, 4000)
+	drive.Serial, drive.Slot = "WD-1", "bay 1"
+	if err := d.CreateComponent(drive, testActor); err != nil {
+		t.Fatalf("CreateComponent: %v", err)
+	}
+	if err := d.CreateComponent(sampleComponent("dimm", "nas01", models.ComponentDIMM, 8), testActor); err != nil {
+		t.Fatalf("CreateComponent: %v", err)
+	}
+	got, _ := d.GetByID("nas01")
+	if got.RAMGB != 8 || got.StorageTB != 4 {
+		t.Errorf("nas01 derived: ram_gb %d storage_tb %v, want 8 and 4", got.RAMGB, got.StorageTB)
+	}
+
+	move := &models.Component{ID: "drive", MachineID: "missing", UpdatedAt: time.Now().UTC()}
+	if err := d.MoveComponent("nas01", move, testActor); !errors.Is(err, db.ErrMoveTargetNotFound) {
+		t.Errorf("move to unknown machine: got %v, want ErrMoveTargetNotFound", err)
+	}
+	move = &models.Component{ID: "drive", MachineID: "pve2", Slot: "bay 3", UpdatedAt: time.Now().UTC()}
+	if err := d.MoveComponent("nas01", move, testActor); err != nil {
+		t.Fatalf("MoveComponent: %v", err)
+	}
+	if move.Serial != "WD-1" || move.CapacityGB != 4000 {
+		t.Errorf("moved component not filled from store: %+v", move)
+	}
+	if got, _ := d.GetByID("nas01"); got.StorageTB != 0 {
+		t.Errorf("nas01 storage_tb after move: got %v, want 0", got.StorageTB)
+	}
+	if got, _ := d.GetByID("pve2"); got.StorageTB != 4 {
+		t.Errorf("pve2 storage_tb after move: got %v, want 4", got.StorageTB)
+	}
+	for _, id := range []string{"nas01", "pve2"} {
+		events, err := d.History(id)
+		if err != nil {
+			t.Fatalf("History %s: %v", id, err)
+		}
+		var moves int
+		for _, e := range events {
+			if e.Operation == models.OpComponentMove {
+				moves++
+			}
+		}
+		if moves != 1 {
+			t.Errorf("History %s: %d component_move events, want 1", id, moves)
+		}
+	}
+
+	// The serial stays reserved while the machine is in the trash, and is
+	// freed once it is purged.
+	if err := d.Delete("pve2", 0, false, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := d.ListComponents("pve2"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("ListComponents on trashed machine: got %v, want sql.ErrNoRows", err)
+	}
+	reuse := sampleComponent("reuse", "nas01", models.ComponentDisk, 4000)
+	reuse.Serial = "WD-1"
+	if err := d.CreateComponent(reuse, testActor); !errors.Is(err, db.ErrComponentSerialInUse) {
+		t.Errorf("reuse serial of trashed machine: got %v, want ErrComponentSerialInUse", err)
+	}
+	if err := d.Purge("pve2", testActor); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if err := d.CreateComponent(reuse, testActor); err != nil {
+		t.Errorf("reuse serial after purge: %v", err)
+	}
+}
+
+func TestComponents_DeriveWritesOnlyCapacity(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("pve2")
+	m.DeriveCapacity = true
+	m.Tags = []string{"nvme"}
+	m.Labels = map[string]string{"env": "prod"}
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Someone else edits the machine first.
+	edit, _ := d.GetByID("pve2")
+	edit.Notes, edit.Location = "moved to the garage", "garage"
+	if err := d.Update(edit, "someone"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	before, _ := d.GetByID("pve2")
+	stale, _ := d.GetByID("pve2")
+
+	if err := d.CreateComponent(sampleComponent("dimm", "pve2", models.ComponentDIMM, 16), testActor); err != nil {
+		t.Fatalf("CreateComponent: %v", err)
+	}
+	after, err := d.GetByID("pve2")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if after.RAMGB != 16 || after.StorageTB != 0 {
+		t.Errorf("derived: ram_gb %d storage_tb %v, want 16 and 0", after.RAMGB, after.StorageTB)
+	}
+	if after.Revision != before.Revision+1 {
+		t.Errorf("revision: got %d, want %d", after.Revision, before.Revision+1)
+	}
+
+	// Apart from the capacity, revision, and updated_at, the row is as the
+	// other edit left it.
+	want := *before
+	want.RAMGB, want.StorageTB, want.Revision, want.UpdatedAt = after.RAMGB, after.StorageTB, after.Revision, after.UpdatedAt
+	if !reflect.DeepEqual(*after, want) {
+		t.Errorf("other fields changed:\n got %+v\nwant %+v", *after, want)
+	}
+
+	// A write based on the row as it was before the component changed is
+	// rejected rather than undoing the new capacity.
+	stale.Notes = "stale write"
+	if err := d.Update(stale, "someone"); !errors.Is(err, db.ErrRevisionMismatch) {
+		t.Errorf("update at the pre-component revision: got %v, want ErrRevisionMismatch", err)
+	}
+}
+
+func TestPurchaseFields(t *testing.T) {
+	d := newTestDB(t)
+	m := sampleMachine("pve1")
+	m.PurchaseDate, m.Vendor, m.Price, m.Currency = "2024-03-15", "Newegg", 1299.99, "USD"
+	m.WarrantyEnd, m.LifetimeYears = "2027-03-15", 5
+	if err := d.Create(m, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := d.Create(sampleMachine("pi01"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := d.GetByID("pve1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.PurchaseDate != "2024-03-15" || got.Vendor != "Newegg" || got.Price != 1299.99 ||
+		got.Currency != "USD" || got.WarrantyEnd != "2027-03-15" || got.LifetimeYears != 5 {
+		t.Errorf("round trip: got %+v", got)
+	}
+
+	// Machines without a warranty date never match a date range.
+	f, err := db.ParseFilter("warranty_end[lt]", "2030-01-01")
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+	list, _, err := d.List(db.ListOptions{Filters: []db.Filter{f}})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != "pve1" {
+		t.Errorf("warranty_end filter: got %v, want only pve1", list)
+	}
+	if got, err := d.WarrantyExpiring("2027-01-01", "2027-12-31"); err != nil || len(got) != 1 {
+		t.Errorf("WarrantyExpiring: got %v, %v", got, err)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	d := newTestDB(t)
+	rack := sampleRack(t, d, 12)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	ap := &models.Asset{ID: "ap1", Type: models.AssetAccessPoint, Name: "hallway", Make: "Ubiquiti", Model: "U6",
+		RadioBands: []string{"2.4ghz", "5ghz"}, CreatedAt: now, UpdatedAt: now}
+	sw := &models.Asset{ID: "sw1", Type: models.AssetSwitch, Name: "core", Make: "MikroTik", Model: "CRS309",
+		PortCount: 9, LocationID: rack, CreatedAt: now, UpdatedAt: now}
+	for _, a := range []*models.Asset{ap, sw} {
+		if err := d.CreateAsset(a); err != nil {
+			t.Fatalf("CreateAsset %s: %v", a.ID, err)
+		}
+	}
+	bad := &models.Asset{ID: "sw2", Type: models.AssetSwitch, Name: "edge", LocationID: "missing", PortCount: 5}
+	if err := d.CreateAsset(bad); !errors.Is(err, db.ErrLocationNotFound) {
+		t.Errorf("CreateAsset in missing location: got %v, want ErrLocationNotFound", err)
+	}
+
+	got, err := d.GetAsset(models.AssetAccessPoint, "ap1")
+	if err != nil {
+		t.Fatalf("GetAsset: %v", err)
+	}
+	if !slices.Equal(got.RadioBands, ap.RadioBands) || got.LocationID != "" || !got.CreatedAt.Equal(now) {
+		t.Errorf("round trip: got %+v", got)
+	}
+	if _, err := d.GetAsset(models.AssetUPS, "ap1"); err != sql.ErrNoRows {
+		t.Errorf("GetAsset with the wrong type: got %v, want sql.ErrNoRows", err)
+	}
+
+	switches, err := d.ListAssets(models.AssetSwitch)
+	if err != nil {
+		t.Fatalf("ListAssets: %v", err)
+	}
+	if len(switches) != 1 || switches[0].PortCount != 9 || switches[0].RadioBands != nil {
+		t.Errorf("ListAssets switches: got %+v", switches)
+	}
+
+	// A location holding an asset cannot be deleted until the asset leaves.
+	if err := d.DeleteLocation(rack); !errors.Is(err, db.ErrLocationInUse) {
+		t.Errorf("DeleteLocation holding a switch: got %v, want ErrLocationInUse", err)
+	}
+	sw.LocationID = ""
+	sw.UpdatedAt = now.Add(time.Minute)
+	if err := d.UpdateAsset(sw); err != nil {
+		t.Fatalf("UpdateAsset: %v", err)
+	}
+	if err := d.DeleteLocation(rack); err != nil {
+		t.Errorf("DeleteLocation after the switch moved: %v", err)
+	}
+
+	if err := d.DeleteAsset(models.AssetSwitch, "ap1"); err != sql.ErrNoRows {
+		t.Errorf("DeleteAsset with the wrong type: got %v, want sql.ErrNoRows", err)
+	}
+	if err := d.DeleteAsset(models.AssetAccessPoint, "ap1"); err != nil {
+		t.Errorf("DeleteAsset: %v", err)
+	}
+}
+
+func TestPower(t *testing.T) {
+	d := newTestDB(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// 1000 VA with no watt rating carries 600 W.
+	ups := &models.Asset{ID: "ups1", Type: models.AssetUPS, Name: "rack ups", Make: "APC", Model: "SMT1000",
+		VARating: 1000, RuntimeMinutes: 10, CreatedAt: now, UpdatedAt: now}
+	if err := d.CreateAsset(ups); err != nil {
+		t.Fatalf("CreateAsset: %v", err)
+	}
+
+	a := sampleMachine("a")
+	a.UPSID, a.IdleWatts, a.PeakWatts = "ups1", 100, 300
+	if err := d.Create(a, testActor); err != nil {
+		t.Fatalf("Create a: %v", err)
+	}
+	b := sampleMachine("b")
+	b.UPSID, b.RatedWatts = "ups1", 350
+	if err := d.Create(b, testActor); !errors.Is(err, db.ErrUPSOverCapacity) {
+		t.Fatalf("Create over capacity: got %v, want ErrUPSOverCapacity", err)
+	}
+	b.RatedWatts = 300
+	if err := d.Create(b, testActor); err != nil {
+		t.Fatalf("Create b at capacity: %v", err)
+	}
+	c := sampleMachine("c")
+	c.UPSID = "missing"
+	if err := d.Create(c, testActor); !errors.Is(err, db.ErrUPSNotFound) {
+		t.Errorf("Create on missing UPS: got %v, want ErrUPSNotFound", err)
+	}
+	// Retired machines are unplugged and do not count.
+	c.UPSID, c.PeakWatts, c.Status = "ups1", 500, models.StatusRetired
+	if err := d.Create(c, testActor); err != nil {
+		t.Fatalf("Create retired c: %v", err)
+	}
+	e := sampleMachine("e")
+	e.Circuit, e.RatedWatts = "garage-15a", 40
+	if err := d.Create(e, testActor); err != nil {
+		t.Fatalf("Create e: %v", err)
+	}
+
+	// The UPS cannot be downgraded below its load, nor deleted while in use.
+	ups.WattRating = 500
+	if err := d.UpdateAsset(ups); !errors.Is(err, db.ErrUPSOverCapacity) {
+		t.Errorf("UpdateAsset below load: got %v, want ErrUPSOverCapacity", err)
+	}
+	if err := d.DeleteAsset(models.AssetUPS, "ups1"); !errors.Is(err, db.ErrAssetInUse) {
+		t.Errorf("DeleteAsset in use: got %v, want ErrAssetInUse", err)
+	}
+
+	report, err := d.PowerReport()
+	if err != nil {
+		t.Fatalf("PowerReport: %v", err)
+	}
+	if len(report.UPS) != 1 {
+		t.Fatalf("UPS: got %d, want 1", len(report.UPS))
+	}
+	u := report.UPS[0]
+	if u.Machines != 2 || u.PeakWatts != 600 || u.IdleWatts != 400 || u.CapacityWatts != 600 ||
+		u.Utilization != 100 || u.EstimatedRuntimeMinutes != 10 {
+		t.Errorf("UPS load: got %+v", u)
+	}
+	if len(report.Circuits) != 1 || report.Circuits[0].Circuit != "garage-15a" || report.Circuits[0].PeakWatts != 40 {
+		t.Errorf("Circuits: got %+v", report.Circuits)
+	}
+
+	// A trashed machine frees its share until it is restored.
+	if err := d.Delete("b", 0, false, testActor); err != nil {
+		t.Fatalf("Delete b: %v", err)
+	}
+	f := sampleMachine("f")
+	f.UPSID, f.PeakWatts = "ups1", 200
+	if err := d.Create(f, testActor); err != nil {
+		t.Fatalf("Create f: %v", err)
+	}
+	if _, err := d.Restore("b", testActor); !errors.Is(err, db.ErrUPSOverCapacity) {
+		t.Errorf("Restore over capacity: got %v, want ErrUPSOverCapacity", err)
+	}
+}
+
+func sampleGuest(id, hostID, name string) *models.Guest {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &models.Guest{
+		ID:        id,
+		Name:      name,
+		Type:      models.GuestLXC,
+		HostID:    hostID,
+		VCPUs:     2,
+		RAMMB:     2048,
+		DiskGB:    16,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func TestGuests(t *testing.T) {
+	d := newTestDB(t)
+	for _, id := range []string{"pve1", "pve2"} {
+		if err := d.Create(sampleMachine(id), testActor); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	g := sampleGuest("g1", "pve1", "gitea")
+	if err := d.CreateGuest(g); err != nil {
+		t.Fatalf("CreateGuest: %v", err)
+	}
+	got, err := d.GetGuest("g1")
+	if err != nil {
+		t.Fatalf("GetGuest: %v", err)
+	}
+	if !reflect.DeepEqual(got, g) {
+		t.Errorf("GetGuest: got %+v, want %+v", got, g)
+	}
+
+	if err := d.CreateGuest(sampleGuest("g2", "pve1", "gitea")); !errors.Is(err, db.ErrGuestNameInUse) {
+		t.Errorf("duplicate name: got %v, want ErrGuestNameInUse", err)
+	}
+	if err := d.CreateGuest(sampleGuest("g2", "missing", "dns")); !errors.Is(err, db.ErrHostNotFound) {
+		t.Errorf("missing host: got %v, want ErrHostNotFound", err)
+	}
+	vm := sampleGuest("g2", "pve2", "gitea")
+	vm.Type = models.GuestVM
+	if err := d.CreateGuest(vm); err != nil {
+		t.Fatalf("CreateGuest on another host: %v", err)
+	}
+	list, err := d.ListGuests(db.GuestFilter{Type: models.GuestVM})
+	if err != nil || len(list) != 1 || list[0].ID != "g2" {
+		t.Errorf("ListGuests by type: got %v, %v", list, err)
+	}
+
+	// Migrating a guest to a host that already runs one with its name fails.
+	g.HostID = "pve2"
+	if err := d.UpdateGuest(g); !errors.Is(err, db.ErrGuestNameInUse) {
+		t.Errorf("UpdateGuest onto clashing host: got %v, want ErrGuestNameInUse", err)
+	}
+	if err := d.DeleteGuest("g2"); err != nil {
+		t.Fatalf("DeleteGuest: %v", err)
+	}
+	if err := d.UpdateGuest(g); err != nil {
+		t.Fatalf("UpdateGuest: %v", err)
+	}
+	list, err = d.ListGuests(db.GuestFilter{HostID: "pve2"})
+	if err != nil || len(list) != 1 || list[0].ID != "g1" {
+		t.Errorf("ListGuests by host: got %v, %v", list, err)
+	}
+	if err := d.DeleteGuest("g2"); err != sql.ErrNoRows {
+		t.Errorf("DeleteGuest twice: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestGuests_HostDeletion(t *testing.T) {
+	d := newTestDB(t)
+	if err := d.Create(sampleMachine("pve1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := d.CreateGuest(sampleGuest("g1", "pve1", "gitea")); err != nil {
+		t.Fatalf("CreateGuest: %v", err)
+	}
+
+	if err := d.Delete("pve1", 0, false, testActor); !errors.Is(err, db.ErrHasGuests) {
+		t.Fatalf("Delete host with guests: got %v, want ErrHasGuests", err)
+	}
+	if err := d.Delete("pve1", 0, true, testActor); err != nil {
+		t.Fatalf("forced Delete: %v", err)
+	}
+	// The guests go to the trash with their host and come back with it.
+	if _, err := d.GetGuest("g1"); err != sql.ErrNoRows {
+		t.Errorf("GetGuest on trashed host: got %v, want sql.ErrNoRows", err)
+	}
+	if err := d.CreateGuest(sampleGuest("g2", "pve1", "dns")); !errors.Is(err, db.ErrHostNotFound) {
+		t.Errorf("CreateGuest on trashed host: got %v, want ErrHostNotFound", err)
+	}
+	if _, err := d.Restore("pve1", testActor); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, err := d.GetGuest("g1"); err != nil {
+		t.Errorf("GetGuest after restore: %v", err)
+	}
+
+	if err := d.Delete("pve1", 0, true, testActor); err != nil {
+		t.Fatalf("forced Delete: %v", err)
+	}
+	if err := d.Purge("pve1", testActor); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if err := d.Create(sampleMachine("pve1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := d.GetGuest("g1"); err != sql.ErrNoRows {
+		t.Errorf("GetGuest after purge: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func sampleMaintenance(id, machineID, date string) *models.MaintenanceEvent {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &models.MaintenanceEvent{
+		ID:          id,
+		MachineID:   machineID,
+		Type:        models.MaintenanceRepair,
+		Description: "replace fan",
+		Date:        date,
+		Cost:        25,
+		Currency:    "USD",
+		PerformedBy: "tom",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	d := newTestDB(t)
+	if err := d.Create(sampleMachine("m1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	old := sampleMaintenance("e1", "m1", "2023-03-01")
+	old.CompletedDate = "2023-03-02"
+	if err := d.CreateMaintenance(old, testActor); err != nil {
+		t.Fatalf("CreateMaintenance: %v", err)
+	}
+	got, err := d.GetMaintenance("m1", "e1")
+	if err != nil {
+		t.Fatalf("GetMaintenance: %v", err)
+	}
+	if !reflect.DeepEqual(got, old) {
+		t.Errorf("GetMaintenance: got %+v, want %+v", got, old)
+	}
+	if err := d.CreateMaintenance(sampleMaintenance("e2", "m1", "2024-05-01"), testActor); err != nil {
+		t.Fatalf("CreateMaintenance: %v", err)
+	}
+	list, err := d.ListMaintenance("m1")
+	if err != nil || len(list) != 2 || list[0].ID != "e2" || list[1].ID != "e1" {
+		t.Errorf("ListMaintenance: got %v, %v, want newest first", list, err)
+	}
+	// Events that do not set the status leave the machine alone.
+	if m, _ := d.GetByID("m1"); m.Status != models.StatusActive || m.Revision != 1 {
+		t.Errorf("machine after plain events: status %q revision %d", m.Status, m.Revision)
+	}
+
+	if err := d.CreateMaintenance(sampleMaintenance("e3", "missing", "2024-05-01"), testActor); err != sql.ErrNoRows {
+		t.Errorf("CreateMaintenance on missing machine: got %v, want sql.ErrNoRows", err)
+	}
+	if _, err := d.GetMaintenance("other", "e1"); err != sql.ErrNoRows {
+		t.Errorf("GetMaintenance on wrong machine: got %v, want sql.ErrNoRows", err)
+	}
+	if err := d.DeleteMaintenance("m1", "e1", testActor); err != nil {
+		t.Fatalf("DeleteMaintenance: %v", err)
+	}
+	if err := d.DeleteMaintenance("m1", "e1", testActor); err != sql.ErrNoRows {
+		t.Errorf("DeleteMaintenance twice: got %v, want sql.ErrNoRows", err)
+	}
+
+	// A machine's log goes to the trash with it and is removed on purge.
+	if err := d.Delete("m1", 0, false, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := d.ListMaintenance("m1"); err != sql.ErrNoRows {
+		t.Errorf("ListMaintenance on trashed machine: got %v, want sql.ErrNoRows", err)
+	}
+	if err := d.Purge("m1", testActor); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if err := d.Create(sampleMachine("m1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if list, err := d.ListMaintenance("m1"); err != nil || len(list) != 0 {
+		t.Errorf("ListMaintenance after purge: got %v, %v", list, err)
+	}
+}
+
+func TestMaintenance_SetsStatus(t *testing.T) {
+	d := newTestDB(t)
+	if err := d.Create(sampleMachine("m1"), testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	first := sampleMaintenance("e1", "m1", "2024-05-01")
+	first.SetsStatus = true
+	second := sampleMaintenance("e2", "m1", "2024-05-02")
+	second.SetsStatus = true
+	for _, e := range []*models.MaintenanceEvent{first, second} {
+		if err := d.CreateMaintenance(e, testActor); err != nil {
+			t.Fatalf("CreateMaintenance: %v", err)
+		}
+	}
+	m, err := d.GetByID("m1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if m.Status != models.StatusMaintenance || m.StatusChangedAt.Before(m.CreatedAt) {
+		t.Errorf("status with open events: got %q changed at %v", m.Status, m.StatusChangedAt)
+	}
+
+	// The machine stays in maintenance until the last open event closes.
+	first.CompletedDate = "2024-05-03"
+	if err := d.UpdateMaintenance(first, testActor); err != nil {
+		t.Fatalf("UpdateMaintenance: %v", err)
+	}
+	if m, _ := d.GetByID("m1"); m.Status != models.StatusMaintenance {
+		t.Errorf("status with one open event: got %q, want maintenance", m.Status)
+	}
+	if err := d.DeleteMaintenance("m1", "e2", testActor); err != nil {
+		t.Fatalf("DeleteMaintenance: %v", err)
+	}
+	if m, _ := d.GetByID("m1"); m.Status != models.StatusActive {
+		t.Errorf("status with no open events: got %q, want active", m.Status)
+	}
+	history, err := d.History("m1")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if n := len(history); n != 3 || history[1].Changes["status"].After != models.StatusMaintenance ||
+		history[2].Changes["status"].After != models.StatusActive || history[2].Actor != testActor {
+		t.Errorf("History: got %d events %+v", n, history)
+	}
+
+	retired := sampleMachine("m2")
+	retired.Status = models.StatusRetired
+	if err := d.Create(retired, testActor); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	held := sampleMaintenance("e3", "m2", "2024-05-01")
+	held.SetsStatus = true
+	if err := d.CreateMaintenance(held, testActor); !errors.Is(err, db.ErrCannotHold) {
+		t.Errorf("open event on retired machine: got %v, want ErrCannotHold", err)
+	}
+	held.CompletedDate = "2024-05-01"
+	if err := d.CreateMaintenance(held, testActor); err != nil {
+		t.Errorf("closed event on retired machine: %v", err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	d := newTestDB(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	expires := now.Add(time.Hour)
+	ci := &models.APIToken{ID: "t1", Name: "atlantis", Scopes: []string{models.ScopeMachinesWrite}, CreatedAt: now}
+	grafana := &models.APIToken{ID: "t2", Name: "grafana", Scopes: []string{models.ScopeMachinesRead}, ExpiresAt: &expires, CreatedAt: now}
+	for _, tok := range []*models.APIToken{grafana, ci} {
+		if err := d.CreateToken(tok, "secret-"+tok.ID); err != nil {
+			t.Fatalf("CreateToken: %v", err)
+		}
+	}
+	dup := *ci
+	dup.ID = "t3"
+	if err := d.CreateToken(&dup, "secret-t3"); !errors.Is(err, db.ErrTokenNameInUse) {
+		t.Errorf("duplicate name: got %v, want ErrTokenNameInUse", err)
+	}
+
+	list, err := d.ListTokens()
+	if err != nil {
+		t.Fatalf("ListTokens: %v", err)
+	}
+	if len(list) != 2 || !reflect.DeepEqual(list[0], ci) || !reflect.DeepEqual(list[1], grafana) {
+		t.Errorf("ListTokens: got %+v", list)
+	}
+
+	got, err := d.AuthenticateToken("secret-t1", now)
+	if err != nil {
+		t.Fatalf("AuthenticateToken: %v", err)
+	}
+	if got.Name != "atlantis" || got.LastUsedAt == nil || !got.LastUsedAt.Equal(now) {
+		t.Errorf("AuthenticateToken: got %+v", got)
+	}
+	// Uses within a minute of the last do not move last_used_at.
+	if got, _ := d.AuthenticateToken("secret-t1", now.Add(30*time.Second)); got == nil || !got.LastUsedAt.Equal(now) {
+		t.Errorf("AuthenticateToken again: got %+v", got)
+	}
+	if _, err := d.AuthenticateToken("secret-t9", now); err != sql.ErrNoRows {
+		t.Errorf("unknown secret: got %v, want sql.ErrNoRows", err)
+	}
+	if _, err := d.AuthenticateToken("secret-t2", expires); err != sql.ErrNoRows {
+		t.Errorf("expired token: got %v, want sql.ErrNoRows", err)
+	}
+
+	if err := d.DeleteToken("t1"); err != nil {
+		t.Fatalf("DeleteToken: %v", err)
+	}
+	if _, err := d.AuthenticateToken("secret-t1", now); err != sql.ErrNoRows {
+		t.Errorf("revoked token: got %v, want sql.ErrNoRows", err)
+	}
+	if err := d.DeleteToken("t1"); err != sql.ErrNoRows {
+		t.Errorf("DeleteToken twice: got %v, want sql.ErrNoRows", err)
 	}
 }
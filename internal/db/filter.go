@@ -0,0 +1,264 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidFilter is returned by ParseFilter for an unknown field, an
+// unsupported operator, or a value that does not match the field's type.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+type fieldType int
+
+const (
+	textField fieldType = iota
+	intField
+	floatField
+	timeField
+	dateField
+)
+
+// filterFields maps every filterable machine field to its column type.
+var filterFields = map[string]fieldType{
+	"id":                  textField,
+	"name":                textField,
+	"kind":                textField,
+	"make":                textField,
+	"model":               textField,
+	"cpu":                 textField,
+	"cpu_cores":           intField,
+	"ram_gb":              intField,
+	"storage_tb":          floatField,
+	"location":            textField,
+	"serial":              textField,
+	"notes":               textField,
+	"parent_id":           textField,
+	"location_id":         textField,
+	"rack_u":              intField,
+	"u_height":            intField,
+	"purchase_date":       dateField,
+	"vendor":              textField,
+	"price":               floatField,
+	"currency":            textField,
+	"warranty_end":        dateField,
+	"lifetime_years":      intField,
+	"rated_watts":         intField,
+	"idle_watts":          intField,
+	"peak_watts":          intField,
+	"ups_id":              textField,
+	"circuit":             textField,
+	"reserved_cores":      intField,
+	"reserved_ram_gb":     intField,
+	"reserved_storage_tb": floatField,
+	"status":              textField,
+	"status_changed_at":   timeField,
+	"created_at":          timeField,
+	"updated_at":          timeField,
+	"deleted_at":          timeField,
+}
+
+// filterOps maps each operator to its SQL comparison. "prefix" and "in" are
+// rendered specially by Filter.sql.
+var filterOps = map[string]string{
+	"eq":     "=",
+	"ne":     "!=",
+	"lt":     "<",
+	"lte":    "<=",
+	"gt":     ">",
+	"gte":    ">=",
+	"prefix": "LIKE",
+	"in":     "IN",
+}
+
+// Filter is a single predicate on a machine column, e.g. ram_gb >= 32.
+// Filters are built with ParseFilter and ANDed together by List. The fields
+// are unexported so only validated column names ever reach the SQL text.
+type Filter struct {
+	field  string
+	op     string
+	values []any
+}
+
+// comparisons maps the symbolic comparison spellings to operators, longest
+// first so that ">=" is not read as ">".
+var comparisons = []struct{ symbol, op string }{
+	{">=", "gte"}, {"<=", "lte"}, {"!=", "ne"}, {">", "gt"}, {"<", "lt"},
+}
+
+// cutComparison splits a symbolic comparison such as ram_gb>=32 into field,
+// operator, and value. The query string has already been split at its first
+// '=', so ram_gb>=32 arrives as key "ram_gb>" with value "32" and ram_gb>32
+// as key "ram_gb>32" with no value; the two halves are rejoined first.
+func cutComparison(key, value string) (field, op, rest string, ok bool) {
+	i := strings.IndexAny(key, "<>!")
+	if i < 0 {
+		return "", "", "", false
+	}
+	expr := key
+	if value != "" || strings.ContainsAny(key[len(key)-1:], "<>!") {
+		expr += "=" + value
+	}
+	for _, c := range comparisons {
+		if strings.HasPrefix(expr[i:], c.symbol) {
+			return expr[:i], c.op, expr[i+len(c.symbol):], true
+		}
+	}
+	return expr[:i], expr[i : i+1], expr[i+1:], true
+}
+
+// ParseFilter parses one list query parameter into a Filter. The key is a
+// field name optionally followed by an operator in brackets, and defaults to
+// equality. The comparison operators may also be written as symbols, so
+// ram_gb>=32 is the same filter as ram_gb[gte]=32:
+//
+//	kind=proxmox               kind = 'proxmox'
+//	kind!=proxmox              kind != 'proxmox'
+//	ram_gb[gte]=32             ram_gb >= 32
+//	ram_gb>=32                 ram_gb >= 32
+//	cpu_cores>8                cpu_cores > 8
+//	storage_tb[lt]=2           storage_tb < 2
+//	location[prefix]=office    location LIKE 'office%'
+//	make[in]=Dell,HP           make IN ('Dell', 'HP')
+//	created_at[gte]=2025-01-01 created_at >= '2025-01-01T00:00:00Z'
+//
+// Timestamps accept RFC 3339 or a bare YYYY-MM-DD date (midnight UTC);
+// purchase_date and warranty_end are dates and accept only YYYY-MM-DD.
+// The prefix operator is only valid on text fields and, like SQLite's LIKE,
+// is case-insensitive for ASCII letters.
+//
+// Tags and labels live in side tables and have their own forms:
+//
+//	tag=gpu-passthrough        has the tag
+//	tag[in]=nvme,10gbe         has any of the tags
+//	label=env=prod             has label env with value prod
+//	label=env                  has label env with any value
+func ParseFilter(key, value string) (Filter, error) {
+	field, op := key, "eq"
+	if f, o, v, ok := cutComparison(key, value); ok {
+		field, op, value = f, o, v
+	} else if i := strings.IndexByte(key, '['); i >= 0 {
+		if !strings.HasSuffix(key, "]") {
+			return Filter{}, fmt.Errorf("%w: malformed parameter %q", ErrInvalidFilter, key)
+		}
+		field, op = key[:i], key[i+1:len(key)-1]
+	}
+
+	switch field {
+	case "tag":
+		switch op {
+		case "eq":
+			return Filter{field: field, op: op, values: []any{value}}, nil
+		case "in":
+			f := Filter{field: field, op: op}
+			for _, t := range strings.Split(value, ",") {
+				f.values = append(f.values, strings.TrimSpace(t))
+			}
+			return f, nil
+		}
+		return Filter{}, fmt.Errorf("%w: tag supports only eq and in, not %q", ErrInvalidFilter, op)
+	case "label":
+		if op != "eq" {
+			return Filter{}, fmt.Errorf("%w: label supports only eq, not %q", ErrInvalidFilter, op)
+		}
+		k, v, hasValue := strings.Cut(value, "=")
+		if k == "" {
+			return Filter{}, fmt.Errorf("%w: label must be key or key=value", ErrInvalidFilter)
+		}
+		if !hasValue {
+			return Filter{field: field, op: "exists", values: []any{k}}, nil
+		}
+		return Filter{field: field, op: op, values: []any{k, v}}, nil
+	}
+
+	typ, ok := filterFields[field]
+	if !ok {
+		return Filter{}, fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, field)
+	}
+	if _, ok := filterOps[op]; !ok {
+		return Filter{}, fmt.Errorf("%w: unknown operator %q for field %q", ErrInvalidFilter, op, field)
+	}
+	if op == "prefix" && typ != textField {
+		return Filter{}, fmt.Errorf("%w: prefix is only supported on text fields, not %q", ErrInvalidFilter, field)
+	}
+
+	raw := []string{value}
+	if op == "in" {
+		raw = strings.Split(value, ",")
+	}
+	f := Filter{field: field, op: op, values: make([]any, 0, len(raw))}
+	for _, r := range raw {
+		v, err := parseFilterValue(typ, strings.TrimSpace(r))
+		if err != nil {
+			return Filter{}, fmt.Errorf("%w: %s: %v", ErrInvalidFilter, field, err)
+		}
+		f.values = append(f.values, v)
+	}
+	return f, nil
+}
+
+func parseFilterValue(typ fieldType, s string) (any, error) {
+	switch typ {
+	case intField:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", s)
+		}
+		return n, nil
+	case floatField:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		return n, nil
+	case timeField:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an RFC 3339 timestamp or YYYY-MM-DD date", s)
+		}
+		// Stored timestamps are UTC RFC 3339 strings, which sort lexically.
+		return t.UTC().Format(time.RFC3339), nil
+	case dateField:
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a YYYY-MM-DD date", s)
+		}
+		return t.Format(time.DateOnly), nil
+	}
+	return s, nil
+}
+
+// sql renders f as a parameterized predicate. Field and operator have already
+// been validated against filterFields and filterOps, so only values are bound.
+func (f Filter) sql() (string, []any) {
+	switch f.field {
+	case "tag":
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(f.values)), ", ")
+		return fmt.Sprintf("id IN (SELECT machine_id FROM machine_tags WHERE tag IN (%s))", placeholders), f.values
+	case "label":
+		if f.op == "exists" {
+			return "id IN (SELECT machine_id FROM machine_labels WHERE key = ?)", f.values
+		}
+		return "id IN (SELECT machine_id FROM machine_labels WHERE key = ? AND value = ?)", f.values
+	}
+	switch f.op {
+	case "prefix":
+		return f.field + ` LIKE ? ESCAPE '\'`, []any{escapeLike(f.values[0].(string)) + "%"}
+	case "in":
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(f.values)), ", ")
+		return fmt.Sprintf("%s IN (%s)", f.field, placeholders), f.values
+	}
+	return fmt.Sprintf("%s %s ?", f.field, filterOps[f.op]), f.values
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
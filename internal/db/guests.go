@@ -0,0 +1,195 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+var (
+	// ErrHostNotFound is returned when a guest's host_id does not name a
+	// live machine.
+	ErrHostNotFound = errors.New("host not found")
+	// ErrGuestNameInUse is returned when the host already runs another guest
+	// with the same name.
+	ErrGuestNameInUse = errors.New("guest name already in use")
+	// ErrHasGuests is returned when deleting a machine that guests run on
+	// without forcing it.
+	ErrHasGuests = errors.New("machine has guests")
+)
+
+// migrateGuests creates the guests table. Guest names are unique per host.
+// Guests of a trashed host are hidden with it and deleted when it is purged.
+func migrateGuests(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS guests (
+			id         TEXT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			type       TEXT NOT NULL,
+			host_id    TEXT NOT NULL REFERENCES machines(id) ON DELETE CASCADE,
+			vcpus      INTEGER NOT NULL DEFAULT 0,
+			ram_mb     INTEGER NOT NULL DEFAULT 0,
+			disk_gb    INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			UNIQUE (host_id, name)
+		);
+	`)
+	return err
+}
+
+const guestColumns = `g.id, g.name, g.type, g.host_id, g.vcpus, g.ram_mb, g.disk_gb, g.created_at, g.updated_at`
+
+// liveGuests selects guests joined to their host, excluding hosts in the
+// trash. Callers append further conditions with AND.
+const liveGuests = `SELECT ` + guestColumns + ` FROM guests g
+	JOIN machines m ON m.id = g.host_id
+	WHERE m.deleted_at IS NULL`
+
+func scanGuest(row rowScanner) (*models.Guest, error) {
+	var g models.Guest
+	var createdAt, updatedAt string
+	if err := row.Scan(&g.ID, &g.Name, &g.Type, &g.HostID, &g.VCPUs, &g.RAMMB, &g.DiskGB, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	var err error
+	g.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
+	}
+	g.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse updated_at %q: %w", updatedAt, err)
+	}
+	return &g, nil
+}
+
+// GuestFilter restricts ListGuests. Empty fields match everything.
+type GuestFilter struct {
+	HostID string
+	Type   string
+}
+
+// ListGuests returns the guests matching f, ordered by name. Guests of
+// trashed hosts are not returned.
+func (d *DB) ListGuests(f GuestFilter) ([]*models.Guest, error) {
+	rows, err := d.conn.Query(liveGuests+`
+		AND (? = '' OR g.host_id = ?) AND (? = '' OR g.type = ?)
+		ORDER BY g.name, g.id`, f.HostID, f.HostID, f.Type, f.Type)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*models.Guest{}
+	for rows.Next() {
+		g, err := scanGuest(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// GetGuest returns the guest with the given ID, or sql.ErrNoRows if there is
+// none or its host is in the trash.
+func (d *DB) GetGuest(id string) (*models.Guest, error) {
+	return getGuest(d.conn, id)
+}
+
+func getGuest(q querier, id string) (*models.Guest, error) {
+	return scanGuest(q.QueryRow(liveGuests+` AND g.id = ?`, id))
+}
+
+// checkGuest returns ErrHostNotFound if g's host is not a live machine, and
+// ErrGuestNameInUse if another guest on the host already has g's name.
+func checkGuest(q querier, g *models.Guest) error {
+	if _, err := getMachine(q, g.HostID, false); errors.Is(err, sql.ErrNoRows) {
+		return ErrHostNotFound
+	} else if err != nil {
+		return err
+	}
+	var other string
+	err := q.QueryRow(`SELECT id FROM guests WHERE host_id = ? AND name = ? AND id != ?`,
+		g.HostID, g.Name, g.ID).Scan(&other)
+	if err == nil {
+		return ErrGuestNameInUse
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// checkNoGuests returns ErrHasGuests if any guest runs on the machine with
+// the given ID.
+func checkNoGuests(q querier, id string) error {
+	var n int
+	if err := q.QueryRow(`SELECT COUNT(*) FROM guests WHERE host_id = ?`, id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrHasGuests
+	}
+	return nil
+}
+
+// CreateGuest inserts a new guest. It returns ErrHostNotFound if its host is
+// missing or in the trash, and ErrGuestNameInUse on a name conflict.
+func (d *DB) CreateGuest(g *models.Guest) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if err := checkGuest(tx, g); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO guests (id, name, type, host_id, vcpus, ram_mb, disk_gb, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			g.ID, g.Name, g.Type, g.HostID, g.VCPUs, g.RAMMB, g.DiskGB,
+			g.CreatedAt.UTC().Format(time.RFC3339),
+			g.UpdatedAt.UTC().Format(time.RFC3339),
+		)
+		return err
+	})
+}
+
+// UpdateGuest replaces every client-supplied field of an existing guest,
+// including its host, so a migrated guest keeps its ID. CreatedAt is taken
+// from the stored row and written back to g. Returns sql.ErrNoRows if there
+// is no such guest, and the errors of CreateGuest.
+func (d *DB) UpdateGuest(g *models.Guest) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		existing, err := getGuest(tx, g.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkGuest(tx, g); err != nil {
+			return err
+		}
+		g.CreatedAt = existing.CreatedAt
+		_, err = tx.Exec(`
+			UPDATE guests
+			SET name = ?, type = ?, host_id = ?, vcpus = ?, ram_mb = ?, disk_gb = ?, updated_at = ?
+			WHERE id = ?`,
+			g.Name, g.Type, g.HostID, g.VCPUs, g.RAMMB, g.DiskGB,
+			g.UpdatedAt.UTC().Format(time.RFC3339),
+			g.ID,
+		)
+		return err
+	})
+}
+
+// DeleteGuest removes the guest with the given ID. Returns sql.ErrNoRows if
+// there is none or its host is in the trash.
+func (d *DB) DeleteGuest(id string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if _, err := getGuest(tx, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM guests WHERE id = ?`, id)
+		return err
+	})
+}
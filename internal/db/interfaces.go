@@ -0,0 +1,222 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+var (
+	// ErrMACInUse is returned when an interface's MAC address is already
+	// assigned to another interface.
+	ErrMACInUse = errors.New("mac address already in use")
+	// ErrInterfaceNameInUse is returned when the machine already has another
+	// interface with the same name.
+	ErrInterfaceNameInUse = errors.New("interface name already in use")
+)
+
+// migrateInterfaces creates the network_interfaces table. MAC addresses are
+// unique across the inventory and interface names are unique per machine.
+// Addresses are stored as a JSON array and searched with json_each.
+func migrateInterfaces(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS network_interfaces (
+			id         TEXT PRIMARY KEY,
+			machine_id TEXT NOT NULL REFERENCES machines(id) ON DELETE CASCADE,
+			name       TEXT NOT NULL,
+			mac        TEXT NOT NULL UNIQUE,
+			addresses  TEXT NOT NULL DEFAULT '[]',
+			vlan       INTEGER NOT NULL DEFAULT 0,
+			speed_mbps INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			UNIQUE (machine_id, name)
+		);
+	`)
+	return err
+}
+
+const interfaceColumns = `i.id, i.machine_id, i.name, i.mac, i.addresses, i.vlan, i.speed_mbps, i.created_at, i.updated_at`
+
+// liveInterfaces selects interfaces joined to their machine, excluding
+// machines in the trash. Callers append further conditions with AND.
+const liveInterfaces = `SELECT ` + interfaceColumns + ` FROM network_interfaces i
+	JOIN machines m ON m.id = i.machine_id
+	WHERE m.deleted_at IS NULL`
+
+func scanInterface(row rowScanner) (*models.NetworkInterface, error) {
+	var n models.NetworkInterface
+	var addresses, createdAt, updatedAt string
+	if err := row.Scan(&n.ID, &n.MachineID, &n.Name, &n.MAC, &addresses, &n.VLAN, &n.SpeedMbps, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(addresses), &n.Addresses); err != nil {
+		return nil, fmt.Errorf("parse addresses of interface %q: %w", n.ID, err)
+	}
+	if n.Addresses == nil {
+		n.Addresses = []string{}
+	}
+	var err error
+	n.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
+	}
+	n.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse updated_at %q: %w", updatedAt, err)
+	}
+	return &n, nil
+}
+
+func (d *DB) queryInterfaces(query string, args ...any) ([]*models.NetworkInterface, error) {
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*models.NetworkInterface{}
+	for rows.Next() {
+		n, err := scanInterface(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// ListInterfaces returns the interfaces of the machine with the given ID,
+// ordered by name. Returns sql.ErrNoRows if the machine does not exist or
+// is in the trash.
+func (d *DB) ListInterfaces(machineID string) ([]*models.NetworkInterface, error) {
+	if _, err := getMachine(d.conn, machineID, false); err != nil {
+		return nil, err
+	}
+	return d.queryInterfaces(liveInterfaces+` AND i.machine_id = ? ORDER BY i.name, i.id`, machineID)
+}
+
+// GetInterface returns one interface of a machine, or sql.ErrNoRows if the
+// machine has no such interface or is in the trash.
+func (d *DB) GetInterface(machineID, id string) (*models.NetworkInterface, error) {
+	return getInterface(d.conn, machineID, id)
+}
+
+func getInterface(q querier, machineID, id string) (*models.NetworkInterface, error) {
+	return scanInterface(q.QueryRow(liveInterfaces+` AND i.machine_id = ? AND i.id = ?`, machineID, id))
+}
+
+// InterfacesByMAC returns the interface with the given normalized MAC
+// address, as a list so it can share a response shape with
+// InterfacesByAddress. Interfaces of trashed machines are not returned.
+func (d *DB) InterfacesByMAC(mac string) ([]*models.NetworkInterface, error) {
+	return d.queryInterfaces(liveInterfaces+` AND i.mac = ? ORDER BY i.id`, mac)
+}
+
+// InterfacesByAddress returns every interface that has the given IP address
+// in canonical form. Interfaces of trashed machines are not returned.
+func (d *DB) InterfacesByAddress(addr string) ([]*models.NetworkInterface, error) {
+	return d.queryInterfaces(liveInterfaces+`
+		AND EXISTS (SELECT 1 FROM json_each(i.addresses) WHERE json_each.value = ?)
+		ORDER BY i.machine_id, i.name`, addr)
+}
+
+// checkInterfaceConflicts returns ErrMACInUse or ErrInterfaceNameInUse if
+// another interface already holds n's MAC or, on the same machine, its name.
+func checkInterfaceConflicts(q querier, n *models.NetworkInterface) error {
+	var other string
+	err := q.QueryRow(`SELECT id FROM network_interfaces WHERE mac = ? AND id != ?`, n.MAC, n.ID).Scan(&other)
+	if err == nil {
+		return ErrMACInUse
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	err = q.QueryRow(`SELECT id FROM network_interfaces WHERE machine_id = ? AND name = ? AND id != ?`,
+		n.MachineID, n.Name, n.ID).Scan(&other)
+	if err == nil {
+		return ErrInterfaceNameInUse
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// CreateInterface adds an interface to the machine n.MachineID. Returns
+// sql.ErrNoRows if the machine does not exist or is in the trash, and
+// ErrMACInUse or ErrInterfaceNameInUse on a conflict.
+func (d *DB) CreateInterface(n *models.NetworkInterface) error {
+	if n.Addresses == nil {
+		n.Addresses = []string{}
+	}
+	addresses, err := json.Marshal(n.Addresses)
+	if err != nil {
+		return err
+	}
+	return d.inTx(func(tx *sql.Tx) error {
+		if _, err := getMachine(tx, n.MachineID, false); err != nil {
+			return err
+		}
+		if err := checkInterfaceConflicts(tx, n); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO network_interfaces (id, machine_id, name, mac, addresses, vlan, speed_mbps, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			n.ID, n.MachineID, n.Name, n.MAC, string(addresses), n.VLAN, n.SpeedMbps,
+			n.CreatedAt.UTC().Format(time.RFC3339),
+			n.UpdatedAt.UTC().Format(time.RFC3339),
+		)
+		return err
+	})
+}
+
+// UpdateInterface replaces every client-supplied field of an existing
+// interface. CreatedAt is taken from the stored row and written back to n.
+// Returns sql.ErrNoRows if the interface does not exist on a live machine,
+// and ErrMACInUse or ErrInterfaceNameInUse on a conflict.
+func (d *DB) UpdateInterface(n *models.NetworkInterface) error {
+	if n.Addresses == nil {
+		n.Addresses = []string{}
+	}
+	addresses, err := json.Marshal(n.Addresses)
+	if err != nil {
+		return err
+	}
+	return d.inTx(func(tx *sql.Tx) error {
+		existing, err := getInterface(tx, n.MachineID, n.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkInterfaceConflicts(tx, n); err != nil {
+			return err
+		}
+		n.CreatedAt = existing.CreatedAt
+		_, err = tx.Exec(`
+			UPDATE network_interfaces
+			SET name = ?, mac = ?, addresses = ?, vlan = ?, speed_mbps = ?, updated_at = ?
+			WHERE id = ?`,
+			n.Name, n.MAC, string(addresses), n.VLAN, n.SpeedMbps,
+			n.UpdatedAt.UTC().Format(time.RFC3339),
+			n.ID,
+		)
+		return err
+	})
+}
+
+// DeleteInterface removes an interface from a machine. Returns
+// sql.ErrNoRows if the interface does not exist on a live machine.
+func (d *DB) DeleteInterface(machineID, id string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if _, err := getInterface(tx, machineID, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM network_interfaces WHERE id = ?`, id)
+		return err
+	})
+}
@@ -0,0 +1,344 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+var (
+	// ErrLocationNotFound is returned when a machine's location_id or a
+	// location's parent_id does not name an existing location.
+	ErrLocationNotFound = errors.New("location not found")
+	// ErrInvalidLocationParent is returned when a location's parent is not
+	// of the kind models.LocationParentKinds requires.
+	ErrInvalidLocationParent = errors.New("invalid location parent")
+	// ErrLocationNameInUse is returned when another location with the same
+	// parent already has the name, ignoring case.
+	ErrLocationNameInUse = errors.New("location name already in use")
+	// ErrLocationInUse is returned when deleting a location, or changing its
+	// kind, while other locations, machines, or assets refer to it.
+	ErrLocationInUse = errors.New("location is in use")
+	// ErrNotARack is returned when a machine has a rack_u but its location
+	// is not a rack.
+	ErrNotARack = errors.New("rack_u requires a rack location")
+	// ErrRackPositionOutOfRange is returned when a machine would extend
+	// past the top of its rack, or a rack is shortened below the machines
+	// placed in it.
+	ErrRackPositionOutOfRange = errors.New("rack position is outside the rack")
+	// ErrRackPositionTaken is returned when a machine's rack units overlap
+	// another live machine in the same rack.
+	ErrRackPositionTaken = errors.New("rack position overlaps another machine")
+	// ErrRackNameAmbiguous is returned by RackByName when racks in different
+	// rooms share the name.
+	ErrRackNameAmbiguous = errors.New("rack name is ambiguous")
+)
+
+// migrateLocations creates the locations table. Sibling names are unique
+// ignoring case so "office rack" and "Office Rack" cannot both exist. Sites
+// have no parent, and NULLs never collide in a unique index, so the index
+// coalesces a missing parent to the empty string.
+func migrateLocations(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS locations (
+			id         TEXT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			kind       TEXT NOT NULL,
+			parent_id  TEXT REFERENCES locations(id),
+			height_u   INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_locations_parent_name
+			ON locations(COALESCE(parent_id, ''), name COLLATE NOCASE);
+	`)
+	return err
+}
+
+const locationColumns = `id, name, kind, parent_id, height_u, created_at, updated_at`
+
+func scanLocation(row rowScanner) (*models.Location, error) {
+	var l models.Location
+	var parentID sql.NullString
+	var createdAt, updatedAt string
+	if err := row.Scan(&l.ID, &l.Name, &l.Kind, &parentID, &l.HeightU, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	l.ParentID = parentID.String
+	var err error
+	l.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
+	}
+	l.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse updated_at %q: %w", updatedAt, err)
+	}
+	return &l, nil
+}
+
+// LocationFilter restricts ListLocations. Empty fields match everything.
+type LocationFilter struct {
+	Kind     string
+	ParentID string
+}
+
+// ListLocations returns the locations matching f, ordered by name.
+func (d *DB) ListLocations(f LocationFilter) ([]*models.Location, error) {
+	rows, err := d.conn.Query(`SELECT `+locationColumns+` FROM locations
+		WHERE (? = '' OR kind = ?) AND (? = '' OR parent_id = ?)
+		ORDER BY name COLLATE NOCASE, id`, f.Kind, f.Kind, f.ParentID, f.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*models.Location{}
+	for rows.Next() {
+		l, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// GetLocation returns the location with the given ID, or sql.ErrNoRows.
+func (d *DB) GetLocation(id string) (*models.Location, error) {
+	return getLocation(d.conn, id)
+}
+
+func getLocation(q querier, id string) (*models.Location, error) {
+	return scanLocation(q.QueryRow(`SELECT `+locationColumns+` FROM locations WHERE id = ?`, id))
+}
+
+// checkLocation returns ErrLocationNotFound or ErrInvalidLocationParent if
+// l's parent is missing or of the wrong kind, and ErrLocationNameInUse if a
+// sibling already has its name.
+func checkLocation(q querier, l *models.Location) error {
+	want := models.LocationParentKinds[l.Kind]
+	if (want == "") != (l.ParentID == "") {
+		return ErrInvalidLocationParent
+	}
+	if l.ParentID != "" {
+		parent, err := getLocation(q, l.ParentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrLocationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if parent.Kind != want {
+			return ErrInvalidLocationParent
+		}
+	}
+	var n int
+	err := q.QueryRow(`SELECT COUNT(*) FROM locations
+		WHERE COALESCE(parent_id, '') = ? AND name = ? COLLATE NOCASE AND id != ?`,
+		l.ParentID, l.Name, l.ID).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrLocationNameInUse
+	}
+	return nil
+}
+
+// CreateLocation inserts a new location. It returns ErrLocationNotFound,
+// ErrInvalidLocationParent, or ErrLocationNameInUse if l does not fit under
+// its parent.
+func (d *DB) CreateLocation(l *models.Location) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if err := checkLocation(tx, l); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO locations (id, name, kind, parent_id, height_u, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			l.ID, l.Name, l.Kind, nullString(l.ParentID), l.HeightU,
+			l.CreatedAt.UTC().Format(time.RFC3339),
+			l.UpdatedAt.UTC().Format(time.RFC3339),
+		)
+		return err
+	})
+}
+
+// UpdateLocation replaces every client-supplied field of an existing
+// location. CreatedAt is taken from the stored row and written back to l.
+// Besides the errors of CreateLocation, it returns ErrLocationInUse when
+// changing the kind of a location that has children or machines, and
+// ErrRackPositionOutOfRange when shortening a rack below a machine placed in
+// it. Returns sql.ErrNoRows if the location does not exist.
+func (d *DB) UpdateLocation(l *models.Location) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		existing, err := getLocation(tx, l.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkLocation(tx, l); err != nil {
+			return err
+		}
+		if l.Kind != existing.Kind {
+			if err := checkLocationUnused(tx, l.ID); err != nil {
+				return err
+			}
+		}
+		if l.Kind == models.LocationRack {
+			var top int
+			if err := tx.QueryRow(`SELECT COALESCE(MAX(rack_u + u_height - 1), 0) FROM machines
+				WHERE location_id = ? AND rack_u > 0 AND deleted_at IS NULL`, l.ID).Scan(&top); err != nil {
+				return err
+			}
+			if top > l.HeightU {
+				return ErrRackPositionOutOfRange
+			}
+		}
+		l.CreatedAt = existing.CreatedAt
+		_, err = tx.Exec(`
+			UPDATE locations SET name = ?, kind = ?, parent_id = ?, height_u = ?, updated_at = ?
+			WHERE id = ?`,
+			l.Name, l.Kind, nullString(l.ParentID), l.HeightU,
+			l.UpdatedAt.UTC().Format(time.RFC3339),
+			l.ID,
+		)
+		return err
+	})
+}
+
+// checkLocationUnused returns ErrLocationInUse if any location, machine, or
+// asset, including machines in the trash, refers to the location with id.
+func checkLocationUnused(q querier, id string) error {
+	var n int
+	if err := q.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM locations WHERE parent_id = ?) +
+		(SELECT COUNT(*) FROM machines WHERE location_id = ?) +
+		(SELECT COUNT(*) FROM assets WHERE location_id = ?)`, id, id, id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrLocationInUse
+	}
+	return nil
+}
+
+// DeleteLocation removes a location. Returns ErrLocationInUse if other
+// locations, machines (including machines in the trash), or assets refer to
+// it, and sql.ErrNoRows if it does not exist.
+func (d *DB) DeleteLocation(id string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if _, err := getLocation(tx, id); err != nil {
+			return err
+		}
+		if err := checkLocationUnused(tx, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM locations WHERE id = ?`, id)
+		return err
+	})
+}
+
+// RackByName returns the rack with the given ID or, failing that, the rack
+// whose name matches ignoring case. Returns sql.ErrNoRows if there is no such
+// rack and ErrRackNameAmbiguous if several racks have the name.
+func (d *DB) RackByName(name string) (*models.Location, error) {
+	rows, err := d.conn.Query(`SELECT `+locationColumns+` FROM locations
+		WHERE kind = ? AND (id = ? OR name = ? COLLATE NOCASE)
+		ORDER BY id = ? DESC, id`, models.LocationRack, name, name, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var racks []*models.Location
+	for rows.Next() {
+		l, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		racks = append(racks, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(racks) == 0:
+		return nil, sql.ErrNoRows
+	case racks[0].ID == name, len(racks) == 1:
+		return racks[0], nil
+	}
+	return nil, ErrRackNameAmbiguous
+}
+
+// RackMachines returns the live machines mounted in the rack with the given
+// ID, ordered from the bottom unit up.
+func (d *DB) RackMachines(rackID string) ([]*models.Machine, error) {
+	rows, err := d.conn.Query(`SELECT `+machineColumns+` FROM machines
+		WHERE location_id = ? AND rack_u > 0 AND deleted_at IS NULL
+		ORDER BY rack_u`, rackID)
+	if err != nil {
+		return nil, err
+	}
+	machines := []*models.Machine{}
+	for rows.Next() {
+		m, err := scanMachine(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		machines = append(machines, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return machines, loadTagsLabels(d.conn, machines...)
+}
+
+// checkPlacement returns an error if m cannot be placed where it says: its
+// location must exist, and a rack position must lie within a rack without
+// overlapping another live machine. A machine with a rack_u and no u_height
+// occupies one unit; m.UHeight is updated to match.
+func checkPlacement(q querier, m *models.Machine) error {
+	if m.RackU > 0 && m.UHeight == 0 {
+		m.UHeight = 1
+	}
+	if m.LocationID == "" {
+		if m.RackU > 0 {
+			return ErrNotARack
+		}
+		return nil
+	}
+	loc, err := getLocation(q, m.LocationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLocationNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if m.RackU == 0 {
+		return nil
+	}
+	if loc.Kind != models.LocationRack {
+		return ErrNotARack
+	}
+	top := m.RackU + m.UHeight - 1
+	if top > loc.HeightU {
+		return ErrRackPositionOutOfRange
+	}
+	var n int
+	if err := q.QueryRow(`SELECT COUNT(*) FROM machines
+		WHERE location_id = ? AND id != ? AND deleted_at IS NULL AND rack_u > 0
+		  AND rack_u <= ? AND rack_u + u_height - 1 >= ?`,
+		m.LocationID, m.ID, top, m.RackU).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrRackPositionTaken
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// ErrCannotHold is returned when an open maintenance event that sets the
+// status is written for a machine whose status cannot move to maintenance,
+// such as one that is retired or not yet in service.
+var ErrCannotHold = errors.New("machine status cannot change to maintenance")
+
+// migrateMaintenance creates the maintenance_events table. A machine's
+// events are hidden while it is in the trash and deleted when it is purged.
+func migrateMaintenance(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS maintenance_events (
+			id             TEXT PRIMARY KEY,
+			machine_id     TEXT NOT NULL REFERENCES machines(id) ON DELETE CASCADE,
+			type           TEXT NOT NULL,
+			description    TEXT NOT NULL DEFAULT '',
+			date           TEXT NOT NULL,
+			completed_date TEXT NOT NULL DEFAULT '',
+			cost           REAL NOT NULL DEFAULT 0,
+			currency       TEXT NOT NULL DEFAULT '',
+			performed_by   TEXT NOT NULL DEFAULT '',
+			sets_status    BOOLEAN NOT NULL DEFAULT 0,
+			created_at     DATETIME NOT NULL,
+			updated_at     DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_maintenance_events_machine_id ON maintenance_events(machine_id, date);
+	`)
+	return err
+}
+
+const maintenanceColumns = `e.id, e.machine_id, e.type, e.description, e.date, e.completed_date, e.cost, e.currency, e.performed_by, e.sets_status, e.created_at, e.updated_at`
+
+// liveMaintenance selects maintenance events joined to their machine,
+// excluding machines in the trash. Callers append further conditions with
+// AND.
+const liveMaintenance = `SELECT ` + maintenanceColumns + ` FROM maintenance_events e
+	JOIN machines m ON m.id = e.machine_id
+	WHERE m.deleted_at IS NULL`
+
+func scanMaintenance(row rowScanner) (*models.MaintenanceEvent, error) {
+	var e models.MaintenanceEvent
+	var createdAt, updatedAt string
+	if err := row.Scan(&e.ID, &e.MachineID, &e.Type, &e.Description, &e.Date, &e.CompletedDate,
+		&e.Cost, &e.Currency, &e.PerformedBy, &e.SetsStatus, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	var err error
+	e.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
+	}
+	e.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse updated_at %q: %w", updatedAt, err)
+	}
+	return &e, nil
+}
+
+// ListMaintenance returns the maintenance events of the machine with the
+// given ID, newest first. Returns sql.ErrNoRows if the machine does not
+// exist or is in the trash.
+func (d *DB) ListMaintenance(machineID string) ([]*models.MaintenanceEvent, error) {
+	if _, err := getMachine(d.conn, machineID, false); err != nil {
+		return nil, err
+	}
+	rows, err := d.conn.Query(liveMaintenance+` AND e.machine_id = ?
+		ORDER BY e.date DESC, e.created_at DESC, e.id`, machineID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*models.MaintenanceEvent{}
+	for rows.Next() {
+		e, err := scanMaintenance(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// GetMaintenance returns one maintenance event of a machine, or
+// sql.ErrNoRows if the machine has no such event or is in the trash.
+func (d *DB) GetMaintenance(machineID, id string) (*models.MaintenanceEvent, error) {
+	return getMaintenance(d.conn, machineID, id)
+}
+
+func getMaintenance(q querier, machineID, id string) (*models.MaintenanceEvent, error) {
+	return scanMaintenance(q.QueryRow(liveMaintenance+` AND e.machine_id = ? AND e.id = ?`, machineID, id))
+}
+
+// holdsStatus reports whether e keeps its machine in maintenance.
+func holdsStatus(e *models.MaintenanceEvent) bool {
+	return e.SetsStatus && e.CompletedDate == ""
+}
+
+// syncMaintenanceStatus moves the live machine with the given ID into
+// maintenance if one of its open events sets the status and it is active.
+// If released is set, because an event that held the machine was closed or
+// removed, and no other event still holds it, a machine in maintenance goes
+// back to active. A status change is recorded as an update event for actor.
+func syncMaintenanceStatus(q querier, machineID, actor string, released bool) error {
+	before, err := getMachine(q, machineID, false)
+	if err != nil {
+		return err
+	}
+	var open int
+	if err := q.QueryRow(`
+		SELECT COUNT(*) FROM maintenance_events
+		WHERE machine_id = ? AND sets_status AND completed_date = ''`, machineID).Scan(&open); err != nil {
+		return err
+	}
+	m := *before
+	switch {
+	case open > 0 && m.Status == models.StatusActive:
+		m.Status = models.StatusMaintenance
+	case open == 0 && released && m.Status == models.StatusMaintenance:
+		m.Status = models.StatusActive
+	default:
+		return nil
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	m.StatusChangedAt, m.UpdatedAt = now, now
+	if err := updateMachine(q, &m); err != nil {
+		return err
+	}
+	return recordEvent(q, actor, models.OpUpdate, before, &m)
+}
+
+// checkCanHold returns sql.ErrNoRows if e's machine does not exist or is in
+// the trash, and ErrCannotHold if e holds the machine in maintenance but it
+// is neither in maintenance nor able to move there.
+func checkCanHold(q querier, e *models.MaintenanceEvent) error {
+	m, err := getMachine(q, e.MachineID, false)
+	if err != nil {
+		return err
+	}
+	if holdsStatus(e) && m.Status != models.StatusMaintenance &&
+		!slices.Contains(models.StatusTransitions[m.Status], models.StatusMaintenance) {
+		return ErrCannotHold
+	}
+	return nil
+}
+
+// CreateMaintenance adds a maintenance event to the machine e.MachineID. If
+// the event is open and sets the status, an active machine is moved to
+// maintenance, recorded as an update event for actor. Returns sql.ErrNoRows
+// if the machine does not exist or is in the trash, and ErrCannotHold if
+// its status cannot move to maintenance.
+func (d *DB) CreateMaintenance(e *models.MaintenanceEvent, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if err := checkCanHold(tx, e); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO maintenance_events (id, machine_id, type, description, date, completed_date, cost, currency, performed_by, sets_status, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.ID, e.MachineID, e.Type, e.Description, e.Date, e.CompletedDate,
+			e.Cost, e.Currency, e.PerformedBy, e.SetsStatus,
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			e.UpdatedAt.UTC().Format(time.RFC3339),
+		)
+		if err != nil {
+			return err
+		}
+		return syncMaintenanceStatus(tx, e.MachineID, actor, false)
+	})
+}
+
+// UpdateMaintenance replaces every client-supplied field of an existing
+// maintenance event. CreatedAt is taken from the stored row and written
+// back to e. Closing the last open event that held the machine in
+// maintenance returns it to active. Returns sql.ErrNoRows if the event does
+// not exist on a live machine, and ErrCannotHold as CreateMaintenance does.
+func (d *DB) UpdateMaintenance(e *models.MaintenanceEvent, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		existing, err := getMaintenance(tx, e.MachineID, e.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkCanHold(tx, e); err != nil {
+			return err
+		}
+		e.CreatedAt = existing.CreatedAt
+		_, err = tx.Exec(`
+			UPDATE maintenance_events
+			SET type = ?, description = ?, date = ?, completed_date = ?, cost = ?, currency = ?,
+			    performed_by = ?, sets_status = ?, updated_at = ?
+			WHERE id = ?`,
+			e.Type, e.Description, e.Date, e.CompletedDate, e.Cost, e.Currency,
+			e.PerformedBy, e.SetsStatus,
+			e.UpdatedAt.UTC().Format(time.RFC3339),
+			e.ID,
+		)
+		if err != nil {
+			return err
+		}
+		return syncMaintenanceStatus(tx, e.MachineID, actor, holdsStatus(existing) && !holdsStatus(e))
+	})
+}
+
+// DeleteMaintenance removes a maintenance event from a machine, returning
+// the machine to active if the event was the last one holding it in
+// maintenance. Returns sql.ErrNoRows if the event does not exist on a live
+// machine.
+func (d *DB) DeleteMaintenance(machineID, id, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		existing, err := getMaintenance(tx, machineID, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM maintenance_events WHERE id = ?`, id); err != nil {
+			return err
+		}
+		return syncMaintenanceStatus(tx, machineID, actor, holdsStatus(existing))
+	})
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+var (
+	// ErrUPSNotFound is returned when a machine's ups_id does not name a
+	// UPS asset.
+	ErrUPSNotFound = errors.New("ups not found")
+	// ErrUPSOverCapacity is returned when a machine write would put more
+	// peak load on a UPS than it can carry, or a UPS update would lower its
+	// capacity below the load already on it.
+	ErrUPSOverCapacity = errors.New("ups capacity exceeded")
+	// ErrAssetInUse is returned when deleting a UPS that machines, including
+	// machines in the trash, are still plugged into.
+	ErrAssetInUse = errors.New("asset is in use")
+)
+
+// drawsPower reports whether a machine in the given status counts towards
+// power budgets. Retired and sold machines are unplugged; planned and
+// ordered ones count so their power is reserved before they arrive.
+func drawsPower(status string) bool {
+	return status != models.StatusRetired && status != models.StatusSold
+}
+
+// checkPower returns ErrUPSNotFound if m.UPSID is set but does not name a
+// UPS, and ErrUPSOverCapacity if m's peak draw (see models.PowerDraw) would
+// take the UPS past its capacity together with the other live machines on
+// it.
+func checkPower(q querier, m *models.Machine) error {
+	if m.UPSID == "" {
+		return nil
+	}
+	ups, err := getAsset(q, models.AssetUPS, m.UPSID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUPSNotFound
+	}
+	if err != nil {
+		return err
+	}
+	peak, _ := models.PowerDraw(m)
+	if !drawsPower(m.Status) || peak == 0 {
+		return nil
+	}
+	load, err := upsLoad(q, ups.ID, m.ID)
+	if err != nil {
+		return err
+	}
+	return checkCapacity(ups, load+peak)
+}
+
+// checkCapacity returns ErrUPSOverCapacity, with the figures, if a peak load
+// of watts exceeds the capacity of ups.
+func checkCapacity(ups *models.Asset, watts int) error {
+	capacity := models.UPSCapacityWatts(ups)
+	if watts > capacity {
+		return fmt.Errorf("%w: %s would carry %d W at peak, more than its %d W", ErrUPSOverCapacity, ups.Name, watts, capacity)
+	}
+	return nil
+}
+
+// upsLoad returns the peak draw in watts of the live machines that draw
+// power from the UPS with upsID, leaving out the machine with exceptID.
+func upsLoad(q querier, upsID, exceptID string) (int, error) {
+	rows, err := q.Query(`SELECT rated_watts, idle_watts, peak_watts, status FROM machines
+		WHERE ups_id = ? AND id != ? AND deleted_at IS NULL`, upsID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var load int
+	for rows.Next() {
+		var m models.Machine
+		if err := rows.Scan(&m.RatedWatts, &m.IdleWatts, &m.PeakWatts, &m.Status); err != nil {
+			return 0, err
+		}
+		if drawsPower(m.Status) {
+			peak, _ := models.PowerDraw(&m)
+			load += peak
+		}
+	}
+	return load, rows.Err()
+}
+
+// PowerReport returns the load on every UPS, ordered by name, and on every
+// circuit, ordered by circuit name, counting the live machines that draw
+// power (see drawsPower). Machines on neither a UPS nor a circuit are
+// totalled under the empty circuit name, which sorts first.
+//
+// A UPS's estimated runtime scales its runtime at full load by the ratio of
+// its capacity to its peak load. Batteries last less than this at low loads,
+// so it is an upper bound.
+func (d *DB) PowerReport() (*models.PowerReport, error) {
+	upsUnits, err := d.ListAssets(models.AssetUPS)
+	if err != nil {
+		return nil, err
+	}
+	report := &models.PowerReport{UPS: []*models.UPSLoad{}, Circuits: []*models.CircuitLoad{}}
+	byUPS := map[string]*models.UPSLoad{}
+	runtimes := map[string]int{}
+	for _, u := range upsUnits {
+		l := &models.UPSLoad{ID: u.ID, Name: u.Name, LocationID: u.LocationID, CapacityWatts: models.UPSCapacityWatts(u)}
+		report.UPS = append(report.UPS, l)
+		byUPS[u.ID] = l
+		runtimes[u.ID] = u.RuntimeMinutes
+	}
+
+	rows, err := d.conn.Query(`SELECT COALESCE(ups_id, ''), circuit, rated_watts, idle_watts, peak_watts, status
+		FROM machines WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byCircuit := map[string]*models.CircuitLoad{}
+	for rows.Next() {
+		var m models.Machine
+		if err := rows.Scan(&m.UPSID, &m.Circuit, &m.RatedWatts, &m.IdleWatts, &m.PeakWatts, &m.Status); err != nil {
+			return nil, err
+		}
+		if !drawsPower(m.Status) {
+			continue
+		}
+		peak, idle := models.PowerDraw(&m)
+		if l, ok := byUPS[m.UPSID]; ok {
+			l.Machines++
+			l.PeakWatts += peak
+			l.IdleWatts += idle
+			continue
+		}
+		c, ok := byCircuit[m.Circuit]
+		if !ok {
+			c = &models.CircuitLoad{Circuit: m.Circuit}
+			byCircuit[m.Circuit] = c
+			report.Circuits = append(report.Circuits, c)
+		}
+		c.Machines++
+		c.PeakWatts += peak
+		c.IdleWatts += idle
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, l := range report.UPS {
+		if l.CapacityWatts > 0 {
+			l.Utilization = math.Round(float64(l.PeakWatts)/float64(l.CapacityWatts)*1000) / 10
+		}
+		if rt := runtimes[l.ID]; rt > 0 && l.PeakWatts > 0 {
+			l.EstimatedRuntimeMinutes = math.Round(float64(rt)*float64(l.CapacityWatts)/float64(l.PeakWatts)*10) / 10
+		}
+	}
+	sort.Slice(report.Circuits, func(i, j int) bool {
+		return report.Circuits[i].Circuit < report.Circuits[j].Circuit
+	})
+	return report, nil
+}
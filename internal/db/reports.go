@@ -0,0 +1,233 @@
+package db
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// WarrantyExpiring returns the live machines whose warranty ends on or after
+// from and on or before until, both YYYY-MM-DD dates, ordered by warranty
+// end and then name. Retired and sold machines are left out: their
+// warranties no longer need renewing.
+func (d *DB) WarrantyExpiring(from, until string) ([]*models.Machine, error) {
+	rows, err := d.conn.Query(`SELECT `+machineColumns+` FROM machines
+		WHERE deleted_at IS NULL AND status NOT IN (?, ?)
+		  AND warranty_end IS NOT NULL AND warranty_end >= ? AND warranty_end <= ?
+		ORDER BY warranty_end, name, id`,
+		models.StatusRetired, models.StatusSold, from, until)
+	if err != nil {
+		return nil, err
+	}
+	machines := []*models.Machine{}
+	for rows.Next() {
+		m, err := scanMachine(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		machines = append(machines, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return machines, loadTagsLabels(d.conn, machines...)
+}
+
+// Cost report groupings accepted by CostReport.
+const (
+	CostByKind     = "kind"
+	CostByLocation = "location"
+)
+
+// CostReport totals the purchase prices of live, unsold machines that have
+// a price, grouped by kind or by location (see CostByKind and
+// CostByLocation) and by currency, since prices in different currencies
+// cannot be added. Groups are ordered by kind or location name, then
+// currency.
+//
+// Each machine is depreciated on a straight line from its purchase date to
+// the end of its expected lifetime, as of asOf. A machine without a purchase
+// date or lifetime is not depreciated and counts at its full price.
+func (d *DB) CostReport(groupBy string, asOf time.Time) ([]*models.CostGroup, error) {
+	rows, err := d.conn.Query(`
+		SELECT m.kind, COALESCE(m.location_id, ''), COALESCE(l.name, ''), m.currency, m.price,
+		       COALESCE(m.purchase_date, ''), m.lifetime_years
+		FROM machines m LEFT JOIN locations l ON l.id = m.location_id
+		WHERE m.deleted_at IS NULL AND m.status != ? AND m.price > 0`, models.StatusSold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type key struct{ group, currency string }
+	groups := map[key]*models.CostGroup{}
+	for rows.Next() {
+		var (
+			kind, locationID, locationName, currency, purchased string
+			price                                               float64
+			lifetime                                            int
+		)
+		if err := rows.Scan(&kind, &locationID, &locationName, &currency, &price, &purchased, &lifetime); err != nil {
+			return nil, err
+		}
+		g := &models.CostGroup{Group: kind, Currency: currency}
+		if groupBy == CostByLocation {
+			g.Group, g.Name = locationID, locationName
+		}
+		k := key{g.Group, currency}
+		if existing, ok := groups[k]; ok {
+			g = existing
+		} else {
+			groups[k] = g
+		}
+		book, annual := depreciate(price, purchased, lifetime, asOf)
+		g.Machines++
+		g.TotalCost += price
+		g.BookValue += book
+		g.AnnualDepreciation += annual
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]*models.CostGroup, 0, len(groups))
+	for _, g := range groups {
+		g.TotalCost = roundCents(g.TotalCost)
+		g.BookValue = roundCents(g.BookValue)
+		g.AnnualDepreciation = roundCents(g.AnnualDepreciation)
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		case a.Group != b.Group:
+			return a.Group < b.Group
+		}
+		return a.Currency < b.Currency
+	})
+	return out, nil
+}
+
+// depreciate returns the straight-line book value of a machine bought for
+// price on purchased (YYYY-MM-DD) with an expected lifetime in years, as of
+// asOf, and the amount written off per year while it is still depreciating.
+// Nothing is written off until after the purchase date, so a machine bought
+// on or after asOf keeps its price and depreciates nothing yet. The machine
+// reaches zero on the anniversary of its purchase that ends its lifetime.
+func depreciate(price float64, purchased string, lifetime int, asOf time.Time) (book, annual float64) {
+	bought, err := time.Parse(time.DateOnly, purchased)
+	if err != nil || lifetime <= 0 {
+		return price, 0
+	}
+	end := bought.AddDate(lifetime, 0, 0)
+	elapsed := max(asOf.Sub(bought), 0)
+	switch {
+	case elapsed == 0:
+		return price, 0
+	case !asOf.Before(end):
+		return 0, 0
+	}
+	used := elapsed.Hours() / end.Sub(bought).Hours()
+	return price * (1 - used), price / float64(lifetime)
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// HypervisorKind is the machine kind the capacity report covers.
+const HypervisorKind = "proxmox"
+
+// CapacityReport sums the CPU cores, RAM, and storage of the active
+// hypervisor hosts, per host ordered by name, per location ordered by
+// location name, and overall. Hosts that are planned, ordered, in
+// maintenance, retired, or sold are left out: nothing can be placed on them.
+func (d *DB) CapacityReport() (*models.CapacityReport, error) {
+	rows, err := d.conn.Query(`
+		SELECT m.id, m.name, COALESCE(m.location_id, ''), COALESCE(l.name, ''),
+		       m.cpu_cores, m.ram_gb, m.storage_tb, m.reserved_cores, m.reserved_ram_gb, m.reserved_storage_tb
+		FROM machines m LEFT JOIN locations l ON l.id = m.location_id
+		WHERE m.deleted_at IS NULL AND m.kind = ? AND m.status = ?
+		ORDER BY m.name, m.id`, HypervisorKind, models.StatusActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &models.CapacityReport{
+		Kind:      HypervisorKind,
+		Hosts:     []*models.HostCapacity{},
+		Locations: []*models.LocationCapacity{},
+	}
+	byLocation := map[string]*models.LocationCapacity{}
+	for rows.Next() {
+		var h models.HostCapacity
+		var locationName string
+		if err := rows.Scan(&h.ID, &h.Name, &h.LocationID, &locationName,
+			&h.Total.CPUCores, &h.Total.RAMGB, &h.Total.StorageTB,
+			&h.Reserved.CPUCores, &h.Reserved.RAMGB, &h.Reserved.StorageTB); err != nil {
+			return nil, err
+		}
+		h.Available = subResources(h.Total, h.Reserved)
+		h.Available.StorageTB = roundTB(h.Available.StorageTB)
+		report.Hosts = append(report.Hosts, &h)
+
+		l, ok := byLocation[h.LocationID]
+		if !ok {
+			l = &models.LocationCapacity{LocationID: h.LocationID, Name: locationName}
+			byLocation[h.LocationID] = l
+			report.Locations = append(report.Locations, l)
+		}
+		addHost(&l.CapacityTotals, &h)
+		addHost(&report.Overall, &h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, l := range report.Locations {
+		roundTotals(&l.CapacityTotals)
+	}
+	roundTotals(&report.Overall)
+	sort.Slice(report.Locations, func(i, j int) bool {
+		a, b := report.Locations[i], report.Locations[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.LocationID < b.LocationID
+	})
+	return report, nil
+}
+
+func addHost(t *models.CapacityTotals, h *models.HostCapacity) {
+	t.Hosts++
+	t.Total = addResources(t.Total, h.Total)
+	t.Reserved = addResources(t.Reserved, h.Reserved)
+	t.Available = addResources(t.Available, h.Available)
+}
+
+func addResources(a, b models.Resources) models.Resources {
+	return models.Resources{CPUCores: a.CPUCores + b.CPUCores, RAMGB: a.RAMGB + b.RAMGB, StorageTB: a.StorageTB + b.StorageTB}
+}
+
+func subResources(a, b models.Resources) models.Resources {
+	return models.Resources{CPUCores: a.CPUCores - b.CPUCores, RAMGB: a.RAMGB - b.RAMGB, StorageTB: a.StorageTB - b.StorageTB}
+}
+
+func roundTotals(t *models.CapacityTotals) {
+	for _, r := range []*models.Resources{&t.Total, &t.Reserved, &t.Available} {
+		r.StorageTB = roundTB(r.StorageTB)
+	}
+}
+
+// roundTB rounds terabytes to the gigabyte, hiding the floating-point error
+// of adding and subtracting fractions.
+func roundTB(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"errors"
+	"html"
+	"strings"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+const (
+	// DefaultSearchLimit is the number of results Search returns when limit
+	// is zero.
+	DefaultSearchLimit = 20
+	// MaxSearchLimit is the largest number of results Search will return.
+	MaxSearchLimit = 100
+)
+
+// ErrEmptySearch is returned by Search when the query has no search terms.
+var ErrEmptySearch = errors.New("empty search query")
+
+// Snippets are highlighted with these control characters, which survive HTML
+// escaping, and only then given their <mark> tags.
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// snippetMarkup is applied to an HTML-escaped snippet.
+var snippetMarkup = strings.NewReplacer(snippetOpen, "<mark>", snippetClose, "</mark>")
+
+// highlight HTML-escapes a snippet so stored text cannot inject markup, then
+// turns the sentinels around matched terms into <mark> tags.
+func highlight(snippet string) string {
+	return snippetMarkup.Replace(html.EscapeString(snippet))
+}
+
+// matchQuery turns free-form user input into an FTS5 MATCH expression. Each
+// whitespace-separated term is quoted, so FTS5 operators and punctuation are
+// matched literally, and made a prefix query so "pve" finds "pve2". Terms are
+// implicitly ANDed.
+func matchQuery(q string) string {
+	terms := strings.Fields(q)
+	for i, t := range terms {
+		terms[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// Search runs a full-text query over name, make, model, cpu, serial, location,
+// and notes, returning the best matches first. Matches in name and serial are
+// weighted above the other columns. Each result carries an HTML-escaped
+// snippet of the best matching column with matched terms wrapped in <mark>
+// tags.
+func (d *DB) Search(q string, limit int) ([]*models.SearchResult, error) {
+	match := matchQuery(q)
+	if match == "" {
+		return nil, ErrEmptySearch
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	rows, err := d.conn.Query(`
+		SELECT `+machineColumns+`, f.score, f.snippet
+		FROM machines
+		JOIN (
+			SELECT rowid AS fts_rowid,
+				-bm25(machines_fts, 10.0, 2.0, 2.0, 1.0, 5.0, 1.0, 1.0) AS score,
+				snippet(machines_fts, -1, ?, ?, '…', 12) AS snippet
+			FROM machines_fts
+			WHERE machines_fts MATCH ?
+		) f ON machines.rowid = f.fts_rowid
+		WHERE machines.deleted_at IS NULL
+		ORDER BY f.score DESC, id
+		LIMIT ?`, snippetOpen, snippetClose, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.SearchResult
+	for rows.Next() {
+		var r models.SearchResult
+		m, err := scanMachine(rows, &r.Score, &r.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		r.Machine = m
+		r.Snippet = highlight(r.Snippet)
+		results = append(results, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	machines := make([]*models.Machine, len(results))
+	for i, r := range results {
+		machines[i] = r.Machine
+	}
+	return results, loadTagsLabels(d.conn, machines...)
+}
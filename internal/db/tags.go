@@ -0,0 +1,117 @@
+package db
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// migrateTags creates the side tables holding machine tags and labels. Rows
+// are removed with their machine by ON DELETE CASCADE.
+func migrateTags(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS machine_tags (
+			machine_id TEXT NOT NULL REFERENCES machines(id) ON DELETE CASCADE,
+			tag        TEXT NOT NULL,
+			PRIMARY KEY (machine_id, tag)
+		);
+		CREATE INDEX IF NOT EXISTS idx_machine_tags_tag ON machine_tags(tag, machine_id);
+		CREATE TABLE IF NOT EXISTS machine_labels (
+			machine_id TEXT NOT NULL REFERENCES machines(id) ON DELETE CASCADE,
+			key        TEXT NOT NULL,
+			value      TEXT NOT NULL,
+			PRIMARY KEY (machine_id, key)
+		);
+		CREATE INDEX IF NOT EXISTS idx_machine_labels_key_value ON machine_labels(key, value, machine_id);
+	`)
+	return err
+}
+
+// normalizeTags sorts tags and removes duplicates so they are stored and
+// returned in a stable order. It never returns nil.
+func normalizeTags(tags []string) []string {
+	out := slices.Clone(tags)
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if out == nil {
+		out = []string{}
+	}
+	return out
+}
+
+// writeTagsLabels replaces the stored tags and labels of m with its current
+// values, normalizing m.Tags and m.Labels in place.
+func writeTagsLabels(q querier, m *models.Machine) error {
+	m.Tags = normalizeTags(m.Tags)
+	if m.Labels == nil {
+		m.Labels = map[string]string{}
+	}
+
+	if _, err := q.Exec(`DELETE FROM machine_tags WHERE machine_id = ?`, m.ID); err != nil {
+		return err
+	}
+	if _, err := q.Exec(`DELETE FROM machine_labels WHERE machine_id = ?`, m.ID); err != nil {
+		return err
+	}
+	for _, t := range m.Tags {
+		if _, err := q.Exec(`INSERT INTO machine_tags (machine_id, tag) VALUES (?, ?)`, m.ID, t); err != nil {
+			return err
+		}
+	}
+	for k, v := range m.Labels {
+		if _, err := q.Exec(`INSERT INTO machine_labels (machine_id, key, value) VALUES (?, ?, ?)`, m.ID, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTagsLabels fills in Tags and Labels for machines with one query per
+// side table. Machines without any get an empty slice and map.
+func loadTagsLabels(q querier, machines ...*models.Machine) error {
+	if len(machines) == 0 {
+		return nil
+	}
+	byID := make(map[string]*models.Machine, len(machines))
+	ids := make([]any, 0, len(machines))
+	for _, m := range machines {
+		m.Tags = []string{}
+		m.Labels = map[string]string{}
+		byID[m.ID] = m
+		ids = append(ids, m.ID)
+	}
+	in := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")"
+
+	rows, err := q.Query(`SELECT machine_id, tag FROM machine_tags WHERE machine_id IN `+in+` ORDER BY tag`, ids...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			rows.Close()
+			return err
+		}
+		byID[id].Tags = append(byID[id].Tags, tag)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.Query(`SELECT machine_id, key, value FROM machine_labels WHERE machine_id IN `+in, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, k, v string
+		if err := rows.Scan(&id, &k, &v); err != nil {
+			return err
+		}
+		byID[id].Labels[k] = v
+	}
+	return rows.Err()
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// ErrTokenNameInUse is returned when another API token already has the name.
+var ErrTokenNameInUse = errors.New("token name already in use")
+
+// tokenUseResolution is how stale a token's last_used_at may get before a
+// request refreshes it, so a busy client does not write on every request.
+const tokenUseResolution = time.Minute
+
+// migrateTokens creates the tokens table. Only the SHA-256 hash of a
+// token's secret is stored; secrets are random, so a slow hash would add
+// nothing.
+func migrateTokens(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS tokens (
+			id           TEXT PRIMARY KEY,
+			name         TEXT NOT NULL UNIQUE,
+			hash         TEXT NOT NULL UNIQUE,
+			scopes       TEXT NOT NULL DEFAULT '[]',
+			expires_at   DATETIME,
+			last_used_at DATETIME,
+			created_at   DATETIME NOT NULL
+		);
+	`)
+	return err
+}
+
+const tokenColumns = `id, name, scopes, expires_at, last_used_at, created_at`
+
+// hashToken returns the stored form of a token secret.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func scanToken(row rowScanner) (*models.APIToken, error) {
+	var t models.APIToken
+	var scopes, createdAt string
+	var expiresAt, lastUsedAt sql.NullString
+	if err := row.Scan(&t.ID, &t.Name, &scopes, &expiresAt, &lastUsedAt, &createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &t.Scopes); err != nil {
+		return nil, fmt.Errorf("parse scopes of token %q: %w", t.ID, err)
+	}
+	var err error
+	t.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at %q: %w", createdAt, err)
+	}
+	for _, c := range []struct {
+		name  string
+		value sql.NullString
+		dst   **time.Time
+	}{
+		{"expires_at", expiresAt, &t.ExpiresAt},
+		{"last_used_at", lastUsedAt, &t.LastUsedAt},
+	} {
+		if !c.value.Valid {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, c.value.String)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s %q: %w", c.name, c.value.String, err)
+		}
+		*c.dst = &ts
+	}
+	return &t, nil
+}
+
+// nullTime returns t formatted for storage, or NULL if t is nil.
+func nullTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return nullString(t.UTC().Format(time.RFC3339))
+}
+
+// ListTokens returns every API token, including expired ones, ordered by
+// name.
+func (d *DB) ListTokens() ([]*models.APIToken, error) {
+	rows, err := d.conn.Query(`SELECT ` + tokenColumns + ` FROM tokens ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*models.APIToken{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// CreateToken stores t with the hash of secret. Returns ErrTokenNameInUse
+// if another token has t's name.
+func (d *DB) CreateToken(t *models.APIToken, secret string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM tokens WHERE name = ?`, t.Name).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrTokenNameInUse
+		}
+		scopes, err := json.Marshal(t.Scopes)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO tokens (id, name, hash, scopes, expires_at, last_used_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			t.ID, t.Name, hashToken(secret), string(scopes),
+			nullTime(t.ExpiresAt), nullTime(t.LastUsedAt),
+			t.CreatedAt.UTC().Format(time.RFC3339),
+		)
+		return err
+	})
+}
+
+// DeleteToken revokes the API token with the given ID. Returns sql.ErrNoRows
+// if there is none.
+func (d *DB) DeleteToken(id string) error {
+	res, err := d.conn.Exec(`DELETE FROM tokens WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AuthenticateToken returns the API token whose secret is secret, stamping
+// its last use with now. Returns sql.ErrNoRows if there is no such token or
+// it expired before now.
+func (d *DB) AuthenticateToken(secret string, now time.Time) (*models.APIToken, error) {
+	t, err := scanToken(d.conn.QueryRow(`SELECT `+tokenColumns+` FROM tokens WHERE hash = ?`, hashToken(secret)))
+	if err != nil {
+		return nil, err
+	}
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+	now = now.UTC().Truncate(time.Second)
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= tokenUseResolution {
+		if _, err := d.conn.Exec(`UPDATE tokens SET last_used_at = ? WHERE id = ?`,
+			now.Format(time.RFC3339), t.ID); err != nil {
+			return nil, err
+		}
+		t.LastUsedAt = &now
+	}
+	return t, nil
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// Restore moves the machine with the given ID out of the trash, bumps its
+// revision, and records a restore event for actor. A machine whose parent
+// is still in the trash cannot be restored before it and returns
+// ErrParentNotFound; one whose rack position has since been taken returns
+// ErrRackPositionTaken, and one whose UPS can no longer carry it returns
+// ErrUPSOverCapacity.
+// Returns sql.ErrNoRows if no such machine is in the trash.
+func (d *DB) Restore(id, actor string) (*models.Machine, error) {
+	var m *models.Machine
+	err := d.inTx(func(tx *sql.Tx) error {
+		before, err := getMachine(tx, id, true)
+		if err != nil {
+			return err
+		}
+		if err := checkParent(tx, before); err != nil {
+			return err
+		}
+		// Another machine may have taken its rack position in the meantime.
+		if err := checkPlacement(tx, before); err != nil {
+			return err
+		}
+		if err := checkPower(tx, before); err != nil {
+			return err
+		}
+		after := *before
+		after.DeletedAt = nil
+		after.Revision++
+		after.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+		if _, err := tx.Exec(`UPDATE machines SET deleted_at = NULL, revision = ?, updated_at = ? WHERE id = ?`,
+			after.Revision, after.UpdatedAt.Format(time.RFC3339), id); err != nil {
+			return err
+		}
+		m = &after
+		return recordEvent(tx, actor, models.OpRestore, before, &after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Purge permanently removes the machine with the given ID from the trash and
+// records a purge event for actor. Its history is kept.
+// Returns sql.ErrNoRows if no such machine is in the trash.
+func (d *DB) Purge(id, actor string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		return purgeMachine(tx, id, actor)
+	})
+}
+
+func purgeMachine(tx *sql.Tx, id, actor string) error {
+	before, err := getMachine(tx, id, true)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM machines WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return recordEvent(tx, actor, models.OpPurge, before, nil)
+}
+
+// PurgeDeletedBefore purges every machine that was moved to the trash before
+// cutoff, recording a purge event for actor on each, and returns how many
+// were removed. It is used by the trash retention sweeper.
+func (d *DB) PurgeDeletedBefore(cutoff time.Time, actor string) (int, error) {
+	var n int
+	err := d.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT id FROM machines WHERE deleted_at < ?`, cutoff.UTC().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := purgeMachine(tx, id, actor); err != nil {
+				return err
+			}
+		}
+		n = len(ids)
+		return nil
+	})
+	return n, err
+}
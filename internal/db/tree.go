@@ -0,0 +1,129 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+var (
+	// ErrParentNotFound is returned when a machine's parent_id does not name
+	// a live machine.
+	ErrParentNotFound = errors.New("parent machine not found")
+	// ErrParentCycle is returned when a parent_id would make a machine its
+	// own ancestor.
+	ErrParentCycle = errors.New("parent would create a cycle")
+	// ErrHasChildren is returned when deleting a machine that live machines
+	// are still placed in.
+	ErrHasChildren = errors.New("machine has child machines")
+)
+
+// nullString maps the empty string to NULL, for optional foreign keys.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// checkParent returns ErrParentNotFound if m.ParentID is set but does not
+// name a live machine, and ErrParentCycle if m is the parent or one of its
+// ancestors. The ancestors are walked with a recursive query; UNION rather
+// than UNION ALL stops the walk even if the stored tree already has a loop.
+func checkParent(q querier, m *models.Machine) error {
+	if m.ParentID == "" {
+		return nil
+	}
+	if m.ParentID == m.ID {
+		return ErrParentCycle
+	}
+	var n int
+	if err := q.QueryRow(`SELECT COUNT(*) FROM machines WHERE id = ? AND deleted_at IS NULL`, m.ParentID).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParentNotFound
+	}
+	err := q.QueryRow(`
+		WITH RECURSIVE ancestors(id) AS (
+			SELECT ?
+			UNION
+			SELECT m.parent_id FROM machines m JOIN ancestors a ON m.id = a.id
+			WHERE m.parent_id IS NOT NULL
+		)
+		SELECT COUNT(*) FROM ancestors WHERE id = ?`, m.ParentID, m.ID).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrParentCycle
+	}
+	return nil
+}
+
+// checkNoChildren returns ErrHasChildren if any live machine has id as its
+// parent.
+func checkNoChildren(q querier, id string) error {
+	var n int
+	if err := q.QueryRow(`SELECT COUNT(*) FROM machines WHERE parent_id = ? AND deleted_at IS NULL`, id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrHasChildren
+	}
+	return nil
+}
+
+// ChildrenFilter returns a list filter matching the machines whose parent is
+// id, for use with List.
+func ChildrenFilter(id string) Filter {
+	return Filter{field: "parent_id", op: "eq", values: []any{id}}
+}
+
+// Tree returns the live machine with the given ID and, recursively, every
+// live machine placed in it. Returns sql.ErrNoRows if the machine does not
+// exist or is in the trash.
+func (d *DB) Tree(id string) (*models.MachineTree, error) {
+	rows, err := d.conn.Query(`
+		WITH RECURSIVE tree(id) AS (
+			SELECT id FROM machines WHERE id = ? AND deleted_at IS NULL
+			UNION
+			SELECT m.id FROM machines m JOIN tree t ON m.parent_id = t.id
+			WHERE m.deleted_at IS NULL
+		)
+		SELECT `+machineColumns+` FROM machines WHERE id IN (SELECT id FROM tree)
+		ORDER BY name, id`, id)
+	if err != nil {
+		return nil, err
+	}
+	var machines []*models.Machine
+	for rows.Next() {
+		m, err := scanMachine(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		machines = append(machines, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadTagsLabels(d.conn, machines...); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*models.MachineTree, len(machines))
+	for _, m := range machines {
+		nodes[m.ID] = &models.MachineTree{Machine: m, Children: []*models.MachineTree{}}
+	}
+	root, ok := nodes[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	// machines is sorted by name, so children are appended in name order.
+	for _, m := range machines {
+		if parent, ok := nodes[m.ParentID]; ok && m.ID != id {
+			parent.Children = append(parent.Children, nodes[m.ID])
+		}
+	}
+	return root, nil
+}
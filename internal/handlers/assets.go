@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// maxPortCount bounds a switch's port_count.
+const maxPortCount = 1024
+
+// validateAsset checks the fields a client supplies on create and update of
+// an asset of type t. It lower-cases, sorts, and de-duplicates radio bands.
+// It returns nil if a may be stored.
+func validateAsset(t models.AssetType, a *models.Asset) error {
+	if a.Name == "" {
+		return validationError("name is required")
+	}
+	if a.Make == "" {
+		return validationError("make is required")
+	}
+	if a.Model == "" {
+		return validationError("model is required")
+	}
+
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"port_count", a.PortCount != 0},
+		{"va_rating", a.VARating != 0},
+		{"watt_rating", a.WattRating != 0},
+		{"runtime_minutes", a.RuntimeMinutes != 0},
+		{"radio_bands", len(a.RadioBands) > 0},
+	} {
+		if f.set && !slices.Contains(t.Fields, f.name) {
+			return validationError(fmt.Sprintf("%s does not apply to a %s", f.name, t.Name))
+		}
+	}
+
+	switch t.Name {
+	case models.AssetSwitch:
+		if a.PortCount < 1 || a.PortCount > maxPortCount {
+			return validationError(fmt.Sprintf("port_count must be between 1 and %d", maxPortCount))
+		}
+	case models.AssetUPS:
+		if a.VARating < 1 {
+			return validationError("va_rating must be positive")
+		}
+		if a.WattRating < 0 || a.WattRating > a.VARating {
+			return validationError("watt_rating must be between 0 and va_rating")
+		}
+		if a.RuntimeMinutes < 0 {
+			return validationError("runtime_minutes must not be negative")
+		}
+	case models.AssetAccessPoint:
+		if len(a.RadioBands) == 0 {
+			return validationError("radio_bands is required")
+		}
+		for i, b := range a.RadioBands {
+			b = strings.ToLower(b)
+			if !models.ValidRadioBands[b] {
+				return validationError("invalid radio band: must be 2.4ghz, 5ghz, or 6ghz")
+			}
+			a.RadioBands[i] = b
+		}
+		slices.Sort(a.RadioBands)
+		a.RadioBands = slices.Compact(a.RadioBands)
+	}
+	return nil
+}
+
+// writeAssetError maps the errors returned by asset writes to a response.
+// notFound is the message used for sql.ErrNoRows.
+func writeAssetError(w http.ResponseWriter, err error, notFound, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, notFound)
+	case errors.Is(err, db.ErrLocationNotFound):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, db.ErrUPSOverCapacity):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, db.ErrAssetInUse):
+		writeError(w, http.StatusConflict, "ups still powers machines; move them first")
+	default:
+		writeError(w, http.StatusInternalServerError, failed)
+	}
+}
+
+// ListAssets returns the handler for GET /api/v1/{path} of asset type t.
+func (h *Handler) ListAssets(t models.AssetType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assets, err := h.DB.ListAssets(t.Name)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to list "+t.Path)
+			return
+		}
+		writeJSON(w, http.StatusOK, models.AssetList{Assets: assets})
+	}
+}
+
+// CreateAsset returns the handler for POST /api/v1/{path} of asset type t.
+// The type comes from the path; a type in the body is ignored.
+func (h *Handler) CreateAsset(t models.AssetType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.Asset
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if err := validateAsset(t, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		now := time.Now().UTC()
+		req.ID = uuid.New().String()
+		req.Type = t.Name
+		req.CreatedAt = now
+		req.UpdatedAt = now
+
+		if err := h.DB.CreateAsset(&req); err != nil {
+			writeAssetError(w, err, t.Name+" not found", "failed to create "+t.Name)
+			return
+		}
+		writeJSON(w, http.StatusCreated, req)
+	}
+}
+
+// GetAsset returns the handler for GET /api/v1/{path}/{id} of asset type t.
+func (h *Handler) GetAsset(t models.AssetType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a, err := h.DB.GetAsset(t.Name, r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, t.Name+" not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to get "+t.Name)
+			return
+		}
+		writeJSON(w, http.StatusOK, a)
+	}
+}
+
+// UpdateAsset returns the handler for PUT /api/v1/{path}/{id} of asset type
+// t, which replaces every client-supplied field.
+func (h *Handler) UpdateAsset(t models.AssetType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.Asset
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if err := validateAsset(t, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		req.ID = r.PathValue("id")
+		req.Type = t.Name
+		req.UpdatedAt = time.Now().UTC()
+
+		if err := h.DB.UpdateAsset(&req); err != nil {
+			writeAssetError(w, err, t.Name+" not found", "failed to update "+t.Name)
+			return
+		}
+		writeJSON(w, http.StatusOK, req)
+	}
+}
+
+// DeleteAsset returns the handler for DELETE /api/v1/{path}/{id} of asset
+// type t. A UPS that machines draw power from answers 409.
+func (h *Handler) DeleteAsset(t models.AssetType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.DB.DeleteAsset(t.Name, r.PathValue("id")); err != nil {
+			writeAssetError(w, err, t.Name+" not found", "failed to delete "+t.Name)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// createTestAsset POSTs payload to the asset collection at path and returns
+// the created record, failing the test on any non-201 response.
+func createTestAsset(t *testing.T, mux http.Handler, path string, payload map[string]any) models.Asset {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	w := serve(mux, authReq(http.MethodPost, "/api/v1/"+path, body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create %s: got %d, want 201\nbody: %s", path, w.Code, w.Body.String())
+	}
+	var a models.Asset
+	decodeBody(t, w, &a)
+	return a
+}
+
+func TestAssets_CRUD(t *testing.T) {
+	mux, _ := newTestMux(t)
+	site := createTestLocation(t, mux, map[string]any{"name": "home", "kind": "site"})
+
+	sw := createTestAsset(t, mux, "switches", map[string]any{
+		"name": "core", "make": "MikroTik", "model": "CRS309", "port_count": 9, "location_id": site.ID,
+		"type": "ups",
+	})
+	if sw.ID == "" || sw.Type != models.AssetSwitch || sw.PortCount != 9 || sw.LocationID != site.ID {
+		t.Errorf("created switch: %+v", sw)
+	}
+	ups := createTestAsset(t, mux, "ups", map[string]any{
+		"name": "rack ups", "make": "APC", "model": "SMT1500", "va_rating": 1500, "runtime_minutes": 12,
+	})
+	if ups.Type != models.AssetUPS || ups.VARating != 1500 || ups.RuntimeMinutes != 12 {
+		t.Errorf("created ups: %+v", ups)
+	}
+	ap := createTestAsset(t, mux, "accesspoints", map[string]any{
+		"name": "hallway", "make": "Ubiquiti", "model": "U6 Pro", "radio_bands": []string{"5GHz", "2.4ghz", "5ghz"},
+	})
+	if !slices.Equal(ap.RadioBands, []string{"2.4ghz", "5ghz"}) {
+		t.Errorf("radio_bands: got %v, want [2.4ghz 5ghz]", ap.RadioBands)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/switches", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: got %d, want 200", w.Code)
+	}
+	var list models.AssetList
+	decodeBody(t, w, &list)
+	if len(list.Assets) != 1 || list.Assets[0].ID != sw.ID {
+		t.Fatalf("list switches: got %+v, want only the switch", list.Assets)
+	}
+
+	// An asset is only reachable through its own type's endpoints.
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/ups/"+sw.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("get switch as ups: got %d, want 404", w.Code)
+	}
+
+	body, _ := json.Marshal(map[string]any{"name": "core", "make": "MikroTik", "model": "CRS326", "port_count": 26})
+	w = serve(mux, authReq(http.MethodPut, "/api/v1/switches/"+sw.ID, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/switches/"+sw.ID, nil))
+	var got models.Asset
+	decodeBody(t, w, &got)
+	if got.Model != "CRS326" || got.PortCount != 26 || got.LocationID != "" || got.CreatedAt.Unix() != sw.CreatedAt.Unix() {
+		t.Errorf("updated: %+v", got)
+	}
+
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/accesspoints/"+ap.ID, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d, want 204", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/accesspoints/"+ap.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: got %d, want 404", w.Code)
+	}
+}
+
+func TestAssets_Validation(t *testing.T) {
+	mux, _ := newTestMux(t)
+	cases := []struct {
+		name, path string
+		payload    map[string]any
+	}{
+		{"missing name", "switches", map[string]any{"make": "m", "model": "m", "port_count": 8}},
+		{"missing model", "ups", map[string]any{"name": "n", "make": "m", "va_rating": 600}},
+		{"no ports", "switches", map[string]any{"name": "n", "make": "m", "model": "m"}},
+		{"too many ports", "switches", map[string]any{"name": "n", "make": "m", "model": "m", "port_count": 5000}},
+		{"switch with va_rating", "switches", map[string]any{"name": "n", "make": "m", "model": "m", "port_count": 8, "va_rating": 600}},
+		{"no va_rating", "ups", map[string]any{"name": "n", "make": "m", "model": "m", "runtime_minutes": 5}},
+		{"negative runtime", "ups", map[string]any{"name": "n", "make": "m", "model": "m", "va_rating": 600, "runtime_minutes": -1}},
+		{"watts above va", "ups", map[string]any{"name": "n", "make": "m", "model": "m", "va_rating": 600, "watt_rating": 700}},
+		{"ups with bands", "ups", map[string]any{"name": "n", "make": "m", "model": "m", "va_rating": 600, "radio_bands": []string{"5ghz"}}},
+		{"no bands", "accesspoints", map[string]any{"name": "n", "make": "m", "model": "m"}},
+		{"bad band", "accesspoints", map[string]any{"name": "n", "make": "m", "model": "m", "radio_bands": []string{"60ghz"}}},
+		{"ap with ports", "accesspoints", map[string]any{"name": "n", "make": "m", "model": "m", "radio_bands": []string{"5ghz"}, "port_count": 1}},
+		{"unknown location", "switches", map[string]any{"name": "n", "make": "m", "model": "m", "port_count": 8, "location_id": "nope"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.payload)
+			w := serve(mux, authReq(http.MethodPost, "/api/v1/"+tc.path, body))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("got %d, want 400\nbody: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAssets_LocationInUse(t *testing.T) {
+	mux, _ := newTestMux(t)
+	site := createTestLocation(t, mux, map[string]any{"name": "home", "kind": "site"})
+	createTestAsset(t, mux, "ups", map[string]any{"name": "u", "make": "APC", "model": "BX", "va_rating": 600, "location_id": site.ID})
+
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/locations/"+site.ID, nil)); w.Code != http.StatusConflict {
+		t.Errorf("delete location holding an asset: got %d, want 409", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// MachineHistory handles GET /api/v1/machines/{id}/history. It returns every
+// recorded change to the machine, oldest first, including for machines that
+// have since been deleted.
+func (h *Handler) MachineHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	events, err := h.DB.History(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get machine history")
+		return
+	}
+	if len(events) == 0 {
+		// Machines created before the audit log existed have no events.
+		if _, err := h.DB.GetByID(id); errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "machine not found")
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to get machine history")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, models.EventList{Events: events})
+}
+
+// Audit handles GET /api/v1/audit. since and until bound the event time to
+// [since, until) and accept RFC 3339 or YYYY-MM-DD. Results are paginated
+// with limit and cursor like ListMachines.
+func (h *Handler) Audit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := db.AuditOptions{Cursor: q.Get("cursor")}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > db.MaxListLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", db.MaxListLimit))
+			return
+		}
+		opts.Limit = limit
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &opts.Since}, {"until", &opts.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, p.name+" must be an RFC 3339 timestamp or YYYY-MM-DD date")
+			return
+		}
+		*p.dst = t
+	}
+
+	events, next, err := h.DB.Audit(opts)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.EventList{Events: events, NextCursor: next})
+}
+
+// parseTime accepts an RFC 3339 timestamp or a bare YYYY-MM-DD date, which
+// is taken as midnight UTC.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
@@ -0,0 +1,117 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/middleware"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+func TestMachineHistory(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{
+		"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R720", "ram_gb": 64,
+	})
+	path := "/api/v1/machines/" + created.ID
+	if w := serve(mux, patchReq(path, `{"ram_gb": 128}`)); w.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(mux, authReq(http.MethodDelete, path, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+
+	// History outlives the machine.
+	w := serve(mux, authReq(http.MethodGet, path+"/history", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var got models.EventList
+	decodeBody(t, w, &got)
+
+	ops := []string{models.OpCreate, models.OpUpdate, models.OpDelete}
+	if len(got.Events) != len(ops) {
+		t.Fatalf("events: got %d, want %d", len(got.Events), len(ops))
+	}
+	for i, e := range got.Events {
+		if e.Operation != ops[i] {
+			t.Errorf("event %d operation: got %q, want %q", i, e.Operation, ops[i])
+		}
+		if e.Actor != middleware.StaticTokenIdentity {
+			t.Errorf("event %d actor: got %q, want %q", i, e.Actor, middleware.StaticTokenIdentity)
+		}
+	}
+	want := models.FieldChange{Before: 64.0, After: 128.0}
+	if len(got.Events[1].Changes) != 1 || got.Events[1].Changes["ram_gb"] != want {
+		t.Errorf("update changes: got %v, want only ram_gb %v", got.Events[1].Changes, want)
+	}
+}
+
+func TestMachineHistory_NotFound(t *testing.T) {
+	mux, _ := newTestMux(t)
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/ghost/history", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status: got %d, want 404", w.Code)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	mux, _ := newTestMux(t)
+	for _, name := range []string{"pve1", "pve2", "pve3"} {
+		createTestMachine(t, mux, map[string]any{"name": name, "kind": "proxmox", "make": "Dell", "model": "R720"})
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/audit?limit=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var page models.EventList
+	decodeBody(t, w, &page)
+	if len(page.Events) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page: got %d events, cursor %q", len(page.Events), page.NextCursor)
+	}
+
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/audit?limit=2&cursor="+page.NextCursor, nil))
+	var last models.EventList
+	decodeBody(t, w, &last)
+	if len(last.Events) != 1 || last.NextCursor != "" {
+		t.Fatalf("second page: got %d events, cursor %q", len(last.Events), last.NextCursor)
+	}
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format(time.DateOnly)
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"since=2000-01-01", 3},
+		{"since=" + tomorrow, 0},
+		{"until=2000-01-01T00:00:00Z", 0},
+		{"since=2000-01-01&until=" + tomorrow, 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodGet, "/api/v1/audit?"+tc.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+			}
+			var got models.EventList
+			decodeBody(t, w, &got)
+			if len(got.Events) != tc.want {
+				t.Errorf("events: got %d, want %d", len(got.Events), tc.want)
+			}
+		})
+	}
+}
+
+func TestAudit_BadRequest(t *testing.T) {
+	mux, _ := newTestMux(t)
+	for _, query := range []string{"since=yesterday", "until=2025-13-01", "limit=0", "cursor=***"} {
+		t.Run(query, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodGet, "/api/v1/audit?"+query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status: got %d, want 400", w.Code)
+			}
+		})
+	}
+}
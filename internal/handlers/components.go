@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// validateComponent checks the fields a client supplies on create and
+// update. It returns nil if c may be stored.
+func validateComponent(c *models.Component) error {
+	if c.Type == "" {
+		return validationError("type is required")
+	}
+	if !models.ValidComponentTypes[c.Type] {
+		return validationError("invalid type: must be disk, dimm, gpu, nic, or other")
+	}
+	if c.CapacityGB < 0 {
+		return validationError("capacity_gb must not be negative")
+	}
+	return nil
+}
+
+// writeComponentError maps the errors returned by component writes to a
+// response. notFound is the message used for sql.ErrNoRows.
+func writeComponentError(w http.ResponseWriter, err error, notFound, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, notFound)
+	case errors.Is(err, db.ErrMoveTargetNotFound):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, db.ErrComponentSerialInUse), errors.Is(err, db.ErrSlotInUse):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, failed)
+	}
+}
+
+// ListComponents handles GET /api/v1/machines/{id}/components.
+func (h *Handler) ListComponents(w http.ResponseWriter, r *http.Request) {
+	components, err := h.DB.ListComponents(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "machine not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list components")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.ComponentList{Components: components})
+}
+
+// CreateComponent handles POST /api/v1/machines/{id}/components.
+func (h *Handler) CreateComponent(w http.ResponseWriter, r *http.Request) {
+	var req models.Component
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateComponent(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	req.ID = uuid.New().String()
+	req.MachineID = r.PathValue("id")
+	req.CreatedAt = now
+	req.UpdatedAt = now
+
+	if err := h.DB.CreateComponent(&req, actor(r)); err != nil {
+		writeComponentError(w, err, "machine not found", "failed to create component")
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// GetComponent handles GET /api/v1/machines/{id}/components/{component}.
+func (h *Handler) GetComponent(w http.ResponseWriter, r *http.Request) {
+	c, err := h.DB.GetComponent(r.PathValue("id"), r.PathValue("component"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "component not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get component")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// UpdateComponent handles PUT /api/v1/machines/{id}/components/{component},
+// replacing every client-supplied field. The machine is taken from the path;
+// moving a component to another machine goes through MoveComponent.
+func (h *Handler) UpdateComponent(w http.ResponseWriter, r *http.Request) {
+	var req models.Component
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateComponent(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req.ID = r.PathValue("component")
+	req.MachineID = r.PathValue("id")
+	req.UpdatedAt = time.Now().UTC()
+
+	if err := h.DB.UpdateComponent(&req, actor(r)); err != nil {
+		writeComponentError(w, err, "component not found", "failed to update component")
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+// DeleteComponent handles DELETE /api/v1/machines/{id}/components/{component}.
+func (h *Handler) DeleteComponent(w http.ResponseWriter, r *http.Request) {
+	err := h.DB.DeleteComponent(r.PathValue("id"), r.PathValue("component"), actor(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "component not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete component")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveComponent handles POST
+// /api/v1/machines/{id}/components/{component}/move, moving the component
+// to the machine and slot in the body. The move is recorded in the history
+// of both machines.
+func (h *Handler) MoveComponent(w http.ResponseWriter, r *http.Request) {
+	var req models.ComponentMove
+	if !readJSON(w, r, &req) {
+		return
+	}
+	from := r.PathValue("id")
+	if req.MachineID == "" {
+		writeError(w, http.StatusBadRequest, "machine_id is required")
+		return
+	}
+	if req.MachineID == from {
+		writeError(w, http.StatusBadRequest, "component is already in this machine; use PUT to change its slot")
+		return
+	}
+
+	c := models.Component{
+		ID:        r.PathValue("component"),
+		MachineID: req.MachineID,
+		Slot:      req.Slot,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := h.DB.MoveComponent(from, &c, actor(r)); err != nil {
+		writeComponentError(w, err, "component not found", "failed to move component")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
@@ -0,0 +1,214 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// createTestComponent POSTs payload as a component of machineID and returns
+// the created record, failing the test on any non-201 response.
+func createTestComponent(t *testing.T, mux http.Handler, machineID string, payload map[string]any) models.Component {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+machineID+"/components", body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create component: got %d, want 201\nbody: %s", w.Code, w.Body.String())
+	}
+	var c models.Component
+	decodeBody(t, w, &c)
+	return c
+}
+
+func TestComponents_CRUD(t *testing.T) {
+	mux, _ := newTestMux(t)
+	m := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740"})
+	base := "/api/v1/machines/" + m.ID + "/components"
+
+	disk := createTestComponent(t, mux, m.ID, map[string]any{
+		"type": "disk", "make": "Samsung", "model": "PM883", "serial": "S4E0NX0N", "capacity_gb": 960, "slot": "bay 1",
+	})
+	if disk.ID == "" || disk.MachineID != m.ID || disk.CapacityGB != 960 {
+		t.Errorf("created: %+v", disk)
+	}
+	createTestComponent(t, mux, m.ID, map[string]any{"type": "dimm", "capacity_gb": 32, "slot": "A1"})
+
+	w := serve(mux, authReq(http.MethodGet, base, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: got %d, want 200", w.Code)
+	}
+	var list models.ComponentList
+	decodeBody(t, w, &list)
+	if len(list.Components) != 2 || list.Components[0].Type != "dimm" || list.Components[1].Type != "disk" {
+		t.Fatalf("list: got %+v, want dimm then disk", list.Components)
+	}
+
+	body, _ := json.Marshal(map[string]any{"type": "disk", "make": "Samsung", "model": "PM883", "serial": "S4E0NX0N", "capacity_gb": 960, "slot": "bay 2"})
+	w = serve(mux, authReq(http.MethodPut, base+"/"+disk.ID, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var updated models.Component
+	decodeBody(t, w, &updated)
+	if updated.Slot != "bay 2" || updated.CreatedAt.Unix() != disk.CreatedAt.Unix() {
+		t.Errorf("updated: %+v", updated)
+	}
+
+	if w := serve(mux, authReq(http.MethodDelete, base+"/"+disk.ID, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d, want 204", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, base+"/"+disk.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: got %d, want 404", w.Code)
+	}
+}
+
+func TestComponents_Errors(t *testing.T) {
+	mux, _ := newTestMux(t)
+	m := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740"})
+	other := createTestMachine(t, mux, map[string]any{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+"})
+	createTestComponent(t, mux, m.ID, map[string]any{"type": "disk", "serial": "WD-1", "slot": "bay 1"})
+
+	tests := []struct {
+		name    string
+		machine string
+		body    string
+		want    int
+	}{
+		{"missing type", m.ID, `{"serial": "x"}`, http.StatusBadRequest},
+		{"bad type", m.ID, `{"type": "fan"}`, http.StatusBadRequest},
+		{"negative capacity", m.ID, `{"type": "disk", "capacity_gb": -1}`, http.StatusBadRequest},
+		{"serial taken on another machine", other.ID, `{"type": "disk", "serial": "WD-1"}`, http.StatusConflict},
+		{"slot taken", m.ID, `{"type": "disk", "slot": "bay 1"}`, http.StatusConflict},
+		{"same slot on another machine", other.ID, `{"type": "disk", "slot": "bay 1"}`, http.StatusCreated},
+		{"unknown machine", "missing", `{"type": "disk"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+tt.machine+"/components", []byte(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d\nbody: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestComponents_Move(t *testing.T) {
+	mux, _ := newTestMux(t)
+	nas := createTestMachine(t, mux, map[string]any{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+", "derive_capacity": true})
+	pve := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740", "derive_capacity": true})
+	drive := createTestComponent(t, mux, nas.ID, map[string]any{"type": "disk", "serial": "WD-1", "capacity_gb": 4000, "slot": "bay 2"})
+	createTestComponent(t, mux, pve.ID, map[string]any{"type": "disk", "capacity_gb": 500, "slot": "bay 1"})
+
+	move := "/api/v1/machines/" + nas.ID + "/components/" + drive.ID + "/move"
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no target", `{}`, http.StatusBadRequest},
+		{"same machine", `{"machine_id": "` + nas.ID + `"}`, http.StatusBadRequest},
+		{"unknown target", `{"machine_id": "missing"}`, http.StatusBadRequest},
+		{"slot taken", `{"machine_id": "` + pve.ID + `", "slot": "bay 1"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodPost, move, []byte(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d\nbody: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	w := serve(mux, authReq(http.MethodPost, move, []byte(`{"machine_id": "`+pve.ID+`", "slot": "bay 2"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("move: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var moved models.Component
+	decodeBody(t, w, &moved)
+	if moved.MachineID != pve.ID || moved.Slot != "bay 2" || moved.Serial != "WD-1" {
+		t.Errorf("moved: %+v", moved)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+pve.ID+"/components/"+drive.ID, nil)); w.Code != http.StatusOK {
+		t.Errorf("get on new machine: got %d, want 200", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodPost, move, []byte(`{"machine_id": "`+pve.ID+`"}`))); w.Code != http.StatusNotFound {
+		t.Errorf("move from old machine again: got %d, want 404", w.Code)
+	}
+
+	// Both machines derive their storage, so the move changes both.
+	for _, tc := range []struct {
+		id   string
+		want float64
+	}{{nas.ID, 0}, {pve.ID, 4.5}} {
+		w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+tc.id, nil))
+		var m models.Machine
+		decodeBody(t, w, &m)
+		if m.StorageTB != tc.want {
+			t.Errorf("%s storage_tb: got %v, want %v", m.Name, m.StorageTB, tc.want)
+		}
+	}
+
+	// The move is one component_move event in each machine's history.
+	for _, id := range []string{nas.ID, pve.ID} {
+		w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+id+"/history", nil))
+		var list models.EventList
+		decodeBody(t, w, &list)
+		var found bool
+		for _, e := range list.Events {
+			if e.Operation != models.OpComponentMove {
+				continue
+			}
+			found = true
+			c := e.Changes["component"]
+			before, _ := c.Before.(map[string]any)
+			after, _ := c.After.(map[string]any)
+			if before["machine_id"] != nas.ID || after["machine_id"] != pve.ID || after["serial"] != "WD-1" {
+				t.Errorf("history of %s: component change %+v", id, c)
+			}
+		}
+		if !found {
+			t.Errorf("history of %s has no component_move event: %+v", id, list.Events)
+		}
+	}
+}
+
+func TestDeriveCapacity(t *testing.T) {
+	mux, _ := newTestMux(t)
+	m := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740", "ram_gb": 64, "storage_tb": 2})
+	createTestComponent(t, mux, m.ID, map[string]any{"type": "dimm", "capacity_gb": 32, "slot": "A1"})
+	createTestComponent(t, mux, m.ID, map[string]any{"type": "dimm", "capacity_gb": 32, "slot": "B1"})
+	createTestComponent(t, mux, m.ID, map[string]any{"type": "disk", "capacity_gb": 960})
+	createTestComponent(t, mux, m.ID, map[string]any{"type": "gpu", "capacity_gb": 24})
+
+	get := func() models.Machine {
+		t.Helper()
+		var got models.Machine
+		decodeBody(t, serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+m.ID, nil)), &got)
+		return got
+	}
+	// Without the flag the client's numbers stand.
+	if got := get(); got.RAMGB != 64 || got.StorageTB != 2 {
+		t.Errorf("before derive: ram_gb %d storage_tb %v, want 64 and 2", got.RAMGB, got.StorageTB)
+	}
+
+	w := serve(mux, patchReq("/api/v1/machines/"+m.ID, `{"derive_capacity": true, "ram_gb": 1}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PATCH derive_capacity: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	var patched models.Machine
+	decodeBody(t, w, &patched)
+	if !patched.DeriveCapacity || patched.RAMGB != 64 || patched.StorageTB != 0.96 {
+		t.Errorf("derived: %+v, want ram_gb 64 and storage_tb 0.96", patched)
+	}
+
+	createTestComponent(t, mux, m.ID, map[string]any{"type": "dimm", "capacity_gb": 16, "slot": "C1"})
+	got := get()
+	if got.RAMGB != 80 {
+		t.Errorf("after adding a DIMM: ram_gb %d, want 80", got.RAMGB)
+	}
+	if got.Revision <= patched.Revision {
+		t.Errorf("revision: got %d, want above %d after derived change", got.Revision, patched.Revision)
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// Rack elevation geometry, in SVG user units.
+const (
+	elevationUnitHeight = 20
+	elevationGutter     = 32 // left column holding the unit numbers
+	elevationRackWidth  = 320
+	elevationHeader     = 30
+	elevationPadding    = 10
+)
+
+// elevationFree is the fill for unoccupied units.
+const elevationFree = "#f2f2f2"
+
+// kindColours maps each machine kind to its fill in rack elevations. Kinds
+// without an entry are drawn in elevationOtherKind.
+var kindColours = map[string]string{
+	"proxmox":     "#4e79a7",
+	"nas":         "#f28e2b",
+	"sbc":         "#59a14f",
+	"bare_metal":  "#e15759",
+	"workstation": "#76b7b2",
+	"laptop":      "#b07aa1",
+}
+
+const elevationOtherKind = "#9c9c9c"
+
+// RackElevation handles GET /api/v1/racks/{name}/elevation.svg. {name} is a
+// rack's ID or its name; a name shared by racks in different rooms is a 409.
+func (h *Handler) RackElevation(w http.ResponseWriter, r *http.Request) {
+	rack, err := h.DB.RackByName(r.PathValue("name"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "rack not found")
+		return
+	}
+	if errors.Is(err, db.ErrRackNameAmbiguous) {
+		writeError(w, http.StatusConflict, "several racks have this name; use the rack ID")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get rack")
+		return
+	}
+	machines, err := h.DB.RackMachines(rack.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list rack machines")
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(renderElevation(rack, machines))
+}
+
+// renderElevation draws rack as a standalone SVG: unit numbers down the left
+// with the top unit first, one box per machine spanning its units, a light
+// box for each free unit, and a legend of the kinds shown. machines must be
+// the rack's mounted machines; placement checks guarantee they fit and do not
+// overlap.
+func renderElevation(rack *models.Location, machines []*models.Machine) []byte {
+	unitTop := func(u int) int {
+		return elevationHeader + (rack.HeightU-u)*elevationUnitHeight
+	}
+	x := elevationPadding + elevationGutter
+	kinds := map[string]bool{}
+	for _, m := range machines {
+		kinds[m.Kind] = true
+	}
+	legend := make([]string, 0, len(kinds))
+	for k := range kinds {
+		legend = append(legend, k)
+	}
+	sort.Strings(legend)
+
+	width := x + elevationRackWidth + elevationPadding
+	legendTop := unitTop(0) + elevationPadding
+	height := legendTop + len(legend)*elevationUnitHeight + elevationPadding
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&b, `<title>%s</title>`+"\n", html.EscapeString(rack.Name))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="14" font-weight="bold">%s (%dU)</text>`+"\n",
+		x, elevationHeader-10, html.EscapeString(rack.Name), rack.HeightU)
+
+	occupied := make([]bool, rack.HeightU+1)
+	for _, m := range machines {
+		for u := m.RackU; u < m.RackU+m.UHeight && u <= rack.HeightU; u++ {
+			occupied[u] = true
+		}
+	}
+	for u := rack.HeightU; u >= 1; u-- {
+		y := unitTop(u)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#666">%d</text>`+"\n",
+			x-6, y+elevationUnitHeight-6, u)
+		if !occupied[u] {
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#ccc"/>`+"\n",
+				x, y, elevationRackWidth, elevationUnitHeight, elevationFree)
+		}
+	}
+	for _, m := range machines {
+		top := m.RackU + m.UHeight - 1
+		y := unitTop(top)
+		h := m.UHeight * elevationUnitHeight
+		units := fmt.Sprintf("U%d", m.RackU)
+		if m.UHeight > 1 {
+			units = fmt.Sprintf("U%d-U%d", m.RackU, top)
+		}
+		fmt.Fprintf(&b, `<g><title>%s (%s, %s)</title>`, html.EscapeString(m.Name), html.EscapeString(m.Kind), units)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#333"/>`,
+			x, y, elevationRackWidth, h, kindColour(m.Kind))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" dominant-baseline="middle" fill="#fff">%s</text></g>`+"\n",
+			x+elevationRackWidth/2, y+h/2, html.EscapeString(m.Name))
+	}
+	for i, k := range legend {
+		y := legendTop + i*elevationUnitHeight
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="14" height="14" fill="%s" stroke="#333"/>`, x, y, kindColour(k))
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`+"\n", x+20, y+11, html.EscapeString(k))
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+func kindColour(kind string) string {
+	if c, ok := kindColours[kind]; ok {
+		return c
+	}
+	return elevationOtherKind
+}
@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRackElevation(t *testing.T) {
+	mux, _ := newTestMux(t)
+	site := createTestLocation(t, mux, map[string]any{"name": "home", "kind": "site"})
+	room := createTestLocation(t, mux, map[string]any{"name": "office", "kind": "room", "parent_id": site.ID})
+	rack := createTestLocation(t, mux, map[string]any{"name": "Rack A", "kind": "rack", "parent_id": room.ID, "height_u": 6})
+	createTestMachine(t, mux, map[string]any{
+		"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R740",
+		"location_id": rack.ID, "rack_u": 1, "u_height": 2,
+	})
+	createTestMachine(t, mux, map[string]any{
+		"name": "nas<1>", "kind": "nas", "make": "Synology", "model": "RS1221+",
+		"location_id": rack.ID, "rack_u": 5,
+	})
+	// In the room but not mounted, so not drawn.
+	createTestMachine(t, mux, map[string]any{"name": "ws1", "kind": "workstation", "make": "HP", "model": "Z2", "location_id": room.ID})
+
+	for _, name := range []string{rack.ID, "rack%20a"} {
+		w := serve(mux, authReq(http.MethodGet, "/api/v1/racks/"+name+"/elevation.svg", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET elevation for %q: got %d, want 200\nbody: %s", name, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "image/svg+xml" {
+			t.Errorf("Content-Type: got %q, want image/svg+xml", ct)
+		}
+		body := w.Body.String()
+		if err := xml.Unmarshal(w.Body.Bytes(), new(struct{})); err != nil {
+			t.Fatalf("elevation is not well-formed XML: %v\n%s", err, body)
+		}
+		for _, want := range []string{"Rack A (6U)", ">pve1<", "pve1 (proxmox, U1-U2)", "nas&lt;1&gt; (nas, U5)", ">proxmox<", ">nas<"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("elevation for %q does not contain %q", name, want)
+			}
+		}
+		if strings.Contains(body, "ws1") || strings.Contains(body, ">workstation<") {
+			t.Errorf("elevation for %q draws an unmounted machine", name)
+		}
+		// Units 3, 4, and 6 are free.
+		if n := strings.Count(body, `fill="#f2f2f2"`); n != 3 {
+			t.Errorf("free units: got %d, want 3", n)
+		}
+	}
+
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/racks/missing/elevation.svg", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("unknown rack: got %d, want 404", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/racks/office/elevation.svg", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("room name: got %d, want 404", w.Code)
+	}
+
+	// A second rack with the same name in another room makes the name ambiguous.
+	lab := createTestLocation(t, mux, map[string]any{"name": "lab", "kind": "room", "parent_id": site.ID})
+	other := createTestLocation(t, mux, map[string]any{"name": "rack a", "kind": "rack", "parent_id": lab.ID, "height_u": 42})
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/racks/rack%20a/elevation.svg", nil)); w.Code != http.StatusConflict {
+		t.Errorf("ambiguous name: got %d, want 409", w.Code)
+	}
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/racks/"+other.ID+"/elevation.svg", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "rack a (42U)") {
+		t.Errorf("by ID with ambiguous name: got %d\n%s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// validGuestType reports whether t is a known guest type.
+func validGuestType(t string) bool {
+	return t == models.GuestVM || t == models.GuestLXC
+}
+
+// validateGuest checks the fields a client supplies on create and update.
+// Whether the host exists is checked by the db package.
+func validateGuest(g *models.Guest) error {
+	if g.Name == "" || g.Type == "" || g.HostID == "" {
+		return validationError("name, type, and host_id are required")
+	}
+	if !validGuestType(g.Type) {
+		return validationError("invalid type: must be vm or lxc")
+	}
+	if g.VCPUs < 0 || g.RAMMB < 0 || g.DiskGB < 0 {
+		return validationError("vcpus, ram_mb, and disk_gb must not be negative")
+	}
+	return nil
+}
+
+// writeGuestError maps the errors returned by guest writes to a response.
+// notFound is the message used for sql.ErrNoRows.
+func writeGuestError(w http.ResponseWriter, err error, notFound, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, notFound)
+	case errors.Is(err, db.ErrHostNotFound):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, db.ErrGuestNameInUse):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, failed)
+	}
+}
+
+// ListGuests handles GET /api/v1/guests, optionally filtered by ?host_id=
+// and ?type=.
+func (h *Handler) ListGuests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := db.GuestFilter{HostID: q.Get("host_id"), Type: q.Get("type")}
+	if f.Type != "" && !validGuestType(f.Type) {
+		writeError(w, http.StatusBadRequest, "invalid type")
+		return
+	}
+	guests, err := h.DB.ListGuests(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list guests")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.GuestList{Guests: guests})
+}
+
+// CreateGuest handles POST /api/v1/guests.
+func (h *Handler) CreateGuest(w http.ResponseWriter, r *http.Request) {
+	var req models.Guest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateGuest(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	req.ID = uuid.New().String()
+	req.CreatedAt = now
+	req.UpdatedAt = now
+
+	if err := h.DB.CreateGuest(&req); err != nil {
+		writeGuestError(w, err, "guest not found", "failed to create guest")
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// GetGuest handles GET /api/v1/guests/{id}.
+func (h *Handler) GetGuest(w http.ResponseWriter, r *http.Request) {
+	g, err := h.DB.GetGuest(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "guest not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get guest")
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+// UpdateGuest handles PUT /api/v1/guests/{id}, replacing every
+// client-supplied field. Changing host_id records a migration.
+func (h *Handler) UpdateGuest(w http.ResponseWriter, r *http.Request) {
+	var req models.Guest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateGuest(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req.ID = r.PathValue("id")
+	req.UpdatedAt = time.Now().UTC()
+
+	if err := h.DB.UpdateGuest(&req); err != nil {
+		writeGuestError(w, err, "guest not found", "failed to update guest")
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+// DeleteGuest handles DELETE /api/v1/guests/{id}.
+func (h *Handler) DeleteGuest(w http.ResponseWriter, r *http.Request) {
+	if err := h.DB.DeleteGuest(r.PathValue("id")); err != nil {
+		writeGuestError(w, err, "guest not found", "failed to delete guest")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,117 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// createTestGuest POSTs payload and returns the created guest, failing the
+// test on any non-201 response.
+func createTestGuest(t *testing.T, mux http.Handler, payload map[string]any) models.Guest {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	w := serve(mux, authReq(http.MethodPost, "/api/v1/guests", body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create guest: got %d, want 201\nbody: %s", w.Code, w.Body.String())
+	}
+	var g models.Guest
+	decodeBody(t, w, &g)
+	return g
+}
+
+func TestGuests_CRUD(t *testing.T) {
+	mux, _ := newTestMux(t)
+	pve1 := createTestMachine(t, mux, map[string]any{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640"})
+	pve2 := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R640"})
+	g := createTestGuest(t, mux, map[string]any{
+		"name": "gitea", "type": "lxc", "host_id": pve1.ID, "vcpus": 2, "ram_mb": 2048, "disk_gb": 16,
+	})
+	if g.ID == "" || g.HostID != pve1.ID || g.RAMMB != 2048 {
+		t.Errorf("created guest: %+v", g)
+	}
+	createTestGuest(t, mux, map[string]any{"name": "win11", "type": "vm", "host_id": pve2.ID, "vcpus": 4})
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/guests?host_id="+pve1.ID, nil))
+	var list models.GuestList
+	decodeBody(t, w, &list)
+	if len(list.Guests) != 1 || list.Guests[0].ID != g.ID {
+		t.Errorf("list host_id=pve1: got %+v", list.Guests)
+	}
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/guests?type=vm", nil))
+	decodeBody(t, w, &list)
+	if len(list.Guests) != 1 || list.Guests[0].Name != "win11" {
+		t.Errorf("list type=vm: got %+v", list.Guests)
+	}
+
+	// Migrating the guest to pve2 keeps its ID.
+	body, _ := json.Marshal(map[string]any{"name": "gitea", "type": "lxc", "host_id": pve2.ID, "vcpus": 4, "ram_mb": 4096, "disk_gb": 16})
+	w = serve(mux, authReq(http.MethodPut, "/api/v1/guests/"+g.ID, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/guests/"+g.ID, nil))
+	var got models.Guest
+	decodeBody(t, w, &got)
+	if got.HostID != pve2.ID || got.VCPUs != 4 || got.CreatedAt.Unix() != g.CreatedAt.Unix() {
+		t.Errorf("after update: %+v", got)
+	}
+
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/guests/"+g.ID, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d, want 204", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/guests/"+g.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted: got %d, want 404", w.Code)
+	}
+}
+
+func TestGuests_Validation(t *testing.T) {
+	mux, _ := newTestMux(t)
+	host := createTestMachine(t, mux, map[string]any{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640"})
+	createTestGuest(t, mux, map[string]any{"name": "gitea", "type": "lxc", "host_id": host.ID})
+
+	cases := []struct {
+		name    string
+		payload map[string]any
+		want    int
+	}{
+		{"missing host_id", map[string]any{"name": "dns", "type": "lxc"}, http.StatusBadRequest},
+		{"invalid type", map[string]any{"name": "dns", "type": "docker", "host_id": host.ID}, http.StatusBadRequest},
+		{"negative ram", map[string]any{"name": "dns", "type": "lxc", "host_id": host.ID, "ram_mb": -1}, http.StatusBadRequest},
+		{"unknown host", map[string]any{"name": "dns", "type": "lxc", "host_id": "missing"}, http.StatusBadRequest},
+		{"duplicate name", map[string]any{"name": "gitea", "type": "vm", "host_id": host.ID}, http.StatusConflict},
+	}
+	for _, tc := range cases {
+		body, _ := json.Marshal(tc.payload)
+		if w := serve(mux, authReq(http.MethodPost, "/api/v1/guests", body)); w.Code != tc.want {
+			t.Errorf("%s: got %d, want %d\nbody: %s", tc.name, w.Code, tc.want, w.Body.String())
+		}
+	}
+}
+
+func TestDeleteMachine_WithGuests(t *testing.T) {
+	mux, _ := newTestMux(t)
+	host := createTestMachine(t, mux, map[string]any{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640"})
+	g := createTestGuest(t, mux, map[string]any{"name": "gitea", "type": "lxc", "host_id": host.ID})
+
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/machines/"+host.ID, nil)); w.Code != http.StatusConflict {
+		t.Errorf("delete host with guests: got %d, want 409", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/machines/"+host.ID+"?force=maybe", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("delete with invalid force: got %d, want 400", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/machines/"+host.ID+"?force=true", nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("forced delete: got %d, want 204", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/guests/"+g.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("guest of trashed host: got %d, want 404", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+host.ID+"/restore", nil)); w.Code != http.StatusOK {
+		t.Fatalf("restore: got %d, want 200", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/guests/"+g.ID, nil)); w.Code != http.StatusOK {
+		t.Errorf("guest after restore: got %d, want 200", w.Code)
+	}
+}
@@ -4,12 +4,19 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"mime"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/middleware"
 	"github.com/tphummel/lab_gear/internal/models"
 )
 
@@ -32,6 +39,209 @@ func writeError(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, map[string]string{"error": msg})
 }
 
+// maxBodyBytes caps the size of JSON request bodies.
+const maxBodyBytes = 64 * 1024
+
+// readJSON decodes the request body into v. On failure it writes a 413 or 400
+// response and returns false.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return false
+		}
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return false
+	}
+	return true
+}
+
+// validationError is a client-facing message explaining why a machine was
+// rejected. It is returned from db.Modify callbacks so the handler can tell
+// a bad request apart from a database failure.
+type validationError string
+
+func (e validationError) Error() string { return string(e) }
+
+// validateMachine checks the fields a client supplies on create, update, and
+// patch. It returns nil if m may be stored.
+func validateMachine(m *models.Machine) error {
+	if m.Name == "" || m.Kind == "" || m.Make == "" || m.Model == "" {
+		return validationError("name, kind, make, and model are required")
+	}
+	if !models.ValidKinds[m.Kind] {
+		return validationError("invalid kind")
+	}
+	if _, ok := models.StatusTransitions[m.Status]; m.Status != "" && !ok {
+		return validationError("invalid status")
+	}
+	if m.RackU < 0 || m.UHeight < 0 || m.UHeight > maxRackHeightU {
+		return validationError(fmt.Sprintf("rack_u must not be negative and u_height must be between 0 and %d", maxRackHeightU))
+	}
+	for _, d := range []struct{ name, value string }{
+		{"purchase_date", m.PurchaseDate},
+		{"warranty_end", m.WarrantyEnd},
+	} {
+		if _, err := time.Parse(time.DateOnly, d.value); d.value != "" && err != nil {
+			return validationError(d.name + " must be a YYYY-MM-DD date")
+		}
+	}
+	if m.PurchaseDate != "" && m.WarrantyEnd != "" && m.WarrantyEnd < m.PurchaseDate {
+		return validationError("warranty_end must not be before purchase_date")
+	}
+	if m.Price < 0 || m.LifetimeYears < 0 {
+		return validationError("price and lifetime_years must not be negative")
+	}
+	m.Currency = strings.ToUpper(m.Currency)
+	if m.Currency != "" && !isCurrencyCode(m.Currency) {
+		return validationError("currency must be a three-letter ISO 4217 code such as USD")
+	}
+	if m.Price > 0 && m.Currency == "" {
+		return validationError("currency is required when price is set")
+	}
+	if m.RatedWatts < 0 || m.IdleWatts < 0 || m.PeakWatts < 0 {
+		return validationError("rated_watts, idle_watts, and peak_watts must not be negative")
+	}
+	if m.IdleWatts > 0 && m.PeakWatts > 0 && m.IdleWatts > m.PeakWatts {
+		return validationError("idle_watts must not be more than peak_watts")
+	}
+	if m.CPUCores < 0 || m.ReservedCores < 0 || m.ReservedRAMGB < 0 || m.ReservedStorageTB < 0 {
+		return validationError("cpu_cores, reserved_cores, reserved_ram_gb, and reserved_storage_tb must not be negative")
+	}
+	if m.UPSID != "" && m.Circuit != "" {
+		return validationError("ups_id and circuit are mutually exclusive: a machine on a UPS draws from the UPS's circuit")
+	}
+	for _, t := range m.Tags {
+		if t == "" || len(t) > maxTagLen || strings.ContainsAny(t, ", \t\n") {
+			return validationError(fmt.Sprintf("invalid tag %q: tags must be 1-%d characters without spaces or commas", t, maxTagLen))
+		}
+	}
+	for k, v := range m.Labels {
+		if k == "" || len(k) > maxLabelKeyLen || strings.ContainsAny(k, "= \t\n") {
+			return validationError(fmt.Sprintf("invalid label key %q: keys must be 1-%d characters without spaces or '='", k, maxLabelKeyLen))
+		}
+		if len(v) > maxLabelValueLen {
+			return validationError(fmt.Sprintf("invalid label %q: values must be at most %d characters", k, maxLabelValueLen))
+		}
+	}
+	return nil
+}
+
+// isCurrencyCode reports whether s has the form of an ISO 4217 code: three
+// upper-case ASCII letters. The code itself is not checked against the list.
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Limits on tags and labels. Commas and '=' are excluded because they
+// separate values in the tag[in]= and label= list filters.
+const (
+	maxTagLen        = 64
+	maxLabelKeyLen   = 63
+	maxLabelValueLen = 255
+)
+
+// transitionError reports a status change that StatusTransitions does not
+// allow. It is answered with 409 Conflict: the request is well-formed but
+// not valid from the machine's current status.
+type transitionError struct {
+	from, to string
+}
+
+func (e transitionError) Error() string {
+	return fmt.Sprintf("status cannot change from %s to %s", e.from, e.to)
+}
+
+// applyStatus carries the lifecycle status from prev to next. An empty
+// next.Status keeps the current status; a different one must be allowed by
+// models.StatusTransitions and stamps StatusChangedAt with now.
+func applyStatus(prev, next *models.Machine, now time.Time) error {
+	if next.Status == "" {
+		next.Status = prev.Status
+	}
+	next.StatusChangedAt = prev.StatusChangedAt
+	if next.Status == prev.Status {
+		return nil
+	}
+	if !slices.Contains(models.StatusTransitions[prev.Status], next.Status) {
+		return transitionError{from: prev.Status, to: next.Status}
+	}
+	next.StatusChangedAt = now
+	return nil
+}
+
+// placementErrorStatus returns the response status for the errors db writes
+// return when a machine's parent, location, or UPS does not fit, or 0 if err is
+// not one of them. References to things that do not exist are bad requests;
+// clashes with other records are conflicts.
+func placementErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrParentNotFound),
+		errors.Is(err, db.ErrLocationNotFound),
+		errors.Is(err, db.ErrNotARack),
+		errors.Is(err, db.ErrRackPositionOutOfRange),
+		errors.Is(err, db.ErrUPSNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, db.ErrParentCycle),
+		errors.Is(err, db.ErrHasChildren),
+		errors.Is(err, db.ErrHasGuests),
+		errors.Is(err, db.ErrRackPositionTaken),
+		errors.Is(err, db.ErrUPSOverCapacity):
+		return http.StatusConflict
+	}
+	return 0
+}
+
+// etag returns m's revision formatted as a strong entity tag.
+func etag(m *models.Machine) string {
+	return `"` + strconv.FormatInt(m.Revision, 10) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value is
+// "*" or lists tag. If-Match uses strong comparison, so weak tags never
+// satisfy it; If-None-Match uses weak comparison (RFC 9110, section 8.8.3.2).
+func etagMatches(header, tag string, weak bool) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// errPreconditionFailed means the request's If-Match header did not match
+// the machine's current ETag.
+var errPreconditionFailed = errors.New("precondition failed")
+
+// checkIfMatch returns errPreconditionFailed if r has an If-Match header that
+// does not match m. Requests without If-Match are unconditional.
+func checkIfMatch(r *http.Request, m *models.Machine) error {
+	h := r.Header.Get("If-Match")
+	if h != "" && !etagMatches(h, etag(m), false) {
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// actor returns the identity to record on audit events for r.
+func actor(r *http.Request) string {
+	return middleware.Identity(r.Context())
+}
+
 // Health handles GET /healthz — no auth required.
 // Returns 503 if the database is unreachable.
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
@@ -51,24 +261,12 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 
 // CreateMachine handles POST /api/v1/machines.
 func (h *Handler) CreateMachine(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, 64*1024)
 	var req models.Machine
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		var maxErr *http.MaxBytesError
-		if errors.As(err, &maxErr) {
-			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
-			return
-		}
-		writeError(w, http.StatusBadRequest, "invalid JSON")
+	if !readJSON(w, r, &req) {
 		return
 	}
-
-	if req.Name == "" || req.Kind == "" || req.Make == "" || req.Model == "" {
-		writeError(w, http.StatusBadRequest, "name, kind, make, and model are required")
-		return
-	}
-	if !models.ValidKinds[req.Kind] {
-		writeError(w, http.StatusBadRequest, "invalid kind")
+	if err := validateMachine(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -76,24 +274,86 @@ func (h *Handler) CreateMachine(w http.ResponseWriter, r *http.Request) {
 	req.ID = uuid.New().String()
 	req.CreatedAt = now
 	req.UpdatedAt = now
+	if req.Status == "" {
+		req.Status = models.DefaultStatus
+	}
+	req.StatusChangedAt = now
 
-	if err := h.DB.Create(&req); err != nil {
+	if err := h.DB.Create(&req, actor(r)); err != nil {
+		if code := placementErrorStatus(err); code != 0 {
+			writeError(w, code, err.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to create machine")
 		return
 	}
 
+	w.Header().Set("ETag", etag(&req))
 	writeJSON(w, http.StatusCreated, req)
 }
 
-// ListMachines handles GET /api/v1/machines with an optional ?kind= filter.
+// listParams are the list query parameters that control paging rather than
+// filtering. Every other parameter is parsed as a field filter.
+var listParams = map[string]bool{"sort": true, "limit": true, "cursor": true}
+
+// ListMachines handles GET /api/v1/machines. Any machine field can be used as
+// a filter (see db.ParseFilter for the syntax); results are ordered by ?sort=
+// and paginated with ?limit= and ?cursor=.
 func (h *Handler) ListMachines(w http.ResponseWriter, r *http.Request) {
-	kind := r.URL.Query().Get("kind")
-	if kind != "" && !models.ValidKinds[kind] {
-		writeError(w, http.StatusBadRequest, "invalid kind")
-		return
+	h.listMachines(w, r, db.ListOptions{})
+}
+
+// listMachines serves a machine list, reading filters, sort, and paging from
+// the query string on top of the defaults in opts.
+func (h *Handler) listMachines(w http.ResponseWriter, r *http.Request, opts db.ListOptions) {
+	q := r.URL.Query()
+	if v := q.Get("sort"); v != "" {
+		opts.Sort = v
+	}
+	opts.Cursor = q.Get("cursor")
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > db.MaxListLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", db.MaxListLimit))
+			return
+		}
+		opts.Limit = limit
+	}
+	for _, key := range slices.Sorted(maps.Keys(q)) {
+		if listParams[key] {
+			continue
+		}
+		for _, v := range q[key] {
+			// ram_gb>32 parses as a key with no value; see db.ParseFilter.
+			if v == "" && !strings.ContainsAny(key, "<>!") {
+				continue
+			}
+			if key == "kind" && !models.ValidKinds[v] {
+				writeError(w, http.StatusBadRequest, "invalid kind")
+				return
+			}
+			if _, ok := models.StatusTransitions[v]; key == "status" && !ok {
+				writeError(w, http.StatusBadRequest, "invalid status")
+				return
+			}
+			f, err := db.ParseFilter(key, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			opts.Filters = append(opts.Filters, f)
+		}
 	}
 
-	machines, err := h.DB.List(kind)
+	machines, next, err := h.DB.List(opts)
+	if errors.Is(err, db.ErrInvalidSort) {
+		writeError(w, http.StatusBadRequest, "invalid sort")
+		return
+	}
+	if errors.Is(err, db.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to list machines")
 		return
@@ -102,7 +362,38 @@ func (h *Handler) ListMachines(w http.ResponseWriter, r *http.Request) {
 	if machines == nil {
 		machines = []*models.Machine{}
 	}
-	writeJSON(w, http.StatusOK, machines)
+	writeJSON(w, http.StatusOK, models.MachineList{Machines: machines, NextCursor: next})
+}
+
+// SearchMachines handles GET /api/v1/machines/search?q= — full-text search
+// across name, make, model, cpu, serial, location, and notes. An optional
+// ?limit= caps the number of results.
+func (h *Handler) SearchMachines(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > db.MaxSearchLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", db.MaxSearchLimit))
+			return
+		}
+		limit = n
+	}
+
+	results, err := h.DB.Search(q.Get("q"), limit)
+	if errors.Is(err, db.ErrEmptySearch) {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to search machines")
+		return
+	}
+
+	if results == nil {
+		results = []*models.SearchResult{}
+	}
+	writeJSON(w, http.StatusOK, models.SearchResults{Results: results})
 }
 
 // GetMachine handles GET /api/v1/machines/{id}.
@@ -117,10 +408,18 @@ func (h *Handler) GetMachine(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "failed to get machine")
 		return
 	}
+
+	tag := etag(machine)
+	w.Header().Set("ETag", tag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, tag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	writeJSON(w, http.StatusOK, machine)
 }
 
-// UpdateMachine handles PUT /api/v1/machines/{id}.
+// UpdateMachine handles PUT /api/v1/machines/{id}. With an If-Match header
+// the update is only applied if the machine's ETag still matches.
 func (h *Handler) UpdateMachine(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
@@ -133,44 +432,215 @@ func (h *Handler) UpdateMachine(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "failed to get machine")
 		return
 	}
-
-	r.Body = http.MaxBytesReader(w, r.Body, 64*1024)
-	var req models.Machine
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		var maxErr *http.MaxBytesError
-		if errors.As(err, &maxErr) {
-			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
-			return
-		}
-		writeError(w, http.StatusBadRequest, "invalid JSON")
+	if err := checkIfMatch(r, existing); err != nil {
+		writeError(w, http.StatusPreconditionFailed, "machine has been modified")
 		return
 	}
 
-	if req.Name == "" || req.Kind == "" || req.Make == "" || req.Model == "" {
-		writeError(w, http.StatusBadRequest, "name, kind, make, and model are required")
+	var req models.Machine
+	if !readJSON(w, r, &req) {
 		return
 	}
-	if !models.ValidKinds[req.Kind] {
-		writeError(w, http.StatusBadRequest, "invalid kind")
+	if err := validateMachine(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	req.ID = id
 	req.CreatedAt = existing.CreatedAt
 	req.UpdatedAt = time.Now().UTC()
+	var terr transitionError
+	if err := applyStatus(existing, &req, req.UpdatedAt); errors.As(err, &terr) {
+		writeError(w, http.StatusConflict, terr.Error())
+		return
+	}
+	// A conditional PUT must also lose to any write that lands between the
+	// read above and this update.
+	req.Revision = 0
+	if r.Header.Get("If-Match") != "" {
+		req.Revision = existing.Revision
+	}
 
-	if err := h.DB.Update(&req); err != nil {
+	err = h.DB.Update(&req, actor(r))
+	if errors.Is(err, db.ErrRevisionMismatch) {
+		writeError(w, http.StatusPreconditionFailed, "machine has been modified")
+		return
+	}
+	if code := placementErrorStatus(err); code != 0 {
+		writeError(w, code, err.Error())
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "machine not found")
+		return
+	}
+	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to update machine")
 		return
 	}
 
+	w.Header().Set("ETag", etag(&req))
 	writeJSON(w, http.StatusOK, req)
 }
 
-// DeleteMachine handles DELETE /api/v1/machines/{id}.
+// PatchMachine handles PATCH /api/v1/machines/{id}. The body is a JSON Merge
+// Patch (RFC 7396): fields present in the patch replace the stored values,
+// fields set to null are cleared, and omitted fields are left unchanged. The
+// merged machine must pass the same validation as CreateMachine. The read,
+// merge, and write happen in a single transaction, so an If-Match header is
+// checked against the same revision the patch is applied to.
+func (h *Handler) PatchMachine(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct != "application/merge-patch+json" && ct != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json")
+		return
+	}
+
+	var patch map[string]any
+	if !readJSON(w, r, &patch) {
+		return
+	}
+	if patch == nil {
+		writeError(w, http.StatusBadRequest, "merge patch must be a JSON object")
+		return
+	}
+
+	updated, err := h.DB.Modify(id, actor(r), func(m *models.Machine) error {
+		if err := checkIfMatch(r, m); err != nil {
+			return err
+		}
+		doc, err := toJSONObject(m)
+		if err != nil {
+			return err
+		}
+		merged, err := json.Marshal(mergePatch(doc, patch))
+		if err != nil {
+			return err
+		}
+		var next models.Machine
+		if err := json.Unmarshal(merged, &next); err != nil {
+			return validationError("invalid field type in merge patch")
+		}
+		if err := validateMachine(&next); err != nil {
+			return err
+		}
+		next.ID = m.ID
+		next.CreatedAt = m.CreatedAt
+		next.UpdatedAt = time.Now().UTC()
+		if err := applyStatus(m, &next, next.UpdatedAt); err != nil {
+			return err
+		}
+		*m = next
+		return nil
+	})
+	var verr validationError
+	if errors.As(err, &verr) {
+		writeError(w, http.StatusBadRequest, verr.Error())
+		return
+	}
+	var terr transitionError
+	if errors.As(err, &terr) {
+		writeError(w, http.StatusConflict, terr.Error())
+		return
+	}
+	if code := placementErrorStatus(err); code != 0 {
+		writeError(w, code, err.Error())
+		return
+	}
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, "machine has been modified")
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "machine not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update machine")
+		return
+	}
+
+	w.Header().Set("ETag", etag(updated))
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// toJSONObject converts v to the generic map form used by mergePatch.
+func toJSONObject(v any) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]any
+	return out, json.Unmarshal(b, &out)
+}
+
+// mergePatch applies patch to target following RFC 7396: objects are merged
+// recursively, null removes a member, and any other value replaces it.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// DeleteMachine handles DELETE /api/v1/machines/{id}. The machine is moved to
+// the trash, from where it can be restored or purged. With an If-Match header
+// the machine is only deleted if its ETag still matches. Machines that still
+// have live machines placed in them answer 409, as do machines that guests
+// run on unless ?force=true. Forced, the guests are left as they are and
+// hidden until the machine is restored.
 func (h *Handler) DeleteMachine(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	err := h.DB.Delete(id)
+	var force bool
+	if v := r.URL.Query().Get("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, "force must be true or false")
+			return
+		}
+	}
+
+	var revision int64
+	if r.Header.Get("If-Match") != "" {
+		existing, err := h.DB.GetByID(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "machine not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to get machine")
+			return
+		}
+		if err := checkIfMatch(r, existing); err != nil {
+			writeError(w, http.StatusPreconditionFailed, "machine has been modified")
+			return
+		}
+		revision = existing.Revision
+	}
+
+	err := h.DB.Delete(id, revision, force, actor(r))
+	if errors.Is(err, db.ErrRevisionMismatch) {
+		writeError(w, http.StatusPreconditionFailed, "machine has been modified")
+		return
+	}
+	if code := placementErrorStatus(err); code != 0 {
+		writeError(w, code, err.Error())
+		return
+	}
 	if errors.Is(err, sql.ErrNoRows) {
 		writeError(w, http.StatusNotFound, "machine not found")
 		return
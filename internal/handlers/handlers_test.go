@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,14 +29,67 @@ func newTestMux(t *testing.T) (http.Handler, *db.DB) {
 	t.Cleanup(func() { d.Close() })
 
 	h := &handlers.Handler{DB: d}
+	auth := &middleware.Authenticator{Token: apiToken, Store: d, Policy: handlers.RoutePolicy}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /healthz", h.Health)
-	mux.Handle("POST /api/v1/machines", middleware.Auth(apiToken, http.HandlerFunc(h.CreateMachine)))
-	mux.Handle("GET /api/v1/machines", middleware.Auth(apiToken, http.HandlerFunc(h.ListMachines)))
-	mux.Handle("GET /api/v1/machines/{id}", middleware.Auth(apiToken, http.HandlerFunc(h.GetMachine)))
-	mux.Handle("PUT /api/v1/machines/{id}", middleware.Auth(apiToken, http.HandlerFunc(h.UpdateMachine)))
-	mux.Handle("DELETE /api/v1/machines/{id}", middleware.Auth(apiToken, http.HandlerFunc(h.DeleteMachine)))
+	mux.Handle("POST /api/v1/machines", auth.Require(http.HandlerFunc(h.CreateMachine)))
+	mux.Handle("GET /api/v1/machines", auth.Require(http.HandlerFunc(h.ListMachines)))
+	mux.Handle("GET /api/v1/machines/search", auth.Require(http.HandlerFunc(h.SearchMachines)))
+	mux.Handle("GET /api/v1/machines/{id}", auth.Require(http.HandlerFunc(h.GetMachine)))
+	mux.Handle("PUT /api/v1/machines/{id}", auth.Require(http.HandlerFunc(h.UpdateMachine)))
+	mux.Handle("PATCH /api/v1/machines/{id}", auth.Require(http.HandlerFunc(h.PatchMachine)))
+	mux.Handle("DELETE /api/v1/machines/{id}", auth.Require(http.HandlerFunc(h.DeleteMachine)))
+	mux.Handle("GET /api/v1/machines/{id}/history", auth.Require(http.HandlerFunc(h.MachineHistory)))
+	mux.Handle("POST /api/v1/machines/{id}/restore", auth.Require(http.HandlerFunc(h.RestoreMachine)))
+	mux.Handle("GET /api/v1/machines/{id}/children", auth.Require(http.HandlerFunc(h.ListChildren)))
+	mux.Handle("GET /api/v1/machines/{id}/tree", auth.Require(http.HandlerFunc(h.MachineTree)))
+	mux.Handle("GET /api/v1/machines/{id}/interfaces", auth.Require(http.HandlerFunc(h.ListInterfaces)))
+	mux.Handle("POST /api/v1/machines/{id}/interfaces", auth.Require(http.HandlerFunc(h.CreateInterface)))
+	mux.Handle("GET /api/v1/machines/{id}/interfaces/{iface}", auth.Require(http.HandlerFunc(h.GetInterface)))
+	mux.Handle("PUT /api/v1/machines/{id}/interfaces/{iface}", auth.Require(http.HandlerFunc(h.UpdateInterface)))
+	mux.Handle("DELETE /api/v1/machines/{id}/interfaces/{iface}", auth.Require(http.HandlerFunc(h.DeleteInterface)))
+	mux.Handle("GET /api/v1/interfaces", auth.Require(http.HandlerFunc(h.LookupInterfaces)))
+	mux.Handle("GET /api/v1/machines/{id}/components", auth.Require(http.HandlerFunc(h.ListComponents)))
+	mux.Handle("POST /api/v1/machines/{id}/components", auth.Require(http.HandlerFunc(h.CreateComponent)))
+	mux.Handle("GET /api/v1/machines/{id}/components/{component}", auth.Require(http.HandlerFunc(h.GetComponent)))
+	mux.Handle("PUT /api/v1/machines/{id}/components/{component}", auth.Require(http.HandlerFunc(h.UpdateComponent)))
+	mux.Handle("DELETE /api/v1/machines/{id}/components/{component}", auth.Require(http.HandlerFunc(h.DeleteComponent)))
+	mux.Handle("POST /api/v1/machines/{id}/components/{component}/move", auth.Require(http.HandlerFunc(h.MoveComponent)))
+	mux.Handle("GET /api/v1/machines/{id}/maintenance", auth.Require(http.HandlerFunc(h.ListMaintenance)))
+	mux.Handle("POST /api/v1/machines/{id}/maintenance", auth.Require(http.HandlerFunc(h.CreateMaintenance)))
+	mux.Handle("GET /api/v1/machines/{id}/maintenance/{event}", auth.Require(http.HandlerFunc(h.GetMaintenance)))
+	mux.Handle("PUT /api/v1/machines/{id}/maintenance/{event}", auth.Require(http.HandlerFunc(h.UpdateMaintenance)))
+	mux.Handle("DELETE /api/v1/machines/{id}/maintenance/{event}", auth.Require(http.HandlerFunc(h.DeleteMaintenance)))
+	mux.Handle("GET /api/v1/locations", auth.Require(http.HandlerFunc(h.ListLocations)))
+	mux.Handle("POST /api/v1/locations", auth.Require(http.HandlerFunc(h.CreateLocation)))
+	mux.Handle("GET /api/v1/locations/{id}", auth.Require(http.HandlerFunc(h.GetLocation)))
+	mux.Handle("PUT /api/v1/locations/{id}", auth.Require(http.HandlerFunc(h.UpdateLocation)))
+	mux.Handle("DELETE /api/v1/locations/{id}", auth.Require(http.HandlerFunc(h.DeleteLocation)))
+	mux.Handle("GET /api/v1/racks/{name}/elevation.svg", auth.Require(http.HandlerFunc(h.RackElevation)))
+	for _, t := range models.AssetTypes {
+		base := "/api/v1/" + t.Path
+		mux.Handle("GET "+base, auth.Require(h.ListAssets(t)))
+		mux.Handle("POST "+base, auth.Require(h.CreateAsset(t)))
+		mux.Handle("GET "+base+"/{id}", auth.Require(h.GetAsset(t)))
+		mux.Handle("PUT "+base+"/{id}", auth.Require(h.UpdateAsset(t)))
+		mux.Handle("DELETE "+base+"/{id}", auth.Require(h.DeleteAsset(t)))
+	}
+	mux.Handle("GET /api/v1/guests", auth.Require(http.HandlerFunc(h.ListGuests)))
+	mux.Handle("POST /api/v1/guests", auth.Require(http.HandlerFunc(h.CreateGuest)))
+	mux.Handle("GET /api/v1/guests/{id}", auth.Require(http.HandlerFunc(h.GetGuest)))
+	mux.Handle("PUT /api/v1/guests/{id}", auth.Require(http.HandlerFunc(h.UpdateGuest)))
+	mux.Handle("DELETE /api/v1/guests/{id}", auth.Require(http.HandlerFunc(h.DeleteGuest)))
+	mux.Handle("GET /api/v1/trash", auth.Require(http.HandlerFunc(h.ListTrash)))
+	mux.Handle("DELETE /api/v1/trash/{id}", auth.Require(http.HandlerFunc(h.PurgeMachine)))
+	mux.Handle("GET /api/v1/audit", auth.Require(http.HandlerFunc(h.Audit)))
+	mux.Handle("GET /api/v1/tokens", auth.Require(http.HandlerFunc(h.ListTokens)))
+	mux.Handle("POST /api/v1/tokens", auth.Require(http.HandlerFunc(h.CreateToken)))
+	mux.Handle("DELETE /api/v1/tokens/{id}", auth.Require(http.HandlerFunc(h.DeleteToken)))
+	mux.Handle("GET /api/v1/reports/warranty", auth.Require(http.HandlerFunc(h.WarrantyReport)))
+	mux.Handle("GET /api/v1/reports/cost", auth.Require(http.HandlerFunc(h.CostReport)))
+	mux.Handle("GET /api/v1/reports/power", auth.Require(http.HandlerFunc(h.PowerReport)))
+	mux.Handle("GET /api/v1/reports/capacity", auth.Require(http.HandlerFunc(h.CapacityReport)))
 
 	return mux, d
 }
@@ -132,21 +186,81 @@ func TestHealth_DBDown(t *testing.T) {
 
 // --- Auth guard on protected routes ---
 
+// protectedRoutes lists one request to every authenticated route.
+var protectedRoutes = []struct {
+	method string
+	path   string
+}{
+	{http.MethodPost, "/api/v1/machines"},
+	{http.MethodGet, "/api/v1/machines"},
+	{http.MethodGet, "/api/v1/machines/search?q=pve"},
+	{http.MethodGet, "/api/v1/machines/some-id"},
+	{http.MethodPut, "/api/v1/machines/some-id"},
+	{http.MethodPatch, "/api/v1/machines/some-id"},
+	{http.MethodDelete, "/api/v1/machines/some-id"},
+	{http.MethodGet, "/api/v1/machines/some-id/history"},
+	{http.MethodGet, "/api/v1/machines/some-id/children"},
+	{http.MethodGet, "/api/v1/machines/some-id/tree"},
+	{http.MethodPost, "/api/v1/machines/some-id/restore"},
+	{http.MethodGet, "/api/v1/machines/some-id/interfaces"},
+	{http.MethodPost, "/api/v1/machines/some-id/interfaces"},
+	{http.MethodGet, "/api/v1/machines/some-id/interfaces/nic-id"},
+	{http.MethodPut, "/api/v1/machines/some-id/interfaces/nic-id"},
+	{http.MethodDelete, "/api/v1/machines/some-id/interfaces/nic-id"},
+	{http.MethodGet, "/api/v1/interfaces?mac=aa:bb:cc:dd:ee:ff"},
+	{http.MethodGet, "/api/v1/machines/some-id/components"},
+	{http.MethodPost, "/api/v1/machines/some-id/components"},
+	{http.MethodGet, "/api/v1/machines/some-id/components/part-id"},
+	{http.MethodPut, "/api/v1/machines/some-id/components/part-id"},
+	{http.MethodDelete, "/api/v1/machines/some-id/components/part-id"},
+	{http.MethodPost, "/api/v1/machines/some-id/components/part-id/move"},
+	{http.MethodGet, "/api/v1/machines/some-id/maintenance"},
+	{http.MethodPost, "/api/v1/machines/some-id/maintenance"},
+	{http.MethodGet, "/api/v1/machines/some-id/maintenance/event-id"},
+	{http.MethodPut, "/api/v1/machines/some-id/maintenance/event-id"},
+	{http.MethodDelete, "/api/v1/machines/some-id/maintenance/event-id"},
+	{http.MethodGet, "/api/v1/locations"},
+	{http.MethodPost, "/api/v1/locations"},
+	{http.MethodGet, "/api/v1/locations/loc-id"},
+	{http.MethodPut, "/api/v1/locations/loc-id"},
+	{http.MethodDelete, "/api/v1/locations/loc-id"},
+	{http.MethodGet, "/api/v1/racks/rack1/elevation.svg"},
+	{http.MethodGet, "/api/v1/switches"},
+	{http.MethodPost, "/api/v1/switches"},
+	{http.MethodGet, "/api/v1/switches/asset-id"},
+	{http.MethodPut, "/api/v1/switches/asset-id"},
+	{http.MethodDelete, "/api/v1/switches/asset-id"},
+	{http.MethodGet, "/api/v1/ups"},
+	{http.MethodPost, "/api/v1/ups"},
+	{http.MethodGet, "/api/v1/ups/asset-id"},
+	{http.MethodPut, "/api/v1/ups/asset-id"},
+	{http.MethodDelete, "/api/v1/ups/asset-id"},
+	{http.MethodGet, "/api/v1/accesspoints"},
+	{http.MethodPost, "/api/v1/accesspoints"},
+	{http.MethodGet, "/api/v1/accesspoints/asset-id"},
+	{http.MethodPut, "/api/v1/accesspoints/asset-id"},
+	{http.MethodDelete, "/api/v1/accesspoints/asset-id"},
+	{http.MethodGet, "/api/v1/tokens"},
+	{http.MethodPost, "/api/v1/tokens"},
+	{http.MethodDelete, "/api/v1/tokens/token-id"},
+	{http.MethodGet, "/api/v1/guests"},
+	{http.MethodPost, "/api/v1/guests"},
+	{http.MethodGet, "/api/v1/guests/guest-id"},
+	{http.MethodPut, "/api/v1/guests/guest-id"},
+	{http.MethodDelete, "/api/v1/guests/guest-id"},
+	{http.MethodGet, "/api/v1/trash"},
+	{http.MethodDelete, "/api/v1/trash/some-id"},
+	{http.MethodGet, "/api/v1/audit"},
+	{http.MethodGet, "/api/v1/reports/warranty"},
+	{http.MethodGet, "/api/v1/reports/cost"},
+	{http.MethodGet, "/api/v1/reports/power"},
+	{http.MethodGet, "/api/v1/reports/capacity"},
+}
+
 func TestProtectedRoutes_RequireAuth(t *testing.T) {
 	mux, _ := newTestMux(t)
 
-	routes := []struct {
-		method string
-		path   string
-	}{
-		{http.MethodPost, "/api/v1/machines"},
-		{http.MethodGet, "/api/v1/machines"},
-		{http.MethodGet, "/api/v1/machines/some-id"},
-		{http.MethodPut, "/api/v1/machines/some-id"},
-		{http.MethodDelete, "/api/v1/machines/some-id"},
-	}
-
-	for _, rt := range routes {
+	for _, rt := range protectedRoutes {
 		t.Run(fmt.Sprintf("%s %s", rt.method, rt.path), func(t *testing.T) {
 			req := httptest.NewRequest(rt.method, rt.path, nil)
 			// deliberately no Authorization header
@@ -158,6 +272,34 @@ func TestProtectedRoutes_RequireAuth(t *testing.T) {
 	}
 }
 
+// A token without the scope a route needs is refused with 403, not 401:
+// read-only tokens may only GET, and only the admin scope may manage
+// tokens or purge machines.
+func TestProtectedRoutes_Scopes(t *testing.T) {
+	mux, _ := newTestMux(t)
+	reader := createTestToken(t, mux, map[string]any{"name": "grafana", "scopes": []string{"machines:read"}})
+	writer := createTestToken(t, mux, map[string]any{"name": "atlantis", "scopes": []string{"machines:write"}})
+
+	for _, rt := range protectedRoutes {
+		admin := strings.HasPrefix(rt.path, "/api/v1/tokens") ||
+			(rt.method == http.MethodDelete && strings.HasPrefix(rt.path, "/api/v1/trash/"))
+		for _, tc := range []struct {
+			token     models.NewAPIToken
+			forbidden bool
+		}{
+			{reader, admin || rt.method != http.MethodGet},
+			{writer, admin},
+		} {
+			t.Run(fmt.Sprintf("%s %s as %s", rt.method, rt.path, tc.token.Name), func(t *testing.T) {
+				w := serve(mux, withToken(authReq(rt.method, rt.path, nil), tc.token.Token))
+				if got := w.Code == http.StatusForbidden; got != tc.forbidden || w.Code == http.StatusUnauthorized {
+					t.Errorf("got %d, want forbidden=%v", w.Code, tc.forbidden)
+				}
+			})
+		}
+	}
+}
+
 // --- CreateMachine ---
 
 func TestCreateMachine_Valid(t *testing.T) {
@@ -230,6 +372,46 @@ func TestCreateMachine_ValidationErrors(t *testing.T) {
 			name:    "invalid kind",
 			payload: map[string]any{"name": "pve2", "kind": "mainframe", "make": "IBM", "model": "Z"},
 		},
+		{
+			name:    "invalid status",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "status": "lost"},
+		},
+		{
+			name:    "empty tag",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "tags": []string{""}},
+		},
+		{
+			name:    "tag with comma",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "tags": []string{"a,b"}},
+		},
+		{
+			name:    "label key with equals",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "labels": map[string]string{"a=b": "c"}},
+		},
+		{
+			name:    "label value too long",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "labels": map[string]string{"env": strings.Repeat("x", 256)}},
+		},
+		{
+			name:    "malformed purchase_date",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "purchase_date": "03/15/2024"},
+		},
+		{
+			name:    "warranty ends before purchase",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "purchase_date": "2024-03-15", "warranty_end": "2023-03-15"},
+		},
+		{
+			name:    "negative price",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "price": -1, "currency": "USD"},
+		},
+		{
+			name:    "price without currency",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "price": 899},
+		},
+		{
+			name:    "invalid currency",
+			payload: map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "X", "price": 899, "currency": "dollars"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -286,10 +468,10 @@ func TestListMachines_Empty(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Errorf("status: got %d, want 200", w.Code)
 	}
-	var machines []models.Machine
-	decodeBody(t, w, &machines)
-	if len(machines) != 0 {
-		t.Errorf("expected empty array, got %d items", len(machines))
+	var list models.MachineList
+	decodeBody(t, w, &list)
+	if len(list.Machines) != 0 {
+		t.Errorf("expected empty array, got %d items", len(list.Machines))
 	}
 }
 
@@ -314,10 +496,10 @@ func TestListMachines_ReturnsAll(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Errorf("status: got %d, want 200", w.Code)
 	}
-	var machines []models.Machine
-	decodeBody(t, w, &machines)
-	if len(machines) != 3 {
-		t.Errorf("expected 3 machines, got %d", len(machines))
+	var list models.MachineList
+	decodeBody(t, w, &list)
+	if len(list.Machines) != 3 {
+		t.Errorf("expected 3 machines, got %d", len(list.Machines))
 	}
 }
 
@@ -356,10 +538,10 @@ func TestListMachines_KindFilter(t *testing.T) {
 			if w.Code != http.StatusOK {
 				t.Fatalf("status: got %d, want 200", w.Code)
 			}
-			var machines []models.Machine
-			decodeBody(t, w, &machines)
-			if len(machines) != tt.want {
-				t.Errorf("kind=%q: got %d machines, want %d", tt.kind, len(machines), tt.want)
+			var list models.MachineList
+			decodeBody(t, w, &list)
+			if len(list.Machines) != tt.want {
+				t.Errorf("kind=%q: got %d machines, want %d", tt.kind, len(list.Machines), tt.want)
 			}
 		})
 	}
@@ -373,6 +555,246 @@ func TestListMachines_InvalidKindFilter(t *testing.T) {
 	}
 }
 
+func TestListMachines_StatusFilter(t *testing.T) {
+	mux, _ := newTestMux(t)
+	createTestMachine(t, mux, map[string]any{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640"})
+	createTestMachine(t, mux, map[string]any{"name": "pve9", "kind": "proxmox", "make": "Dell", "model": "R750", "status": "planned"})
+	createTestMachine(t, mux, map[string]any{"name": "nas00", "kind": "nas", "make": "Synology", "model": "DS218", "status": "retired"})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"status=active", []string{"pve1"}},
+		{"status[in]=planned,retired&sort=name", []string{"nas00", "pve9"}},
+		{"status[ne]=retired&sort=name", []string{"pve1", "pve9"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodGet, "/api/v1/machines?"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+			}
+			var list models.MachineList
+			decodeBody(t, w, &list)
+			var names []string
+			for _, m := range list.Machines {
+				names = append(names, m.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/machines?status=lost", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid status filter: got %d, want 400", w.Code)
+	}
+}
+
+func TestListMachines_Pagination(t *testing.T) {
+	mux, _ := newTestMux(t)
+
+	for i := range 5 {
+		payload := map[string]any{"name": fmt.Sprintf("node%d", i), "kind": "proxmox", "make": "Dell", "model": "R640"}
+		body, _ := json.Marshal(payload)
+		if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines", body)); w.Code != http.StatusCreated {
+			t.Fatalf("create %d: %s", i, w.Body.String())
+		}
+	}
+
+	var names []string
+	path := "/api/v1/machines?sort=-name&limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		w := serve(mux, authReq(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+		}
+		var list models.MachineList
+		decodeBody(t, w, &list)
+		if len(list.Machines) > 2 {
+			t.Fatalf("page size: got %d, want <= 2", len(list.Machines))
+		}
+		for _, m := range list.Machines {
+			names = append(names, m.Name)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		path = "/api/v1/machines?sort=-name&limit=2&cursor=" + list.NextCursor
+	}
+
+	want := []string{"node4", "node3", "node2", "node1", "node0"}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("names: got %v, want %v", names, want)
+	}
+}
+
+func TestListMachines_InvalidPaginationParams(t *testing.T) {
+	mux, _ := newTestMux(t)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"non-numeric limit", "limit=ten"},
+		{"zero limit", "limit=0"},
+		{"limit too large", "limit=100000"},
+		{"unknown sort", "sort=serial"},
+		{"malformed cursor", "cursor=***"},
+		{"garbage cursor", "cursor=bm9wZQ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodGet, "/api/v1/machines?"+tt.query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status: got %d, want 400\nbody: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestListMachines_FieldFilters(t *testing.T) {
+	mux, _ := newTestMux(t)
+
+	creates := []map[string]any{
+		{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640", "ram_gb": 32, "location": "office rack", "tags": []string{"gpu-passthrough"}, "labels": map[string]string{"env": "prod"}},
+		{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740", "ram_gb": 128, "location": "office rack", "labels": map[string]string{"env": "dev"}},
+		{"name": "pve3", "kind": "proxmox", "make": "HP", "model": "DL20", "ram_gb": 16, "location": "closet", "tags": []string{"gpu-passthrough", "10gbe"}},
+		{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+", "ram_gb": 8, "location": "office rack"},
+	}
+	for _, c := range creates {
+		body, _ := json.Marshal(c)
+		if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines", body)); w.Code != http.StatusCreated {
+			t.Fatalf("create %v: %s", c["name"], w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"kind=proxmox&location[prefix]=office&ram_gb[lt]=64", []string{"pve1"}},
+		{"make[in]=HP,Synology&sort=name", []string{"nas01", "pve3"}},
+		{"ram_gb[gte]=32&sort=-ram_gb", []string{"pve2", "pve1"}},
+		{"tag=gpu-passthrough&sort=name", []string{"pve1", "pve3"}},
+		{"label=env=prod", []string{"pve1"}},
+		{"label=env&sort=-name", []string{"pve2", "pve1"}},
+		{"ram_gb>=32&sort=-ram_gb", []string{"pve2", "pve1"}},
+		{"ram_gb<=32&sort=name", []string{"nas01", "pve1", "pve3"}},
+		{"ram_gb>32", []string{"pve2"}},
+		{"ram_gb<32&sort=name", []string{"nas01", "pve3"}},
+		{"kind!=proxmox", []string{"nas01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodGet, "/api/v1/machines?"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+			}
+			var list models.MachineList
+			decodeBody(t, w, &list)
+			var names []string
+			for _, m := range list.Machines {
+				names = append(names, m.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestListMachines_InvalidFieldFilter(t *testing.T) {
+	mux, _ := newTestMux(t)
+
+	tests := []string{
+		"colour=red",
+		"ram_gb[gte]=lots",
+		"ram_gb[approx]=32",
+		"ram_gb>=lots",
+		"ram_gb!32",
+		"storage_tb[prefix]=1",
+		"created_at[gte]=yesterday",
+		"tag[prefix]=gpu",
+		"label==prod",
+		"warranty_end[lt]=2026-01-01T00:00:00Z",
+	}
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodGet, "/api/v1/machines?"+query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status: got %d, want 400\nbody: %s", w.Code, w.Body.String())
+			}
+			var body map[string]string
+			decodeBody(t, w, &body)
+			if !strings.HasPrefix(body["error"], "invalid filter") {
+				t.Errorf("error: got %q, want prefix %q", body["error"], "invalid filter")
+			}
+		})
+	}
+}
+
+// --- SearchMachines ---
+
+func TestSearchMachines(t *testing.T) {
+	mux, _ := newTestMux(t)
+
+	creates := []map[string]any{
+		{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "OptiPlex 7050", "notes": "swapped fans in March"},
+		{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+", "notes": "replication target for pve2"},
+		{"name": "pi01", "kind": "sbc", "make": "Raspberry Pi", "model": "4B"},
+	}
+	for _, c := range creates {
+		body, _ := json.Marshal(c)
+		if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines", body)); w.Code != http.StatusCreated {
+			t.Fatalf("create %v: %s", c["name"], w.Body.String())
+		}
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/search?q=pve2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var got models.SearchResults
+	decodeBody(t, w, &got)
+	if len(got.Results) != 2 {
+		t.Fatalf("results: got %d, want 2", len(got.Results))
+	}
+	if got.Results[0].Machine.Name != "pve2" {
+		t.Errorf("top result: got %q, want pve2", got.Results[0].Machine.Name)
+	}
+	if !strings.Contains(got.Results[1].Snippet, "<mark>") {
+		t.Errorf("snippet not highlighted: %q", got.Results[1].Snippet)
+	}
+
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/machines/search?q=nothing-matches-this", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("no-match status: got %d, want 200", w.Code)
+	}
+	got = models.SearchResults{}
+	decodeBody(t, w, &got)
+	if got.Results == nil || len(got.Results) != 0 {
+		t.Errorf("no-match results: got %v, want empty array", got.Results)
+	}
+}
+
+func TestSearchMachines_BadRequest(t *testing.T) {
+	mux, _ := newTestMux(t)
+
+	for _, query := range []string{"", "q=", "q=%20%20", "q=pve&limit=0", "q=pve&limit=many"} {
+		t.Run(query, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/search?"+query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status: got %d, want 400\nbody: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
 // --- GetMachine ---
 
 func TestGetMachine_Found(t *testing.T) {
@@ -546,6 +968,256 @@ func TestUpdateMachine_InvalidJSON(t *testing.T) {
 	}
 }
 
+// --- PatchMachine ---
+
+// patchReq builds an authenticated merge-patch request.
+func patchReq(path string, body string) *http.Request {
+	r := authReq(http.MethodPatch, path, []byte(body))
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	return r
+}
+
+// createTestMachine POSTs payload and returns the created machine.
+func createTestMachine(t *testing.T, mux http.Handler, payload map[string]any) models.Machine {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	w := serve(mux, authReq(http.MethodPost, "/api/v1/machines", body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	var m models.Machine
+	decodeBody(t, w, &m)
+	return m
+}
+
+func TestPatchMachine_ChangesOnlyGivenFields(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{
+		"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "OptiPlex 7050",
+		"cpu": "i7-7700", "ram_gb": 32, "location": "office rack", "notes": "primary",
+	})
+
+	w := serve(mux, patchReq("/api/v1/machines/"+created.ID, `{"location": "closet"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var patched models.Machine
+	decodeBody(t, w, &patched)
+
+	if patched.Location != "closet" {
+		t.Errorf("Location: got %q, want closet", patched.Location)
+	}
+	if patched.CPU != "i7-7700" || patched.RAMGB != 32 || patched.Notes != "primary" {
+		t.Errorf("untouched fields changed: %+v", patched)
+	}
+	if patched.ID != created.ID {
+		t.Errorf("ID changed: got %q, want %q", patched.ID, created.ID)
+	}
+
+	// The change is persisted.
+	getW := serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+created.ID, nil))
+	var got models.Machine
+	decodeBody(t, getW, &got)
+	if got.Location != "closet" || got.Notes != "primary" {
+		t.Errorf("stored machine: Location %q Notes %q", got.Location, got.Notes)
+	}
+}
+
+func TestPatchMachine_NullClearsField(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{
+		"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+", "notes": "old notes", "ram_gb": 8,
+	})
+
+	w := serve(mux, patchReq("/api/v1/machines/"+created.ID, `{"notes": null, "ram_gb": null}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var patched models.Machine
+	decodeBody(t, w, &patched)
+	if patched.Notes != "" || patched.RAMGB != 0 {
+		t.Errorf("null should clear: Notes %q RAMGB %d", patched.Notes, patched.RAMGB)
+	}
+}
+
+func TestMachineStatus_Transitions(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740"})
+	if created.Status != models.StatusActive {
+		t.Errorf("default status: got %q, want active", created.Status)
+	}
+	if !created.StatusChangedAt.Equal(created.CreatedAt) {
+		t.Errorf("StatusChangedAt: got %v, want created_at %v", created.StatusChangedAt, created.CreatedAt)
+	}
+	path := "/api/v1/machines/" + created.ID
+
+	// Changing other fields leaves the status and its timestamp alone.
+	w := serve(mux, patchReq(path, `{"notes": "rack 2"}`))
+	var patched models.Machine
+	decodeBody(t, w, &patched)
+	if patched.Status != models.StatusActive || patched.StatusChangedAt.Unix() != created.StatusChangedAt.Unix() {
+		t.Errorf("after notes patch: status %q changed at %v", patched.Status, patched.StatusChangedAt)
+	}
+
+	w = serve(mux, patchReq(path, `{"status": "retired"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("active -> retired: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	decodeBody(t, w, &patched)
+	if patched.Status != models.StatusRetired || !patched.StatusChangedAt.Equal(patched.UpdatedAt) {
+		t.Errorf("after retire: status %q changed at %v", patched.Status, patched.StatusChangedAt)
+	}
+
+	// A retired machine cannot go back to planned, by PATCH or PUT.
+	w = serve(mux, patchReq(path, `{"status": "planned"}`))
+	if w.Code != http.StatusConflict {
+		t.Errorf("PATCH retired -> planned: got %d, want 409\nbody: %s", w.Code, w.Body.String())
+	}
+	body, _ := json.Marshal(map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740", "status": "planned"})
+	w = serve(mux, authReq(http.MethodPut, path, body))
+	if w.Code != http.StatusConflict {
+		t.Errorf("PUT retired -> planned: got %d, want 409\nbody: %s", w.Code, w.Body.String())
+	}
+
+	// A PUT without a status keeps the current one.
+	body, _ = json.Marshal(map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740"})
+	w = serve(mux, authReq(http.MethodPut, path, body))
+	var put models.Machine
+	decodeBody(t, w, &put)
+	if put.Status != models.StatusRetired {
+		t.Errorf("PUT without status: got %q, want retired", put.Status)
+	}
+}
+
+func TestMachineStatus_TransitionTable(t *testing.T) {
+	tests := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"planned", "ordered", true},
+		{"ordered", "active", true},
+		{"active", "maintenance", true},
+		{"maintenance", "active", true},
+		{"active", "sold", true},
+		{"retired", "active", true},
+		{"retired", "planned", false},
+		{"sold", "active", false},
+		{"planned", "maintenance", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			mux, _ := newTestMux(t)
+			created := createTestMachine(t, mux, map[string]any{"name": "m", "kind": "sbc", "make": "Raspberry Pi", "model": "4B", "status": tt.from})
+			w := serve(mux, patchReq("/api/v1/machines/"+created.ID, `{"status": "`+tt.to+`"}`))
+			want := http.StatusConflict
+			if tt.ok {
+				want = http.StatusOK
+			}
+			if w.Code != want {
+				t.Errorf("got %d, want %d\nbody: %s", w.Code, want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPatchMachine_TagsAndLabels(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{
+		"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740",
+		"tags":   []string{"nvme", "10gbe"},
+		"labels": map[string]string{"env": "prod", "owner": "tom"},
+	})
+	if fmt.Sprint(created.Tags) != "[10gbe nvme]" {
+		t.Errorf("created Tags: got %v, want sorted [10gbe nvme]", created.Tags)
+	}
+
+	// Labels merge key by key; tags, being an array, are replaced.
+	w := serve(mux, patchReq("/api/v1/machines/"+created.ID, `{"tags": ["gpu-passthrough"], "labels": {"owner": null, "rack": "r1"}}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var patched models.Machine
+	decodeBody(t, w, &patched)
+	if fmt.Sprint(patched.Tags) != "[gpu-passthrough]" {
+		t.Errorf("Tags: got %v, want [gpu-passthrough]", patched.Tags)
+	}
+	if want := map[string]string{"env": "prod", "rack": "r1"}; fmt.Sprint(patched.Labels) != fmt.Sprint(want) {
+		t.Errorf("Labels: got %v, want %v", patched.Labels, want)
+	}
+}
+
+func TestPatchMachine_ServerFieldsIgnored(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{"name": "pi01", "kind": "sbc", "make": "Raspberry Pi", "model": "4B"})
+
+	w := serve(mux, patchReq("/api/v1/machines/"+created.ID, `{"id": "hijack", "created_at": "2000-01-01T00:00:00Z"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var patched models.Machine
+	decodeBody(t, w, &patched)
+	if patched.ID != created.ID {
+		t.Errorf("ID: got %q, want %q", patched.ID, created.ID)
+	}
+	if !patched.CreatedAt.Truncate(time.Second).Equal(created.CreatedAt.Truncate(time.Second)) {
+		t.Errorf("CreatedAt changed: got %v, want %v", patched.CreatedAt, created.CreatedAt)
+	}
+}
+
+func TestPatchMachine_ValidationErrors(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{"name": "ws01", "kind": "workstation", "make": "System76", "model": "Thelio"})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"null required field", `{"name": null}`},
+		{"empty required field", `{"make": ""}`},
+		{"invalid kind", `{"kind": "toaster"}`},
+		{"wrong type", `{"ram_gb": "lots"}`},
+		{"not an object", `["name"]`},
+		{"null document", `null`},
+		{"invalid JSON", `{`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(mux, patchReq("/api/v1/machines/"+created.ID, tt.body))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status: got %d, want 400\nbody: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Rejected patches leave the machine untouched.
+	getW := serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+created.ID, nil))
+	var got models.Machine
+	decodeBody(t, getW, &got)
+	if got.Name != "ws01" || got.Kind != "workstation" || got.Make != "System76" {
+		t.Errorf("machine modified by rejected patch: %+v", got)
+	}
+}
+
+func TestPatchMachine_UnsupportedMediaType(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{"name": "ws01", "kind": "workstation", "make": "Dell", "model": "XPS"})
+
+	r := authReq(http.MethodPatch, "/api/v1/machines/"+created.ID, []byte(`{"notes": "x"}`))
+	r.Header.Set("Content-Type", "application/json-patch+json")
+	w := serve(mux, r)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status: got %d, want 415", w.Code)
+	}
+}
+
+func TestPatchMachine_NotFound(t *testing.T) {
+	mux, _ := newTestMux(t)
+	w := serve(mux, patchReq("/api/v1/machines/no-such-id", `{"notes": "x"}`))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status: got %d, want 404", w.Code)
+	}
+}
+
 // --- DeleteMachine ---
 
 func TestDeleteMachine_Found(t *testing.T) {
@@ -582,6 +1254,117 @@ func TestDeleteMachine_NotFound(t *testing.T) {
 	}
 }
 
+// --- Conditional requests ---
+
+func TestGetMachine_ETag(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{
+		"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R720",
+	})
+	if created.Revision != 1 {
+		t.Errorf("revision: got %d, want 1", created.Revision)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+created.ID, nil))
+	if got := w.Header().Get("ETag"); got != `"1"` {
+		t.Fatalf("ETag: got %q, want %q", got, `"1"`)
+	}
+
+	tests := []struct {
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{`"1"`, http.StatusNotModified},
+		{`W/"1"`, http.StatusNotModified},
+		{`"7", "1"`, http.StatusNotModified},
+		{`*`, http.StatusNotModified},
+		{`"2"`, http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.ifNoneMatch, func(t *testing.T) {
+			r := authReq(http.MethodGet, "/api/v1/machines/"+created.ID, nil)
+			r.Header.Set("If-None-Match", tc.ifNoneMatch)
+			w := serve(mux, r)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status: got %d, want %d", w.Code, tc.wantStatus)
+			}
+			if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %q", w.Body.String())
+			}
+			if w.Header().Get("ETag") != `"1"` {
+				t.Errorf("ETag: got %q", w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	full := []byte(`{"name":"pve1","kind":"proxmox","make":"Dell","model":"R720","notes":"put"}`)
+	writes := []struct {
+		name       string
+		req        func(path string) *http.Request
+		wantStatus int
+	}{
+		{"PUT", func(path string) *http.Request { return authReq(http.MethodPut, path, full) }, http.StatusOK},
+		{"PATCH", func(path string) *http.Request { return patchReq(path, `{"notes":"patched"}`) }, http.StatusOK},
+		{"DELETE", func(path string) *http.Request { return authReq(http.MethodDelete, path, nil) }, http.StatusNoContent},
+	}
+	for _, tc := range writes {
+		t.Run(tc.name, func(t *testing.T) {
+			mux, _ := newTestMux(t)
+			created := createTestMachine(t, mux, map[string]any{
+				"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R720",
+			})
+			path := "/api/v1/machines/" + created.ID
+
+			// Someone else updates the machine, moving it to revision 2.
+			if w := serve(mux, patchReq(path, `{"location":"garage"}`)); w.Code != http.StatusOK {
+				t.Fatalf("concurrent patch: %d %s", w.Code, w.Body.String())
+			}
+
+			stale := tc.req(path)
+			stale.Header.Set("If-Match", `"1"`)
+			if w := serve(mux, stale); w.Code != http.StatusPreconditionFailed {
+				t.Fatalf("stale If-Match: got %d, want 412\nbody: %s", w.Code, w.Body.String())
+			}
+			weak := tc.req(path)
+			weak.Header.Set("If-Match", `W/"2"`)
+			if w := serve(mux, weak); w.Code != http.StatusPreconditionFailed {
+				t.Fatalf("weak If-Match: got %d, want 412", w.Code)
+			}
+			var unchanged models.Machine
+			decodeBody(t, serve(mux, authReq(http.MethodGet, path, nil)), &unchanged)
+			if unchanged.Revision != 2 || unchanged.Location != "garage" {
+				t.Fatalf("rejected write changed the machine: %+v", unchanged)
+			}
+
+			current := tc.req(path)
+			current.Header.Set("If-Match", `"2"`)
+			w := serve(mux, current)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("current If-Match: got %d, want %d\nbody: %s", w.Code, tc.wantStatus, w.Body.String())
+			}
+			if tc.wantStatus == http.StatusOK && w.Header().Get("ETag") != `"3"` {
+				t.Errorf("ETag after write: got %q, want %q", w.Header().Get("ETag"), `"3"`)
+			}
+		})
+	}
+}
+
+func TestConditionalWrites_NotFound(t *testing.T) {
+	mux, _ := newTestMux(t)
+	for _, r := range []*http.Request{
+		authReq(http.MethodPut, "/api/v1/machines/ghost", []byte(`{"name":"a","kind":"sbc","make":"b","model":"c"}`)),
+		patchReq("/api/v1/machines/ghost", `{}`),
+		authReq(http.MethodDelete, "/api/v1/machines/ghost", nil),
+	} {
+		r.Header.Set("If-Match", `"1"`)
+		if w := serve(mux, r); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", r.Method, w.Code)
+		}
+	}
+}
+
 // --- Content-Type ---
 
 func TestResponseContentType(t *testing.T) {
@@ -684,9 +1467,9 @@ func TestListMachines_UTF8RoundTrip(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("list: %d", w.Code)
 	}
-	var machines []models.Machine
-	decodeBody(t, w, &machines)
-	if len(machines) != 1 || machines[0].Name != "пи01" {
-		t.Errorf("UTF-8 name not preserved in list: %+v", machines)
+	var list models.MachineList
+	decodeBody(t, w, &list)
+	if len(list.Machines) != 1 || list.Machines[0].Name != "пи01" {
+		t.Errorf("UTF-8 name not preserved in list: %+v", list.Machines)
 	}
 }
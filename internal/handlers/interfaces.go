@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// maxVLAN is the highest usable 802.1Q VLAN ID.
+const maxVLAN = 4094
+
+// normalizeMAC parses s as a MAC address and returns it in lower-case
+// colon-separated form, so every accepted spelling is stored the same way.
+func normalizeMAC(s string) (string, error) {
+	hw, err := net.ParseMAC(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid mac %q", s)
+	}
+	return hw.String(), nil
+}
+
+// normalizeAddr parses s as an IPv4 or IPv6 address and returns its
+// canonical form. IPv4-mapped IPv6 addresses are reduced to IPv4.
+func normalizeAddr(s string) (string, error) {
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q", s)
+	}
+	return a.Unmap().String(), nil
+}
+
+// validateInterface checks the fields a client supplies on create and
+// update, normalizing the MAC and addresses in place. It returns nil if n
+// may be stored.
+func validateInterface(n *models.NetworkInterface) error {
+	if n.Name == "" {
+		return validationError("name is required")
+	}
+	if n.MAC == "" {
+		return validationError("mac is required")
+	}
+	mac, err := normalizeMAC(n.MAC)
+	if err != nil {
+		return validationError(err.Error())
+	}
+	n.MAC = mac
+	for i, s := range n.Addresses {
+		addr, err := normalizeAddr(s)
+		if err != nil {
+			return validationError(err.Error())
+		}
+		n.Addresses[i] = addr
+	}
+	if n.VLAN < 0 || n.VLAN > maxVLAN {
+		return validationError(fmt.Sprintf("vlan must be between 0 (untagged) and %d", maxVLAN))
+	}
+	if n.SpeedMbps < 0 {
+		return validationError("speed_mbps must not be negative")
+	}
+	return nil
+}
+
+// writeInterfaceError maps the errors returned by interface writes to a
+// response. notFound is the message used for sql.ErrNoRows.
+func writeInterfaceError(w http.ResponseWriter, err error, notFound, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, notFound)
+	case errors.Is(err, db.ErrMACInUse), errors.Is(err, db.ErrInterfaceNameInUse):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, failed)
+	}
+}
+
+// ListInterfaces handles GET /api/v1/machines/{id}/interfaces.
+func (h *Handler) ListInterfaces(w http.ResponseWriter, r *http.Request) {
+	ifaces, err := h.DB.ListInterfaces(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "machine not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list interfaces")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.InterfaceList{Interfaces: ifaces})
+}
+
+// CreateInterface handles POST /api/v1/machines/{id}/interfaces.
+func (h *Handler) CreateInterface(w http.ResponseWriter, r *http.Request) {
+	var req models.NetworkInterface
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateInterface(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	req.ID = uuid.New().String()
+	req.MachineID = r.PathValue("id")
+	req.CreatedAt = now
+	req.UpdatedAt = now
+
+	if err := h.DB.CreateInterface(&req); err != nil {
+		writeInterfaceError(w, err, "machine not found", "failed to create interface")
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// GetInterface handles GET /api/v1/machines/{id}/interfaces/{iface}.
+func (h *Handler) GetInterface(w http.ResponseWriter, r *http.Request) {
+	n, err := h.DB.GetInterface(r.PathValue("id"), r.PathValue("iface"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "interface not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get interface")
+		return
+	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+// UpdateInterface handles PUT /api/v1/machines/{id}/interfaces/{iface},
+// replacing every client-supplied field.
+func (h *Handler) UpdateInterface(w http.ResponseWriter, r *http.Request) {
+	var req models.NetworkInterface
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateInterface(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req.ID = r.PathValue("iface")
+	req.MachineID = r.PathValue("id")
+	req.UpdatedAt = time.Now().UTC()
+
+	if err := h.DB.UpdateInterface(&req); err != nil {
+		writeInterfaceError(w, err, "interface not found", "failed to update interface")
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+// DeleteInterface handles DELETE /api/v1/machines/{id}/interfaces/{iface}.
+func (h *Handler) DeleteInterface(w http.ResponseWriter, r *http.Request) {
+	err := h.DB.DeleteInterface(r.PathValue("id"), r.PathValue("iface"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "interface not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete interface")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LookupInterfaces handles GET /api/v1/interfaces, finding interfaces by
+// exactly one of ?mac= or ?ip=. Both are normalized first, so any spelling
+// of a MAC or IPv6 address matches.
+func (h *Handler) LookupInterfaces(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mac, ip := q.Get("mac"), q.Get("ip")
+	if (mac == "") == (ip == "") {
+		writeError(w, http.StatusBadRequest, "exactly one of mac or ip is required")
+		return
+	}
+
+	var (
+		ifaces []*models.NetworkInterface
+		err    error
+	)
+	if mac != "" {
+		if mac, err = normalizeMAC(mac); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ifaces, err = h.DB.InterfacesByMAC(mac)
+	} else {
+		if ip, err = normalizeAddr(ip); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ifaces, err = h.DB.InterfacesByAddress(ip)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to look up interfaces")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.InterfaceList{Interfaces: ifaces})
+}
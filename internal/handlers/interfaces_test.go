@@ -0,0 +1,202 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// createTestInterface POSTs payload as an interface of machineID and returns
+// the created record, failing the test on any non-201 response.
+func createTestInterface(t *testing.T, mux http.Handler, machineID string, payload map[string]any) models.NetworkInterface {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+machineID+"/interfaces", body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create interface: got %d, want 201\nbody: %s", w.Code, w.Body.String())
+	}
+	var n models.NetworkInterface
+	decodeBody(t, w, &n)
+	return n
+}
+
+func TestInterfaces_CRUD(t *testing.T) {
+	mux, _ := newTestMux(t)
+	m := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740"})
+	base := "/api/v1/machines/" + m.ID + "/interfaces"
+
+	created := createTestInterface(t, mux, m.ID, map[string]any{
+		"name": "eno1", "mac": "AA-BB-CC-00-11-22",
+		"addresses": []string{"192.168.1.10", "2001:DB8::0:10"}, "vlan": 10, "speed_mbps": 1000,
+	})
+	if created.ID == "" || created.MachineID != m.ID {
+		t.Errorf("created: ID %q MachineID %q", created.ID, created.MachineID)
+	}
+	if created.MAC != "aa:bb:cc:00:11:22" {
+		t.Errorf("MAC: got %q, want normalized aa:bb:cc:00:11:22", created.MAC)
+	}
+	if len(created.Addresses) != 2 || created.Addresses[1] != "2001:db8::10" {
+		t.Errorf("Addresses: got %v, want canonical IPv6", created.Addresses)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, base, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: got %d, want 200", w.Code)
+	}
+	var list models.InterfaceList
+	decodeBody(t, w, &list)
+	if len(list.Interfaces) != 1 || list.Interfaces[0].Name != "eno1" {
+		t.Fatalf("list: got %+v", list.Interfaces)
+	}
+
+	body, _ := json.Marshal(map[string]any{"name": "eno1", "mac": "aabb.cc00.1122", "speed_mbps": 10000})
+	w = serve(mux, authReq(http.MethodPut, base+"/"+created.ID, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var updated models.NetworkInterface
+	decodeBody(t, w, &updated)
+	if updated.SpeedMbps != 10000 || updated.VLAN != 0 || len(updated.Addresses) != 0 {
+		t.Errorf("update should replace every field: %+v", updated)
+	}
+	if updated.CreatedAt.Unix() != created.CreatedAt.Unix() {
+		t.Errorf("CreatedAt changed: got %v, want %v", updated.CreatedAt, created.CreatedAt)
+	}
+
+	if w := serve(mux, authReq(http.MethodDelete, base+"/"+created.ID, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d, want 204", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, base+"/"+created.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: got %d, want 404", w.Code)
+	}
+}
+
+func TestInterfaces_ValidationErrors(t *testing.T) {
+	mux, _ := newTestMux(t)
+	m := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740"})
+
+	tests := []struct {
+		name    string
+		payload map[string]any
+	}{
+		{"missing name", map[string]any{"mac": "aa:bb:cc:00:11:22"}},
+		{"missing mac", map[string]any{"name": "eno1"}},
+		{"invalid mac", map[string]any{"name": "eno1", "mac": "not-a-mac"}},
+		{"invalid address", map[string]any{"name": "eno1", "mac": "aa:bb:cc:00:11:22", "addresses": []string{"10.0.0.300"}}},
+		{"address with prefix", map[string]any{"name": "eno1", "mac": "aa:bb:cc:00:11:22", "addresses": []string{"10.0.0.1/24"}}},
+		{"vlan out of range", map[string]any{"name": "eno1", "mac": "aa:bb:cc:00:11:22", "vlan": 4095}},
+		{"negative speed", map[string]any{"name": "eno1", "mac": "aa:bb:cc:00:11:22", "speed_mbps": -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.payload)
+			w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+m.ID+"/interfaces", body))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status: got %d, want 400\nbody: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestInterfaces_Conflicts(t *testing.T) {
+	mux, _ := newTestMux(t)
+	pve := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740"})
+	nas := createTestMachine(t, mux, map[string]any{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+"})
+	createTestInterface(t, mux, pve.ID, map[string]any{"name": "eno1", "mac": "aa:bb:cc:00:11:22"})
+
+	tests := []struct {
+		name      string
+		machineID string
+		payload   map[string]any
+	}{
+		{"mac on another machine", nas.ID, map[string]any{"name": "eth0", "mac": "AA:BB:CC:00:11:22"}},
+		{"name on same machine", pve.ID, map[string]any{"name": "eno1", "mac": "aa:bb:cc:00:11:33"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.payload)
+			w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+tt.machineID+"/interfaces", body))
+			if w.Code != http.StatusConflict {
+				t.Errorf("status: got %d, want 409\nbody: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// The same name on a different machine is fine.
+	createTestInterface(t, mux, nas.ID, map[string]any{"name": "eno1", "mac": "aa:bb:cc:00:11:44"})
+}
+
+func TestInterfaces_MachineNotFound(t *testing.T) {
+	mux, _ := newTestMux(t)
+	body := []byte(`{"name": "eno1", "mac": "aa:bb:cc:00:11:22"}`)
+	if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/nope/interfaces", body)); w.Code != http.StatusNotFound {
+		t.Errorf("create: got %d, want 404", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/nope/interfaces", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("list: got %d, want 404", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodPut, "/api/v1/machines/nope/interfaces/nic", body)); w.Code != http.StatusNotFound {
+		t.Errorf("update: got %d, want 404", w.Code)
+	}
+}
+
+func TestLookupInterfaces(t *testing.T) {
+	mux, _ := newTestMux(t)
+	pve := createTestMachine(t, mux, map[string]any{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740"})
+	nas := createTestMachine(t, mux, map[string]any{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+"})
+	createTestInterface(t, mux, pve.ID, map[string]any{"name": "eno1", "mac": "aa:bb:cc:00:11:22", "addresses": []string{"10.0.0.5", "fd00::5"}})
+	createTestInterface(t, mux, nas.ID, map[string]any{"name": "eth0", "mac": "aa:bb:cc:00:11:33", "addresses": []string{"10.0.0.5"}})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"mac=AA-BB-CC-00-11-22", []string{pve.ID}},
+		{"ip=10.0.0.5", []string{nas.ID, pve.ID}},
+		{"ip=fd00:0:0::5", []string{pve.ID}},
+		{"ip=10.0.0.6", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodGet, "/api/v1/interfaces?"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+			}
+			var list models.InterfaceList
+			decodeBody(t, w, &list)
+			var got []string
+			for _, n := range list.Interfaces {
+				got = append(got, n.MachineID)
+			}
+			slices.Sort(got)
+			slices.Sort(tt.want)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got machines %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Interfaces of trashed machines are not returned.
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/machines/"+nas.ID, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d, want 204", w.Code)
+	}
+	var list models.InterfaceList
+	decodeBody(t, serve(mux, authReq(http.MethodGet, "/api/v1/interfaces?ip=10.0.0.5", nil)), &list)
+	if len(list.Interfaces) != 1 || list.Interfaces[0].MachineID != pve.ID {
+		t.Errorf("after trashing nas01: got %+v", list.Interfaces)
+	}
+}
+
+func TestLookupInterfaces_BadRequest(t *testing.T) {
+	mux, _ := newTestMux(t)
+	for _, query := range []string{"", "mac=aa:bb:cc:00:11:22&ip=10.0.0.1", "mac=zz", "ip=host.lan"} {
+		t.Run(query, func(t *testing.T) {
+			if w := serve(mux, authReq(http.MethodGet, "/api/v1/interfaces?"+query, nil)); w.Code != http.StatusBadRequest {
+				t.Errorf("status: got %d, want 400", w.Code)
+			}
+		})
+	}
+}
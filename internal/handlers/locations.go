@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// maxRackHeightU is the tallest rack, and so the tallest machine, accepted.
+const maxRackHeightU = 100
+
+// validateLocation checks the fields a client supplies on create and update.
+// Parent rules need the stored parent and are checked by the db package.
+func validateLocation(l *models.Location) error {
+	if l.Name == "" || l.Kind == "" {
+		return validationError("name and kind are required")
+	}
+	if _, ok := models.LocationParentKinds[l.Kind]; !ok {
+		return validationError("invalid kind: must be site, room, or rack")
+	}
+	if l.Kind == models.LocationRack && (l.HeightU < 1 || l.HeightU > maxRackHeightU) {
+		return validationError(fmt.Sprintf("height_u must be between 1 and %d for a rack", maxRackHeightU))
+	}
+	if l.Kind != models.LocationRack && l.HeightU != 0 {
+		return validationError("height_u is only valid for racks")
+	}
+	return nil
+}
+
+// writeLocationError maps the errors returned by location writes to a
+// response. notFound is the message used for sql.ErrNoRows.
+func writeLocationError(w http.ResponseWriter, err error, notFound, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, notFound)
+	case errors.Is(err, db.ErrLocationNotFound):
+		writeError(w, http.StatusBadRequest, "parent location not found")
+	case errors.Is(err, db.ErrInvalidLocationParent):
+		writeError(w, http.StatusBadRequest, "a site has no parent, a room's parent must be a site, and a rack's parent must be a room")
+	case errors.Is(err, db.ErrLocationNameInUse),
+		errors.Is(err, db.ErrLocationInUse),
+		errors.Is(err, db.ErrRackPositionOutOfRange):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, failed)
+	}
+}
+
+// ListLocations handles GET /api/v1/locations, optionally filtered by
+// ?kind= and ?parent_id=.
+func (h *Handler) ListLocations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := db.LocationFilter{Kind: q.Get("kind"), ParentID: q.Get("parent_id")}
+	if _, ok := models.LocationParentKinds[f.Kind]; f.Kind != "" && !ok {
+		writeError(w, http.StatusBadRequest, "invalid kind")
+		return
+	}
+	locs, err := h.DB.ListLocations(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list locations")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.LocationList{Locations: locs})
+}
+
+// CreateLocation handles POST /api/v1/locations.
+func (h *Handler) CreateLocation(w http.ResponseWriter, r *http.Request) {
+	var req models.Location
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateLocation(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	req.ID = uuid.New().String()
+	req.CreatedAt = now
+	req.UpdatedAt = now
+
+	if err := h.DB.CreateLocation(&req); err != nil {
+		writeLocationError(w, err, "location not found", "failed to create location")
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// GetLocation handles GET /api/v1/locations/{id}.
+func (h *Handler) GetLocation(w http.ResponseWriter, r *http.Request) {
+	l, err := h.DB.GetLocation(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "location not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get location")
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// UpdateLocation handles PUT /api/v1/locations/{id}, replacing every
+// client-supplied field.
+func (h *Handler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	var req models.Location
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateLocation(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req.ID = r.PathValue("id")
+	req.UpdatedAt = time.Now().UTC()
+
+	if err := h.DB.UpdateLocation(&req); err != nil {
+		writeLocationError(w, err, "location not found", "failed to update location")
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+// DeleteLocation handles DELETE /api/v1/locations/{id}. Locations that other
+// locations, machines, or assets still refer to answer 409.
+func (h *Handler) DeleteLocation(w http.ResponseWriter, r *http.Request) {
+	if err := h.DB.DeleteLocation(r.PathValue("id")); err != nil {
+		writeLocationError(w, err, "location not found", "failed to delete location")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,173 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// createTestLocation POSTs payload and returns the created location, failing
+// the test on any non-201 response.
+func createTestLocation(t *testing.T, mux http.Handler, payload map[string]any) models.Location {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	w := serve(mux, authReq(http.MethodPost, "/api/v1/locations", body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create location: got %d, want 201\nbody: %s", w.Code, w.Body.String())
+	}
+	var l models.Location
+	decodeBody(t, w, &l)
+	return l
+}
+
+func TestLocations_CRUD(t *testing.T) {
+	mux, _ := newTestMux(t)
+	site := createTestLocation(t, mux, map[string]any{"name": "home", "kind": "site"})
+	room := createTestLocation(t, mux, map[string]any{"name": "office", "kind": "room", "parent_id": site.ID})
+	rack := createTestLocation(t, mux, map[string]any{"name": "office rack", "kind": "rack", "parent_id": room.ID, "height_u": 12})
+	if rack.ID == "" || rack.ParentID != room.ID || rack.HeightU != 12 {
+		t.Errorf("created rack: %+v", rack)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/locations?kind=rack", nil))
+	var list models.LocationList
+	decodeBody(t, w, &list)
+	if len(list.Locations) != 1 || list.Locations[0].ID != rack.ID {
+		t.Errorf("list kind=rack: got %+v", list.Locations)
+	}
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/locations?parent_id="+site.ID, nil))
+	decodeBody(t, w, &list)
+	if len(list.Locations) != 1 || list.Locations[0].ID != room.ID {
+		t.Errorf("list parent_id=site: got %+v", list.Locations)
+	}
+
+	body, _ := json.Marshal(map[string]any{"name": "office rack", "kind": "rack", "parent_id": room.ID, "height_u": 24})
+	w = serve(mux, authReq(http.MethodPut, "/api/v1/locations/"+rack.ID, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/locations/"+rack.ID, nil))
+	var got models.Location
+	decodeBody(t, w, &got)
+	if got.HeightU != 24 || got.CreatedAt.Unix() != rack.CreatedAt.Unix() {
+		t.Errorf("after update: %+v", got)
+	}
+
+	// The room still holds the rack.
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/locations/"+room.ID, nil)); w.Code != http.StatusConflict {
+		t.Errorf("delete room with rack: got %d, want 409", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/locations/"+rack.ID, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete rack: got %d, want 204", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/locations/"+rack.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted rack: got %d, want 404", w.Code)
+	}
+}
+
+func TestLocations_Validation(t *testing.T) {
+	mux, _ := newTestMux(t)
+	site := createTestLocation(t, mux, map[string]any{"name": "home", "kind": "site"})
+	room := createTestLocation(t, mux, map[string]any{"name": "Office", "kind": "room", "parent_id": site.ID})
+
+	tests := []struct {
+		name    string
+		payload map[string]any
+		want    int
+	}{
+		{"missing name", map[string]any{"kind": "site"}, http.StatusBadRequest},
+		{"invalid kind", map[string]any{"name": "x", "kind": "shelf"}, http.StatusBadRequest},
+		{"rack without height", map[string]any{"name": "r", "kind": "rack", "parent_id": room.ID}, http.StatusBadRequest},
+		{"height on a room", map[string]any{"name": "r", "kind": "room", "parent_id": site.ID, "height_u": 4}, http.StatusBadRequest},
+		{"room without site", map[string]any{"name": "r", "kind": "room"}, http.StatusBadRequest},
+		{"site with parent", map[string]any{"name": "s", "kind": "site", "parent_id": site.ID}, http.StatusBadRequest},
+		{"rack in a site", map[string]any{"name": "r", "kind": "rack", "parent_id": site.ID, "height_u": 42}, http.StatusBadRequest},
+		{"unknown parent", map[string]any{"name": "r", "kind": "room", "parent_id": "missing"}, http.StatusBadRequest},
+		{"duplicate name ignoring case", map[string]any{"name": "office", "kind": "room", "parent_id": site.ID}, http.StatusConflict},
+		{"duplicate site", map[string]any{"name": "HOME", "kind": "site"}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.payload)
+			w := serve(mux, authReq(http.MethodPost, "/api/v1/locations", body))
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d\nbody: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/locations?kind=shelf", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("list kind=shelf: got %d, want 400", w.Code)
+	}
+}
+
+func TestMachineRackPlacement(t *testing.T) {
+	mux, _ := newTestMux(t)
+	site := createTestLocation(t, mux, map[string]any{"name": "home", "kind": "site"})
+	room := createTestLocation(t, mux, map[string]any{"name": "office", "kind": "room", "parent_id": site.ID})
+	rack := createTestLocation(t, mux, map[string]any{"name": "rack1", "kind": "rack", "parent_id": room.ID, "height_u": 12})
+
+	server := createTestMachine(t, mux, map[string]any{
+		"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R740",
+		"location_id": rack.ID, "rack_u": 3, "u_height": 2,
+	})
+	if server.LocationID != rack.ID || server.RackU != 3 || server.UHeight != 2 {
+		t.Errorf("created placement: %+v", server)
+	}
+	sw := createTestMachine(t, mux, map[string]any{
+		"name": "sw1", "kind": "bare_metal", "make": "Ubiquiti", "model": "USW-24",
+		"location_id": rack.ID, "rack_u": 12,
+	})
+	if sw.UHeight != 1 {
+		t.Errorf("u_height default: got %d, want 1", sw.UHeight)
+	}
+	// Placing a machine in a room needs no rack position.
+	createTestMachine(t, mux, map[string]any{"name": "ws1", "kind": "workstation", "make": "HP", "model": "Z2", "location_id": room.ID})
+
+	tests := []struct {
+		name  string
+		patch string
+		want  int
+	}{
+		{"overlaps pve1 from below", `{"location_id": "` + rack.ID + `", "rack_u": 2, "u_height": 2}`, http.StatusConflict},
+		{"overlaps pve1 from above", `{"location_id": "` + rack.ID + `", "rack_u": 4}`, http.StatusConflict},
+		{"past the top", `{"location_id": "` + rack.ID + `", "rack_u": 11, "u_height": 3}`, http.StatusBadRequest},
+		{"not a rack", `{"location_id": "` + room.ID + `", "rack_u": 1}`, http.StatusBadRequest},
+		{"rack_u without location", `{"rack_u": 1}`, http.StatusBadRequest},
+		{"unknown location", `{"location_id": "missing"}`, http.StatusBadRequest},
+		{"negative rack_u", `{"location_id": "` + rack.ID + `", "rack_u": -1}`, http.StatusBadRequest},
+		{"free slot", `{"location_id": "` + rack.ID + `", "rack_u": 5, "u_height": 2}`, http.StatusOK},
+	}
+	m := createTestMachine(t, mux, map[string]any{"name": "nas01", "kind": "nas", "make": "Synology", "model": "RS820+"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(mux, patchReq("/api/v1/machines/"+m.ID, tt.patch))
+			if w.Code != tt.want {
+				t.Errorf("PATCH %s: got %d, want %d\nbody: %s", tt.patch, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// A machine may be re-saved in its own position.
+	if w := serve(mux, patchReq("/api/v1/machines/"+server.ID, `{"notes": "rails installed"}`)); w.Code != http.StatusOK {
+		t.Errorf("re-save in place: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+
+	// The rack cannot shrink below sw1 at U12, nor be deleted while in use.
+	body, _ := json.Marshal(map[string]any{"name": "rack1", "kind": "rack", "parent_id": room.ID, "height_u": 10})
+	if w := serve(mux, authReq(http.MethodPut, "/api/v1/locations/"+rack.ID, body)); w.Code != http.StatusConflict {
+		t.Errorf("shrink rack below placed machine: got %d, want 409", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/locations/"+rack.ID, nil)); w.Code != http.StatusConflict {
+		t.Errorf("delete rack in use: got %d, want 409", w.Code)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/machines?location_id="+rack.ID+"&sort=name", nil))
+	var list models.MachineList
+	decodeBody(t, w, &list)
+	if len(list.Machines) != 3 {
+		t.Errorf("machines in rack: got %d, want 3", len(list.Machines))
+	}
+}
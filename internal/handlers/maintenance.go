@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// validateMaintenance checks the fields a client supplies on create and
+// update. It returns nil if e may be stored.
+func validateMaintenance(e *models.MaintenanceEvent) error {
+	if e.Type == "" || e.Date == "" {
+		return validationError("type and date are required")
+	}
+	if !models.ValidMaintenanceTypes[e.Type] {
+		return validationError("invalid type: must be repair, upgrade, firmware, or cleaning")
+	}
+	for _, d := range []struct{ name, value string }{
+		{"date", e.Date},
+		{"completed_date", e.CompletedDate},
+	} {
+		if _, err := time.Parse(time.DateOnly, d.value); d.value != "" && err != nil {
+			return validationError(d.name + " must be a YYYY-MM-DD date")
+		}
+	}
+	if e.CompletedDate != "" && e.CompletedDate < e.Date {
+		return validationError("completed_date must not be before date")
+	}
+	if e.Cost < 0 {
+		return validationError("cost must not be negative")
+	}
+	e.Currency = strings.ToUpper(e.Currency)
+	if e.Currency != "" && !isCurrencyCode(e.Currency) {
+		return validationError("currency must be a three-letter ISO 4217 code such as USD")
+	}
+	if e.Cost > 0 && e.Currency == "" {
+		return validationError("currency is required when cost is set")
+	}
+	return nil
+}
+
+// writeMaintenanceError maps the errors returned by maintenance writes to a
+// response. notFound is the message used for sql.ErrNoRows.
+func writeMaintenanceError(w http.ResponseWriter, err error, notFound, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, notFound)
+	case errors.Is(err, db.ErrCannotHold):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		if status := placementErrorStatus(err); status != 0 {
+			writeError(w, status, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, failed)
+	}
+}
+
+// ListMaintenance handles GET /api/v1/machines/{id}/maintenance, returning
+// the machine's maintenance events newest first.
+func (h *Handler) ListMaintenance(w http.ResponseWriter, r *http.Request) {
+	events, err := h.DB.ListMaintenance(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "machine not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list maintenance events")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.MaintenanceList{Events: events})
+}
+
+// CreateMaintenance handles POST /api/v1/machines/{id}/maintenance. An open
+// event with sets_status moves an active machine to maintenance.
+func (h *Handler) CreateMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req models.MaintenanceEvent
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateMaintenance(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	req.ID = uuid.New().String()
+	req.MachineID = r.PathValue("id")
+	req.CreatedAt = now
+	req.UpdatedAt = now
+
+	if err := h.DB.CreateMaintenance(&req, actor(r)); err != nil {
+		writeMaintenanceError(w, err, "machine not found", "failed to create maintenance event")
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// GetMaintenance handles GET /api/v1/machines/{id}/maintenance/{event}.
+func (h *Handler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	e, err := h.DB.GetMaintenance(r.PathValue("id"), r.PathValue("event"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "maintenance event not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get maintenance event")
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// UpdateMaintenance handles PUT /api/v1/machines/{id}/maintenance/{event},
+// replacing every client-supplied field. Setting completed_date on the last
+// open event that held the machine in maintenance returns it to active.
+func (h *Handler) UpdateMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req models.MaintenanceEvent
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateMaintenance(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req.ID = r.PathValue("event")
+	req.MachineID = r.PathValue("id")
+	req.UpdatedAt = time.Now().UTC()
+
+	if err := h.DB.UpdateMaintenance(&req, actor(r)); err != nil {
+		writeMaintenanceError(w, err, "maintenance event not found", "failed to update maintenance event")
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+// DeleteMaintenance handles DELETE /api/v1/machines/{id}/maintenance/{event}.
+func (h *Handler) DeleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	err := h.DB.DeleteMaintenance(r.PathValue("id"), r.PathValue("event"), actor(r))
+	if err != nil {
+		writeMaintenanceError(w, err, "maintenance event not found", "failed to delete maintenance event")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
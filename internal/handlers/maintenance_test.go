@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// createTestMaintenance POSTs payload to the machine's maintenance log and
+// returns the created event, failing the test on any non-201 response.
+func createTestMaintenance(t *testing.T, mux http.Handler, machineID string, payload map[string]any) models.MaintenanceEvent {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+machineID+"/maintenance", body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create maintenance event: got %d, want 201\nbody: %s", w.Code, w.Body.String())
+	}
+	var e models.MaintenanceEvent
+	decodeBody(t, w, &e)
+	return e
+}
+
+// machineStatus fetches the machine with the given ID and returns its status.
+func machineStatus(t *testing.T, mux http.Handler, id string) string {
+	t.Helper()
+	var m models.Machine
+	decodeBody(t, serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+id, nil)), &m)
+	return m.Status
+}
+
+func TestMaintenance_CRUD(t *testing.T) {
+	mux, _ := newTestMux(t)
+	m := createTestMachine(t, mux, map[string]any{"name": "nas1", "kind": "nas", "make": "Synology", "model": "DS920+"})
+	createTestMaintenance(t, mux, m.ID, map[string]any{
+		"type": "cleaning", "date": "2024-01-10", "completed_date": "2024-01-10", "performed_by": "tom",
+	})
+	e := createTestMaintenance(t, mux, m.ID, map[string]any{
+		"type": "repair", "description": "replace failed PSU", "date": "2024-06-01",
+		"cost": 89.5, "currency": "usd",
+	})
+	if e.ID == "" || e.MachineID != m.ID || e.Currency != "USD" || e.CompletedDate != "" {
+		t.Errorf("created event: %+v", e)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+m.ID+"/maintenance", nil))
+	var list models.MaintenanceList
+	decodeBody(t, w, &list)
+	if len(list.Events) != 2 || list.Events[0].ID != e.ID || list.Events[1].Type != "cleaning" {
+		t.Errorf("list should be newest first: got %+v", list.Events)
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"type": "repair", "description": "replace failed PSU", "date": "2024-06-01", "completed_date": "2024-06-03",
+		"cost": 89.5, "currency": "USD",
+	})
+	w = serve(mux, authReq(http.MethodPut, "/api/v1/machines/"+m.ID+"/maintenance/"+e.ID, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+m.ID+"/maintenance/"+e.ID, nil))
+	var got models.MaintenanceEvent
+	decodeBody(t, w, &got)
+	if got.CompletedDate != "2024-06-03" || got.CreatedAt.Unix() != e.CreatedAt.Unix() {
+		t.Errorf("after update: %+v", got)
+	}
+
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/machines/"+m.ID+"/maintenance/"+e.ID, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d, want 204", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+m.ID+"/maintenance/"+e.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted: got %d, want 404", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/missing/maintenance", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("list for missing machine: got %d, want 404", w.Code)
+	}
+}
+
+func TestMaintenance_Validation(t *testing.T) {
+	mux, _ := newTestMux(t)
+	m := createTestMachine(t, mux, map[string]any{"name": "nas1", "kind": "nas", "make": "Synology", "model": "DS920+"})
+
+	cases := []struct {
+		name    string
+		payload map[string]any
+		want    int
+	}{
+		{"missing date", map[string]any{"type": "repair"}, http.StatusBadRequest},
+		{"invalid type", map[string]any{"type": "polish", "date": "2024-06-01"}, http.StatusBadRequest},
+		{"bad date", map[string]any{"type": "repair", "date": "06/01/2024"}, http.StatusBadRequest},
+		{"completed before started", map[string]any{"type": "repair", "date": "2024-06-01", "completed_date": "2024-05-31"}, http.StatusBadRequest},
+		{"negative cost", map[string]any{"type": "repair", "date": "2024-06-01", "cost": -1, "currency": "USD"}, http.StatusBadRequest},
+		{"cost without currency", map[string]any{"type": "repair", "date": "2024-06-01", "cost": 10}, http.StatusBadRequest},
+		{"bad currency", map[string]any{"type": "repair", "date": "2024-06-01", "cost": 10, "currency": "dollars"}, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.payload)
+			w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+m.ID+"/maintenance", body))
+			if w.Code != tc.want {
+				t.Errorf("got %d, want %d\nbody: %s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMaintenance_SetsStatus(t *testing.T) {
+	mux, _ := newTestMux(t)
+	m := createTestMachine(t, mux, map[string]any{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640"})
+	open := map[string]any{"type": "firmware", "date": "2024-06-01", "sets_status": true}
+
+	e := createTestMaintenance(t, mux, m.ID, open)
+	if got := machineStatus(t, mux, m.ID); got != models.StatusMaintenance {
+		t.Fatalf("status with open event: got %q, want maintenance", got)
+	}
+
+	open["completed_date"] = "2024-06-02"
+	body, _ := json.Marshal(open)
+	if w := serve(mux, authReq(http.MethodPut, "/api/v1/machines/"+m.ID+"/maintenance/"+e.ID, body)); w.Code != http.StatusOK {
+		t.Fatalf("close event: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	if got := machineStatus(t, mux, m.ID); got != models.StatusActive {
+		t.Errorf("status after closing event: got %q, want active", got)
+	}
+
+	// A machine that is not in service cannot be held in maintenance.
+	planned := createTestMachine(t, mux, map[string]any{"name": "pve9", "kind": "proxmox", "make": "Dell", "model": "R640", "status": "planned"})
+	body, _ = json.Marshal(map[string]any{"type": "upgrade", "date": "2024-06-01", "sets_status": true})
+	if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+planned.ID+"/maintenance", body)); w.Code != http.StatusConflict {
+		t.Errorf("open event on planned machine: got %d, want 409", w.Code)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+const (
+	// defaultWarrantyWindow is the expiring_within used when none is given.
+	defaultWarrantyWindow = 90
+	// maxWarrantyWindow bounds expiring_within to ten years.
+	maxWarrantyWindow = 3650
+)
+
+// parseDays parses a window such as "90d" or "12w" into a number of days.
+func parseDays(s string) (int, error) {
+	unit := 1
+	switch {
+	case strings.HasSuffix(s, "d"):
+		s = strings.TrimSuffix(s, "d")
+	case strings.HasSuffix(s, "w"):
+		s, unit = strings.TrimSuffix(s, "w"), 7
+	default:
+		return 0, fmt.Errorf("missing unit")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	return n * unit, nil
+}
+
+// reportDate returns the as_of query parameter, a YYYY-MM-DD date that
+// defaults to today in UTC. It writes a 400 and returns false if as_of is
+// malformed.
+func reportDate(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	v := r.URL.Query().Get("as_of")
+	if v == "" {
+		return time.Now().UTC().Truncate(24 * time.Hour), true
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "as_of must be a YYYY-MM-DD date")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// WarrantyReport handles GET /api/v1/reports/warranty. It lists machines
+// whose warranty ends within expiring_within (days or weeks, e.g. 90d or
+// 12w; default 90d) of as_of, including both ends.
+func (h *Handler) WarrantyReport(w http.ResponseWriter, r *http.Request) {
+	asOf, ok := reportDate(w, r)
+	if !ok {
+		return
+	}
+	days := defaultWarrantyWindow
+	if v := r.URL.Query().Get("expiring_within"); v != "" {
+		n, err := parseDays(v)
+		if err != nil || n < 0 || n > maxWarrantyWindow {
+			writeError(w, http.StatusBadRequest,
+				fmt.Sprintf("expiring_within must be a number of days or weeks such as 90d or 12w, at most %dd", maxWarrantyWindow))
+			return
+		}
+		days = n
+	}
+
+	report := models.WarrantyReport{
+		AsOf:  asOf.Format(time.DateOnly),
+		Until: asOf.AddDate(0, 0, days).Format(time.DateOnly),
+	}
+	machines, err := h.DB.WarrantyExpiring(report.AsOf, report.Until)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to build warranty report")
+		return
+	}
+	report.Machines = machines
+	writeJSON(w, http.StatusOK, report)
+}
+
+// CostReport handles GET /api/v1/reports/cost. group_by is kind (the
+// default) or location, and depreciation is computed as of as_of.
+func (h *Handler) CostReport(w http.ResponseWriter, r *http.Request) {
+	asOf, ok := reportDate(w, r)
+	if !ok {
+		return
+	}
+	groupBy := r.URL.Query().Get("group_by")
+	switch groupBy {
+	case "":
+		groupBy = db.CostByKind
+	case db.CostByKind, db.CostByLocation:
+	default:
+		writeError(w, http.StatusBadRequest, "group_by must be kind or location")
+		return
+	}
+
+	groups, err := h.DB.CostReport(groupBy, asOf)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to build cost report")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.CostReport{
+		AsOf:    asOf.Format(time.DateOnly),
+		GroupBy: groupBy,
+		Groups:  groups,
+	})
+}
+
+// PowerReport handles GET /api/v1/reports/power. It reports the idle and
+// peak load on each UPS against its capacity, with an estimated runtime, and
+// on each circuit that feeds machines directly.
+func (h *Handler) PowerReport(w http.ResponseWriter, r *http.Request) {
+	report, err := h.DB.PowerReport()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to build power report")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// CapacityReport handles GET /api/v1/reports/capacity. It totals the CPU
+// cores, RAM, and storage of the active hypervisor hosts per host, per
+// location, and overall, with the headroom left after each host's reserved
+// capacity.
+func (h *Handler) CapacityReport(w http.ResponseWriter, r *http.Request) {
+	report, err := h.DB.CapacityReport()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to build capacity report")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
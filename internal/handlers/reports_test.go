@@ -0,0 +1,270 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+func TestWarrantyReport(t *testing.T) {
+	mux, _ := newTestMux(t)
+	for _, c := range []map[string]any{
+		{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640", "warranty_end": "2026-11-01"},
+		{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740", "warranty_end": "2026-10-20"},
+		{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+", "warranty_end": "2027-06-01"},
+		{"name": "old", "kind": "nas", "make": "Synology", "model": "DS918+", "warranty_end": "2026-10-01"},
+		{"name": "retired", "kind": "proxmox", "make": "HP", "model": "DL20", "warranty_end": "2026-10-30", "status": "retired"},
+		{"name": "pi01", "kind": "sbc", "make": "Raspberry Pi", "model": "4 Model B"},
+	} {
+		createTestMachine(t, mux, c)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"as_of=2026-10-15", []string{"pve2", "pve1"}},
+		{"as_of=2026-10-15&expiring_within=10d", []string{"pve2"}},
+		{"as_of=2026-10-15&expiring_within=30w", []string{"pve2", "pve1"}},
+		{"as_of=2026-10-15&expiring_within=365d", []string{"pve2", "pve1", "nas01"}},
+		{"as_of=2026-10-20&expiring_within=0d", []string{"pve2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serve(mux, authReq(http.MethodGet, "/api/v1/reports/warranty?"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+			}
+			var report models.WarrantyReport
+			decodeBody(t, w, &report)
+			var names []string
+			for _, m := range report.Machines {
+				names = append(names, m.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/reports/warranty?as_of=2026-10-15", nil))
+	var report models.WarrantyReport
+	decodeBody(t, w, &report)
+	if report.AsOf != "2026-10-15" || report.Until != "2027-01-13" {
+		t.Errorf("window: got %s to %s, want 2026-10-15 to 2027-01-13", report.AsOf, report.Until)
+	}
+
+	for _, query := range []string{"expiring_within=90", "expiring_within=3m", "expiring_within=-5d", "expiring_within=9999d", "as_of=tomorrow"} {
+		if w := serve(mux, authReq(http.MethodGet, "/api/v1/reports/warranty?"+query, nil)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestCostReport(t *testing.T) {
+	mux, _ := newTestMux(t)
+	rack := createTestLocation(t, mux, map[string]any{"name": "rack1", "kind": "rack", "parent_id": createTestLocation(t, mux, map[string]any{
+		"name": "office", "kind": "room", "parent_id": createTestLocation(t, mux, map[string]any{"name": "home", "kind": "site"}).ID,
+	}).ID, "height_u": 42})
+	for _, c := range []map[string]any{
+		// 730 days into a four-year life of 1461 days.
+		{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640", "price": 2000, "currency": "usd",
+			"purchase_date": "2024-10-15", "lifetime_years": 4, "location_id": rack.ID},
+		// Not depreciated without a lifetime.
+		{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740", "price": 1000, "currency": "USD", "purchase_date": "2024-10-15"},
+		// Fully depreciated.
+		{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+", "price": 600, "currency": "USD",
+			"purchase_date": "2016-01-01", "lifetime_years": 5, "location_id": rack.ID},
+		{"name": "nas02", "kind": "nas", "make": "Synology", "model": "DS923+", "price": 500, "currency": "EUR", "location_id": rack.ID},
+		{"name": "sold", "kind": "nas", "make": "Synology", "model": "DS418", "price": 400, "currency": "USD", "status": "sold"},
+		{"name": "pi01", "kind": "sbc", "make": "Raspberry Pi", "model": "4 Model B"},
+	} {
+		createTestMachine(t, mux, c)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/reports/cost?as_of=2026-10-15", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var report models.CostReport
+	decodeBody(t, w, &report)
+	if report.GroupBy != "kind" || report.AsOf != "2026-10-15" {
+		t.Errorf("report: got group_by %q as_of %q", report.GroupBy, report.AsOf)
+	}
+	want := []models.CostGroup{
+		{Group: "nas", Currency: "EUR", Machines: 1, TotalCost: 500, BookValue: 500},
+		{Group: "nas", Currency: "USD", Machines: 1, TotalCost: 600},
+		{Group: "proxmox", Currency: "USD", Machines: 2, TotalCost: 3000, BookValue: 2000.68, AnnualDepreciation: 500},
+	}
+	if len(report.Groups) != len(want) {
+		t.Fatalf("groups: got %+v, want %d groups", report.Groups, len(want))
+	}
+	for i, g := range report.Groups {
+		if *g != want[i] {
+			t.Errorf("group %d: got %+v, want %+v", i, *g, want[i])
+		}
+	}
+
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/reports/cost?as_of=2026-10-15&group_by=location", nil))
+	decodeBody(t, w, &report)
+	var got []string
+	for _, g := range report.Groups {
+		got = append(got, fmt.Sprintf("%s/%s/%d", g.Name, g.Currency, g.Machines))
+	}
+	if fmt.Sprint(got) != "[/USD/1 rack1/EUR/1 rack1/USD/2]" {
+		t.Errorf("by location: got %v", got)
+	}
+
+	for _, query := range []string{"group_by=vendor", "as_of=2026-13-01"} {
+		if w := serve(mux, authReq(http.MethodGet, "/api/v1/reports/cost?"+query, nil)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestCostReport_FuturePurchase(t *testing.T) {
+	mux, _ := newTestMux(t)
+	createTestMachine(t, mux, map[string]any{"name": "pve3", "kind": "proxmox", "make": "Dell", "model": "R650",
+		"status": "ordered", "price": 3000, "currency": "USD", "purchase_date": "2027-01-01", "lifetime_years": 3})
+
+	for _, asOf := range []string{"2026-10-15", "2027-01-01"} {
+		w := serve(mux, authReq(http.MethodGet, "/api/v1/reports/cost?as_of="+asOf, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+		}
+		var report models.CostReport
+		decodeBody(t, w, &report)
+		want := models.CostGroup{Group: "proxmox", Currency: "USD", Machines: 1, TotalCost: 3000, BookValue: 3000}
+		if len(report.Groups) != 1 || *report.Groups[0] != want {
+			t.Errorf("as of %s: got %+v, want %+v", asOf, report.Groups, want)
+		}
+	}
+}
+
+func TestPowerReport(t *testing.T) {
+	mux, _ := newTestMux(t)
+	ups := createTestAsset(t, mux, "ups", map[string]any{
+		"name": "rack ups", "make": "APC", "model": "SMT1500", "va_rating": 1500, "watt_rating": 1000, "runtime_minutes": 7,
+	})
+	createTestMachine(t, mux, map[string]any{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640",
+		"ups_id": ups.ID, "idle_watts": 150, "peak_watts": 400})
+	nas := createTestMachine(t, mux, map[string]any{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+",
+		"ups_id": ups.ID, "rated_watts": 100})
+	createTestMachine(t, mux, map[string]any{"name": "pi01", "kind": "sbc", "make": "Raspberry Pi", "model": "4 Model B",
+		"circuit": "office-a", "rated_watts": 15})
+
+	// pve2 would take the UPS to 1100 W.
+	body := []byte(`{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740", "ups_id": "` + ups.ID + `", "peak_watts": 600}`)
+	if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines", body)); w.Code != http.StatusConflict {
+		t.Errorf("create over capacity: got %d, want 409\nbody: %s", w.Code, w.Body.String())
+	}
+	if w := serve(mux, patchReq("/api/v1/machines/"+nas.ID, `{"rated_watts": 700}`)); w.Code != http.StatusConflict {
+		t.Errorf("patch over capacity: got %d, want 409\nbody: %s", w.Code, w.Body.String())
+	}
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/ups/"+ups.ID, nil)); w.Code != http.StatusConflict {
+		t.Errorf("delete ups in use: got %d, want 409", w.Code)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/reports/power", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var report models.PowerReport
+	decodeBody(t, w, &report)
+	if len(report.UPS) != 1 {
+		t.Fatalf("ups: got %d entries, want 1", len(report.UPS))
+	}
+	u := report.UPS[0]
+	// 500 W of a 1000 W UPS doubles its 7 minute full-load runtime.
+	if u.Machines != 2 || u.IdleWatts != 250 || u.PeakWatts != 500 || u.CapacityWatts != 1000 ||
+		u.Utilization != 50 || u.EstimatedRuntimeMinutes != 14 {
+		t.Errorf("ups: got %+v", u)
+	}
+	if len(report.Circuits) != 1 || report.Circuits[0].Circuit != "office-a" || report.Circuits[0].PeakWatts != 15 {
+		t.Errorf("circuits: got %+v", report.Circuits)
+	}
+}
+
+func TestPowerValidation(t *testing.T) {
+	mux, _ := newTestMux(t)
+	for _, payload := range []string{
+		`"rated_watts": -1`,
+		`"idle_watts": 300, "peak_watts": 200`,
+		`"ups_id": "nope"`,
+		`"ups_id": "nope", "circuit": "office-a"`,
+	} {
+		body := []byte(`{"name": "n", "kind": "proxmox", "make": "m", "model": "m", ` + payload + `}`)
+		if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines", body)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400\nbody: %s", payload, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCapacityReport(t *testing.T) {
+	mux, _ := newTestMux(t)
+	rack := createTestLocation(t, mux, map[string]any{"name": "rack1", "kind": "rack", "parent_id": createTestLocation(t, mux, map[string]any{
+		"name": "office", "kind": "room", "parent_id": createTestLocation(t, mux, map[string]any{"name": "home", "kind": "site"}).ID,
+	}).ID, "height_u": 42})
+	for _, c := range []map[string]any{
+		{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640", "location_id": rack.ID,
+			"cpu_cores": 20, "ram_gb": 256, "storage_tb": 4, "reserved_cores": 4, "reserved_ram_gb": 32, "reserved_storage_tb": 0.5},
+		{"name": "pve2", "kind": "proxmox", "make": "Dell", "model": "R740", "location_id": rack.ID,
+			"cpu_cores": 16, "ram_gb": 128, "storage_tb": 2.2},
+		// Overcommitted on cores.
+		{"name": "pve3", "kind": "proxmox", "make": "Intel", "model": "NUC", "cpu_cores": 4, "ram_gb": 64, "storage_tb": 1, "reserved_cores": 6},
+		// Not counted: wrong kind, or not in service.
+		{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+", "cpu_cores": 4, "ram_gb": 8},
+		{"name": "pve4", "kind": "proxmox", "make": "Dell", "model": "R650", "cpu_cores": 32, "status": "planned"},
+		{"name": "pve5", "kind": "proxmox", "make": "Dell", "model": "R630", "cpu_cores": 24, "status": "retired"},
+	} {
+		createTestMachine(t, mux, c)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/reports/capacity", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var report models.CapacityReport
+	decodeBody(t, w, &report)
+
+	var hosts []string
+	for _, h := range report.Hosts {
+		hosts = append(hosts, h.Name)
+	}
+	if report.Kind != "proxmox" || fmt.Sprint(hosts) != "[pve1 pve2 pve3]" {
+		t.Fatalf("hosts: got kind %q, %v", report.Kind, hosts)
+	}
+	if got, want := report.Hosts[0].Available, (models.Resources{CPUCores: 16, RAMGB: 224, StorageTB: 3.5}); got != want {
+		t.Errorf("pve1 available: got %+v, want %+v", got, want)
+	}
+	if got := report.Hosts[2].Available.CPUCores; got != -2 {
+		t.Errorf("pve3 available cores: got %d, want -2", got)
+	}
+
+	if len(report.Locations) != 2 {
+		t.Fatalf("locations: got %+v, want 2", report.Locations)
+	}
+	if l := report.Locations[0]; l.LocationID != "" || l.Hosts != 1 || l.Total.RAMGB != 64 {
+		t.Errorf("unplaced hosts: got %+v", l)
+	}
+	l := report.Locations[1]
+	want := models.CapacityTotals{
+		Hosts:     2,
+		Total:     models.Resources{CPUCores: 36, RAMGB: 384, StorageTB: 6.2},
+		Reserved:  models.Resources{CPUCores: 4, RAMGB: 32, StorageTB: 0.5},
+		Available: models.Resources{CPUCores: 32, RAMGB: 352, StorageTB: 5.7},
+	}
+	if l.Name != "rack1" || l.LocationID != rack.ID || l.CapacityTotals != want {
+		t.Errorf("rack1: got %+v, want %+v", l, want)
+	}
+	if o := report.Overall; o.Hosts != 3 || o.Total.CPUCores != 40 || o.Available.CPUCores != 30 || o.Available.StorageTB != 6.7 {
+		t.Errorf("overall: got %+v", o)
+	}
+
+	body := []byte(`{"name": "n", "kind": "proxmox", "make": "m", "model": "m", "reserved_ram_gb": -8}`)
+	if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines", body)); w.Code != http.StatusBadRequest {
+		t.Errorf("negative reserved_ram_gb: got %d, want 400", w.Code)
+	}
+}
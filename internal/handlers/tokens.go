@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tphummel/lab_gear/internal/db"
+	"github.com/tphummel/lab_gear/internal/middleware"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+const (
+	// tokenSecretPrefix starts every issued token secret, so a leaked one is
+	// easy to recognise in logs and secret scanners.
+	tokenSecretPrefix = "lgt_"
+	// tokenSecretBytes is how many random bytes a token secret carries.
+	tokenSecretBytes = 32
+	maxTokenNameLen  = 64
+)
+
+// RoutePolicy lists the routes that need more than the default scope for
+// their method: managing tokens, and purging machines, which cannot be
+// undone. See middleware.Policy.
+var RoutePolicy = middleware.Policy{
+	"GET /api/v1/tokens":         models.ScopeAdmin,
+	"POST /api/v1/tokens":        models.ScopeAdmin,
+	"DELETE /api/v1/tokens/{id}": models.ScopeAdmin,
+	"DELETE /api/v1/trash/{id}":  models.ScopeAdmin,
+}
+
+// newTokenSecret returns a random token secret.
+func newTokenSecret() (string, error) {
+	b := make([]byte, tokenSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenSecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validateToken checks the fields a client supplies on create, sorting and
+// de-duplicating the scopes. It returns nil if t may be stored.
+func validateToken(t *models.APIToken, now time.Time) error {
+	if t.Name == "" || len(t.Name) > maxTokenNameLen {
+		return validationError("name is required and must be at most 64 characters")
+	}
+	if len(t.Scopes) == 0 {
+		return validationError("scopes is required")
+	}
+	for _, s := range t.Scopes {
+		if !models.ValidScopes[s] {
+			return validationError("invalid scope: must be machines:read, machines:write, or admin")
+		}
+	}
+	slices.Sort(t.Scopes)
+	t.Scopes = slices.Compact(t.Scopes)
+	if t.ExpiresAt != nil && !t.ExpiresAt.After(now) {
+		return validationError("expires_at must be in the future")
+	}
+	return nil
+}
+
+// ListTokens handles GET /api/v1/tokens. Secrets are never returned.
+func (h *Handler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.DB.ListTokens()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list tokens")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.APITokenList{Tokens: tokens})
+}
+
+// CreateToken handles POST /api/v1/tokens. The response is the only place
+// the token's secret is ever shown.
+func (h *Handler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var req models.APIToken
+	if !readJSON(w, r, &req) {
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := validateToken(&req, now); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	secret, err := newTokenSecret()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+	req.ID = uuid.New().String()
+	req.LastUsedAt = nil
+	req.CreatedAt = now
+	if req.ExpiresAt != nil {
+		exp := req.ExpiresAt.UTC().Truncate(time.Second)
+		req.ExpiresAt = &exp
+	}
+
+	err = h.DB.CreateToken(&req, secret)
+	if errors.Is(err, db.ErrTokenNameInUse) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+	writeJSON(w, http.StatusCreated, models.NewAPIToken{APIToken: req, Token: secret})
+}
+
+// DeleteToken handles DELETE /api/v1/tokens/{id}, revoking the token.
+func (h *Handler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	err := h.DB.DeleteToken(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "token not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to revoke token")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+// createTestToken POSTs payload to the token API and returns the created
+// token with its secret, failing the test on any non-201 response.
+func createTestToken(t *testing.T, mux http.Handler, payload map[string]any) models.NewAPIToken {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	w := serve(mux, authReq(http.MethodPost, "/api/v1/tokens", body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token: got %d, want 201\nbody: %s", w.Code, w.Body.String())
+	}
+	var tok models.NewAPIToken
+	decodeBody(t, w, &tok)
+	return tok
+}
+
+// withToken returns r authenticated with secret instead of the test token.
+func withToken(r *http.Request, secret string) *http.Request {
+	r.Header.Set("Authorization", "Bearer "+secret)
+	return r
+}
+
+func TestTokens_CreateUseRevoke(t *testing.T) {
+	mux, _ := newTestMux(t)
+	tok := createTestToken(t, mux, map[string]any{
+		"name": "atlantis", "scopes": []string{"machines:write", "machines:read", "machines:write"},
+	})
+	if !strings.HasPrefix(tok.Token, "lgt_") || tok.ID == "" || len(tok.Scopes) != 2 || tok.ExpiresAt != nil {
+		t.Errorf("created token: %+v", tok)
+	}
+
+	// The issued token authenticates, and its name is recorded as the actor.
+	body, _ := json.Marshal(map[string]any{"name": "pve1", "kind": "proxmox", "make": "Dell", "model": "R640"})
+	w := serve(mux, withToken(authReq(http.MethodPost, "/api/v1/machines", body), tok.Token))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create machine with issued token: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	var m models.Machine
+	decodeBody(t, w, &m)
+	var history models.EventList
+	decodeBody(t, serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+m.ID+"/history", nil)), &history)
+	if len(history.Events) != 1 || history.Events[0].Actor != "token:atlantis" {
+		t.Errorf("history actor: got %+v", history.Events)
+	}
+
+	// Listing shows when the token was used but never its secret.
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/tokens", nil))
+	if strings.Contains(w.Body.String(), tok.Token) {
+		t.Errorf("list exposes the secret: %s", w.Body.String())
+	}
+	var list models.APITokenList
+	decodeBody(t, w, &list)
+	if len(list.Tokens) != 1 || list.Tokens[0].LastUsedAt == nil {
+		t.Errorf("list: got %+v", list.Tokens)
+	}
+
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/tokens/"+tok.ID, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: got %d, want 204", w.Code)
+	}
+	if w := serve(mux, withToken(authReq(http.MethodGet, "/api/v1/machines", nil), tok.Token)); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: got %d, want 401", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/tokens/"+tok.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("revoke twice: got %d, want 404", w.Code)
+	}
+}
+
+func TestTokens_AdminScopeRequired(t *testing.T) {
+	mux, _ := newTestMux(t)
+	reader := createTestToken(t, mux, map[string]any{"name": "grafana", "scopes": []string{"machines:read"}})
+	admin := createTestToken(t, mux, map[string]any{"name": "ops", "scopes": []string{"admin"}})
+
+	if w := serve(mux, withToken(authReq(http.MethodGet, "/api/v1/tokens", nil), reader.Token)); w.Code != http.StatusForbidden {
+		t.Errorf("list with machines:read token: got %d, want 403", w.Code)
+	}
+	body, _ := json.Marshal(map[string]any{"name": "ansible", "scopes": []string{"machines:read"}})
+	if w := serve(mux, withToken(authReq(http.MethodPost, "/api/v1/tokens", body), admin.Token)); w.Code != http.StatusCreated {
+		t.Errorf("create with admin token: got %d, want 201", w.Code)
+	}
+}
+
+func TestTokens_Validation(t *testing.T) {
+	mux, _ := newTestMux(t)
+	createTestToken(t, mux, map[string]any{"name": "grafana", "scopes": []string{"machines:read"}})
+
+	cases := []struct {
+		name    string
+		payload map[string]any
+		want    int
+	}{
+		{"missing name", map[string]any{"scopes": []string{"admin"}}, http.StatusBadRequest},
+		{"missing scopes", map[string]any{"name": "ci"}, http.StatusBadRequest},
+		{"invalid scope", map[string]any{"name": "ci", "scopes": []string{"machines:delete"}}, http.StatusBadRequest},
+		{"expired", map[string]any{"name": "ci", "scopes": []string{"admin"}, "expires_at": time.Now().Add(-time.Hour)}, http.StatusBadRequest},
+		{"duplicate name", map[string]any{"name": "grafana", "scopes": []string{"admin"}}, http.StatusConflict},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.payload)
+			w := serve(mux, authReq(http.MethodPost, "/api/v1/tokens", body))
+			if w.Code != tc.want {
+				t.Errorf("got %d, want %d\nbody: %s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/tphummel/lab_gear/internal/db"
+)
+
+// ListTrash handles GET /api/v1/trash. It accepts the same filter, sort, and
+// paging parameters as ListMachines and defaults to the most recently
+// deleted machines first.
+func (h *Handler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	h.listMachines(w, r, db.ListOptions{Trashed: true, Sort: "-deleted_at"})
+}
+
+// RestoreMachine handles POST /api/v1/machines/{id}/restore, moving a
+// machine out of the trash. A machine whose parent is still in the trash,
+// whose rack position has been taken since, or whose UPS no longer has room
+// for it answers 409.
+func (h *Handler) RestoreMachine(w http.ResponseWriter, r *http.Request) {
+	m, err := h.DB.Restore(r.PathValue("id"), actor(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "machine not in trash")
+		return
+	}
+	if errors.Is(err, db.ErrParentNotFound) {
+		writeError(w, http.StatusConflict, "parent machine is in the trash; restore it first")
+		return
+	}
+	if errors.Is(err, db.ErrRackPositionTaken) || errors.Is(err, db.ErrUPSOverCapacity) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to restore machine")
+		return
+	}
+	w.Header().Set("ETag", etag(m))
+	writeJSON(w, http.StatusOK, m)
+}
+
+// PurgeMachine handles DELETE /api/v1/trash/{id}, permanently removing a
+// machine that is already in the trash. Its history is kept.
+func (h *Handler) PurgeMachine(w http.ResponseWriter, r *http.Request) {
+	err := h.DB.Purge(r.PathValue("id"), actor(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "machine not in trash")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to purge machine")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
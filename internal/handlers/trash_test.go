@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+func TestTrash_DeleteRestore(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{
+		"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+",
+		"serial": "2040PDN123456", "notes": "bought 2021",
+	})
+	path := "/api/v1/machines/" + created.ID
+
+	if w := serve(mux, authReq(http.MethodDelete, path, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d, want 204", w.Code)
+	}
+
+	// Hidden from get, list, and search.
+	if w := serve(mux, authReq(http.MethodGet, path, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("get trashed: got %d, want 404", w.Code)
+	}
+	var list models.MachineList
+	decodeBody(t, serve(mux, authReq(http.MethodGet, "/api/v1/machines", nil)), &list)
+	if len(list.Machines) != 0 {
+		t.Errorf("list: got %d machines, want 0", len(list.Machines))
+	}
+	var results models.SearchResults
+	decodeBody(t, serve(mux, authReq(http.MethodGet, "/api/v1/machines/search?q=nas01", nil)), &results)
+	if len(results.Results) != 0 {
+		t.Errorf("search: got %d results, want 0", len(results.Results))
+	}
+
+	// Visible in the trash with its data intact.
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/trash", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("trash: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var trash models.MachineList
+	decodeBody(t, w, &trash)
+	if len(trash.Machines) != 1 {
+		t.Fatalf("trash: got %d machines, want 1", len(trash.Machines))
+	}
+	if m := trash.Machines[0]; m.DeletedAt == nil || m.Serial != "2040PDN123456" || m.Notes != "bought 2021" {
+		t.Errorf("trashed machine: %+v", m)
+	}
+
+	w = serve(mux, authReq(http.MethodPost, path+"/restore", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var restored models.Machine
+	decodeBody(t, w, &restored)
+	if restored.DeletedAt != nil || restored.Serial != "2040PDN123456" {
+		t.Errorf("restored machine: %+v", restored)
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Error("restore response has no ETag")
+	}
+	if w := serve(mux, authReq(http.MethodGet, path, nil)); w.Code != http.StatusOK {
+		t.Errorf("get restored: got %d, want 200", w.Code)
+	}
+	if w := serve(mux, authReq(http.MethodPost, path+"/restore", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("restore live machine: got %d, want 404", w.Code)
+	}
+}
+
+func TestTrash_Purge(t *testing.T) {
+	mux, _ := newTestMux(t)
+	created := createTestMachine(t, mux, map[string]any{
+		"name": "pi01", "kind": "sbc", "make": "Raspberry Pi", "model": "4 Model B",
+	})
+
+	// Only machines already in the trash can be purged.
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/trash/"+created.ID, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("purge live machine: got %d, want 404", w.Code)
+	}
+	serve(mux, authReq(http.MethodDelete, "/api/v1/machines/"+created.ID, nil))
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/trash/"+created.ID, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("purge: got %d, want 204", w.Code)
+	}
+
+	var trash models.MachineList
+	decodeBody(t, serve(mux, authReq(http.MethodGet, "/api/v1/trash", nil)), &trash)
+	if len(trash.Machines) != 0 {
+		t.Errorf("trash after purge: got %d machines, want 0", len(trash.Machines))
+	}
+	if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+created.ID+"/restore", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("restore purged machine: got %d, want 404", w.Code)
+	}
+
+	// The history survives the purge.
+	var history models.EventList
+	decodeBody(t, serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+created.ID+"/history", nil)), &history)
+	if n := len(history.Events); n != 3 || history.Events[n-1].Operation != models.OpPurge {
+		t.Errorf("history after purge: got %d events", n)
+	}
+}
+
+func TestTrash_ListSortAndFilter(t *testing.T) {
+	mux, _ := newTestMux(t)
+	for _, name := range []string{"a", "b", "c"} {
+		m := createTestMachine(t, mux, map[string]any{"name": name, "kind": "sbc", "make": "Raspberry Pi", "model": "4"})
+		serve(mux, authReq(http.MethodDelete, "/api/v1/machines/"+m.ID, nil))
+	}
+
+	var trash models.MachineList
+	decodeBody(t, serve(mux, authReq(http.MethodGet, "/api/v1/trash?sort=name&name[ne]=b", nil)), &trash)
+	if len(trash.Machines) != 2 || trash.Machines[0].Name != "a" || trash.Machines[1].Name != "c" {
+		t.Errorf("filtered trash: got %+v", trash.Machines)
+	}
+
+	if w := serve(mux, authReq(http.MethodGet, "/api/v1/machines?sort=deleted_at", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("deleted_at sort on machine list: got %d, want 400", w.Code)
+	}
+}
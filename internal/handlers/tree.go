@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/tphummel/lab_gear/internal/db"
+)
+
+// ListChildren handles GET /api/v1/machines/{id}/children, listing the
+// machines placed directly in a machine. It accepts the same filter, sort,
+// and paging parameters as ListMachines and defaults to name order.
+func (h *Handler) ListChildren(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := h.DB.GetByID(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "machine not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get machine")
+		return
+	}
+	h.listMachines(w, r, db.ListOptions{Filters: []db.Filter{db.ChildrenFilter(id)}, Sort: "name"})
+}
+
+// MachineTree handles GET /api/v1/machines/{id}/tree, returning a machine
+// with everything placed in it, nested to any depth.
+func (h *Handler) MachineTree(w http.ResponseWriter, r *http.Request) {
+	tree, err := h.DB.Tree(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "machine not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get machine tree")
+		return
+	}
+	writeJSON(w, http.StatusOK, tree)
+}
@@ -0,0 +1,124 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+func TestMachineParent_ChildrenAndTree(t *testing.T) {
+	mux, _ := newTestMux(t)
+	chassis := createTestMachine(t, mux, map[string]any{"name": "chassis", "kind": "bare_metal", "make": "Supermicro", "model": "SYS-2029"})
+	nas := createTestMachine(t, mux, map[string]any{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+", "parent_id": chassis.ID})
+	node := createTestMachine(t, mux, map[string]any{"name": "blade1", "kind": "proxmox", "make": "Supermicro", "model": "X11", "parent_id": chassis.ID})
+	pi := createTestMachine(t, mux, map[string]any{"name": "pi01", "kind": "sbc", "make": "Raspberry Pi", "model": "4B", "parent_id": nas.ID})
+	if nas.ParentID != chassis.ID {
+		t.Errorf("created parent_id: got %q, want %q", nas.ParentID, chassis.ID)
+	}
+
+	w := serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+chassis.ID+"/children", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("children: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var children models.MachineList
+	decodeBody(t, w, &children)
+	if len(children.Machines) != 2 || children.Machines[0].ID != node.ID || children.Machines[1].ID != nas.ID {
+		t.Errorf("children: got %+v, want blade1 then nas01", children.Machines)
+	}
+
+	// Children accept the usual list filters.
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+chassis.ID+"/children?kind=nas", nil))
+	decodeBody(t, w, &children)
+	if len(children.Machines) != 1 || children.Machines[0].ID != nas.ID {
+		t.Errorf("filtered children: got %+v, want only nas01", children.Machines)
+	}
+
+	w = serve(mux, authReq(http.MethodGet, "/api/v1/machines/"+chassis.ID+"/tree", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("tree: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var tree models.MachineTree
+	decodeBody(t, w, &tree)
+	if tree.Machine.ID != chassis.ID || len(tree.Children) != 2 {
+		t.Fatalf("tree root: got %+v", tree)
+	}
+	if got := tree.Children[1]; got.Machine.ID != nas.ID || len(got.Children) != 1 || got.Children[0].Machine.ID != pi.ID {
+		t.Errorf("tree: nas01 subtree is %+v, want pi01 inside it", got)
+	}
+	if len(tree.Children[0].Children) != 0 {
+		t.Errorf("tree: blade1 has children %+v", tree.Children[0].Children)
+	}
+
+	for _, path := range []string{"/api/v1/machines/missing/children", "/api/v1/machines/missing/tree"} {
+		if w := serve(mux, authReq(http.MethodGet, path, nil)); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: got %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestMachineParent_Errors(t *testing.T) {
+	mux, _ := newTestMux(t)
+	a := createTestMachine(t, mux, map[string]any{"name": "a", "kind": "bare_metal", "make": "Dell", "model": "R740"})
+	b := createTestMachine(t, mux, map[string]any{"name": "b", "kind": "proxmox", "make": "Dell", "model": "R640", "parent_id": a.ID})
+
+	body, _ := json.Marshal(map[string]any{"name": "c", "kind": "sbc", "make": "Raspberry Pi", "model": "4B", "parent_id": "missing"})
+	if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines", body)); w.Code != http.StatusBadRequest {
+		t.Errorf("create with unknown parent: got %d, want 400", w.Code)
+	}
+
+	tests := []struct {
+		name  string
+		id    string
+		patch string
+		want  int
+	}{
+		{"self", a.ID, `{"parent_id": "` + a.ID + `"}`, http.StatusConflict},
+		{"cycle", a.ID, `{"parent_id": "` + b.ID + `"}`, http.StatusConflict},
+		{"unknown parent", b.ID, `{"parent_id": "missing"}`, http.StatusBadRequest},
+		{"clear parent", b.ID, `{"parent_id": null}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(mux, patchReq("/api/v1/machines/"+tt.id, tt.patch))
+			if w.Code != tt.want {
+				t.Errorf("PATCH %s: got %d, want %d\nbody: %s", tt.patch, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// PUT replaces parent_id like any other field.
+	body, _ = json.Marshal(map[string]any{"name": "a", "kind": "bare_metal", "make": "Dell", "model": "R740", "parent_id": b.ID})
+	if w := serve(mux, authReq(http.MethodPut, "/api/v1/machines/"+a.ID, body)); w.Code != http.StatusOK {
+		t.Fatalf("PUT a into b: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	body, _ = json.Marshal(map[string]any{"name": "b", "kind": "proxmox", "make": "Dell", "model": "R640", "parent_id": a.ID})
+	if w := serve(mux, authReq(http.MethodPut, "/api/v1/machines/"+b.ID, body)); w.Code != http.StatusConflict {
+		t.Errorf("PUT b into a: got %d, want 409", w.Code)
+	}
+}
+
+func TestMachineParent_DeleteAndRestore(t *testing.T) {
+	mux, _ := newTestMux(t)
+	parent := createTestMachine(t, mux, map[string]any{"name": "nas01", "kind": "nas", "make": "Synology", "model": "DS920+"})
+	child := createTestMachine(t, mux, map[string]any{"name": "pi01", "kind": "sbc", "make": "Raspberry Pi", "model": "4B", "parent_id": parent.ID})
+
+	if w := serve(mux, authReq(http.MethodDelete, "/api/v1/machines/"+parent.ID, nil)); w.Code != http.StatusConflict {
+		t.Fatalf("delete parent with child: got %d, want 409", w.Code)
+	}
+	for _, id := range []string{child.ID, parent.ID} {
+		if w := serve(mux, authReq(http.MethodDelete, "/api/v1/machines/"+id, nil)); w.Code != http.StatusNoContent {
+			t.Fatalf("delete %s: got %d, want 204", id, w.Code)
+		}
+	}
+
+	if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+child.ID+"/restore", nil)); w.Code != http.StatusConflict {
+		t.Errorf("restore child before parent: got %d, want 409", w.Code)
+	}
+	for _, id := range []string{parent.ID, child.ID} {
+		if w := serve(mux, authReq(http.MethodPost, "/api/v1/machines/"+id+"/restore", nil)); w.Code != http.StatusOK {
+			t.Fatalf("restore %s: got %d, want 200\nbody: %s", id, w.Code, w.Body.String())
+		}
+	}
+}
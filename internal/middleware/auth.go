@@ -1,26 +1,244 @@
 package middleware
 
 import (
+	"context"
 	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
 )
 
-const unauthorizedBody = `{"error":"unauthorized"}` + "\n"
+const (
+	unauthorizedBody    = `{"error":"unauthorized"}` + "\n"
+	authFailedBody      = `{"error":"failed to check token"}` + "\n"
+	tooManyRequestsBody = `{"error":"too many requests"}` + "\n"
+)
 
-// Auth returns a handler that requires a valid Bearer token before
-// delegating to next. Responds with 401 if the header is missing or wrong.
-// Token comparison uses constant-time equality to prevent timing attacks.
-func Auth(token string, next http.Handler) http.Handler {
+// StaticTokenIdentity is the identity attached to requests authenticated
+// with the static API token.
+const StaticTokenIdentity = "api_token"
+
+// IssuedTokenPrefix prefixes the identity of requests authenticated with a
+// token issued through the token API; the token's name follows it.
+const IssuedTokenPrefix = "token:"
+
+// ClientCertPrefix prefixes the identity of requests authenticated with a
+// TLS client certificate; the name matched in ClientCerts follows it.
+const ClientCertPrefix = "cert:"
+
+// OIDCSubjectPrefix prefixes the identity of requests authenticated with an
+// OIDC JWT; the JWT's sub follows it.
+const OIDCSubjectPrefix = "oidc:"
+
+type contextKey int
+
+const (
+	identityKey contextKey = iota
+	scopesKey
+)
+
+// WithIdentity returns a copy of ctx carrying the authenticated identity.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// Identity returns the identity attached to ctx by Auth, or "" if the
+// request was not authenticated.
+func Identity(ctx context.Context) string {
+	id, _ := ctx.Value(identityKey).(string)
+	return id
+}
+
+// WithScopes returns a copy of ctx carrying the scopes granted to the
+// authenticated identity.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey, scopes)
+}
+
+// Scopes returns the scopes attached to ctx by Auth, or nil if the request
+// was not authenticated.
+func Scopes(ctx context.Context) []string {
+	s, _ := ctx.Value(scopesKey).([]string)
+	return s
+}
+
+// TokenStore looks up tokens issued through the token API. It is
+// implemented by *db.DB.
+type TokenStore interface {
+	// AuthenticateToken returns the unexpired token with the given secret
+	// and records its use at now, or sql.ErrNoRows if there is none.
+	AuthenticateToken(secret string, now time.Time) (*models.APIToken, error)
+}
+
+// Policy maps route patterns, as registered on the mux ("DELETE
+// /api/v1/tokens/{id}"), to the scope a request to the route needs. Routes
+// that are not listed need machines:read for GET and HEAD, and
+// machines:write for every other method.
+type Policy map[string]string
+
+// Scope returns the scope needed for r, which must have been routed by an
+// http.ServeMux so that r.Pattern is set.
+func (p Policy) Scope(r *http.Request) string {
+	if s, ok := p[r.Pattern]; ok {
+		return s
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return models.ScopeMachinesRead
+	}
+	return models.ScopeMachinesWrite
+}
+
+// Authenticator checks bearer tokens against the static API token and, if
+// set, the tokens issued through the token API (Store) and JWTs from an
+// OpenID Connect provider (JWT), then checks the token's scopes against
+// Policy. Requests without a bearer token may instead present a verified
+// TLS client certificate whose subject is listed in ClientCerts.
+type Authenticator struct {
+	Token  string
+	Store  TokenStore
+	JWT    *JWTVerifier
+	Policy Policy
+	// ClientCerts maps a client certificate's DNS or email SAN, or its
+	// common name, to the scope the certificate grants.
+	ClientCerts map[string]string
+	// Limiter, if set, throttles requests and locks out clients that fail
+	// authentication too often.
+	Limiter *RateLimiter
+}
+
+// clientCertName returns the first name of r's verified client certificate
+// listed in a.ClientCerts, checking SANs before the common name, or "" if
+// there is none.
+func (a *Authenticator) clientCertName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	names := append(append(slices.Clone(leaf.DNSNames), leaf.EmailAddresses...), leaf.Subject.CommonName)
+	for _, name := range names {
+		if _, ok := a.ClientCerts[name]; ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// errUnauthorized is returned by authenticate when the request carries no
+// credential or one that is unknown, expired, or otherwise invalid.
+var errUnauthorized = errors.New("unauthorized")
+
+// authenticate returns the identity and scopes of the credential r carries,
+// errUnauthorized if there is no valid one, or another error if it could
+// not be checked.
+func (a *Authenticator) authenticate(r *http.Request, now time.Time) (string, []string, error) {
+	authHeader := r.Header.Get("Authorization")
+	got := strings.TrimPrefix(authHeader, "Bearer ")
+	if authHeader == "" {
+		if name := a.clientCertName(r); name != "" {
+			return ClientCertPrefix + name, []string{a.ClientCerts[name]}, nil
+		}
+	}
+	if !strings.HasPrefix(authHeader, "Bearer ") || got == "" {
+		return "", nil, errUnauthorized
+	}
+	switch {
+	case subtle.ConstantTimeCompare([]byte(got), []byte(a.Token)) == 1:
+		return StaticTokenIdentity, []string{models.ScopeAdmin}, nil
+	case a.JWT != nil && strings.Count(got, ".") == 2:
+		// Issued token secrets never contain a dot.
+		sub, scopes, err := a.JWT.Verify(got, now)
+		if err != nil {
+			slog.Info("JWT rejected", "error", err)
+			return "", nil, errUnauthorized
+		}
+		return OIDCSubjectPrefix + sub, scopes, nil
+	case a.Store != nil:
+		t, err := a.Store.AuthenticateToken(got, now)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, errUnauthorized
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return IssuedTokenPrefix + t.Name, t.Scopes, nil
+	}
+	return "", nil, errUnauthorized
+}
+
+// Require returns a handler that requires a valid Bearer token with the
+// scope Policy gives the route before delegating to next. Responds with 401
+// if the header is missing or the token is unknown or expired, and with 403
+// if the token is valid but lacks the scope. The static token is compared
+// in constant time and carries StaticTokenIdentity with the admin scope; an
+// issued token carries IssuedTokenPrefix and its name, with its own scopes;
+// a JWT carries OIDCSubjectPrefix and its sub, with the scopes its roles
+// grant; and a client certificate, used only when there is no Authorization
+// header, carries ClientCertPrefix and the matched name, with the scope it
+// is mapped to.
+//
+// With a Limiter, a locked-out client IP gets 429 before its credential is
+// looked at, unless that credential has authenticated from the IP before. A
+// failed authentication counts towards locking its IP out and takes from
+// the IP's bucket, and an authenticated request takes from its identity's
+// bucket; an empty bucket is a 429.
+func (a *Authenticator) Require(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		got := strings.TrimPrefix(authHeader, "Bearer ")
-		if !strings.HasPrefix(authHeader, "Bearer ") || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(unauthorizedBody))
+		now := time.Now()
+		ip, cred := a.Limiter.clientIP(r), a.Limiter.credential(r)
+		if wait, locked := a.Limiter.lockedOut(ip, cred, now); locked {
+			writeTooManyRequests(w, wait, "lockout")
+			return
+		}
+		identity, scopes, err := a.authenticate(r, now)
+		if errors.Is(err, errUnauthorized) {
+			if a.Limiter.fail(ip, cred, now) {
+				slog.Warn("client locked out after failed authentications", "ip", ip.String())
+				writeTooManyRequests(w, a.Limiter.Lockout, "lockout")
+				return
+			}
+			if wait, ok := a.Limiter.allow("ip:"+ip.String(), now); !ok {
+				writeTooManyRequests(w, wait, "rate_limit")
+				return
+			}
+			rejectedRequests.WithLabelValues("401").Inc()
+			writeAuthError(w, http.StatusUnauthorized, unauthorizedBody)
+			return
+		}
+		if err != nil {
+			slog.Error("token lookup failed", "error", err)
+			writeAuthError(w, http.StatusInternalServerError, authFailedBody)
+			return
+		}
+		a.Limiter.succeed(ip, cred, now)
+		if wait, ok := a.Limiter.allow("identity:"+identity, now); !ok {
+			writeTooManyRequests(w, wait, "rate_limit")
+			return
+		}
+		if want := a.Policy.Scope(r); !models.HasScope(scopes, want) {
+			rejectedRequests.WithLabelValues("403").Inc()
+			writeAuthError(w, http.StatusForbidden, fmt.Sprintf(`{"error":"forbidden: requires the %s scope"}`+"\n", want))
 			return
 		}
-		next.ServeHTTP(w, r)
+		ctx := WithScopes(WithIdentity(r.Context(), identity), scopes)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// Auth returns a handler that requires the static Bearer token before
+// delegating to next; see Authenticator.Require.
+func Auth(token string, next http.Handler) http.Handler {
+	return (&Authenticator{Token: token}).Require(next)
+}
+
+func writeAuthError(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
@@ -1,11 +1,20 @@
 package middleware_test
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/tphummel/lab_gear/internal/middleware"
+	"github.com/tphummel/lab_gear/internal/models"
 )
 
 const testToken = "super-secret-token"
@@ -141,3 +150,174 @@ func TestAuth_DifferentTokens(t *testing.T) {
 		t.Errorf("tokenA on handlerB: got %d, want 401", recAonB.Code)
 	}
 }
+
+func TestAuth_SetsIdentity(t *testing.T) {
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = middleware.Identity(r.Context())
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	middleware.Auth(testToken, next).ServeHTTP(httptest.NewRecorder(), req)
+	if got != middleware.StaticTokenIdentity {
+		t.Errorf("Identity: got %q, want %q", got, middleware.StaticTokenIdentity)
+	}
+}
+
+func TestIdentity_Unauthenticated(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := middleware.Identity(req.Context()); got != "" {
+		t.Errorf("Identity without Auth: got %q, want empty", got)
+	}
+}
+
+// fakeTokenStore serves issued tokens from a map keyed by secret.
+type fakeTokenStore struct {
+	tokens map[string]*models.APIToken
+	err    error
+}
+
+func (s *fakeTokenStore) AuthenticateToken(secret string, _ time.Time) (*models.APIToken, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	t, ok := s.tokens[secret]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func TestAuthenticator_IssuedTokens(t *testing.T) {
+	store := &fakeTokenStore{tokens: map[string]*models.APIToken{
+		"lgt_grafana": {ID: "t1", Name: "grafana", Scopes: []string{models.ScopeMachinesRead}},
+	}}
+	auth := &middleware.Authenticator{Token: testToken, Store: store}
+
+	var identity string
+	var scopes []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = middleware.Identity(r.Context())
+		scopes = middleware.Scopes(r.Context())
+	})
+	tests := []struct {
+		token        string
+		wantStatus   int
+		wantIdentity string
+		wantScopes   []string
+	}{
+		{"lgt_grafana", http.StatusOK, "token:grafana", []string{models.ScopeMachinesRead}},
+		{testToken, http.StatusOK, middleware.StaticTokenIdentity, []string{models.ScopeAdmin}},
+		{"lgt_unknown", http.StatusUnauthorized, "", nil},
+	}
+	for _, tt := range tests {
+		identity, scopes = "", nil
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		auth.Require(next).ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus || identity != tt.wantIdentity || !slices.Equal(scopes, tt.wantScopes) {
+			t.Errorf("token %q: got %d %q %v, want %d %q %v",
+				tt.token, rec.Code, identity, scopes, tt.wantStatus, tt.wantIdentity, tt.wantScopes)
+		}
+	}
+
+	store.err = errors.New("database is locked")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer lgt_grafana")
+	rec := httptest.NewRecorder()
+	auth.Require(next).ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("store failure: got %d, want 500", rec.Code)
+	}
+}
+
+func TestAuthenticator_Policy(t *testing.T) {
+	store := &fakeTokenStore{tokens: map[string]*models.APIToken{
+		"lgt_grafana":  {ID: "t1", Name: "grafana", Scopes: []string{models.ScopeMachinesRead}},
+		"lgt_atlantis": {ID: "t2", Name: "atlantis", Scopes: []string{models.ScopeMachinesWrite}},
+	}}
+	auth := &middleware.Authenticator{Token: testToken, Store: store, Policy: middleware.Policy{
+		"GET /tokens": models.ScopeAdmin,
+	}}
+	mux := http.NewServeMux()
+	mux.Handle("GET /machines", auth.Require(okHandler))
+	mux.Handle("POST /machines", auth.Require(okHandler))
+	mux.Handle("GET /tokens", auth.Require(okHandler))
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"lgt_grafana", http.MethodGet, "/machines", http.StatusOK},
+		{"lgt_grafana", http.MethodPost, "/machines", http.StatusForbidden},
+		{"lgt_atlantis", http.MethodPost, "/machines", http.StatusOK},
+		{"lgt_atlantis", http.MethodGet, "/tokens", http.StatusForbidden},
+		{testToken, http.MethodGet, "/tokens", http.StatusOK},
+		{"wrong-token", http.MethodPost, "/machines", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s with %q: got %d, want %d", tt.method, tt.path, tt.token, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusForbidden && !strings.Contains(rec.Body.String(), "scope") {
+			t.Errorf("403 body should name the missing scope: %s", rec.Body.String())
+		}
+	}
+}
+
+func TestAuthenticator_ClientCerts(t *testing.T) {
+	auth := &middleware.Authenticator{Token: testToken, ClientCerts: map[string]string{
+		"grafana.lab":    models.ScopeMachinesRead,
+		"ansible@lab.io": models.ScopeMachinesWrite,
+	}}
+	mux := http.NewServeMux()
+	record := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Identity", middleware.Identity(r.Context()))
+	})
+	mux.Handle("GET /machines", auth.Require(record))
+	mux.Handle("POST /machines", auth.Require(record))
+
+	// verified stands in for a certificate the TLS handshake verified.
+	verified := func(cn string, dns, email []string) *tls.ConnectionState {
+		leaf := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dns, EmailAddresses: email}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+	}
+	tests := []struct {
+		name         string
+		method       string
+		tls          *tls.ConnectionState
+		header       string
+		want         int
+		wantIdentity string
+	}{
+		{"DNS SAN", http.MethodGet, verified("grafana", []string{"grafana.lab"}, nil), "", http.StatusOK, "cert:grafana.lab"},
+		{"common name", http.MethodGet, verified("grafana.lab", nil, nil), "", http.StatusOK, "cert:grafana.lab"},
+		{"email SAN", http.MethodPost, verified("", nil, []string{"ansible@lab.io"}), "", http.StatusOK, "cert:ansible@lab.io"},
+		{"read-only certificate", http.MethodPost, verified("grafana.lab", nil, nil), "", http.StatusForbidden, ""},
+		{"unmapped certificate", http.MethodGet, verified("laptop.lab", nil, nil), "", http.StatusUnauthorized, ""},
+		{"unverified certificate", http.MethodGet, &tls.ConnectionState{}, "", http.StatusUnauthorized, ""},
+		{"bearer token wins", http.MethodPost, verified("grafana.lab", nil, nil), "Bearer " + testToken, http.StatusOK, middleware.StaticTokenIdentity},
+		{"bad bearer token", http.MethodGet, verified("grafana.lab", nil, nil), "Bearer wrong-token", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/machines", nil)
+			req.TLS = tt.tls
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.want || rec.Header().Get("X-Identity") != tt.wantIdentity {
+				t.Errorf("got %d %q, want %d %q", rec.Code, rec.Header().Get("X-Identity"), tt.want, tt.wantIdentity)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+const (
+	// jwtLeeway is the clock skew allowed when checking exp and nbf.
+	jwtLeeway = time.Minute
+	// keySetRefreshInterval is the least time between reloads of a key set
+	// triggered by tokens signed with a key it does not hold, so a flood of
+	// forged tokens cannot hammer the IdP.
+	keySetRefreshInterval = time.Minute
+	// keySetFetchTimeout bounds a JWKS download.
+	keySetFetchTimeout = 10 * time.Second
+	// maxKeySetSize bounds the size of a JWKS document.
+	maxKeySetSize = 1 << 20
+	// minRSAKeyBits is the smallest RSA modulus accepted in a key set.
+	minRSAKeyBits = 2048
+)
+
+// jwk is a public key from a key set that can verify signatures.
+type jwk struct {
+	kid string
+	alg string // RS256 or ES256
+	key crypto.PublicKey
+}
+
+// KeySet is a JSON Web Key Set read from an http(s) URL or a local file. It
+// holds the RSA and P-256 keys of the set and reloads the set when asked for
+// a key it does not hold, so keys the IdP rotates in are picked up.
+type KeySet struct {
+	source string
+	client *http.Client
+
+	mu   sync.Mutex
+	keys []jwk
+	// loadedAt is when the set was last loaded or a reload last started.
+	loadedAt time.Time
+}
+
+// NewKeySet loads the key set at source, which is an http:// or https:// URL
+// or a file path. It fails if the set cannot be read or holds no usable key.
+func NewKeySet(ctx context.Context, source string) (*KeySet, error) {
+	s := &KeySet{source: source, client: &http.Client{Timeout: keySetFetchTimeout}}
+	keys, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.keys, s.loadedAt = keys, time.Now()
+	return s, nil
+}
+
+// load reads and parses the key set.
+func (s *KeySet) load(ctx context.Context) ([]jwk, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(s.source, "http://") || strings.HasPrefix(s.source, "https://") {
+		data, err = s.fetch(ctx)
+	} else {
+		data, err = os.ReadFile(s.source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS %s: %w", s.source, err)
+	}
+	keys, err := parseKeySet(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse JWKS %s: %w", s.source, err)
+	}
+	return keys, nil
+}
+
+func (s *KeySet) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxKeySetSize))
+}
+
+// parseKeySet returns the signing keys in a JWKS document. Keys of other
+// types or curves, or marked for encryption, are skipped.
+func parseKeySet(data []byte) ([]jwk, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var keys []jwk
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key jwk
+		var err error
+		switch {
+		case k.Kty == "RSA" && (k.Alg == "" || k.Alg == "RS256"):
+			key.alg = "RS256"
+			key.key, err = parseRSAKey(k.N, k.E)
+		case k.Kty == "EC" && k.Crv == "P-256" && (k.Alg == "" || k.Alg == "ES256"):
+			key.alg = "ES256"
+			key.key, err = parseP256Key(k.X, k.Y)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		key.kid = k.Kid
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no RS256 or ES256 signing keys")
+	}
+	return keys, nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("decode n: %w", err)
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("decode e: %w", err)
+	}
+	if len(eb) == 0 || len(eb) > 4 {
+		return nil, errors.New("unsupported exponent")
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(new(big.Int).SetBytes(eb).Int64())}
+	if key.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("modulus shorter than %d bits", minRSAKeyBits)
+	}
+	return key, nil
+}
+
+func parseP256Key(x, y string) (*ecdsa.PublicKey, error) {
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, fmt.Errorf("decode x: %w", err)
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, fmt.Errorf("decode y: %w", err)
+	}
+	if len(xb) != 32 || len(yb) != 32 {
+		return nil, errors.New("coordinates must be 32 bytes")
+	}
+	// crypto/ecdh rejects points that are not on the curve.
+	if _, err := ecdh.P256().NewPublicKey(slices.Concat([]byte{4}, xb, yb)); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}, nil
+}
+
+// lookup returns the keys that may have signed a token with the given kid
+// and alg; every key for alg if kid is empty. If there are none and the set
+// was last loaded at least keySetRefreshInterval before now, it is reloaded
+// first. The reload happens outside s.mu, so tokens signed with known keys
+// are verified meanwhile, and others arriving during it fail rather than
+// wait or start another.
+func (s *KeySet) lookup(kid, alg string, now time.Time) []jwk {
+	s.mu.Lock()
+	keys := matchKeys(s.keys, kid, alg)
+	if len(keys) > 0 || now.Sub(s.loadedAt) < keySetRefreshInterval {
+		s.mu.Unlock()
+		return keys
+	}
+	s.loadedAt = now
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), keySetFetchTimeout)
+	defer cancel()
+	loaded, err := s.load(ctx)
+	if err != nil {
+		slog.Warn("JWKS reload failed", "error", err)
+		return nil
+	}
+	s.mu.Lock()
+	s.keys = loaded
+	s.mu.Unlock()
+	return matchKeys(loaded, kid, alg)
+}
+
+// matchKeys returns the keys for alg with the given kid, or every key for
+// alg if kid is empty.
+func matchKeys(keys []jwk, kid, alg string) []jwk {
+	var out []jwk
+	for _, k := range keys {
+		if k.alg == alg && (kid == "" || k.kid == kid) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// JWTVerifier authenticates JWTs issued by an OpenID Connect provider. A
+// token must be signed with RS256 or ES256 by a key in Keys, name Issuer as
+// iss and Audience among aud, and carry sub and an unexpired exp.
+type JWTVerifier struct {
+	Issuer   string
+	Audience string
+	Keys     *KeySet
+	// RolesClaim names the claim holding the caller's roles or groups. A
+	// dotted name reaches into nested objects, as in Keycloak's
+	// "realm_access.roles".
+	RolesClaim string
+	// ReadRoles and WriteRoles grant machines:read and machines:write to
+	// tokens that list any of them in RolesClaim.
+	ReadRoles  []string
+	WriteRoles []string
+}
+
+// audience is the aud claim, which may be a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// Verify checks raw and returns its subject and the scopes its roles grant,
+// which are empty if it holds none of the configured roles.
+func (v *JWTVerifier) Verify(raw string, now time.Time) (string, []string, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return "", nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", nil, fmt.Errorf("header: %w", err)
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return "", nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	verified := false
+	for _, k := range v.Keys.lookup(header.Kid, header.Alg, now) {
+		if verifySignature(k, digest[:], sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return "", nil, errors.New("signature not verified by any known key")
+	}
+
+	var claims struct {
+		Issuer    string   `json:"iss"`
+		Subject   string   `json:"sub"`
+		Audience  audience `json:"aud"`
+		Expiry    *float64 `json:"exp"`
+		NotBefore *float64 `json:"nbf"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", nil, fmt.Errorf("claims: %w", err)
+	}
+	switch {
+	case claims.Issuer != v.Issuer:
+		return "", nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case !slices.Contains(claims.Audience, v.Audience):
+		return "", nil, fmt.Errorf("audience %q not in %v", v.Audience, []string(claims.Audience))
+	case claims.Subject == "":
+		return "", nil, errors.New("missing sub")
+	case claims.Expiry == nil:
+		return "", nil, errors.New("missing exp")
+	case now.After(unixTime(*claims.Expiry).Add(jwtLeeway)):
+		return "", nil, errors.New("token expired")
+	case claims.NotBefore != nil && now.Add(jwtLeeway).Before(unixTime(*claims.NotBefore)):
+		return "", nil, errors.New("token not yet valid")
+	}
+
+	var all map[string]any
+	if err := decodeSegment(parts[1], &all); err != nil {
+		return "", nil, fmt.Errorf("claims: %w", err)
+	}
+	roles := claimStrings(all, v.RolesClaim)
+	hasAny := func(want []string) bool {
+		return slices.ContainsFunc(roles, func(r string) bool { return slices.Contains(want, r) })
+	}
+	switch {
+	case hasAny(v.WriteRoles):
+		return claims.Subject, []string{models.ScopeMachinesWrite}, nil
+	case hasAny(v.ReadRoles):
+		return claims.Subject, []string{models.ScopeMachinesRead}, nil
+	}
+	return claims.Subject, nil, nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token into v.
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+func verifySignature(k jwk, digest, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		// JWS carries an ES256 signature as r and s, 32 bytes each.
+		if len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+// unixTime converts a NumericDate claim to a time, dropping any fraction of
+// a second.
+func unixTime(secs float64) time.Time {
+	return time.Unix(int64(secs), 0)
+}
+
+// claimStrings returns the claim at the dotted path name as a list of
+// strings. A string claim is split on spaces, as OAuth scope claims are.
+func claimStrings(claims map[string]any, name string) []string {
+	var v any = claims
+	for _, key := range strings.Split(name, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var out []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
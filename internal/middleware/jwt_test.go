@@ -0,0 +1,361 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tphummel/lab_gear/internal/middleware"
+	"github.com/tphummel/lab_gear/internal/models"
+)
+
+const (
+	testIssuer   = "https://auth.lab.example"
+	testAudience = "lab_gear"
+)
+
+var b64 = base64.RawURLEncoding
+
+// testKey is a locally generated signing key with its JWK form.
+type testKey struct {
+	kid    string
+	signer crypto.Signer
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid, k}
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid, k}
+}
+
+func (k testKey) jwk() map[string]string {
+	switch pub := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "use": "sig",
+			"n": b64.EncodeToString(pub.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": k.kid, "crv": "P-256",
+			"x": b64.EncodeToString(pub.X.FillBytes(make([]byte, 32))), "y": b64.EncodeToString(pub.Y.FillBytes(make([]byte, 32)))}
+	}
+	panic("unsupported key")
+}
+
+// sign returns a JWT with the given claims signed by k.
+func (k testKey) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := k.signer.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": k.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch key := k.signer.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + b64.EncodeToString(sig)
+}
+
+func keySetJSON(keys ...testKey) []byte {
+	var jwks []map[string]string
+	for _, k := range keys {
+		jwks = append(jwks, k.jwk())
+	}
+	b, _ := json.Marshal(map[string]any{"keys": jwks})
+	return b
+}
+
+// writeKeySet writes a JWKS holding keys to a temporary file and returns
+// its path.
+func writeKeySet(t *testing.T, keys ...testKey) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, keySetJSON(keys...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// claims returns valid claims for sub with the given groups, expiring in an
+// hour.
+func claims(sub string, groups ...string) map[string]any {
+	return map[string]any{
+		"iss": testIssuer, "aud": testAudience, "sub": sub, "groups": groups,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func with(c map[string]any, key string, value any) map[string]any {
+	out := make(map[string]any, len(c))
+	for k, v := range c {
+		out[k] = v
+	}
+	if value == nil {
+		delete(out, key)
+	} else {
+		out[key] = value
+	}
+	return out
+}
+
+func newVerifier(t *testing.T, source string) *middleware.JWTVerifier {
+	t.Helper()
+	keys, err := middleware.NewKeySet(context.Background(), source)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	return &middleware.JWTVerifier{
+		Issuer: testIssuer, Audience: testAudience, Keys: keys,
+		RolesClaim: "groups", ReadRoles: []string{"lab-viewers"}, WriteRoles: []string{"lab-admins"},
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, ecKey := newRSAKey(t, "rsa-1"), newECKey(t, "ec-1")
+	v := newVerifier(t, writeKeySet(t, rsaKey, ecKey))
+	stranger := newRSAKey(t, "rsa-1") // same kid, different key
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		token      string
+		wantErr    bool
+		wantScopes []string
+	}{
+		{"RS256 writer", rsaKey.sign(t, claims("alice", "lab-admins")), false, []string{models.ScopeMachinesWrite}},
+		{"ES256 reader", ecKey.sign(t, claims("alice", "users", "lab-viewers")), false, []string{models.ScopeMachinesRead}},
+		{"both roles", rsaKey.sign(t, claims("alice", "lab-viewers", "lab-admins")), false, []string{models.ScopeMachinesWrite}},
+		{"no role", rsaKey.sign(t, claims("alice", "users")), false, nil},
+		{"audience list", rsaKey.sign(t, with(claims("alice", "lab-admins"), "aud", []string{"grafana", testAudience})), false, []string{models.ScopeMachinesWrite}},
+		{"expired", rsaKey.sign(t, with(claims("alice"), "exp", now.Add(-2*time.Minute).Unix())), true, nil},
+		{"within leeway", rsaKey.sign(t, with(claims("alice"), "exp", now.Add(-30*time.Second).Unix())), false, nil},
+		{"not yet valid", rsaKey.sign(t, with(claims("alice"), "nbf", now.Add(5*time.Minute).Unix())), true, nil},
+		{"missing exp", rsaKey.sign(t, with(claims("alice"), "exp", nil)), true, nil},
+		{"missing sub", rsaKey.sign(t, with(claims("alice"), "sub", nil)), true, nil},
+		{"wrong issuer", rsaKey.sign(t, with(claims("alice"), "iss", "https://evil.example")), true, nil},
+		{"wrong audience", rsaKey.sign(t, with(claims("alice"), "aud", "grafana")), true, nil},
+		{"unknown signer", stranger.sign(t, claims("alice", "lab-admins")), true, nil},
+		{"unknown kid", newECKey(t, "ec-2").sign(t, claims("alice")), true, nil},
+		{"malformed", "not.a-jwt", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, scopes, err := v.Verify(tt.token, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err: got %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (sub != "alice" || !slices.Equal(scopes, tt.wantScopes)) {
+				t.Errorf("got %q %v, want alice %v", sub, scopes, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestJWTVerifier_RejectsUnsignedAlgorithms(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	v := newVerifier(t, writeKeySet(t, rsaKey))
+	payload, _ := json.Marshal(claims("alice", "lab-admins"))
+	for _, alg := range []string{"none", "HS256"} {
+		header, _ := json.Marshal(map[string]string{"alg": alg, "kid": "rsa-1"})
+		token := b64.EncodeToString(header) + "." + b64.EncodeToString(payload) + "."
+		if _, _, err := v.Verify(token, time.Now()); err == nil {
+			t.Errorf("alg %s: verified, want error", alg)
+		}
+	}
+}
+
+func TestJWTVerifier_NestedRolesClaim(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	v := newVerifier(t, writeKeySet(t, rsaKey))
+	v.RolesClaim = "realm_access.roles"
+	token := rsaKey.sign(t, with(claims("alice"), "realm_access", map[string]any{"roles": []string{"lab-viewers"}}))
+	_, scopes, err := v.Verify(token, time.Now())
+	if err != nil || !slices.Equal(scopes, []string{models.ScopeMachinesRead}) {
+		t.Errorf("got %v, %v; want [machines:read]", scopes, err)
+	}
+}
+
+func TestKeySet_URLReloadsForUnknownKey(t *testing.T) {
+	oldKey, newKey := newRSAKey(t, "2026-09"), newECKey(t, "2026-10")
+	var mu sync.Mutex
+	served := keySetJSON(oldKey)
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		w.Write(served)
+	}))
+	defer srv.Close()
+
+	v := newVerifier(t, srv.URL)
+	mu.Lock()
+	served = keySetJSON(oldKey, newKey)
+	mu.Unlock()
+
+	// The IdP has rotated in a key, but the set was loaded too recently to
+	// fetch it again.
+	token := newKey.sign(t, claims("alice", "lab-admins"))
+	now := time.Now()
+	if _, _, err := v.Verify(token, now); err == nil {
+		t.Fatal("verified before the reload interval passed")
+	}
+	if _, _, err := v.Verify(token, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("after reload: %v", err)
+	}
+	if _, _, err := v.Verify(oldKey.sign(t, claims("alice")), now.Add(2*time.Minute)); err != nil {
+		t.Errorf("old key after reload: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fetches != 2 {
+		t.Errorf("fetches: got %d, want 2", fetches)
+	}
+}
+
+func TestKeySet_ReloadDoesNotBlockVerification(t *testing.T) {
+	oldKey, newKey := newRSAKey(t, "2026-09"), newECKey(t, "2026-10")
+	var (
+		mu      sync.Mutex
+		fetches int
+	)
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		n := fetches
+		mu.Unlock()
+		if n == 1 {
+			w.Write(keySetJSON(oldKey))
+			return
+		}
+		close(started)
+		<-release
+		w.Write(keySetJSON(oldKey, newKey))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	v := newVerifier(t, srv.URL)
+	later := time.Now().Add(2 * time.Minute)
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := v.Verify(newRSAKey(t, "2026-11").sign(t, claims("alice")), later)
+		done <- err
+	}()
+	<-started
+
+	// While the reload hangs, known keys still verify and other unknown
+	// keys fail at once without starting a second fetch.
+	if _, _, err := v.Verify(oldKey.sign(t, claims("alice")), later); err != nil {
+		t.Errorf("known key during reload: %v", err)
+	}
+	if _, _, err := v.Verify(newKey.sign(t, claims("alice")), later); err == nil {
+		t.Error("unknown key during reload: verified")
+	}
+	mu.Lock()
+	if fetches != 2 {
+		t.Errorf("fetches: got %d, want 2", fetches)
+	}
+	mu.Unlock()
+
+	release <- struct{}{}
+	if err := <-done; err == nil {
+		t.Error("token from a key the IdP does not hold: verified")
+	}
+}
+
+func TestNewKeySet_Errors(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.json")
+	if err := os.WriteFile(empty, []byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range []string{filepath.Join(t.TempDir(), "missing.json"), empty} {
+		if _, err := middleware.NewKeySet(context.Background(), source); err == nil {
+			t.Errorf("NewKeySet(%s): got nil error", source)
+		}
+	}
+}
+
+func TestAuthenticator_JWT(t *testing.T) {
+	key := newECKey(t, "ec-1")
+	auth := &middleware.Authenticator{Token: testToken, JWT: newVerifier(t, writeKeySet(t, key))}
+	var identity string
+	mux := http.NewServeMux()
+	record := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = middleware.Identity(r.Context())
+	})
+	mux.Handle("GET /machines", auth.Require(record))
+	mux.Handle("POST /machines", auth.Require(record))
+
+	viewer := key.sign(t, claims("alice", "lab-viewers"))
+	tests := []struct {
+		token  string
+		method string
+		want   int
+	}{
+		{viewer, http.MethodGet, http.StatusOK},
+		{viewer, http.MethodPost, http.StatusForbidden},
+		{key.sign(t, claims("bob", "lab-admins")), http.MethodPost, http.StatusOK},
+		{key.sign(t, claims("carol")), http.MethodGet, http.StatusForbidden},
+		{key.sign(t, with(claims("alice", "lab-admins"), "iss", "https://evil.example")), http.MethodGet, http.StatusUnauthorized},
+		{testToken, http.MethodPost, http.StatusOK},
+	}
+	for i, tt := range tests {
+		identity = ""
+		req := httptest.NewRequest(tt.method, "/machines", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("case %d: got %d, want %d", i, rec.Code, tt.want)
+		}
+	}
+
+	// sub, prefixed, is recorded as the identity.
+	req := httptest.NewRequest(http.MethodGet, "/machines", nil)
+	req.Header.Set("Authorization", "Bearer "+viewer)
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if identity != "oidc:alice" {
+		t.Errorf("identity: got %q, want oidc:alice", identity)
+	}
+}
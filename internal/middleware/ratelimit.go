@@ -0,0 +1,290 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// limiterSweepInterval is how often idle buckets and expired failure counts
+// are dropped, so clients that went away do not pile up in memory.
+const limiterSweepInterval = time.Minute
+
+// provenCredentialTTL is how long after its last success from an address a
+// credential still gets through while that address is locked out.
+const provenCredentialTTL = 24 * time.Hour
+
+var (
+	limitedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lab_gear_requests_limited_total",
+		Help: "Requests answered with 429, by reason (rate_limit or lockout).",
+	}, []string{"reason"})
+	rejectedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lab_gear_requests_rejected_total",
+		Help: "Requests that failed authentication (401) or authorization (403), by status code.",
+	}, []string{"code"})
+)
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses and CIDR
+// prefixes.
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(v); err == nil {
+			out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: must be an IP address or CIDR prefix", v)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// ClientIP returns the address of the client that sent r. X-Forwarded-For is
+// believed only as far as trusted proxies vouch for it: starting from the
+// peer, each trusted hop is replaced by the address it forwarded for, from
+// the right, and the first untrusted one is the client.
+func ClientIP(r *http.Request, trusted []netip.Prefix) netip.Addr {
+	isTrusted := func(a netip.Addr) bool {
+		for _, p := range trusted {
+			if p.Contains(a) {
+				return true
+			}
+		}
+		return false
+	}
+	client := parseIP(r.RemoteAddr)
+	if !client.IsValid() || !isTrusted(client) {
+		return client
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseIP(strings.TrimSpace(hops[i]))
+		if !hop.IsValid() {
+			break
+		}
+		client = hop
+		if !isTrusted(hop) {
+			break
+		}
+	}
+	return client
+}
+
+// parseIP parses an address with or without a port.
+func parseIP(s string) netip.Addr {
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap()
+	}
+	addr, _ := netip.ParseAddr(s)
+	return addr.Unmap()
+}
+
+// bucket is a token bucket; tokens is its level as of last.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// failureCount tracks the failed authentications from one client IP.
+type failureCount struct {
+	n           int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// credential is a SHA-256 digest of the credential a request presents; the
+// zero value means none.
+type credential [sha256.Size]byte
+
+// provenKey is a credential that has authenticated from a client IP.
+type provenKey struct {
+	ip   netip.Addr
+	cred credential
+}
+
+// RateLimiter throttles requests with a token bucket per authenticated
+// identity, or per client IP for requests that fail authentication, and
+// locks out client IPs that fail authentication too often. A locked-out IP
+// still lets through credentials that have authenticated from it before, so
+// one misconfigured client cannot lock out its neighbours behind the same
+// NAT or proxy. A nil *RateLimiter allows everything.
+type RateLimiter struct {
+	// Rate is the sustained requests per second allowed per key, and Burst
+	// how many may arrive at once. Zero Rate disables rate limiting.
+	Rate  float64
+	Burst int
+	// MaxFailures failed authentications from one client IP within Lockout
+	// lock it out for Lockout. Zero MaxFailures disables lockout.
+	MaxFailures int
+	Lockout     time.Duration
+	// TrustedProxies lists the proxies whose X-Forwarded-For is believed
+	// when working out the client IP.
+	TrustedProxies []netip.Prefix
+
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	failures map[netip.Addr]*failureCount
+	proven   map[provenKey]time.Time // last success
+	swept    time.Time
+}
+
+// clientIP returns the client address of r.
+func (l *RateLimiter) clientIP(r *http.Request) netip.Addr {
+	if l == nil {
+		return netip.Addr{}
+	}
+	return ClientIP(r, l.TrustedProxies)
+}
+
+// credential returns the digest of the Authorization header r carries, or
+// else of its TLS client certificate. It is the zero credential if there
+// is neither or lockout is disabled.
+func (l *RateLimiter) credential(r *http.Request) credential {
+	switch {
+	case l == nil || l.MaxFailures <= 0:
+		return credential{}
+	case r.Header.Get("Authorization") != "":
+		return sha256.Sum256([]byte(r.Header.Get("Authorization")))
+	case r.TLS != nil && len(r.TLS.PeerCertificates) > 0:
+		return sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+	}
+	return credential{}
+}
+
+// allow takes a token from key's bucket at now. If the bucket is empty it
+// returns false and how long until a token is available.
+func (l *RateLimiter) allow(key string, now time.Time) (time.Duration, bool) {
+	if l == nil || l.Rate <= 0 {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / l.Rate * float64(time.Second)), false
+}
+
+// lockedOut reports whether ip is locked out at now for a request
+// presenting cred, and for how much longer. A credential proven from ip
+// within provenCredentialTTL is never locked out.
+func (l *RateLimiter) lockedOut(ip netip.Addr, cred credential, now time.Time) (time.Duration, bool) {
+	if l == nil || l.MaxFailures <= 0 {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.failures[ip]
+	if !ok || !now.Before(f.lockedUntil) {
+		return 0, false
+	}
+	if last, ok := l.proven[provenKey{ip, cred}]; ok && cred != (credential{}) && now.Sub(last) < provenCredentialTTL {
+		return 0, false
+	}
+	return f.lockedUntil.Sub(now), true
+}
+
+// fail records a failed authentication from ip at now. If it is the
+// MaxFailures-th within Lockout, ip is locked out and fail returns true.
+// Successful requests from ip do not reset the count, so interleaving
+// them with guesses does not buy more guesses; only time does. cred, the
+// credential that failed, is no longer proven from ip.
+func (l *RateLimiter) fail(ip netip.Addr, cred credential, now time.Time) bool {
+	if l == nil || l.MaxFailures <= 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	delete(l.proven, provenKey{ip, cred})
+	f, ok := l.failures[ip]
+	if !ok || now.Sub(f.first) >= l.Lockout {
+		f = &failureCount{first: now}
+		l.failures[ip] = f
+	}
+	f.n++
+	if f.n < l.MaxFailures {
+		return false
+	}
+	f.n, f.first, f.lockedUntil = 0, now, now.Add(l.Lockout)
+	return true
+}
+
+// succeed records that cred authenticated from ip at now. It leaves ip's
+// failure count alone.
+func (l *RateLimiter) succeed(ip netip.Addr, cred credential, now time.Time) {
+	if l == nil || l.MaxFailures <= 0 || cred == (credential{}) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	l.proven[provenKey{ip, cred}] = now
+}
+
+// sweep drops full buckets, failure counts that have run out, and proven
+// credentials past provenCredentialTTL, at most once per
+// limiterSweepInterval. The caller holds l.mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+		l.failures = make(map[netip.Addr]*failureCount)
+		l.proven = make(map[provenKey]time.Time)
+	}
+	if now.Sub(l.swept) < limiterSweepInterval {
+		return
+	}
+	l.swept = now
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= float64(l.Burst) {
+			delete(l.buckets, k)
+		}
+	}
+	for ip, f := range l.failures {
+		if now.Sub(f.first) >= l.Lockout && !now.Before(f.lockedUntil) {
+			delete(l.failures, ip)
+		}
+	}
+	for k, last := range l.proven {
+		if now.Sub(last) >= provenCredentialTTL {
+			delete(l.proven, k)
+		}
+	}
+}
+
+// writeTooManyRequests answers 429 with a Retry-After of wait, rounded up
+// to whole seconds, and counts the request as limited for reason.
+func writeTooManyRequests(w http.ResponseWriter, wait time.Duration, reason string) {
+	limitedRequests.WithLabelValues(reason).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+	writeAuthError(w, http.StatusTooManyRequests, tooManyRequestsBody)
+}
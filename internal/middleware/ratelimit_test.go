@@ -0,0 +1,211 @@
+package middleware_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tphummel/lab_gear/internal/middleware"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := middleware.ParseTrustedProxies(" 127.0.0.1, 10.0.0.0/8,,fd00::/8 ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"127.0.0.1/32", "10.0.0.0/8", "fd00::/8"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("prefix %d: got %s, want %s", i, got[i], want[i])
+		}
+	}
+	if _, err := middleware.ParseTrustedProxies("caddy.lab"); err == nil {
+		t.Error("hostname: expected error, got nil")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, _ := middleware.ParseTrustedProxies("127.0.0.1,10.0.0.0/8")
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct", "192.0.2.7:51234", nil, "192.0.2.7"},
+		{"untrusted peer's header is ignored", "192.0.2.7:51234", []string{"203.0.113.9"}, "192.0.2.7"},
+		{"trusted proxy", "127.0.0.1:40000", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"spoofed hop left of the client", "127.0.0.1:40000", []string{"198.51.100.1, 203.0.113.9"}, "203.0.113.9"},
+		{"chain of trusted proxies", "127.0.0.1:40000", []string{"203.0.113.9, 10.1.2.3", "10.4.5.6"}, "203.0.113.9"},
+		{"all hops trusted", "127.0.0.1:40000", []string{"10.1.2.3"}, "10.1.2.3"},
+		{"garbage hop", "127.0.0.1:40000", []string{"203.0.113.9, not-an-ip"}, "127.0.0.1"},
+		{"IPv4-mapped peer", "[::ffff:192.0.2.7]:51234", nil, "192.0.2.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := middleware.ClientIP(req, trusted); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// counterValue scrapes the default Prometheus registry for the value of the
+// series with the given name and labels, e.g. `x_total{reason="lockout"}`.
+func counterValue(t *testing.T, series string) float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), series+" "); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return f
+		}
+	}
+	return 0
+}
+
+// limitedRequest returns a request from the given client, through a trusted
+// proxy, carrying token.
+func limitedRequest(client, token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	req.Header.Set("X-Forwarded-For", client)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestAuthenticator_RateLimit(t *testing.T) {
+	trusted, _ := middleware.ParseTrustedProxies("127.0.0.1")
+	auth := &middleware.Authenticator{Token: testToken, Limiter: &middleware.RateLimiter{
+		Rate: 0.5, Burst: 2, TrustedProxies: trusted,
+	}}
+	handler := auth.Require(okHandler)
+	const series = `lab_gear_requests_limited_total{reason="rate_limit"}`
+	before := counterValue(t, series)
+
+	// The bucket belongs to the identity, whichever address it calls from.
+	for i, client := range []string{"192.0.2.1", "192.0.2.2"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, limitedRequest(client, testToken))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d, want 200", i+1, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, limitedRequest("192.0.2.3", testToken))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request: got %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After: got %q, want 2", got)
+	}
+	if got := counterValue(t, series); got != before+1 {
+		t.Errorf("%s: got %v, want %v", series, got, before+1)
+	}
+
+	// Failed requests are limited by client IP instead.
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, limitedRequest("198.51.100.4", "wrong-token"))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failed request %d: got %d, want 401", i+1, rec.Code)
+		}
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, limitedRequest("198.51.100.4", "wrong-token"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("third failed request: got %d, want 429", rec.Code)
+	}
+}
+
+func TestAuthenticator_Lockout(t *testing.T) {
+	trusted, _ := middleware.ParseTrustedProxies("127.0.0.1")
+	auth := &middleware.Authenticator{Token: testToken, Limiter: &middleware.RateLimiter{
+		MaxFailures: 3, Lockout: 15 * time.Minute, TrustedProxies: trusted,
+	}}
+	handler := auth.Require(okHandler)
+	const (
+		lockouts = `lab_gear_requests_limited_total{reason="lockout"}`
+		rejected = `lab_gear_requests_rejected_total{code="401"}`
+	)
+	beforeLockouts, beforeRejected := counterValue(t, lockouts), counterValue(t, rejected)
+
+	serve := func(client, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, limitedRequest(client, token))
+		return rec
+	}
+	for i := 0; i < 2; i++ {
+		if rec := serve("203.0.113.9", "guess"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: got %d, want 401", i+1, rec.Code)
+		}
+	}
+	rec := serve("203.0.113.9", "guess")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "900" {
+		t.Fatalf("third failure: got %d Retry-After %q, want 429 900", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// Once locked out, even the right token is refused from that address if
+	// it has not worked from there before, but other clients behind the
+	// same proxy are unaffected.
+	if rec := serve("203.0.113.9", testToken); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("valid token while locked out: got %d, want 429", rec.Code)
+	}
+	if rec := serve("192.0.2.1", testToken); rec.Code != http.StatusOK {
+		t.Errorf("other client: got %d, want 200", rec.Code)
+	}
+
+	// Successes in between do not clear earlier failures.
+	for i := 0; i < 2; i++ {
+		if rec := serve("192.0.2.1", "guess"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("interleaved failure %d: got %d, want 401", i+1, rec.Code)
+		}
+		if rec := serve("192.0.2.1", testToken); rec.Code != http.StatusOK {
+			t.Fatalf("interleaved success %d: got %d, want 200", i+1, rec.Code)
+		}
+	}
+	if rec := serve("192.0.2.1", "guess"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("third failure between successes: got %d, want 429", rec.Code)
+	}
+
+	// The token that has worked from the address still does, so a client
+	// guessing behind a shared NAT cannot lock out its neighbours, but
+	// anything else from there is refused.
+	if rec := serve("192.0.2.1", testToken); rec.Code != http.StatusOK {
+		t.Errorf("proven token while locked out: got %d, want 200", rec.Code)
+	}
+	if rec := serve("192.0.2.1", "guess"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("guess while locked out: got %d, want 429", rec.Code)
+	}
+	if rec := serve("192.0.2.1", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("no credential while locked out: got %d, want 429", rec.Code)
+	}
+
+	if got := counterValue(t, lockouts); got != beforeLockouts+5 {
+		t.Errorf("%s: got %v, want %v", lockouts, got, beforeLockouts+5)
+	}
+	if got := counterValue(t, rejected); got != beforeRejected+4 {
+		t.Errorf("%s: got %v, want %v", rejected, got, beforeRejected+4)
+	}
+}
@@ -2,21 +2,75 @@ package models
 
 import "time"
 
-// Machine represents a physical machine in the homelab inventory.
+// Machine represents a physical machine in the homelab inventory. Tags is a
+// sorted set of free-form markers such as "gpu-passthrough"; Labels holds
+// key/value pairs such as env=prod. ParentID names the machine this one is
+// placed in or runs on, such as the NAS enclosure an SBC is mounted in.
+// LocationID places the machine in a site, room, or rack; in a rack, RackU
+// is the lowest unit it occupies and UHeight how many units it spans.
 type Machine struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Kind      string    `json:"kind"`
-	Make      string    `json:"make"`
-	Model     string    `json:"model"`
-	CPU       string    `json:"cpu"`
-	RAMGB     int       `json:"ram_gb"`
-	StorageTB float64   `json:"storage_tb"`
-	Location  string    `json:"location"`
-	Serial    string    `json:"serial"`
-	Notes     string    `json:"notes"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Kind      string            `json:"kind"`
+	Make      string            `json:"make"`
+	Model     string            `json:"model"`
+	CPU       string            `json:"cpu"`
+	CPUCores  int               `json:"cpu_cores"`
+	RAMGB     int               `json:"ram_gb"`
+	StorageTB float64           `json:"storage_tb"`
+	Location  string            `json:"location"`
+	Serial    string            `json:"serial"`
+	Notes     string            `json:"notes"`
+	Tags      []string          `json:"tags"`
+	Labels    map[string]string `json:"labels"`
+	ParentID  string            `json:"parent_id,omitempty"`
+	// Location above is free text kept for notes such as "top shelf";
+	// LocationID refers to a Location record.
+	LocationID string `json:"location_id,omitempty"`
+	RackU      int    `json:"rack_u"`
+	UHeight    int    `json:"u_height"`
+	// DeriveCapacity makes the server compute RAMGB from the machine's DIMM
+	// components and StorageTB from its disks, ignoring client values.
+	DeriveCapacity bool `json:"derive_capacity"`
+	// Purchase and warranty details. PurchaseDate and WarrantyEnd are
+	// YYYY-MM-DD dates, empty when unknown. Price is in Currency, an ISO 4217
+	// code, and LifetimeYears is how long the machine is expected to stay in
+	// service; the cost report depreciates Price over it.
+	PurchaseDate  string  `json:"purchase_date"`
+	Vendor        string  `json:"vendor"`
+	Price         float64 `json:"price"`
+	Currency      string  `json:"currency"`
+	WarrantyEnd   string  `json:"warranty_end"`
+	LifetimeYears int     `json:"lifetime_years"`
+	// RatedWatts is the nameplate rating of the power supply, and IdleWatts
+	// and PeakWatts the measured or estimated draw; zero when unknown. See
+	// PowerDraw.
+	RatedWatts int `json:"rated_watts"`
+	IdleWatts  int `json:"idle_watts"`
+	PeakWatts  int `json:"peak_watts"`
+	// UPSID is the UPS asset the machine is plugged into. Circuit names the
+	// mains circuit feeding a machine that is not on a UPS. At most one of
+	// the two is set.
+	UPSID   string `json:"ups_id,omitempty"`
+	Circuit string `json:"circuit"`
+	// ReservedCores, ReservedRAMGB, and ReservedStorageTB are the share of a
+	// hypervisor's capacity that is already spoken for, whether kept back
+	// for the host itself or allocated to workloads. The capacity report
+	// subtracts them to find the headroom.
+	ReservedCores     int     `json:"reserved_cores"`
+	ReservedRAMGB     int     `json:"reserved_ram_gb"`
+	ReservedStorageTB float64 `json:"reserved_storage_tb"`
+	// Status is the machine's lifecycle stage; see StatusTransitions.
+	// StatusChangedAt is set by the server whenever Status changes.
+	Status          string    `json:"status"`
+	StatusChangedAt time.Time `json:"status_changed_at"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	// Revision increases by one on every write. The API exposes it as the
+	// machine's ETag for conditional requests.
+	Revision int64 `json:"revision"`
+	// DeletedAt is set while the machine is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 // ValidKinds is the set of allowed machine kind values.
@@ -28,3 +82,517 @@ var ValidKinds = map[string]bool{
 	"workstation": true,
 	"laptop":      true,
 }
+
+// Machine lifecycle statuses.
+const (
+	StatusPlanned     = "planned"
+	StatusOrdered     = "ordered"
+	StatusActive      = "active"
+	StatusMaintenance = "maintenance"
+	StatusRetired     = "retired"
+	StatusSold        = "sold"
+)
+
+// DefaultStatus is the status of a machine created without one. Machines
+// that existed before statuses were introduced are also active.
+const DefaultStatus = StatusActive
+
+// StatusTransitions lists, for each status, the statuses a machine may move
+// to next. Keeping the same status is always allowed. A sold machine is
+// gone for good; a retired one can only be sold or brought back into use.
+var StatusTransitions = map[string][]string{
+	StatusPlanned:     {StatusOrdered, StatusActive},
+	StatusOrdered:     {StatusPlanned, StatusActive},
+	StatusActive:      {StatusMaintenance, StatusRetired, StatusSold},
+	StatusMaintenance: {StatusActive, StatusRetired, StatusSold},
+	StatusRetired:     {StatusActive, StatusSold},
+	StatusSold:        {},
+}
+
+// MachineList is one page of results from the machine list endpoint.
+// NextCursor is omitted on the final page.
+type MachineList struct {
+	Machines   []*Machine `json:"machines"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// MachineTree is a machine together with everything placed in it,
+// recursively. Children are ordered by name.
+type MachineTree struct {
+	Machine  *Machine       `json:"machine"`
+	Children []*MachineTree `json:"children"`
+}
+
+// SearchResult is a machine matched by full-text search. Score is higher for
+// better matches, and Snippet is an HTML-escaped excerpt of the best matching
+// field with matched terms wrapped in <mark> tags.
+type SearchResult struct {
+	Machine *Machine `json:"machine"`
+	Score   float64  `json:"score"`
+	Snippet string   `json:"snippet"`
+}
+
+// SearchResults is the response body of the machine search endpoint.
+type SearchResults struct {
+	Results []*SearchResult `json:"results"`
+}
+
+// Machine event operations.
+const (
+	OpCreate  = "create"
+	OpUpdate  = "update"
+	OpDelete  = "delete"
+	OpRestore = "restore"
+	OpPurge   = "purge"
+	// OpComponentMove is recorded on both machines when a component moves
+	// from one to the other.
+	OpComponentMove = "component_move"
+)
+
+// FieldChange is the before and after value of one machine field. Before is
+// null on create and After is null on purge. A component_move event has a
+// single "component" change holding the component before and after the move.
+type FieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// MachineEvent is one entry in the audit log: a single write to a machine,
+// who made it, and which fields it changed.
+type MachineEvent struct {
+	ID        int64                  `json:"id"`
+	MachineID string                 `json:"machine_id"`
+	Actor     string                 `json:"actor"`
+	Operation string                 `json:"operation"`
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// EventList is the response body of the history and audit endpoints.
+// NextCursor is omitted on the final page.
+type EventList struct {
+	Events     []*MachineEvent `json:"events"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// NetworkInterface is a network interface on a machine. MAC is stored in
+// lower-case colon-separated form and is unique across the inventory;
+// Addresses holds IPv4 and IPv6 addresses in canonical form.
+type NetworkInterface struct {
+	ID        string   `json:"id"`
+	MachineID string   `json:"machine_id"`
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac"`
+	Addresses []string `json:"addresses"`
+	// VLAN is the 802.1Q VLAN ID, or 0 for untagged.
+	VLAN      int       `json:"vlan"`
+	SpeedMbps int       `json:"speed_mbps"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// InterfaceList is the response body of the interface list and lookup
+// endpoints.
+type InterfaceList struct {
+	Interfaces []*NetworkInterface `json:"interfaces"`
+}
+
+// Guest types.
+const (
+	GuestVM  = "vm"
+	GuestLXC = "lxc"
+)
+
+// Guest is a virtual machine or LXC container running on a host machine.
+// Names are unique per host. RAMMB and DiskGB follow the units Proxmox uses
+// for guests rather than those of Machine.
+type Guest struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	HostID    string    `json:"host_id"`
+	VCPUs     int       `json:"vcpus"`
+	RAMMB     int       `json:"ram_mb"`
+	DiskGB    int       `json:"disk_gb"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GuestList is the response body of the guest list endpoint.
+type GuestList struct {
+	Guests []*Guest `json:"guests"`
+}
+
+// Maintenance event types.
+const (
+	MaintenanceRepair   = "repair"
+	MaintenanceUpgrade  = "upgrade"
+	MaintenanceFirmware = "firmware"
+	MaintenanceCleaning = "cleaning"
+)
+
+// ValidMaintenanceTypes is the set of allowed maintenance event type values.
+var ValidMaintenanceTypes = map[string]bool{
+	MaintenanceRepair:   true,
+	MaintenanceUpgrade:  true,
+	MaintenanceFirmware: true,
+	MaintenanceCleaning: true,
+}
+
+// MaintenanceEvent is a dated piece of work done on a machine. An event with
+// no CompletedDate is open. While an open event has SetsStatus, its machine
+// is held in the maintenance status.
+type MaintenanceEvent struct {
+	ID          string `json:"id"`
+	MachineID   string `json:"machine_id"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	// Date is the YYYY-MM-DD day the work started, and CompletedDate the day
+	// it finished.
+	Date          string    `json:"date"`
+	CompletedDate string    `json:"completed_date"`
+	Cost          float64   `json:"cost"`
+	Currency      string    `json:"currency"`
+	PerformedBy   string    `json:"performed_by"`
+	SetsStatus    bool      `json:"sets_status"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// MaintenanceList is the response body of the maintenance list endpoint.
+type MaintenanceList struct {
+	Events []*MaintenanceEvent `json:"events"`
+}
+
+// Location kinds, from outermost to innermost.
+const (
+	LocationSite = "site"
+	LocationRoom = "room"
+	LocationRack = "rack"
+)
+
+// LocationParentKinds maps each location kind to the kind its parent must
+// be. Sites are top-level and have no parent.
+var LocationParentKinds = map[string]string{
+	LocationSite: "",
+	LocationRoom: LocationSite,
+	LocationRack: LocationRoom,
+}
+
+// Location is a site, a room within a site, or a rack within a room. Names
+// are unique, ignoring case, among locations with the same parent. HeightU
+// is the number of rack units in a rack and zero for other kinds.
+type Location struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	HeightU   int       `json:"height_u"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LocationList is the response body of the location list endpoint.
+type LocationList struct {
+	Locations []*Location `json:"locations"`
+}
+
+// Asset types: network and power gear tracked alongside machines.
+const (
+	AssetSwitch      = "switch"
+	AssetUPS         = "ups"
+	AssetAccessPoint = "accesspoint"
+)
+
+// AssetType describes one type of asset: the path segment its endpoints are
+// served under, /api/v1/{Path}, and the JSON names of the type-specific
+// Asset fields it uses. The type-specific fields of other types must be left
+// zero.
+type AssetType struct {
+	Name   string
+	Path   string
+	Fields []string
+}
+
+// AssetTypes lists every asset type. Adding a type here, with its fields on
+// Asset, is enough to serve it.
+var AssetTypes = []AssetType{
+	{Name: AssetSwitch, Path: "switches", Fields: []string{"port_count"}},
+	{Name: AssetUPS, Path: "ups", Fields: []string{"va_rating", "watt_rating", "runtime_minutes"}},
+	{Name: AssetAccessPoint, Path: "accesspoints", Fields: []string{"radio_bands"}},
+}
+
+// DefaultPowerFactor converts a UPS's VA rating to watts when it has no
+// watt rating. Most small UPS units deliver 0.6 to 0.9 W per VA, so the low
+// end keeps power budgets on the safe side.
+const DefaultPowerFactor = 0.6
+
+// UPSCapacityWatts returns the load in watts the UPS a can carry: its watt
+// rating, or its VA rating times DefaultPowerFactor.
+func UPSCapacityWatts(a *Asset) int {
+	if a.WattRating > 0 {
+		return a.WattRating
+	}
+	return int(float64(a.VARating) * DefaultPowerFactor)
+}
+
+// PowerDraw returns the peak and idle draw of m in watts for power
+// budgets. Peak falls back to the rated wattage and idle to peak, so
+// unknown values are budgeted high rather than ignored.
+func PowerDraw(m *Machine) (peak, idle int) {
+	peak = m.PeakWatts
+	if peak == 0 {
+		peak = m.RatedWatts
+	}
+	idle = m.IdleWatts
+	if idle == 0 {
+		idle = peak
+	}
+	return peak, idle
+}
+
+// ValidRadioBands is the set of allowed access point radio bands.
+var ValidRadioBands = map[string]bool{
+	"2.4ghz": true,
+	"5ghz":   true,
+	"6ghz":   true,
+}
+
+// Asset is a piece of equipment that is not a machine, such as a switch, a
+// UPS, or a wireless access point. The fields after Notes are specific to
+// one type and omitted for the others.
+type Asset struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Make       string `json:"make"`
+	Model      string `json:"model"`
+	Serial     string `json:"serial"`
+	LocationID string `json:"location_id,omitempty"`
+	Notes      string `json:"notes"`
+	// PortCount is the number of ports on a switch.
+	PortCount int `json:"port_count,omitempty"`
+	// VARating is a UPS's capacity in volt-amperes and WattRating its
+	// capacity in watts, if known; see UPSCapacityWatts. RuntimeMinutes is its
+	// battery runtime at full load.
+	VARating       int `json:"va_rating,omitempty"`
+	WattRating     int `json:"watt_rating,omitempty"`
+	RuntimeMinutes int `json:"runtime_minutes,omitempty"`
+	// RadioBands is the sorted set of bands an access point broadcasts on;
+	// see ValidRadioBands.
+	RadioBands []string  `json:"radio_bands,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// AssetList is the response body of the asset list endpoints.
+type AssetList struct {
+	Assets []*Asset `json:"assets"`
+}
+
+// Component types. DIMM capacity counts toward a machine's derived RAMGB and
+// disk capacity toward its derived StorageTB.
+const (
+	ComponentDisk  = "disk"
+	ComponentDIMM  = "dimm"
+	ComponentGPU   = "gpu"
+	ComponentNIC   = "nic"
+	ComponentOther = "other"
+)
+
+// ValidComponentTypes is the set of allowed component type values.
+var ValidComponentTypes = map[string]bool{
+	ComponentDisk:  true,
+	ComponentDIMM:  true,
+	ComponentGPU:   true,
+	ComponentNIC:   true,
+	ComponentOther: true,
+}
+
+// Component is a part installed in a machine, such as a disk or DIMM. A
+// non-empty Serial is unique across the inventory, and a non-empty Slot is
+// unique within the machine.
+type Component struct {
+	ID        string `json:"id"`
+	MachineID string `json:"machine_id"`
+	Type      string `json:"type"`
+	Make      string `json:"make"`
+	Model     string `json:"model"`
+	Serial    string `json:"serial"`
+	// CapacityGB is the size of a disk, DIMM, or GPU memory in gigabytes.
+	CapacityGB int       `json:"capacity_gb"`
+	Slot       string    `json:"slot"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ComponentList is the response body of the component list endpoint.
+type ComponentList struct {
+	Components []*Component `json:"components"`
+}
+
+// ComponentMove is the request body for moving a component to another
+// machine. Slot is the component's slot in the new machine.
+type ComponentMove struct {
+	MachineID string `json:"machine_id"`
+	Slot      string `json:"slot"`
+}
+
+// WarrantyReport lists the machines whose warranty ends between AsOf and
+// Until, both YYYY-MM-DD dates, ordered by warranty end.
+type WarrantyReport struct {
+	AsOf     string     `json:"as_of"`
+	Until    string     `json:"until"`
+	Machines []*Machine `json:"machines"`
+}
+
+// CostGroup totals the purchase prices of the machines sharing a kind or
+// location and a currency. BookValue is what remains of TotalCost after
+// straight-line depreciation over each machine's lifetime, and
+// AnnualDepreciation is how much of it is written off per year for the
+// machines that have started but not finished depreciating.
+type CostGroup struct {
+	// Group is the machine kind, or the location ID when grouping by
+	// location; Name is then the location's name. Both are empty for
+	// machines without a location.
+	Group              string  `json:"group"`
+	Name               string  `json:"name,omitempty"`
+	Currency           string  `json:"currency"`
+	Machines           int     `json:"machines"`
+	TotalCost          float64 `json:"total_cost"`
+	BookValue          float64 `json:"book_value"`
+	AnnualDepreciation float64 `json:"annual_depreciation"`
+}
+
+// UPSLoad is the power drawn from one UPS by the machines plugged into it,
+// in watts. Utilization is PeakWatts as a percentage of CapacityWatts, and
+// EstimatedRuntimeMinutes is how long the battery may carry PeakWatts; it is
+// omitted when the UPS has no runtime or no load.
+type UPSLoad struct {
+	ID                      string  `json:"id"`
+	Name                    string  `json:"name"`
+	LocationID              string  `json:"location_id,omitempty"`
+	Machines                int     `json:"machines"`
+	IdleWatts               int     `json:"idle_watts"`
+	PeakWatts               int     `json:"peak_watts"`
+	CapacityWatts           int     `json:"capacity_watts"`
+	Utilization             float64 `json:"utilization"`
+	EstimatedRuntimeMinutes float64 `json:"estimated_runtime_minutes,omitempty"`
+}
+
+// CircuitLoad is the power drawn in watts by the machines on one circuit
+// that are not on a UPS. Circuit is empty for machines with neither.
+type CircuitLoad struct {
+	Circuit   string `json:"circuit"`
+	Machines  int    `json:"machines"`
+	IdleWatts int    `json:"idle_watts"`
+	PeakWatts int    `json:"peak_watts"`
+}
+
+// PowerReport is the response body of the power report endpoint.
+type PowerReport struct {
+	UPS      []*UPSLoad     `json:"ups"`
+	Circuits []*CircuitLoad `json:"circuits"`
+}
+
+// Resources is an amount of hypervisor capacity.
+type Resources struct {
+	CPUCores  int     `json:"cpu_cores"`
+	RAMGB     int     `json:"ram_gb"`
+	StorageTB float64 `json:"storage_tb"`
+}
+
+// CapacityTotals sums the capacity of a set of hosts. Available is Total
+// less Reserved; it is negative where a host is overcommitted.
+type CapacityTotals struct {
+	Hosts     int       `json:"hosts"`
+	Total     Resources `json:"total"`
+	Reserved  Resources `json:"reserved"`
+	Available Resources `json:"available"`
+}
+
+// HostCapacity is the capacity of one hypervisor host.
+type HostCapacity struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	LocationID string    `json:"location_id,omitempty"`
+	Total      Resources `json:"total"`
+	Reserved   Resources `json:"reserved"`
+	Available  Resources `json:"available"`
+}
+
+// LocationCapacity is the capacity of the hosts in one location. LocationID
+// and Name are empty for hosts without a location.
+type LocationCapacity struct {
+	LocationID string `json:"location_id"`
+	Name       string `json:"name"`
+	CapacityTotals
+}
+
+// CapacityReport is the response body of the capacity report endpoint.
+type CapacityReport struct {
+	Kind      string              `json:"kind"`
+	Hosts     []*HostCapacity     `json:"hosts"`
+	Locations []*LocationCapacity `json:"locations"`
+	Overall   CapacityTotals      `json:"overall"`
+}
+
+// CostReport is the response body of the cost report endpoint. GroupBy is
+// "kind" or "location".
+type CostReport struct {
+	AsOf    string       `json:"as_of"`
+	GroupBy string       `json:"group_by"`
+	Groups  []*CostGroup `json:"groups"`
+}
+
+// API token scopes. ScopeAdmin grants every scope, and ScopeMachinesWrite
+// grants ScopeMachinesRead; see HasScope.
+const (
+	ScopeMachinesRead  = "machines:read"
+	ScopeMachinesWrite = "machines:write"
+	ScopeAdmin         = "admin"
+)
+
+// ValidScopes is the set of allowed API token scopes.
+var ValidScopes = map[string]bool{
+	ScopeMachinesRead:  true,
+	ScopeMachinesWrite: true,
+	ScopeAdmin:         true,
+}
+
+// HasScope reports whether a credential holding scopes may act with the
+// scope want.
+func HasScope(scopes []string, want string) bool {
+	for _, s := range scopes {
+		if s == want || s == ScopeAdmin || (s == ScopeMachinesWrite && want == ScopeMachinesRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken is a bearer token issued through the token API. Only a hash of
+// the secret is stored; the secret itself is returned once, on creation.
+type APIToken struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is nil for a token that does not expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// LastUsedAt is when the token last authenticated a request, to within
+	// a minute, or nil if it never has.
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NewAPIToken is the response body of the token create endpoint: the stored
+// token together with its secret.
+type NewAPIToken struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+// APITokenList is the response body of the token list endpoint.
+type APITokenList struct {
+	Tokens []*APIToken `json:"tokens"`
+}
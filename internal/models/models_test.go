@@ -37,3 +37,23 @@ func TestValidKinds_IsCaseSensitive(t *testing.T) {
 		t.Error("ValidKinds should be case-sensitive; 'NAS' should not match 'nas'")
 	}
 }
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		want   string
+		ok     bool
+	}{
+		{[]string{models.ScopeMachinesRead}, models.ScopeMachinesRead, true},
+		{[]string{models.ScopeMachinesRead}, models.ScopeMachinesWrite, false},
+		{[]string{models.ScopeMachinesWrite}, models.ScopeMachinesRead, true},
+		{[]string{models.ScopeMachinesWrite}, models.ScopeAdmin, false},
+		{[]string{models.ScopeAdmin}, models.ScopeMachinesWrite, true},
+		{nil, models.ScopeMachinesRead, false},
+	}
+	for _, tt := range tests {
+		if got := models.HasScope(tt.scopes, tt.want); got != tt.ok {
+			t.Errorf("HasScope(%v, %q): got %v, want %v", tt.scopes, tt.want, got, tt.ok)
+		}
+	}
+}
@@ -80,7 +80,7 @@ function listMachines() {
     'list: status 200': (r) => r.status === 200,
     'list: returns array': (r) => {
       const body = parseJSON(r);
-      return body !== null && Array.isArray(body);
+      return body !== null && Array.isArray(body.machines);
     },
   });
 }
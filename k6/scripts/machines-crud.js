@@ -139,13 +139,14 @@ export default function () {
 
   // ── Step 3: Appears in list ───────────────────────────────────────────────
   group('3. appears in list', () => {
-    const res = http.get(`${BASE_URL}/api/v1/machines`, { headers: authHeaders() });
+    // Newest first, so the machine just created is on the first page.
+    const res = http.get(`${BASE_URL}/api/v1/machines?sort=-created_at`, { headers: authHeaders() });
     check(res, {
       'list: status 200': (r) => r.status === 200,
       'list: machine is present': (r) => {
         const body = parseJSON(r);
-        if (!body || !Array.isArray(body)) return false;
-        return body.some((m) => m.id === machineID);
+        if (!body || !Array.isArray(body.machines)) return false;
+        return body.machines.some((m) => m.id === machineID);
       },
     });
   });
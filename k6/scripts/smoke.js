@@ -75,7 +75,7 @@ export default function () {
       'list status is 200': (r) => r.status === 200,
       'list returns array': (r) => {
         const body = parseJSON(r);
-        return body !== null && Array.isArray(body);
+        return body !== null && Array.isArray(body.machines);
       },
     });
   });
@@ -86,12 +86,12 @@ export default function () {
       'list with filter status is 200': (r) => r.status === 200,
       'list with filter returns array': (r) => {
         const body = parseJSON(r);
-        return body !== null && Array.isArray(body);
+        return body !== null && Array.isArray(body.machines);
       },
       'list with filter all items match kind': (r) => {
         const body = parseJSON(r);
-        if (!body || !Array.isArray(body)) return false;
-        return body.every((m) => m.kind === 'proxmox');
+        if (!body || !Array.isArray(body.machines)) return false;
+        return body.machines.every((m) => m.kind === 'proxmox');
       },
     });
   });
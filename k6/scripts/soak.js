@@ -106,7 +106,7 @@ export default function () {
       'soak list: status 200': (r) => r.status === 200,
       'soak list: returns array': (r) => {
         const body = parseJSON(r);
-        return body !== null && Array.isArray(body);
+        return body !== null && Array.isArray(body.machines);
       },
     });
   }
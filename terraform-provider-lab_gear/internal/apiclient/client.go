@@ -4,8 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxRetries is how many times a request answered with 429 Too Many
+	// Requests is retried before the 429 is returned to the caller.
+	maxRetries = 5
+	// maxRetryAfter is the longest Retry-After the client will wait out.
+	// Longer waits, such as an authentication lockout, are returned at once.
+	maxRetryAfter = 30 * time.Second
 )
 
 // Client is an HTTP client for the lab_gear REST API.
@@ -32,27 +46,110 @@ type Machine struct {
 	Make      string  `json:"make"`
 	Model     string  `json:"model"`
 	CPU       string  `json:"cpu"`
+	CPUCores  int64   `json:"cpu_cores"`
 	RAMGB     int64   `json:"ram_gb"`
 	StorageTB float64 `json:"storage_tb"`
 	Location  string  `json:"location"`
 	Serial    string  `json:"serial"`
 	Notes     string  `json:"notes"`
+	// Tags and Labels are always sent so that an update replaces them.
+	Tags   []string          `json:"tags"`
+	Labels map[string]string `json:"labels"`
+	// ParentID is omitted when empty, which on an update clears the parent.
+	ParentID string `json:"parent_id,omitempty"`
+	// LocationID refers to a Location. Like ParentID it is omitted when
+	// empty. A zero UHeight with a RackU set means one unit.
+	LocationID string `json:"location_id,omitempty"`
+	RackU      int64  `json:"rack_u"`
+	UHeight    int64  `json:"u_height"`
+	// DeriveCapacity makes the server compute RAMGB and StorageTB from the
+	// machine's DIMM and disk components.
+	DeriveCapacity bool `json:"derive_capacity"`
+	// PurchaseDate and WarrantyEnd are YYYY-MM-DD dates; Price is in the
+	// ISO 4217 Currency.
+	PurchaseDate  string  `json:"purchase_date"`
+	Vendor        string  `json:"vendor"`
+	Price         float64 `json:"price"`
+	Currency      string  `json:"currency"`
+	WarrantyEnd   string  `json:"warranty_end"`
+	LifetimeYears int64   `json:"lifetime_years"`
+	// RatedWatts, IdleWatts, and PeakWatts are the machine's power draw. It
+	// is fed by the UPS asset UPSID, omitted when empty, or else by the
+	// named Circuit.
+	RatedWatts int64  `json:"rated_watts"`
+	IdleWatts  int64  `json:"idle_watts"`
+	PeakWatts  int64  `json:"peak_watts"`
+	UPSID      string `json:"ups_id,omitempty"`
+	Circuit    string `json:"circuit"`
+	// The Reserved fields are the part of a hypervisor's capacity already
+	// spoken for, subtracted by the capacity report.
+	ReservedCores     int64   `json:"reserved_cores"`
+	ReservedRAMGB     int64   `json:"reserved_ram_gb"`
+	ReservedStorageTB float64 `json:"reserved_storage_tb"`
+	// Status is omitted when empty so the server keeps the current status.
+	Status          string `json:"status,omitempty"`
+	StatusChangedAt string `json:"status_changed_at,omitempty"`
+	// Revision is the server's write counter for the machine. When set on
+	// an update it is sent as If-Match so stale writes are rejected.
+	Revision int64 `json:"revision,omitempty"`
 }
 
+// ErrModified is returned by UpdateMachine when the machine has been changed
+// since the revision the caller last read.
+var ErrModified = errors.New("machine was modified since it was last read")
+
 func (c *Client) doRequest(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	return c.doRequestWithHeader(ctx, method, path, body, nil)
+}
+
+// doRequestWithHeader sends the request, waiting out and retrying up to
+// maxRetries 429 responses whose Retry-After is at most maxRetryAfter.
+func (c *Client) doRequestWithHeader(ctx context.Context, method, path string, body any, header http.Header) (*http.Response, error) {
 	var buf bytes.Buffer
 	if body != nil {
 		if err := json.NewEncoder(&buf).Encode(body); err != nil {
 			return nil, fmt.Errorf("encode request: %w", err)
 		}
 	}
-	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, &buf)
-	if err != nil {
-		return nil, fmt.Errorf("build request: %w", err)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return nil, fmt.Errorf("build request: %w", err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.httpClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt == maxRetries {
+			return resp, err
+		}
+		wait, ok := retryAfter(resp)
+		if !ok {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.Header.Set("Content-Type", "application/json")
-	return c.httpClient.Do(req)
+}
+
+// retryAfter returns how long resp asks the client to wait before retrying,
+// and false if it gives no wait in seconds or one longer than maxRetryAfter.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	wait := time.Duration(secs) * time.Second
+	return wait, wait <= maxRetryAfter
 }
 
 // CreateMachine POSTs a new machine and returns the server-assigned record.
@@ -87,9 +184,15 @@ func (c *Client) GetMachine(ctx context.Context, id string) (*Machine, error) {
 	return &out, json.NewDecoder(resp.Body).Decode(&out)
 }
 
-// UpdateMachine PUTs a full replacement for the machine with m.ID.
+// UpdateMachine PUTs a full replacement for the machine with m.ID. If
+// m.Revision is set the update is conditional on the machine still being at
+// that revision, and ErrModified is returned if it is not.
 func (c *Client) UpdateMachine(ctx context.Context, m Machine) (*Machine, error) {
-	resp, err := c.doRequest(ctx, http.MethodPut, "/api/v1/machines/"+m.ID, m)
+	var header http.Header
+	if m.Revision != 0 {
+		header = http.Header{"If-Match": {fmt.Sprintf(`"%d"`, m.Revision)}}
+	}
+	resp, err := c.doRequestWithHeader(ctx, http.MethodPut, "/api/v1/machines/"+m.ID, m, header)
 	if err != nil {
 		return nil, err
 	}
@@ -97,6 +200,9 @@ func (c *Client) UpdateMachine(ctx context.Context, m Machine) (*Machine, error)
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, fmt.Errorf("update machine %q: not found", m.ID)
 	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return nil, fmt.Errorf("update machine %q: %w", m.ID, ErrModified)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("update machine %q: unexpected status %d", m.ID, resp.StatusCode)
 	}
@@ -104,12 +210,39 @@ func (c *Client) UpdateMachine(ctx context.Context, m Machine) (*Machine, error)
 	return &out, json.NewDecoder(resp.Body).Decode(&out)
 }
 
-// ListMachines returns all machines, optionally filtered by kind.
+// MachineList is one page of the machine list response. NextCursor is empty
+// on the final page.
+type MachineList struct {
+	Machines   []Machine `json:"machines"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// ListMachines returns all machines, optionally filtered by kind. It follows
+// next_cursor until every page has been read.
 func (c *Client) ListMachines(ctx context.Context, kind string) ([]Machine, error) {
-	path := "/api/v1/machines"
+	q := url.Values{}
 	if kind != "" {
-		path += "?kind=" + kind
+		q.Set("kind", kind)
+	}
+	out := []Machine{}
+	for {
+		path := "/api/v1/machines"
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+		page, err := c.listMachinesPage(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page.Machines...)
+		if page.NextCursor == "" {
+			return out, nil
+		}
+		q.Set("cursor", page.NextCursor)
 	}
+}
+
+func (c *Client) listMachinesPage(ctx context.Context, path string) (*MachineList, error) {
 	resp, err := c.doRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return nil, err
@@ -118,8 +251,8 @@ func (c *Client) ListMachines(ctx context.Context, kind string) ([]Machine, erro
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("list machines: unexpected status %d", resp.StatusCode)
 	}
-	var out []Machine
-	return out, json.NewDecoder(resp.Body).Decode(&out)
+	var out MachineList
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
 }
 
 // DeleteMachine removes the machine with the given ID.
@@ -134,3 +267,356 @@ func (c *Client) DeleteMachine(ctx context.Context, id string) error {
 	}
 	return fmt.Errorf("delete machine %q: unexpected status %d", id, resp.StatusCode)
 }
+
+// Location mirrors the JSON shape of a lab_gear location: a site, a room in
+// a site, or a rack in a room.
+type Location struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	ParentID string `json:"parent_id,omitempty"`
+	HeightU  int64  `json:"height_u"`
+}
+
+// CreateLocation POSTs a new location and returns the server-assigned record.
+func (c *Client) CreateLocation(ctx context.Context, l Location) (*Location, error) {
+	resp, err := c.doRequest(ctx, http.MethodPost, "/api/v1/locations", l)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("create location: unexpected status %d", resp.StatusCode)
+	}
+	var out Location
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
+}
+
+// GetLocation fetches a single location by ID. Returns nil, nil when the
+// server responds 404.
+func (c *Client) GetLocation(ctx context.Context, id string) (*Location, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/locations/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get location %q: unexpected status %d", id, resp.StatusCode)
+	}
+	var out Location
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
+}
+
+// UpdateLocation PUTs a full replacement for the location with l.ID.
+func (c *Client) UpdateLocation(ctx context.Context, l Location) (*Location, error) {
+	resp, err := c.doRequest(ctx, http.MethodPut, "/api/v1/locations/"+l.ID, l)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("update location %q: not found", l.ID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("update location %q: unexpected status %d", l.ID, resp.StatusCode)
+	}
+	var out Location
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
+}
+
+// DeleteLocation removes the location with the given ID. The server refuses
+// with 409 while machines, assets, or other locations still refer to it.
+func (c *Client) DeleteLocation(ctx context.Context, id string) error {
+	resp, err := c.doRequest(ctx, http.MethodDelete, "/api/v1/locations/"+id, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return fmt.Errorf("delete location %q: unexpected status %d", id, resp.StatusCode)
+}
+
+// Guest mirrors the JSON shape of a lab_gear guest: a VM or LXC container
+// running on a host machine.
+type Guest struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	HostID string `json:"host_id"`
+	VCPUs  int64  `json:"vcpus"`
+	RAMMB  int64  `json:"ram_mb"`
+	DiskGB int64  `json:"disk_gb"`
+}
+
+// CreateGuest POSTs a new guest and returns the server-assigned record.
+func (c *Client) CreateGuest(ctx context.Context, g Guest) (*Guest, error) {
+	resp, err := c.doRequest(ctx, http.MethodPost, "/api/v1/guests", g)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("create guest: unexpected status %d", resp.StatusCode)
+	}
+	var out Guest
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
+}
+
+// GetGuest fetches a single guest by ID. Returns nil, nil when the server
+// responds 404, which it also does while the guest's host is in the trash.
+func (c *Client) GetGuest(ctx context.Context, id string) (*Guest, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/guests/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get guest %q: unexpected status %d", id, resp.StatusCode)
+	}
+	var out Guest
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
+}
+
+// UpdateGuest PUTs a full replacement for the guest with g.ID.
+func (c *Client) UpdateGuest(ctx context.Context, g Guest) (*Guest, error) {
+	resp, err := c.doRequest(ctx, http.MethodPut, "/api/v1/guests/"+g.ID, g)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("update guest %q: not found", g.ID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("update guest %q: unexpected status %d", g.ID, resp.StatusCode)
+	}
+	var out Guest
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
+}
+
+// DeleteGuest removes the guest with the given ID.
+func (c *Client) DeleteGuest(ctx context.Context, id string) error {
+	resp, err := c.doRequest(ctx, http.MethodDelete, "/api/v1/guests/"+id, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return fmt.Errorf("delete guest %q: unexpected status %d", id, resp.StatusCode)
+}
+
+// Asset mirrors the JSON shape of a lab_gear asset: a switch, UPS, or access
+// point. The fields after Notes apply to one type each.
+type Asset struct {
+	ID             string   `json:"id,omitempty"`
+	Type           string   `json:"type,omitempty"`
+	Name           string   `json:"name"`
+	Make           string   `json:"make"`
+	Model          string   `json:"model"`
+	Serial         string   `json:"serial"`
+	LocationID     string   `json:"location_id,omitempty"`
+	Notes          string   `json:"notes"`
+	PortCount      int64    `json:"port_count,omitempty"`
+	VARating       int64    `json:"va_rating,omitempty"`
+	WattRating     int64    `json:"watt_rating,omitempty"`
+	RuntimeMinutes int64    `json:"runtime_minutes,omitempty"`
+	RadioBands     []string `json:"radio_bands,omitempty"`
+}
+
+// AssetList is the response body of the asset list endpoints.
+type AssetList struct {
+	Assets []Asset `json:"assets"`
+}
+
+// AssetField is an integer field of Asset that applies to one asset type.
+type AssetField struct {
+	// Name is the JSON and Terraform attribute name.
+	Name        string
+	Description string
+	// Required fields must be set; the others default to zero.
+	Required bool
+	Value    func(*Asset) *int64
+}
+
+// AssetType describes an asset type: its singular name, the collection
+// served at /api/v1/{Path}, and the type-specific fields it uses.
+type AssetType struct {
+	Name       string
+	Path       string
+	Fields     []AssetField
+	RadioBands bool
+}
+
+// The asset types served by lab_gear.
+var (
+	SwitchType = AssetType{
+		Name: "switch",
+		Path: "switches",
+		Fields: []AssetField{
+			{Name: "port_count", Description: "Number of ports.", Required: true, Value: func(a *Asset) *int64 { return &a.PortCount }},
+		},
+	}
+	UPSType = AssetType{
+		Name: "ups",
+		Path: "ups",
+		Fields: []AssetField{
+			{Name: "va_rating", Description: "Capacity in volt-amperes.", Required: true, Value: func(a *Asset) *int64 { return &a.VARating }},
+			{Name: "watt_rating", Description: "Capacity in watts. When unset, 60% of va_rating is assumed.", Value: func(a *Asset) *int64 { return &a.WattRating }},
+			{Name: "runtime_minutes", Description: "Battery runtime at full load, in minutes.", Value: func(a *Asset) *int64 { return &a.RuntimeMinutes }},
+		},
+	}
+	AccessPointType = AssetType{
+		Name:       "accesspoint",
+		Path:       "accesspoints",
+		RadioBands: true,
+	}
+)
+
+// CreateAsset POSTs a new asset of type t and returns the server-assigned
+// record.
+func (c *Client) CreateAsset(ctx context.Context, t AssetType, a Asset) (*Asset, error) {
+	resp, err := c.doRequest(ctx, http.MethodPost, "/api/v1/"+t.Path, a)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("create %s: unexpected status %d", t.Name, resp.StatusCode)
+	}
+	var out Asset
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
+}
+
+// GetAsset fetches a single asset of type t by ID. Returns nil, nil when the
+// server responds 404.
+func (c *Client) GetAsset(ctx context.Context, t AssetType, id string) (*Asset, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/"+t.Path+"/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s %q: unexpected status %d", t.Name, id, resp.StatusCode)
+	}
+	var out Asset
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
+}
+
+// ListAssets fetches every asset of type t.
+func (c *Client) ListAssets(ctx context.Context, t AssetType) ([]Asset, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/"+t.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list %s: unexpected status %d", t.Path, resp.StatusCode)
+	}
+	var out AssetList
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Assets, nil
+}
+
+// UpdateAsset PUTs a full replacement for the asset of type t with a.ID.
+func (c *Client) UpdateAsset(ctx context.Context, t AssetType, a Asset) (*Asset, error) {
+	resp, err := c.doRequest(ctx, http.MethodPut, "/api/v1/"+t.Path+"/"+a.ID, a)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("update %s %q: not found", t.Name, a.ID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("update %s %q: unexpected status %d", t.Name, a.ID, resp.StatusCode)
+	}
+	var out Asset
+	return &out, json.NewDecoder(resp.Body).Decode(&out)
+}
+
+// DeleteAsset removes the asset of type t with the given ID.
+func (c *Client) DeleteAsset(ctx context.Context, t AssetType, id string) error {
+	resp, err := c.doRequest(ctx, http.MethodDelete, "/api/v1/"+t.Path+"/"+id, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return fmt.Errorf("delete %s %q: unexpected status %d", t.Name, id, resp.StatusCode)
+}
+
+// Resources is an amount of hypervisor capacity in the capacity report.
+type Resources struct {
+	CPUCores  int64   `json:"cpu_cores"`
+	RAMGB     int64   `json:"ram_gb"`
+	StorageTB float64 `json:"storage_tb"`
+}
+
+// CapacityTotals sums the capacity of a set of hosts. Available is negative
+// where hosts are overcommitted.
+type CapacityTotals struct {
+	Hosts     int64     `json:"hosts"`
+	Total     Resources `json:"total"`
+	Reserved  Resources `json:"reserved"`
+	Available Resources `json:"available"`
+}
+
+// HostCapacity is the capacity of one hypervisor host.
+type HostCapacity struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	LocationID string    `json:"location_id,omitempty"`
+	Total      Resources `json:"total"`
+	Reserved   Resources `json:"reserved"`
+	Available  Resources `json:"available"`
+}
+
+// LocationCapacity is the capacity of the hosts in one location; LocationID
+// is empty for hosts without one.
+type LocationCapacity struct {
+	LocationID string `json:"location_id"`
+	Name       string `json:"name"`
+	CapacityTotals
+}
+
+// CapacityReport mirrors the response of GET /api/v1/reports/capacity.
+type CapacityReport struct {
+	Kind      string             `json:"kind"`
+	Hosts     []HostCapacity     `json:"hosts"`
+	Locations []LocationCapacity `json:"locations"`
+	Overall   CapacityTotals     `json:"overall"`
+}
+
+// GetCapacityReport fetches the capacity of the active hypervisor hosts.
+func (c *Client) GetCapacityReport(ctx context.Context) (*CapacityReport, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/api/v1/reports/capacity", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get capacity report: unexpected status %d", resp.StatusCode)
+	}
+	var out CapacityReport
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -3,9 +3,11 @@ package apiclient_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
 )
@@ -172,6 +174,38 @@ func TestClient_UpdateMachine_NotFound(t *testing.T) {
 	}
 }
 
+func TestClient_UpdateMachine_IfMatch(t *testing.T) {
+	tests := []struct {
+		revision int64
+		want     string
+	}{
+		{0, ""},
+		{7, `"7"`},
+	}
+	for _, tc := range tests {
+		_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("If-Match"); got != tc.want {
+				t.Errorf("revision %d: If-Match: got %q, want %q", tc.revision, got, tc.want)
+			}
+			writeMachine(w, http.StatusOK, apiclient.Machine{ID: "uuid-4"})
+		})
+		if _, err := client.UpdateMachine(context.Background(), apiclient.Machine{ID: "uuid-4", Revision: tc.revision}); err != nil {
+			t.Fatalf("UpdateMachine: %v", err)
+		}
+	}
+}
+
+func TestClient_UpdateMachine_PreconditionFailed(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+	})
+
+	_, err := client.UpdateMachine(context.Background(), apiclient.Machine{ID: "some-id", Revision: 3})
+	if !errors.Is(err, apiclient.ErrModified) {
+		t.Fatalf("expected ErrModified on 412, got %v", err)
+	}
+}
+
 func TestClient_UpdateMachine_ServerError(t *testing.T) {
 	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -258,7 +292,7 @@ func TestClient_ListMachines_All(t *testing.T) {
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(machines)
+		json.NewEncoder(w).Encode(apiclient.MachineList{Machines: machines})
 	})
 
 	got, err := client.ListMachines(context.Background(), "")
@@ -280,9 +314,9 @@ func TestClient_ListMachines_WithKindFilter(t *testing.T) {
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]apiclient.Machine{
+		json.NewEncoder(w).Encode(apiclient.MachineList{Machines: []apiclient.Machine{
 			{ID: "uuid-1", Name: "pve1", Kind: "proxmox", Make: "Dell", Model: "R640"},
-		})
+		}})
 	})
 
 	got, err := client.ListMachines(context.Background(), "proxmox")
@@ -301,7 +335,7 @@ func TestClient_ListMachines_Empty(t *testing.T) {
 	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]apiclient.Machine{})
+		json.NewEncoder(w).Encode(apiclient.MachineList{Machines: []apiclient.Machine{}})
 	})
 
 	got, err := client.ListMachines(context.Background(), "")
@@ -313,6 +347,44 @@ func TestClient_ListMachines_Empty(t *testing.T) {
 	}
 }
 
+func TestClient_ListMachines_FollowsCursor(t *testing.T) {
+	var cursors []string
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		if got := r.URL.Query().Get("kind"); got != "proxmox" {
+			t.Errorf("kind: got %q on page %d, want proxmox", got, len(cursors))
+		}
+		page := apiclient.MachineList{}
+		switch cursor {
+		case "":
+			page.Machines = []apiclient.Machine{{ID: "uuid-1", Name: "pve1", Kind: "proxmox"}}
+			page.NextCursor = "page-2"
+		case "page-2":
+			page.Machines = []apiclient.Machine{{ID: "uuid-2", Name: "pve2", Kind: "proxmox"}}
+		default:
+			t.Errorf("unexpected cursor %q", cursor)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(page)
+	})
+
+	got, err := client.ListMachines(context.Background(), "proxmox")
+	if err != nil {
+		t.Fatalf("ListMachines: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("len: got %d, want 2", len(got))
+	}
+	if got[1].Name != "pve2" {
+		t.Errorf("machines[1].Name: got %q, want pve2", got[1].Name)
+	}
+	if len(cursors) != 2 {
+		t.Errorf("requests: got %d, want 2", len(cursors))
+	}
+}
+
 func TestClient_ListMachines_ServerError(t *testing.T) {
 	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -326,6 +398,51 @@ func TestClient_ListMachines_ServerError(t *testing.T) {
 
 // --- Content-Type ---
 
+func TestClient_RetriesTooManyRequests(t *testing.T) {
+	calls := 0
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var got apiclient.Machine
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil || got.Name != "pve1" {
+			t.Errorf("attempt %d: body not resent: %+v, %v", calls, got, err)
+		}
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		writeMachine(w, http.StatusCreated, apiclient.Machine{ID: "uuid-1", Name: "pve1"})
+	})
+
+	start := time.Now()
+	m, err := client.CreateMachine(context.Background(), apiclient.Machine{Name: "pve1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.ID != "uuid-1" || calls != 2 {
+		t.Errorf("got %+v after %d calls, want uuid-1 after 2", m, calls)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the 1s Retry-After", elapsed)
+	}
+}
+
+func TestClient_DoesNotWaitOutLongRetryAfter(t *testing.T) {
+	calls := 0
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "900")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	if _, err := client.GetMachine(context.Background(), "uuid-1"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if calls != 1 {
+		t.Errorf("calls: got %d, want 1", calls)
+	}
+}
+
 func TestClient_SetsContentTypeOnWrite(t *testing.T) {
 	var gotCT string
 	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
@@ -338,3 +455,163 @@ func TestClient_SetsContentTypeOnWrite(t *testing.T) {
 		t.Errorf("Content-Type: got %q, want application/json", gotCT)
 	}
 }
+
+// --- Locations ---
+
+func TestClient_CreateLocation_Success(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/locations" {
+			t.Errorf("request: got %s %s, want POST /api/v1/locations", r.Method, r.URL.Path)
+		}
+		var body apiclient.Location
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request body: %v", err)
+		}
+		if body.Kind != "rack" || body.ParentID != "uuid-room" || body.HeightU != 42 {
+			t.Errorf("body: got %+v", body)
+		}
+		body.ID = "uuid-rack"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(body)
+	})
+
+	got, err := client.CreateLocation(context.Background(), apiclient.Location{Name: "rack1", Kind: "rack", ParentID: "uuid-room", HeightU: 42})
+	if err != nil {
+		t.Fatalf("CreateLocation: %v", err)
+	}
+	if got.ID != "uuid-rack" {
+		t.Errorf("ID: got %q, want uuid-rack", got.ID)
+	}
+}
+
+func TestClient_GetLocation_NotFound(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	got, err := client.GetLocation(context.Background(), "missing")
+	if err != nil || got != nil {
+		t.Errorf("GetLocation: got %v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestClient_UpdateLocation_Conflict(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/api/v1/locations/uuid-rack" {
+			t.Errorf("request: got %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusConflict)
+	})
+
+	if _, err := client.UpdateLocation(context.Background(), apiclient.Location{ID: "uuid-rack", Name: "rack1", Kind: "rack", HeightU: 4}); err == nil {
+		t.Error("expected error on 409, got nil")
+	}
+}
+
+func TestClient_DeleteLocation_InUse(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+
+	if err := client.DeleteLocation(context.Background(), "uuid-site"); err == nil {
+		t.Error("expected error on 409, got nil")
+	}
+}
+
+// --- Assets ---
+
+func TestClient_CreateAsset_UsesTypePath(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/ups" {
+			t.Errorf("request: got %s %s, want POST /api/v1/ups", r.Method, r.URL.Path)
+		}
+		var body apiclient.Asset
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request body: %v", err)
+		}
+		if body.VARating != 1500 || body.PortCount != 0 {
+			t.Errorf("body: got %+v", body)
+		}
+		body.ID, body.Type = "uuid-ups", "ups"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(body)
+	})
+
+	got, err := client.CreateAsset(context.Background(), apiclient.UPSType, apiclient.Asset{Name: "rack ups", Make: "APC", Model: "SMT1500", VARating: 1500})
+	if err != nil {
+		t.Fatalf("CreateAsset: %v", err)
+	}
+	if got.ID != "uuid-ups" || got.Type != "ups" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestClient_ListAssets(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/accesspoints" {
+			t.Errorf("path: got %s, want /api/v1/accesspoints", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(apiclient.AssetList{Assets: []apiclient.Asset{
+			{ID: "a1", Name: "hallway", RadioBands: []string{"2.4ghz", "5ghz"}},
+		}})
+	})
+
+	got, err := client.ListAssets(context.Background(), apiclient.AccessPointType)
+	if err != nil {
+		t.Fatalf("ListAssets: %v", err)
+	}
+	if len(got) != 1 || len(got[0].RadioBands) != 2 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestClient_GetAsset_NotFound(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	got, err := client.GetAsset(context.Background(), apiclient.SwitchType, "missing")
+	if err != nil || got != nil {
+		t.Errorf("GetAsset: got %v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestClient_GetCapacityReport(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/reports/capacity" {
+			t.Errorf("path: got %s, want /api/v1/reports/capacity", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind":"proxmox","hosts":[],"locations":[{"location_id":"loc-1","name":"garage","hosts":2,
+			"total":{"cpu_cores":32,"ram_gb":128,"storage_tb":4},"reserved":{"cpu_cores":8,"ram_gb":32,"storage_tb":1.5},
+			"available":{"cpu_cores":24,"ram_gb":96,"storage_tb":2.5}}],"overall":{"hosts":2}}`))
+	})
+
+	got, err := client.GetCapacityReport(context.Background())
+	if err != nil {
+		t.Fatalf("GetCapacityReport: %v", err)
+	}
+	if len(got.Locations) != 1 {
+		t.Fatalf("locations: got %+v", got.Locations)
+	}
+	if l := got.Locations[0]; l.Hosts != 2 || l.Available.CPUCores != 24 || l.Reserved.StorageTB != 1.5 {
+		t.Errorf("locations[0]: got %+v", l)
+	}
+}
+
+func TestClient_GetGuest_NotFound(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/guests/missing" {
+			t.Errorf("path: got %s, want /api/v1/guests/missing", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	got, err := client.GetGuest(context.Background(), "missing")
+	if err != nil || got != nil {
+		t.Errorf("GetGuest: got %v, %v; want nil, nil", got, err)
+	}
+}
@@ -0,0 +1,152 @@
+package datasources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+)
+
+// Ensure full interface compliance at compile time.
+var _ datasource.DataSource = &assetsDataSource{}
+var _ datasource.DataSourceWithConfigure = &assetsDataSource{}
+
+// assetsDataSource lists every asset of one type. Its name, lab_gear_{list},
+// is also the name of the list attribute.
+type assetsDataSource struct {
+	client    *apiclient.Client
+	assetType apiclient.AssetType
+	list      string
+}
+
+// NewSwitchesDataSource is the factory function for lab_gear_switches.
+func NewSwitchesDataSource() datasource.DataSource {
+	return &assetsDataSource{assetType: apiclient.SwitchType, list: "switches"}
+}
+
+// NewUPSUnitsDataSource is the factory function for lab_gear_ups_units.
+func NewUPSUnitsDataSource() datasource.DataSource {
+	return &assetsDataSource{assetType: apiclient.UPSType, list: "ups_units"}
+}
+
+// NewAccessPointsDataSource is the factory function for lab_gear_accesspoints.
+func NewAccessPointsDataSource() datasource.DataSource {
+	return &assetsDataSource{assetType: apiclient.AccessPointType, list: "accesspoints"}
+}
+
+func (d *assetsDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_" + d.list // → e.g. "lab_gear_switches"
+}
+
+func (d *assetsDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	attrs := map[string]schema.Attribute{
+		"id":          schema.StringAttribute{Computed: true, Description: "Server-generated UUID."},
+		"name":        schema.StringAttribute{Computed: true, Description: "Handle for the " + d.assetType.Name + "."},
+		"make":        schema.StringAttribute{Computed: true, Description: "Manufacturer."},
+		"model":       schema.StringAttribute{Computed: true, Description: "Model name or number."},
+		"serial":      schema.StringAttribute{Computed: true, Description: "Serial number."},
+		"location_id": schema.StringAttribute{Computed: true, Description: "ID of the site, room, or rack holding it, or null."},
+		"notes":       schema.StringAttribute{Computed: true, Description: "Free-form notes."},
+	}
+	for _, f := range d.assetType.Fields {
+		attrs[f.Name] = schema.Int64Attribute{Computed: true, Description: f.Description}
+	}
+	if d.assetType.RadioBands {
+		attrs["radio_bands"] = schema.SetAttribute{
+			Computed:    true,
+			ElementType: types.StringType,
+			Description: "Bands it broadcasts on.",
+		}
+	}
+	resp.Schema = schema.Schema{
+		Description: fmt.Sprintf("Lists every %s in the lab_gear inventory.", d.assetType.Name),
+		Attributes: map[string]schema.Attribute{
+			d.list: schema.ListNestedAttribute{
+				Description:  fmt.Sprintf("List of %s returned by the API, ordered by name.", d.assetType.Path),
+				Computed:     true,
+				NestedObject: schema.NestedAttributeObject{Attributes: attrs},
+			},
+		},
+	}
+}
+
+func (d *assetsDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	client, ok := req.ProviderData.(*apiclient.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected provider data type",
+			fmt.Sprintf("Expected *apiclient.Client, got %T", req.ProviderData),
+		)
+		return
+	}
+	d.client = client
+}
+
+func (d *assetsDataSource) Read(ctx context.Context, _ datasource.ReadRequest, resp *datasource.ReadResponse) {
+	assets, err := d.client.ListAssets(ctx, d.assetType)
+	if err != nil {
+		resp.Diagnostics.AddError("Error listing lab_gear "+d.assetType.Path, err.Error())
+		return
+	}
+
+	objType := types.ObjectType{AttrTypes: d.attrTypes()}
+	items := make([]attr.Value, len(assets))
+	for i := range assets {
+		items[i] = d.assetToObject(&assets[i])
+	}
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root(d.list), types.ListValueMust(objType, items))...)
+}
+
+// attrTypes returns the attribute types of one listed asset.
+func (d *assetsDataSource) attrTypes() map[string]attr.Type {
+	t := map[string]attr.Type{
+		"id":          types.StringType,
+		"name":        types.StringType,
+		"make":        types.StringType,
+		"model":       types.StringType,
+		"serial":      types.StringType,
+		"location_id": types.StringType,
+		"notes":       types.StringType,
+	}
+	for _, f := range d.assetType.Fields {
+		t[f.Name] = types.Int64Type
+	}
+	if d.assetType.RadioBands {
+		t["radio_bands"] = types.SetType{ElemType: types.StringType}
+	}
+	return t
+}
+
+func (d *assetsDataSource) assetToObject(a *apiclient.Asset) types.Object {
+	attrs := map[string]attr.Value{
+		"id":          types.StringValue(a.ID),
+		"name":        types.StringValue(a.Name),
+		"make":        types.StringValue(a.Make),
+		"model":       types.StringValue(a.Model),
+		"serial":      types.StringValue(a.Serial),
+		"location_id": types.StringNull(),
+		"notes":       types.StringValue(a.Notes),
+	}
+	if a.LocationID != "" {
+		attrs["location_id"] = types.StringValue(a.LocationID)
+	}
+	for _, f := range d.assetType.Fields {
+		attrs[f.Name] = types.Int64Value(*f.Value(a))
+	}
+	if d.assetType.RadioBands {
+		bands := make([]attr.Value, len(a.RadioBands))
+		for i, b := range a.RadioBands {
+			bands[i] = types.StringValue(b)
+		}
+		attrs["radio_bands"] = types.SetValueMust(types.StringType, bands)
+	}
+	return types.ObjectValueMust(d.attrTypes(), attrs)
+}
@@ -0,0 +1,108 @@
+package datasources_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/datasources"
+)
+
+// testAccessPointsModel mirrors the lab_gear_accesspoints state.
+type testAccessPointsModel struct {
+	AccessPoints []testAccessPointItem `tfsdk:"accesspoints"`
+}
+
+type testAccessPointItem struct {
+	ID         types.String `tfsdk:"id"`
+	Name       types.String `tfsdk:"name"`
+	Make       types.String `tfsdk:"make"`
+	Model      types.String `tfsdk:"model"`
+	Serial     types.String `tfsdk:"serial"`
+	LocationID types.String `tfsdk:"location_id"`
+	Notes      types.String `tfsdk:"notes"`
+	RadioBands []string     `tfsdk:"radio_bands"`
+}
+
+func TestAssetsDataSource_Metadata(t *testing.T) {
+	for want, d := range map[string]datasource.DataSource{
+		"lab_gear_switches":     datasources.NewSwitchesDataSource(),
+		"lab_gear_ups_units":    datasources.NewUPSUnitsDataSource(),
+		"lab_gear_accesspoints": datasources.NewAccessPointsDataSource(),
+	} {
+		var resp datasource.MetadataResponse
+		d.Metadata(context.Background(), datasource.MetadataRequest{ProviderTypeName: "lab_gear"}, &resp)
+		if resp.TypeName != want {
+			t.Errorf("TypeName: got %q, want %q", resp.TypeName, want)
+		}
+	}
+}
+
+func TestAssetsDataSource_Schema_TypedFields(t *testing.T) {
+	schm := getDataSourceSchema(t, datasources.NewUPSUnitsDataSource())
+	tfType := schm.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+	list, ok := tfType.AttributeTypes["ups_units"].(tftypes.List)
+	if !ok {
+		t.Fatal("schema missing 'ups_units' list")
+	}
+	attrs := list.ElementType.(tftypes.Object).AttributeTypes
+	for _, name := range []string{"va_rating", "watt_rating", "runtime_minutes"} {
+		if _, ok := attrs[name]; !ok {
+			t.Errorf("ups_units missing %q", name)
+		}
+	}
+	for _, name := range []string{"port_count", "radio_bands"} {
+		if _, ok := attrs[name]; ok {
+			t.Errorf("ups_units should not have %q", name)
+		}
+	}
+}
+
+func TestAssetsDataSource_Read_ReturnsList(t *testing.T) {
+	ctx := context.Background()
+	d := datasources.NewAccessPointsDataSource()
+	schm := getDataSourceSchema(t, d)
+
+	client := newMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/v1/accesspoints" {
+			t.Errorf("request: got %s %s, want GET /api/v1/accesspoints", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(apiclient.AssetList{Assets: []apiclient.Asset{
+			{ID: "uuid-1", Type: "accesspoint", Name: "hallway", Make: "Ubiquiti", Model: "U6 Pro", LocationID: "uuid-room", RadioBands: []string{"2.4ghz", "5ghz"}},
+			{ID: "uuid-2", Type: "accesspoint", Name: "garage", Make: "Ubiquiti", Model: "U6 Lite", RadioBands: []string{"5ghz"}},
+		}})
+	})
+	configureDataSource(t, d, client)
+
+	tfType := schm.Schema.Type().TerraformType(ctx)
+	config := tfsdk.Config{Schema: schm.Schema, Raw: tftypes.NewValue(tfType, map[string]tftypes.Value{
+		"accesspoints": tftypes.NewValue(tfType.(tftypes.Object).AttributeTypes["accesspoints"], nil),
+	})}
+	resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schm.Schema, Raw: tftypes.NewValue(tfType, nil)}}
+	d.Read(ctx, datasource.ReadRequest{Config: config}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read: unexpected error: %v", resp.Diagnostics)
+	}
+
+	var state testAccessPointsModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Read: state.Get: %v", diags)
+	}
+	if len(state.AccessPoints) != 2 {
+		t.Fatalf("accesspoints count: got %d, want 2", len(state.AccessPoints))
+	}
+	first, second := state.AccessPoints[0], state.AccessPoints[1]
+	if first.Name.ValueString() != "hallway" || first.LocationID.ValueString() != "uuid-room" || len(first.RadioBands) != 2 {
+		t.Errorf("accesspoints[0]: got %+v", first)
+	}
+	if !second.LocationID.IsNull() {
+		t.Errorf("accesspoints[1].LocationID: got %v, want null", second.LocationID)
+	}
+}
@@ -0,0 +1,193 @@
+package datasources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+)
+
+// Ensure full interface compliance at compile time.
+var _ datasource.DataSource = &capacityDataSource{}
+var _ datasource.DataSourceWithConfigure = &capacityDataSource{}
+
+// capacityDataSource reads the capacity report, so that modules can check a
+// host's headroom before placing a guest on it.
+type capacityDataSource struct {
+	client *apiclient.Client
+}
+
+// NewCapacityDataSource is the factory function for lab_gear_capacity.
+func NewCapacityDataSource() datasource.DataSource {
+	return &capacityDataSource{}
+}
+
+type capacityDataSourceModel struct {
+	Kind      types.String            `tfsdk:"kind"`
+	Hosts     []hostCapacityModel     `tfsdk:"hosts"`
+	Locations []locationCapacityModel `tfsdk:"locations"`
+	Overall   capacityTotalsModel     `tfsdk:"overall"`
+}
+
+type resourcesModel struct {
+	CPUCores  types.Int64   `tfsdk:"cpu_cores"`
+	RAMGB     types.Int64   `tfsdk:"ram_gb"`
+	StorageTB types.Float64 `tfsdk:"storage_tb"`
+}
+
+type hostCapacityModel struct {
+	ID         types.String   `tfsdk:"id"`
+	Name       types.String   `tfsdk:"name"`
+	LocationID types.String   `tfsdk:"location_id"`
+	Total      resourcesModel `tfsdk:"total"`
+	Reserved   resourcesModel `tfsdk:"reserved"`
+	Available  resourcesModel `tfsdk:"available"`
+}
+
+type locationCapacityModel struct {
+	LocationID types.String   `tfsdk:"location_id"`
+	Name       types.String   `tfsdk:"name"`
+	Hosts      types.Int64    `tfsdk:"hosts"`
+	Total      resourcesModel `tfsdk:"total"`
+	Reserved   resourcesModel `tfsdk:"reserved"`
+	Available  resourcesModel `tfsdk:"available"`
+}
+
+type capacityTotalsModel struct {
+	Hosts     types.Int64    `tfsdk:"hosts"`
+	Total     resourcesModel `tfsdk:"total"`
+	Reserved  resourcesModel `tfsdk:"reserved"`
+	Available resourcesModel `tfsdk:"available"`
+}
+
+func (d *capacityDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_capacity" // → "lab_gear_capacity"
+}
+
+// resourcesAttributes returns the total, reserved, and available attributes
+// shared by hosts, locations, and the overall totals.
+func resourcesAttributes(attrs map[string]schema.Attribute) map[string]schema.Attribute {
+	for name, desc := range map[string]string{
+		"total":     "Capacity recorded on the hosts.",
+		"reserved":  "Capacity already spoken for.",
+		"available": "Total less reserved; negative where overcommitted.",
+	} {
+		attrs[name] = schema.SingleNestedAttribute{
+			Computed:    true,
+			Description: desc,
+			Attributes: map[string]schema.Attribute{
+				"cpu_cores":  schema.Int64Attribute{Computed: true, Description: "CPU cores."},
+				"ram_gb":     schema.Int64Attribute{Computed: true, Description: "RAM in gigabytes."},
+				"storage_tb": schema.Float64Attribute{Computed: true, Description: "Storage in terabytes."},
+			},
+		}
+	}
+	return attrs
+}
+
+func (d *capacityDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Reports the CPU cores, RAM, and storage of the active hypervisor hosts in the lab_gear inventory, and the headroom left after what each host has reserved.",
+		Attributes: map[string]schema.Attribute{
+			"kind": schema.StringAttribute{
+				Computed:    true,
+				Description: "Machine kind counted as a hypervisor host.",
+			},
+			"hosts": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "Each host, ordered by name.",
+				NestedObject: schema.NestedAttributeObject{Attributes: resourcesAttributes(map[string]schema.Attribute{
+					"id":          schema.StringAttribute{Computed: true, Description: "Machine ID."},
+					"name":        schema.StringAttribute{Computed: true, Description: "Machine name."},
+					"location_id": schema.StringAttribute{Computed: true, Description: "ID of the location the host is in; null if none."},
+				})},
+			},
+			"locations": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "Totals per location, ordered by location name.",
+				NestedObject: schema.NestedAttributeObject{Attributes: resourcesAttributes(map[string]schema.Attribute{
+					"location_id": schema.StringAttribute{Computed: true, Description: "Location ID; empty for hosts without a location."},
+					"name":        schema.StringAttribute{Computed: true, Description: "Location name."},
+					"hosts":       schema.Int64Attribute{Computed: true, Description: "Number of hosts."},
+				})},
+			},
+			"overall": schema.SingleNestedAttribute{
+				Computed:    true,
+				Description: "Totals over every host.",
+				Attributes: resourcesAttributes(map[string]schema.Attribute{
+					"hosts": schema.Int64Attribute{Computed: true, Description: "Number of hosts."},
+				}),
+			},
+		},
+	}
+}
+
+func (d *capacityDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	client, ok := req.ProviderData.(*apiclient.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected provider data type",
+			fmt.Sprintf("Expected *apiclient.Client, got %T", req.ProviderData),
+		)
+		return
+	}
+	d.client = client
+}
+
+func (d *capacityDataSource) Read(ctx context.Context, _ datasource.ReadRequest, resp *datasource.ReadResponse) {
+	report, err := d.client.GetCapacityReport(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError("Error reading lab_gear capacity report", err.Error())
+		return
+	}
+
+	state := capacityDataSourceModel{
+		Kind:      types.StringValue(report.Kind),
+		Hosts:     make([]hostCapacityModel, len(report.Hosts)),
+		Locations: make([]locationCapacityModel, len(report.Locations)),
+		Overall: capacityTotalsModel{
+			Hosts:     types.Int64Value(report.Overall.Hosts),
+			Total:     resourcesValue(report.Overall.Total),
+			Reserved:  resourcesValue(report.Overall.Reserved),
+			Available: resourcesValue(report.Overall.Available),
+		},
+	}
+	for i, h := range report.Hosts {
+		state.Hosts[i] = hostCapacityModel{
+			ID:         types.StringValue(h.ID),
+			Name:       types.StringValue(h.Name),
+			LocationID: types.StringNull(),
+			Total:      resourcesValue(h.Total),
+			Reserved:   resourcesValue(h.Reserved),
+			Available:  resourcesValue(h.Available),
+		}
+		if h.LocationID != "" {
+			state.Hosts[i].LocationID = types.StringValue(h.LocationID)
+		}
+	}
+	for i, l := range report.Locations {
+		state.Locations[i] = locationCapacityModel{
+			LocationID: types.StringValue(l.LocationID),
+			Name:       types.StringValue(l.Name),
+			Hosts:      types.Int64Value(l.Hosts),
+			Total:      resourcesValue(l.Total),
+			Reserved:   resourcesValue(l.Reserved),
+			Available:  resourcesValue(l.Available),
+		}
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func resourcesValue(r apiclient.Resources) resourcesModel {
+	return resourcesModel{
+		CPUCores:  types.Int64Value(r.CPUCores),
+		RAMGB:     types.Int64Value(r.RAMGB),
+		StorageTB: types.Float64Value(r.StorageTB),
+	}
+}
@@ -0,0 +1,90 @@
+package datasources_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/datasources"
+)
+
+// testCapacityModel mirrors the lab_gear_capacity state, leaving out the
+// per-location totals.
+type testCapacityModel struct {
+	Kind      types.String `tfsdk:"kind"`
+	Hosts     types.List   `tfsdk:"hosts"`
+	Locations types.List   `tfsdk:"locations"`
+	Overall   struct {
+		Hosts     types.Int64       `tfsdk:"hosts"`
+		Total     testResourcesItem `tfsdk:"total"`
+		Reserved  testResourcesItem `tfsdk:"reserved"`
+		Available testResourcesItem `tfsdk:"available"`
+	} `tfsdk:"overall"`
+}
+
+type testResourcesItem struct {
+	CPUCores  types.Int64   `tfsdk:"cpu_cores"`
+	RAMGB     types.Int64   `tfsdk:"ram_gb"`
+	StorageTB types.Float64 `tfsdk:"storage_tb"`
+}
+
+func TestCapacityDataSource_Metadata(t *testing.T) {
+	var resp datasource.MetadataResponse
+	datasources.NewCapacityDataSource().Metadata(context.Background(), datasource.MetadataRequest{ProviderTypeName: "lab_gear"}, &resp)
+	if resp.TypeName != "lab_gear_capacity" {
+		t.Errorf("TypeName: got %q, want lab_gear_capacity", resp.TypeName)
+	}
+}
+
+func TestCapacityDataSource_Read(t *testing.T) {
+	ctx := context.Background()
+	d := datasources.NewCapacityDataSource()
+	schm := getDataSourceSchema(t, d)
+
+	client := newMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/v1/reports/capacity" {
+			t.Errorf("request: got %s %s, want GET /api/v1/reports/capacity", r.Method, r.URL.Path)
+		}
+		host := apiclient.HostCapacity{
+			ID: "uuid-1", Name: "pve1",
+			Total:     apiclient.Resources{CPUCores: 16, RAMGB: 64, StorageTB: 2},
+			Reserved:  apiclient.Resources{CPUCores: 20, RAMGB: 16, StorageTB: 0.5},
+			Available: apiclient.Resources{CPUCores: -4, RAMGB: 48, StorageTB: 1.5},
+		}
+		totals := apiclient.CapacityTotals{Hosts: 1, Total: host.Total, Reserved: host.Reserved, Available: host.Available}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(apiclient.CapacityReport{
+			Kind:      "proxmox",
+			Hosts:     []apiclient.HostCapacity{host},
+			Locations: []apiclient.LocationCapacity{{Name: "", CapacityTotals: totals}},
+			Overall:   totals,
+		})
+	})
+	configureDataSource(t, d, client)
+
+	tfType := schm.Schema.Type().TerraformType(ctx)
+	config := tfsdk.Config{Schema: schm.Schema, Raw: tftypes.NewValue(tfType, nil)}
+	resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schm.Schema, Raw: tftypes.NewValue(tfType, nil)}}
+	d.Read(ctx, datasource.ReadRequest{Config: config}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read: unexpected error: %v", resp.Diagnostics)
+	}
+
+	var state testCapacityModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Read: state.Get: %v", diags)
+	}
+	if state.Kind.ValueString() != "proxmox" || len(state.Hosts.Elements()) != 1 || len(state.Locations.Elements()) != 1 {
+		t.Errorf("state: got %+v", state)
+	}
+	o := state.Overall
+	if o.Hosts.ValueInt64() != 1 || o.Available.CPUCores.ValueInt64() != -4 || o.Available.StorageTB.ValueFloat64() != 1.5 {
+		t.Errorf("overall: got %+v", o)
+	}
+}
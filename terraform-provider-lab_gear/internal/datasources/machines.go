@@ -29,17 +29,41 @@ type machinesDataSourceModel struct {
 }
 
 type machineDataModel struct {
-	ID        types.String  `tfsdk:"id"`
-	Name      types.String  `tfsdk:"name"`
-	Kind      types.String  `tfsdk:"kind"`
-	Make      types.String  `tfsdk:"make"`
-	Model     types.String  `tfsdk:"model"`
-	CPU       types.String  `tfsdk:"cpu"`
-	RAMGB     types.Int64   `tfsdk:"ram_gb"`
-	StorageTB types.Float64 `tfsdk:"storage_tb"`
-	Location  types.String  `tfsdk:"location"`
-	Serial    types.String  `tfsdk:"serial"`
-	Notes     types.String  `tfsdk:"notes"`
+	ID                types.String      `tfsdk:"id"`
+	Name              types.String      `tfsdk:"name"`
+	Kind              types.String      `tfsdk:"kind"`
+	Make              types.String      `tfsdk:"make"`
+	Model             types.String      `tfsdk:"model"`
+	CPU               types.String      `tfsdk:"cpu"`
+	CPUCores          types.Int64       `tfsdk:"cpu_cores"`
+	RAMGB             types.Int64       `tfsdk:"ram_gb"`
+	StorageTB         types.Float64     `tfsdk:"storage_tb"`
+	Location          types.String      `tfsdk:"location"`
+	Serial            types.String      `tfsdk:"serial"`
+	Notes             types.String      `tfsdk:"notes"`
+	Tags              []string          `tfsdk:"tags"`
+	Labels            map[string]string `tfsdk:"labels"`
+	ParentID          types.String      `tfsdk:"parent_id"`
+	LocationID        types.String      `tfsdk:"location_id"`
+	RackU             types.Int64       `tfsdk:"rack_u"`
+	UHeight           types.Int64       `tfsdk:"u_height"`
+	DeriveCapacity    types.Bool        `tfsdk:"derive_capacity"`
+	PurchaseDate      types.String      `tfsdk:"purchase_date"`
+	Vendor            types.String      `tfsdk:"vendor"`
+	Price             types.Float64     `tfsdk:"price"`
+	Currency          types.String      `tfsdk:"currency"`
+	WarrantyEnd       types.String      `tfsdk:"warranty_end"`
+	LifetimeYears     types.Int64       `tfsdk:"lifetime_years"`
+	RatedWatts        types.Int64       `tfsdk:"rated_watts"`
+	IdleWatts         types.Int64       `tfsdk:"idle_watts"`
+	PeakWatts         types.Int64       `tfsdk:"peak_watts"`
+	UPSID             types.String      `tfsdk:"ups_id"`
+	Circuit           types.String      `tfsdk:"circuit"`
+	ReservedCores     types.Int64       `tfsdk:"reserved_cores"`
+	ReservedRAMGB     types.Int64       `tfsdk:"reserved_ram_gb"`
+	ReservedStorageTB types.Float64     `tfsdk:"reserved_storage_tb"`
+	Status            types.String      `tfsdk:"status"`
+	StatusChangedAt   types.String      `tfsdk:"status_changed_at"`
 }
 
 func (d *machinesDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
@@ -59,17 +83,41 @@ func (d *machinesDataSource) Schema(_ context.Context, _ datasource.SchemaReques
 				Computed:    true,
 				NestedObject: schema.NestedAttributeObject{
 					Attributes: map[string]schema.Attribute{
-						"id":         schema.StringAttribute{Computed: true, Description: "Server-generated UUID."},
-						"name":       schema.StringAttribute{Computed: true, Description: "Handle for the machine."},
-						"kind":       schema.StringAttribute{Computed: true, Description: "Machine type."},
-						"make":       schema.StringAttribute{Computed: true, Description: "Manufacturer."},
-						"model":      schema.StringAttribute{Computed: true, Description: "Model name or number."},
-						"cpu":        schema.StringAttribute{Computed: true, Description: "CPU model."},
-						"ram_gb":     schema.Int64Attribute{Computed: true, Description: "RAM in gigabytes."},
-						"storage_tb": schema.Float64Attribute{Computed: true, Description: "Total storage in terabytes."},
-						"location":   schema.StringAttribute{Computed: true, Description: "Physical location."},
-						"serial":     schema.StringAttribute{Computed: true, Description: "Serial number."},
-						"notes":      schema.StringAttribute{Computed: true, Description: "Free-form notes."},
+						"id":                  schema.StringAttribute{Computed: true, Description: "Server-generated UUID."},
+						"name":                schema.StringAttribute{Computed: true, Description: "Handle for the machine."},
+						"kind":                schema.StringAttribute{Computed: true, Description: "Machine type."},
+						"make":                schema.StringAttribute{Computed: true, Description: "Manufacturer."},
+						"model":               schema.StringAttribute{Computed: true, Description: "Model name or number."},
+						"cpu":                 schema.StringAttribute{Computed: true, Description: "CPU model."},
+						"cpu_cores":           schema.Int64Attribute{Computed: true, Description: "Number of CPU cores."},
+						"ram_gb":              schema.Int64Attribute{Computed: true, Description: "RAM in gigabytes."},
+						"storage_tb":          schema.Float64Attribute{Computed: true, Description: "Total storage in terabytes."},
+						"location":            schema.StringAttribute{Computed: true, Description: "Physical location."},
+						"serial":              schema.StringAttribute{Computed: true, Description: "Serial number."},
+						"notes":               schema.StringAttribute{Computed: true, Description: "Free-form notes."},
+						"tags":                schema.SetAttribute{Computed: true, ElementType: types.StringType, Description: "Free-form tags."},
+						"labels":              schema.MapAttribute{Computed: true, ElementType: types.StringType, Description: "Key/value labels."},
+						"parent_id":           schema.StringAttribute{Computed: true, Description: "ID of the machine this one is placed in; null if none."},
+						"location_id":         schema.StringAttribute{Computed: true, Description: "ID of the location the machine is in; null if none."},
+						"rack_u":              schema.Int64Attribute{Computed: true, Description: "Lowest rack unit occupied; 0 if not rack-mounted."},
+						"u_height":            schema.Int64Attribute{Computed: true, Description: "Number of rack units occupied."},
+						"derive_capacity":     schema.BoolAttribute{Computed: true, Description: "Whether ram_gb and storage_tb are computed from components."},
+						"purchase_date":       schema.StringAttribute{Computed: true, Description: "Purchase date as YYYY-MM-DD; empty if unknown."},
+						"vendor":              schema.StringAttribute{Computed: true, Description: "Where the machine was bought."},
+						"price":               schema.Float64Attribute{Computed: true, Description: "Purchase price in currency."},
+						"currency":            schema.StringAttribute{Computed: true, Description: "ISO 4217 code of the price."},
+						"warranty_end":        schema.StringAttribute{Computed: true, Description: "Last day of the warranty as YYYY-MM-DD; empty if unknown."},
+						"lifetime_years":      schema.Int64Attribute{Computed: true, Description: "Expected years in service."},
+						"rated_watts":         schema.Int64Attribute{Computed: true, Description: "Nameplate power rating in watts."},
+						"idle_watts":          schema.Int64Attribute{Computed: true, Description: "Measured draw in watts when idle."},
+						"peak_watts":          schema.Int64Attribute{Computed: true, Description: "Measured draw in watts at full load."},
+						"ups_id":              schema.StringAttribute{Computed: true, Description: "ID of the UPS feeding the machine, or null."},
+						"circuit":             schema.StringAttribute{Computed: true, Description: "Circuit feeding the machine directly; empty if unknown."},
+						"reserved_cores":      schema.Int64Attribute{Computed: true, Description: "CPU cores already spoken for on a hypervisor host."},
+						"reserved_ram_gb":     schema.Int64Attribute{Computed: true, Description: "RAM in gigabytes already spoken for on a hypervisor host."},
+						"reserved_storage_tb": schema.Float64Attribute{Computed: true, Description: "Storage in terabytes already spoken for on a hypervisor host."},
+						"status":              schema.StringAttribute{Computed: true, Description: "Lifecycle status."},
+						"status_changed_at":   schema.StringAttribute{Computed: true, Description: "When the status last changed (RFC 3339)."},
 					},
 				},
 			},
@@ -108,17 +156,50 @@ func (d *machinesDataSource) Read(ctx context.Context, req datasource.ReadReques
 	state.Machines = make([]machineDataModel, len(machines))
 	for i, m := range machines {
 		state.Machines[i] = machineDataModel{
-			ID:        types.StringValue(m.ID),
-			Name:      types.StringValue(m.Name),
-			Kind:      types.StringValue(m.Kind),
-			Make:      types.StringValue(m.Make),
-			Model:     types.StringValue(m.Model),
-			CPU:       types.StringValue(m.CPU),
-			RAMGB:     types.Int64Value(m.RAMGB),
-			StorageTB: types.Float64Value(m.StorageTB),
-			Location:  types.StringValue(m.Location),
-			Serial:    types.StringValue(m.Serial),
-			Notes:     types.StringValue(m.Notes),
+			ID:                types.StringValue(m.ID),
+			Name:              types.StringValue(m.Name),
+			Kind:              types.StringValue(m.Kind),
+			Make:              types.StringValue(m.Make),
+			Model:             types.StringValue(m.Model),
+			CPU:               types.StringValue(m.CPU),
+			CPUCores:          types.Int64Value(m.CPUCores),
+			RAMGB:             types.Int64Value(m.RAMGB),
+			StorageTB:         types.Float64Value(m.StorageTB),
+			Location:          types.StringValue(m.Location),
+			Serial:            types.StringValue(m.Serial),
+			Notes:             types.StringValue(m.Notes),
+			Tags:              m.Tags,
+			Labels:            m.Labels,
+			ParentID:          types.StringNull(),
+			LocationID:        types.StringNull(),
+			RackU:             types.Int64Value(m.RackU),
+			UHeight:           types.Int64Value(m.UHeight),
+			DeriveCapacity:    types.BoolValue(m.DeriveCapacity),
+			PurchaseDate:      types.StringValue(m.PurchaseDate),
+			Vendor:            types.StringValue(m.Vendor),
+			Price:             types.Float64Value(m.Price),
+			Currency:          types.StringValue(m.Currency),
+			WarrantyEnd:       types.StringValue(m.WarrantyEnd),
+			LifetimeYears:     types.Int64Value(m.LifetimeYears),
+			RatedWatts:        types.Int64Value(m.RatedWatts),
+			IdleWatts:         types.Int64Value(m.IdleWatts),
+			PeakWatts:         types.Int64Value(m.PeakWatts),
+			UPSID:             types.StringNull(),
+			Circuit:           types.StringValue(m.Circuit),
+			ReservedCores:     types.Int64Value(m.ReservedCores),
+			ReservedRAMGB:     types.Int64Value(m.ReservedRAMGB),
+			ReservedStorageTB: types.Float64Value(m.ReservedStorageTB),
+			Status:            types.StringValue(m.Status),
+			StatusChangedAt:   types.StringValue(m.StatusChangedAt),
+		}
+		if m.ParentID != "" {
+			state.Machines[i].ParentID = types.StringValue(m.ParentID)
+		}
+		if m.LocationID != "" {
+			state.Machines[i].LocationID = types.StringValue(m.LocationID)
+		}
+		if m.UPSID != "" {
+			state.Machines[i].UPSID = types.StringValue(m.UPSID)
 		}
 	}
 
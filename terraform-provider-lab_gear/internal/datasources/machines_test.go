@@ -3,6 +3,7 @@ package datasources_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -22,17 +23,41 @@ type testMachinesModel struct {
 }
 
 type testMachineItem struct {
-	ID        types.String  `tfsdk:"id"`
-	Name      types.String  `tfsdk:"name"`
-	Kind      types.String  `tfsdk:"kind"`
-	Make      types.String  `tfsdk:"make"`
-	Model     types.String  `tfsdk:"model"`
-	CPU       types.String  `tfsdk:"cpu"`
-	RAMGB     types.Int64   `tfsdk:"ram_gb"`
-	StorageTB types.Float64 `tfsdk:"storage_tb"`
-	Location  types.String  `tfsdk:"location"`
-	Serial    types.String  `tfsdk:"serial"`
-	Notes     types.String  `tfsdk:"notes"`
+	ID                types.String      `tfsdk:"id"`
+	Name              types.String      `tfsdk:"name"`
+	Kind              types.String      `tfsdk:"kind"`
+	Make              types.String      `tfsdk:"make"`
+	Model             types.String      `tfsdk:"model"`
+	CPU               types.String      `tfsdk:"cpu"`
+	CPUCores          types.Int64       `tfsdk:"cpu_cores"`
+	RAMGB             types.Int64       `tfsdk:"ram_gb"`
+	StorageTB         types.Float64     `tfsdk:"storage_tb"`
+	Location          types.String      `tfsdk:"location"`
+	Serial            types.String      `tfsdk:"serial"`
+	Notes             types.String      `tfsdk:"notes"`
+	Tags              []string          `tfsdk:"tags"`
+	Labels            map[string]string `tfsdk:"labels"`
+	ParentID          types.String      `tfsdk:"parent_id"`
+	LocationID        types.String      `tfsdk:"location_id"`
+	RackU             types.Int64       `tfsdk:"rack_u"`
+	UHeight           types.Int64       `tfsdk:"u_height"`
+	DeriveCapacity    types.Bool        `tfsdk:"derive_capacity"`
+	PurchaseDate      types.String      `tfsdk:"purchase_date"`
+	Vendor            types.String      `tfsdk:"vendor"`
+	Price             types.Float64     `tfsdk:"price"`
+	Currency          types.String      `tfsdk:"currency"`
+	WarrantyEnd       types.String      `tfsdk:"warranty_end"`
+	LifetimeYears     types.Int64       `tfsdk:"lifetime_years"`
+	RatedWatts        types.Int64       `tfsdk:"rated_watts"`
+	IdleWatts         types.Int64       `tfsdk:"idle_watts"`
+	PeakWatts         types.Int64       `tfsdk:"peak_watts"`
+	UPSID             types.String      `tfsdk:"ups_id"`
+	Circuit           types.String      `tfsdk:"circuit"`
+	ReservedCores     types.Int64       `tfsdk:"reserved_cores"`
+	ReservedRAMGB     types.Int64       `tfsdk:"reserved_ram_gb"`
+	ReservedStorageTB types.Float64     `tfsdk:"reserved_storage_tb"`
+	Status            types.String      `tfsdk:"status"`
+	StatusChangedAt   types.String      `tfsdk:"status_changed_at"`
 }
 
 // getDataSourceSchema returns the schema from the data source.
@@ -176,8 +201,8 @@ func TestMachinesDataSource_Read_ReturnsList(t *testing.T) {
 	schm := getDataSourceSchema(t, d)
 
 	apiMachines := []apiclient.Machine{
-		{ID: "uuid-1", Name: "pve1", Kind: "proxmox", Make: "Dell", Model: "R640"},
-		{ID: "uuid-2", Name: "nas01", Kind: "nas", Make: "Synology", Model: "DS920+"},
+		{ID: "uuid-1", Name: "pve1", Kind: "proxmox", Make: "Dell", Model: "R640", Tags: []string{"gpu-passthrough"}, Labels: map[string]string{"env": "prod"}, ParentID: "uuid-0", LocationID: "uuid-rack", RackU: 10, UHeight: 2, Status: "active", StatusChangedAt: "2026-01-01T00:00:00Z", PeakWatts: 350, UPSID: "uuid-ups"},
+		{ID: "uuid-2", Name: "nas01", Kind: "nas", Make: "Synology", Model: "DS920+", Circuit: "office-a"},
 	}
 	client := newMockServer(t, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -188,7 +213,7 @@ func TestMachinesDataSource_Read_ReturnsList(t *testing.T) {
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(apiMachines)
+		json.NewEncoder(w).Encode(apiclient.MachineList{Machines: apiMachines})
 	})
 	configureDataSource(t, d, client)
 
@@ -214,6 +239,25 @@ func TestMachinesDataSource_Read_ReturnsList(t *testing.T) {
 	if state.Machines[1].Kind.ValueString() != "nas" {
 		t.Errorf("machines[1].Kind: got %q, want %q", state.Machines[1].Kind.ValueString(), "nas")
 	}
+	if fmt.Sprint(state.Machines[0].Tags) != "[gpu-passthrough]" || state.Machines[0].Labels["env"] != "prod" {
+		t.Errorf("machines[0]: got tags %v labels %v", state.Machines[0].Tags, state.Machines[0].Labels)
+	}
+	if state.Machines[0].Status.ValueString() != "active" || state.Machines[0].StatusChangedAt.ValueString() != "2026-01-01T00:00:00Z" {
+		t.Errorf("machines[0]: got status %q changed at %q", state.Machines[0].Status.ValueString(), state.Machines[0].StatusChangedAt.ValueString())
+	}
+	if state.Machines[0].ParentID.ValueString() != "uuid-0" || !state.Machines[1].ParentID.IsNull() {
+		t.Errorf("parent_id: got %v and %v, want uuid-0 and null", state.Machines[0].ParentID, state.Machines[1].ParentID)
+	}
+	if m0, m1 := state.Machines[0], state.Machines[1]; m0.UPSID.ValueString() != "uuid-ups" || m0.PeakWatts.ValueInt64() != 350 ||
+		!m1.UPSID.IsNull() || m1.Circuit.ValueString() != "office-a" {
+		t.Errorf("power: got ups_id=%v peak_watts=%v and ups_id=%v circuit=%v", m0.UPSID, m0.PeakWatts, m1.UPSID, m1.Circuit)
+	}
+	if got := state.Machines[0]; got.LocationID.ValueString() != "uuid-rack" || got.RackU.ValueInt64() != 10 || got.UHeight.ValueInt64() != 2 {
+		t.Errorf("machines[0] placement: got location_id=%v rack_u=%v u_height=%v", got.LocationID, got.RackU, got.UHeight)
+	}
+	if !state.Machines[1].LocationID.IsNull() {
+		t.Errorf("machines[1].LocationID: got %v, want null", state.Machines[1].LocationID)
+	}
 }
 
 func TestMachinesDataSource_Read_WithKindFilter(t *testing.T) {
@@ -227,9 +271,9 @@ func TestMachinesDataSource_Read_WithKindFilter(t *testing.T) {
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]apiclient.Machine{
+		json.NewEncoder(w).Encode(apiclient.MachineList{Machines: []apiclient.Machine{
 			{ID: "uuid-1", Name: "pve1", Kind: "proxmox", Make: "Dell", Model: "R640"},
-		})
+		}})
 	})
 	configureDataSource(t, d, client)
 
@@ -262,7 +306,7 @@ func TestMachinesDataSource_Read_EmptyList(t *testing.T) {
 	client := newMockServer(t, func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]apiclient.Machine{})
+		json.NewEncoder(w).Encode(apiclient.MachineList{Machines: []apiclient.Machine{}})
 	})
 	configureDataSource(t, d, client)
 
@@ -84,11 +84,20 @@ func (p *labGearProvider) Configure(ctx context.Context, req provider.ConfigureR
 func (p *labGearProvider) Resources(_ context.Context) []func() resource.Resource {
 	return []func() resource.Resource{
 		resources.NewMachineResource,
+		resources.NewLocationResource,
+		resources.NewGuestResource,
+		resources.NewSwitchResource,
+		resources.NewUPSResource,
+		resources.NewAccessPointResource,
 	}
 }
 
 func (p *labGearProvider) DataSources(_ context.Context) []func() datasource.DataSource {
 	return []func() datasource.DataSource{
 		datasources.NewMachinesDataSource,
+		datasources.NewSwitchesDataSource,
+		datasources.NewUPSUnitsDataSource,
+		datasources.NewAccessPointsDataSource,
+		datasources.NewCapacityDataSource,
 	}
 }
@@ -2,9 +2,12 @@ package provider_test
 
 import (
 	"context"
+	"slices"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
 	fwprovider "github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-go/tftypes"
 	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
@@ -88,23 +91,35 @@ func TestProvider_Schema_HasToken(t *testing.T) {
 
 // --- Resources ---
 
-func TestProvider_Resources_HasMachine(t *testing.T) {
+func TestProvider_Resources(t *testing.T) {
 	ctx := context.Background()
 	p := provider.New()
-	factories := p.Resources(ctx)
-	if len(factories) != 1 {
-		t.Errorf("Resources: got %d factories, want 1", len(factories))
+	var got []string
+	for _, f := range p.Resources(ctx) {
+		var resp resource.MetadataResponse
+		f().Metadata(ctx, resource.MetadataRequest{ProviderTypeName: "lab_gear"}, &resp)
+		got = append(got, resp.TypeName)
+	}
+	want := []string{"lab_gear_machine", "lab_gear_location", "lab_gear_guest", "lab_gear_switch", "lab_gear_ups", "lab_gear_accesspoint"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Resources: got %v, want %v", got, want)
 	}
 }
 
 // --- DataSources ---
 
-func TestProvider_DataSources_HasMachines(t *testing.T) {
+func TestProvider_DataSources(t *testing.T) {
 	ctx := context.Background()
 	p := provider.New()
-	sources := p.DataSources(ctx)
-	if len(sources) != 1 {
-		t.Errorf("DataSources: got %d, want 1", len(sources))
+	var got []string
+	for _, f := range p.DataSources(ctx) {
+		var resp datasource.MetadataResponse
+		f().Metadata(ctx, datasource.MetadataRequest{ProviderTypeName: "lab_gear"}, &resp)
+		got = append(got, resp.TypeName)
+	}
+	want := []string{"lab_gear_machines", "lab_gear_switches", "lab_gear_ups_units", "lab_gear_accesspoints", "lab_gear_capacity"}
+	if !slices.Equal(got, want) {
+		t.Errorf("DataSources: got %v, want %v", got, want)
 	}
 }
 
@@ -0,0 +1,265 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+)
+
+// assetResource manages one asset type. The attributes depend on the type,
+// so plan and state are handled as objects built from assetType rather than
+// through a model struct.
+type assetResource struct {
+	client      *apiclient.Client
+	assetType   apiclient.AssetType
+	description string
+}
+
+// NewSwitchResource is the factory function for lab_gear_switch.
+func NewSwitchResource() resource.Resource {
+	return &assetResource{assetType: apiclient.SwitchType, description: "Manages a network switch."}
+}
+
+// NewUPSResource is the factory function for lab_gear_ups.
+func NewUPSResource() resource.Resource {
+	return &assetResource{assetType: apiclient.UPSType, description: "Manages an uninterruptible power supply."}
+}
+
+// NewAccessPointResource is the factory function for lab_gear_accesspoint.
+func NewAccessPointResource() resource.Resource {
+	return &assetResource{assetType: apiclient.AccessPointType, description: "Manages a wireless access point."}
+}
+
+func (r *assetResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_" + r.assetType.Name // → e.g. "lab_gear_switch"
+}
+
+func (r *assetResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	attrs := map[string]schema.Attribute{
+		"id": schema.StringAttribute{
+			Description: "Server-generated UUID.",
+			Computed:    true,
+			PlanModifiers: []planmodifier.String{
+				stringplanmodifier.UseStateForUnknown(),
+			},
+		},
+		"name":  schema.StringAttribute{Description: "Handle for the " + r.assetType.Name + ".", Required: true},
+		"make":  schema.StringAttribute{Description: "Manufacturer.", Required: true},
+		"model": schema.StringAttribute{Description: "Model name or number.", Required: true},
+		"serial": schema.StringAttribute{
+			Description: "Serial number.",
+			Optional:    true,
+			Computed:    true,
+		},
+		"location_id": schema.StringAttribute{
+			Description: "ID of the site, room, or rack holding it.",
+			Optional:    true,
+		},
+		"notes": schema.StringAttribute{
+			Description: "Free-form notes.",
+			Optional:    true,
+			Computed:    true,
+		},
+	}
+	for _, f := range r.assetType.Fields {
+		attrs[f.Name] = schema.Int64Attribute{
+			Description: f.Description,
+			Required:    f.Required,
+			Optional:    !f.Required,
+			Computed:    !f.Required,
+		}
+	}
+	if r.assetType.RadioBands {
+		attrs["radio_bands"] = schema.SetAttribute{
+			Description: "Bands it broadcasts on: 2.4ghz, 5ghz, and/or 6ghz.",
+			ElementType: types.StringType,
+			Required:    true,
+		}
+	}
+	resp.Schema = schema.Schema{Description: r.description, Attributes: attrs}
+}
+
+func (r *assetResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	client, ok := req.ProviderData.(*apiclient.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected provider data type",
+			fmt.Sprintf("Expected *apiclient.Client, got %T", req.ProviderData),
+		)
+		return
+	}
+	r.client = client
+}
+
+// resourceName is the Terraform type name used in diagnostics.
+func (r *assetResource) resourceName() string {
+	return "lab_gear_" + r.assetType.Name
+}
+
+func (r *assetResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan types.Object
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	a := r.assetFromObject(ctx, plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	created, err := r.client.CreateAsset(ctx, r.assetType, a)
+	if err != nil {
+		resp.Diagnostics.AddError("Error creating "+r.resourceName(), err.Error())
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, r.assetToObject(created))...)
+}
+
+func (r *assetResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state types.Object
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	id := state.Attributes()["id"].(types.String).ValueString()
+
+	a, err := r.client.GetAsset(ctx, r.assetType, id)
+	if err != nil {
+		resp.Diagnostics.AddError("Error reading "+r.resourceName(), err.Error())
+		return
+	}
+	if a == nil {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, r.assetToObject(a))...)
+}
+
+func (r *assetResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan, state types.Object
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	a := r.assetFromObject(ctx, plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	a.ID = state.Attributes()["id"].(types.String).ValueString()
+
+	updated, err := r.client.UpdateAsset(ctx, r.assetType, a)
+	if err != nil {
+		resp.Diagnostics.AddError("Error updating "+r.resourceName(), err.Error())
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, r.assetToObject(updated))...)
+}
+
+func (r *assetResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state types.Object
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	id := state.Attributes()["id"].(types.String).ValueString()
+	if err := r.client.DeleteAsset(ctx, r.assetType, id); err != nil {
+		resp.Diagnostics.AddError("Error deleting "+r.resourceName(), err.Error())
+	}
+}
+
+// ImportState enables: terraform import lab_gear_switch.core <uuid>
+func (r *assetResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	a, err := r.client.GetAsset(ctx, r.assetType, req.ID)
+	if err != nil {
+		resp.Diagnostics.AddError("Error importing "+r.resourceName(), err.Error())
+		return
+	}
+	if a == nil {
+		resp.Diagnostics.AddError("Asset not found",
+			fmt.Sprintf("No %s with ID %q exists in the lab_gear service.", r.assetType.Name, req.ID))
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, r.assetToObject(a))...)
+}
+
+// attrTypes returns the attribute types of the asset type's schema.
+func (r *assetResource) attrTypes() map[string]attr.Type {
+	t := map[string]attr.Type{
+		"id":          types.StringType,
+		"name":        types.StringType,
+		"make":        types.StringType,
+		"model":       types.StringType,
+		"serial":      types.StringType,
+		"location_id": types.StringType,
+		"notes":       types.StringType,
+	}
+	for _, f := range r.assetType.Fields {
+		t[f.Name] = types.Int64Type
+	}
+	if r.assetType.RadioBands {
+		t["radio_bands"] = types.SetType{ElemType: types.StringType}
+	}
+	return t
+}
+
+// assetFromObject converts a plan to the API form. Unknown values, left by
+// optional attributes that are unset, become zero.
+func (r *assetResource) assetFromObject(ctx context.Context, obj types.Object, diags *diag.Diagnostics) apiclient.Asset {
+	attrs := obj.Attributes()
+	str := func(name string) string { return attrs[name].(types.String).ValueString() }
+	a := apiclient.Asset{
+		Name:       str("name"),
+		Make:       str("make"),
+		Model:      str("model"),
+		Serial:     str("serial"),
+		LocationID: str("location_id"),
+		Notes:      str("notes"),
+	}
+	for _, f := range r.assetType.Fields {
+		*f.Value(&a) = attrs[f.Name].(types.Int64).ValueInt64()
+	}
+	if r.assetType.RadioBands {
+		diags.Append(attrs["radio_bands"].(types.Set).ElementsAs(ctx, &a.RadioBands, false)...)
+	}
+	return a
+}
+
+// assetToObject copies API response fields into a state object.
+func (r *assetResource) assetToObject(a *apiclient.Asset) types.Object {
+	attrs := map[string]attr.Value{
+		"id":          types.StringValue(a.ID),
+		"name":        types.StringValue(a.Name),
+		"make":        types.StringValue(a.Make),
+		"model":       types.StringValue(a.Model),
+		"serial":      types.StringValue(a.Serial),
+		"location_id": optionalStringValue(a.LocationID),
+		"notes":       types.StringValue(a.Notes),
+	}
+	for _, f := range r.assetType.Fields {
+		attrs[f.Name] = types.Int64Value(*f.Value(a))
+	}
+	if r.assetType.RadioBands {
+		bands := make([]attr.Value, len(a.RadioBands))
+		for i, b := range a.RadioBands {
+			bands[i] = types.StringValue(b)
+		}
+		attrs["radio_bands"] = types.SetValueMust(types.StringType, bands)
+	}
+	return types.ObjectValueMust(r.attrTypes(), attrs)
+}
@@ -0,0 +1,221 @@
+package resources_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	resourceschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/resources"
+)
+
+// testUPSModel mirrors the lab_gear_ups schema for decoding state in tests.
+type testUPSModel struct {
+	ID             types.String `tfsdk:"id"`
+	Name           types.String `tfsdk:"name"`
+	Make           types.String `tfsdk:"make"`
+	Model          types.String `tfsdk:"model"`
+	Serial         types.String `tfsdk:"serial"`
+	LocationID     types.String `tfsdk:"location_id"`
+	Notes          types.String `tfsdk:"notes"`
+	VARating       types.Int64  `tfsdk:"va_rating"`
+	WattRating     types.Int64  `tfsdk:"watt_rating"`
+	RuntimeMinutes types.Int64  `tfsdk:"runtime_minutes"`
+}
+
+// testAccessPointModel mirrors the lab_gear_accesspoint schema.
+type testAccessPointModel struct {
+	ID         types.String `tfsdk:"id"`
+	Name       types.String `tfsdk:"name"`
+	Make       types.String `tfsdk:"make"`
+	Model      types.String `tfsdk:"model"`
+	Serial     types.String `tfsdk:"serial"`
+	LocationID types.String `tfsdk:"location_id"`
+	Notes      types.String `tfsdk:"notes"`
+	RadioBands []string     `tfsdk:"radio_bands"`
+}
+
+// buildAssetPlan constructs a tfsdk.Plan for an asset schema with the given
+// attribute values. Common attributes not in values are unknown, or null for
+// location_id, as when omitted in config.
+func buildAssetPlan(t *testing.T, schm resourceschema.Schema, values map[string]tftypes.Value) tfsdk.Plan {
+	t.Helper()
+	ctx := context.Background()
+	tfType := schm.Type().TerraformType(ctx).(tftypes.Object)
+	attrs := map[string]tftypes.Value{}
+	for name, typ := range tfType.AttributeTypes {
+		attrs[name] = tftypes.NewValue(typ, tftypes.UnknownValue)
+	}
+	attrs["location_id"] = tftypes.NewValue(tftypes.String, nil)
+	for name, v := range values {
+		attrs[name] = v
+	}
+	return tfsdk.Plan{Schema: schm, Raw: tftypes.NewValue(tfType, attrs)}
+}
+
+// writeAsset encodes a as JSON with statusCode.
+func writeAsset(w http.ResponseWriter, statusCode int, a apiclient.Asset) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(a)
+}
+
+func TestAssetResource_Metadata(t *testing.T) {
+	for want, r := range map[string]resource.Resource{
+		"lab_gear_switch":      resources.NewSwitchResource(),
+		"lab_gear_ups":         resources.NewUPSResource(),
+		"lab_gear_accesspoint": resources.NewAccessPointResource(),
+	} {
+		var resp resource.MetadataResponse
+		r.Metadata(context.Background(), resource.MetadataRequest{ProviderTypeName: "lab_gear"}, &resp)
+		if resp.TypeName != want {
+			t.Errorf("TypeName: got %q, want %q", resp.TypeName, want)
+		}
+	}
+}
+
+func TestAssetResource_Schema_TypedFields(t *testing.T) {
+	schm := getSchema(t, resources.NewSwitchResource())
+	if a, ok := schm.Attributes["port_count"]; !ok || !a.IsRequired() {
+		t.Error("lab_gear_switch: port_count should be required")
+	}
+	for _, name := range []string{"va_rating", "watt_rating", "runtime_minutes", "radio_bands"} {
+		if _, ok := schm.Attributes[name]; ok {
+			t.Errorf("lab_gear_switch should not have %q", name)
+		}
+	}
+	ups := getSchema(t, resources.NewUPSResource())
+	if a := ups.Attributes["runtime_minutes"]; a == nil || !a.IsOptional() || !a.IsComputed() {
+		t.Error("lab_gear_ups: runtime_minutes should be optional and computed")
+	}
+}
+
+func TestAssetResource_Create_UPS(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewUPSResource()
+	schm := getSchema(t, r)
+
+	var got apiclient.Asset
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/api/v1/ups" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+		}
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		body := got
+		body.ID, body.Type = "uuid-ups", "ups"
+		writeAsset(w, http.StatusCreated, body)
+	})
+	configureResource(t, r, client)
+
+	plan := buildAssetPlan(t, schm, map[string]tftypes.Value{
+		"name":      tftypes.NewValue(tftypes.String, "rack ups"),
+		"make":      tftypes.NewValue(tftypes.String, "APC"),
+		"model":     tftypes.NewValue(tftypes.String, "SMT1500"),
+		"va_rating": tftypes.NewValue(tftypes.Number, big.NewFloat(1500)),
+	})
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: plan}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+	if got.VARating != 1500 || got.RuntimeMinutes != 0 || got.Serial != "" {
+		t.Errorf("request: got %+v", got)
+	}
+
+	var state testUPSModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if state.ID.ValueString() != "uuid-ups" || state.VARating.ValueInt64() != 1500 ||
+		state.RuntimeMinutes.IsUnknown() || !state.LocationID.IsNull() {
+		t.Errorf("state: got %+v", state)
+	}
+}
+
+func TestAssetResource_Create_AccessPointBands(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewAccessPointResource()
+	schm := getSchema(t, r)
+
+	var got apiclient.Asset
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/accesspoints" {
+			t.Errorf("path: got %s, want /api/v1/accesspoints", req.URL.Path)
+		}
+		json.NewDecoder(req.Body).Decode(&got)
+		body := got
+		body.ID = "uuid-ap"
+		writeAsset(w, http.StatusCreated, body)
+	})
+	configureResource(t, r, client)
+
+	bands := tftypes.NewValue(tftypes.Set{ElementType: tftypes.String}, []tftypes.Value{
+		tftypes.NewValue(tftypes.String, "5ghz"),
+		tftypes.NewValue(tftypes.String, "6ghz"),
+	})
+	plan := buildAssetPlan(t, schm, map[string]tftypes.Value{
+		"name":        tftypes.NewValue(tftypes.String, "hallway"),
+		"make":        tftypes.NewValue(tftypes.String, "Ubiquiti"),
+		"model":       tftypes.NewValue(tftypes.String, "U7 Pro"),
+		"location_id": tftypes.NewValue(tftypes.String, "uuid-room"),
+		"radio_bands": bands,
+	})
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: plan}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+	if len(got.RadioBands) != 2 || got.LocationID != "uuid-room" {
+		t.Errorf("request: got %+v", got)
+	}
+
+	var state testAccessPointModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if state.ID.ValueString() != "uuid-ap" || len(state.RadioBands) != 2 || state.LocationID.ValueString() != "uuid-room" {
+		t.Errorf("state: got %+v", state)
+	}
+}
+
+func TestAssetResource_Read_NotFound_RemovesResource(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewSwitchResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/switches/uuid-gone" {
+			t.Errorf("path: got %s", req.URL.Path)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	configureResource(t, r, client)
+
+	prior := buildAssetPlan(t, schm, map[string]tftypes.Value{
+		"id":         tftypes.NewValue(tftypes.String, "uuid-gone"),
+		"name":       tftypes.NewValue(tftypes.String, "core"),
+		"make":       tftypes.NewValue(tftypes.String, "MikroTik"),
+		"model":      tftypes.NewValue(tftypes.String, "CRS309"),
+		"serial":     tftypes.NewValue(tftypes.String, ""),
+		"notes":      tftypes.NewValue(tftypes.String, ""),
+		"port_count": tftypes.NewValue(tftypes.Number, big.NewFloat(9)),
+	})
+	state := tfsdk.State{Schema: schm, Raw: prior.Raw}
+	resp := &resource.ReadResponse{State: state}
+	r.Read(ctx, resource.ReadRequest{State: state}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read: unexpected error: %v", resp.Diagnostics)
+	}
+	if !resp.State.Raw.IsNull() {
+		t.Error("Read: expected state to be removed on 404")
+	}
+}
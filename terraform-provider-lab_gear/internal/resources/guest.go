@@ -0,0 +1,184 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+)
+
+type guestResource struct {
+	client *apiclient.Client
+}
+
+// guestModel maps the Terraform schema attributes to Go values.
+type guestModel struct {
+	ID     types.String `tfsdk:"id"`
+	Name   types.String `tfsdk:"name"`
+	Type   types.String `tfsdk:"type"`
+	HostID types.String `tfsdk:"host_id"`
+	VCPUs  types.Int64  `tfsdk:"vcpus"`
+	RAMMB  types.Int64  `tfsdk:"ram_mb"`
+	DiskGB types.Int64  `tfsdk:"disk_gb"`
+}
+
+// NewGuestResource is the factory function registered with the provider.
+func NewGuestResource() resource.Resource {
+	return &guestResource{}
+}
+
+func (r *guestResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_guest" // → "lab_gear_guest"
+}
+
+func (r *guestResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Records a VM or LXC container running on a host machine.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "Server-generated UUID.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name":    schema.StringAttribute{Description: "Guest name, unique per host.", Required: true},
+			"type":    schema.StringAttribute{Description: "Guest type: vm or lxc.", Required: true},
+			"host_id": schema.StringAttribute{Description: "ID of the machine the guest runs on. Changing it records a migration.", Required: true},
+			"vcpus":   schema.Int64Attribute{Description: "Virtual CPUs.", Optional: true, Computed: true},
+			"ram_mb":  schema.Int64Attribute{Description: "RAM in megabytes.", Optional: true, Computed: true},
+			"disk_gb": schema.Int64Attribute{Description: "Disk size in gigabytes.", Optional: true, Computed: true},
+		},
+	}
+}
+
+func (r *guestResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	client, ok := req.ProviderData.(*apiclient.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected provider data type",
+			fmt.Sprintf("Expected *apiclient.Client, got %T", req.ProviderData),
+		)
+		return
+	}
+	r.client = client
+}
+
+func (r *guestResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan guestModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	created, err := r.client.CreateGuest(ctx, guestFromModel(&plan, ""))
+	if err != nil {
+		resp.Diagnostics.AddError("Error creating lab_gear_guest", err.Error())
+		return
+	}
+
+	guestToState(created, &plan)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *guestResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state guestModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	g, err := r.client.GetGuest(ctx, state.ID.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Error reading lab_gear_guest", err.Error())
+		return
+	}
+	if g == nil {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	guestToState(g, &state)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func (r *guestResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan guestModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	var state guestModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updated, err := r.client.UpdateGuest(ctx, guestFromModel(&plan, state.ID.ValueString()))
+	if err != nil {
+		resp.Diagnostics.AddError("Error updating lab_gear_guest", err.Error())
+		return
+	}
+
+	guestToState(updated, &plan)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *guestResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state guestModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if err := r.client.DeleteGuest(ctx, state.ID.ValueString()); err != nil {
+		resp.Diagnostics.AddError("Error deleting lab_gear_guest", err.Error())
+	}
+}
+
+// ImportState enables: terraform import lab_gear_guest.gitea <uuid>
+func (r *guestResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	g, err := r.client.GetGuest(ctx, req.ID)
+	if err != nil {
+		resp.Diagnostics.AddError("Error importing lab_gear_guest", err.Error())
+		return
+	}
+	if g == nil {
+		resp.Diagnostics.AddError("Guest not found",
+			fmt.Sprintf("No guest with ID %q exists in the lab_gear service.", req.ID))
+		return
+	}
+
+	var state guestModel
+	guestToState(g, &state)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+// guestFromModel builds the API request body for m. Unknown sizes, from
+// attributes omitted in config, are sent as zero.
+func guestFromModel(m *guestModel, id string) apiclient.Guest {
+	return apiclient.Guest{
+		ID:     id,
+		Name:   m.Name.ValueString(),
+		Type:   m.Type.ValueString(),
+		HostID: m.HostID.ValueString(),
+		VCPUs:  m.VCPUs.ValueInt64(),
+		RAMMB:  m.RAMMB.ValueInt64(),
+		DiskGB: m.DiskGB.ValueInt64(),
+	}
+}
+
+// guestToState copies API response fields into the Terraform state model.
+func guestToState(g *apiclient.Guest, s *guestModel) {
+	s.ID = types.StringValue(g.ID)
+	s.Name = types.StringValue(g.Name)
+	s.Type = types.StringValue(g.Type)
+	s.HostID = types.StringValue(g.HostID)
+	s.VCPUs = types.Int64Value(g.VCPUs)
+	s.RAMMB = types.Int64Value(g.RAMMB)
+	s.DiskGB = types.Int64Value(g.DiskGB)
+}
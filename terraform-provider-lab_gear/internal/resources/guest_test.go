@@ -0,0 +1,137 @@
+package resources_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	resourceschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/resources"
+)
+
+// testGuestModel mirrors guestModel for decoding state in tests.
+type testGuestModel struct {
+	ID     types.String `tfsdk:"id"`
+	Name   types.String `tfsdk:"name"`
+	Type   types.String `tfsdk:"type"`
+	HostID types.String `tfsdk:"host_id"`
+	VCPUs  types.Int64  `tfsdk:"vcpus"`
+	RAMMB  types.Int64  `tfsdk:"ram_mb"`
+	DiskGB types.Int64  `tfsdk:"disk_gb"`
+}
+
+// buildGuestPlan constructs a tfsdk.Plan for the guest schema. The ID is
+// unknown, as are sizes not in sizes, as when omitted in config.
+func buildGuestPlan(t *testing.T, schm resourceschema.Schema, name, typ, hostID string, sizes map[string]int64) tfsdk.Plan {
+	t.Helper()
+	attrs := map[string]tftypes.Value{
+		"id":      tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"name":    tftypes.NewValue(tftypes.String, name),
+		"type":    tftypes.NewValue(tftypes.String, typ),
+		"host_id": tftypes.NewValue(tftypes.String, hostID),
+	}
+	for _, k := range []string{"vcpus", "ram_mb", "disk_gb"} {
+		attrs[k] = tftypes.NewValue(tftypes.Number, tftypes.UnknownValue)
+		if v, ok := sizes[k]; ok {
+			attrs[k] = tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(v))
+		}
+	}
+	return tfsdk.Plan{Schema: schm, Raw: tftypes.NewValue(schm.Type().TerraformType(context.Background()), attrs)}
+}
+
+// writeGuest encodes g as JSON with statusCode.
+func writeGuest(w http.ResponseWriter, statusCode int, g apiclient.Guest) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(g)
+}
+
+func TestGuestResource_Metadata(t *testing.T) {
+	var resp resource.MetadataResponse
+	resources.NewGuestResource().Metadata(context.Background(), resource.MetadataRequest{ProviderTypeName: "lab_gear"}, &resp)
+	if resp.TypeName != "lab_gear_guest" {
+		t.Errorf("TypeName: got %q, want lab_gear_guest", resp.TypeName)
+	}
+}
+
+func TestGuestResource_Create(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewGuestResource()
+	schm := getSchema(t, r)
+
+	var got apiclient.Guest
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/api/v1/guests" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+		}
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		body := got
+		body.ID = "uuid-guest"
+		writeGuest(w, http.StatusCreated, body)
+	})
+	configureResource(t, r, client)
+
+	plan := buildGuestPlan(t, schm, "gitea", "lxc", "uuid-pve2", map[string]int64{"vcpus": 2, "ram_mb": 2048})
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: plan}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+	if got.HostID != "uuid-pve2" || got.VCPUs != 2 || got.RAMMB != 2048 || got.DiskGB != 0 {
+		t.Errorf("request: got %+v", got)
+	}
+
+	var state testGuestModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if state.ID.ValueString() != "uuid-guest" || state.Type.ValueString() != "lxc" || state.DiskGB.IsUnknown() {
+		t.Errorf("state: got %+v", state)
+	}
+}
+
+func TestGuestResource_Update_Migrates(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewGuestResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut || req.URL.Path != "/api/v1/guests/uuid-guest" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+		}
+		var body apiclient.Guest
+		json.NewDecoder(req.Body).Decode(&body)
+		writeGuest(w, http.StatusOK, body)
+	})
+	configureResource(t, r, client)
+
+	sizes := map[string]int64{"vcpus": 2, "ram_mb": 2048, "disk_gb": 16}
+	prior := buildGuestPlan(t, schm, "gitea", "lxc", "uuid-pve1", sizes)
+	state := tfsdk.State{Schema: schm, Raw: prior.Raw}
+	if diags := state.SetAttribute(ctx, path.Root("id"), "uuid-guest"); diags.HasError() {
+		t.Fatalf("set id: %v", diags)
+	}
+	plan := buildGuestPlan(t, schm, "gitea", "lxc", "uuid-pve2", sizes)
+	resp := &resource.UpdateResponse{State: state}
+	r.Update(ctx, resource.UpdateRequest{Plan: plan, State: state}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Update: unexpected error: %v", resp.Diagnostics)
+	}
+	var got testGuestModel
+	if diags := resp.State.Get(ctx, &got); diags.HasError() {
+		t.Fatalf("Update: state.Get: %v", diags)
+	}
+	if got.ID.ValueString() != "uuid-guest" || got.HostID.ValueString() != "uuid-pve2" {
+		t.Errorf("state: got %+v", got)
+	}
+}
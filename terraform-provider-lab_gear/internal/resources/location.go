@@ -0,0 +1,182 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+)
+
+type locationResource struct {
+	client *apiclient.Client
+}
+
+// locationModel maps the Terraform schema attributes to Go values.
+type locationModel struct {
+	ID       types.String `tfsdk:"id"`
+	Name     types.String `tfsdk:"name"`
+	Kind     types.String `tfsdk:"kind"`
+	ParentID types.String `tfsdk:"parent_id"`
+	HeightU  types.Int64  `tfsdk:"height_u"`
+}
+
+// NewLocationResource is the factory function registered with the provider.
+func NewLocationResource() resource.Resource {
+	return &locationResource{}
+}
+
+func (r *locationResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_location" // → "lab_gear_location"
+}
+
+func (r *locationResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Manages a site, room, or rack that machines can be placed in.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "Server-generated UUID.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": schema.StringAttribute{Description: "Name, unique among locations with the same parent.", Required: true},
+			"kind": schema.StringAttribute{Description: "Location type: site, room, or rack.", Required: true},
+			"parent_id": schema.StringAttribute{
+				Description: "ID of the containing location: a site for a room, a room for a rack. Must be unset for a site.",
+				Optional:    true,
+			},
+			"height_u": schema.Int64Attribute{
+				Description: "Height of a rack in rack units. Required for racks; must be unset for sites and rooms.",
+				Optional:    true,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func (r *locationResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	client, ok := req.ProviderData.(*apiclient.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected provider data type",
+			fmt.Sprintf("Expected *apiclient.Client, got %T", req.ProviderData),
+		)
+		return
+	}
+	r.client = client
+}
+
+func (r *locationResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan locationModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	created, err := r.client.CreateLocation(ctx, apiclient.Location{
+		Name:     plan.Name.ValueString(),
+		Kind:     plan.Kind.ValueString(),
+		ParentID: plan.ParentID.ValueString(),
+		HeightU:  plan.HeightU.ValueInt64(),
+	})
+	if err != nil {
+		resp.Diagnostics.AddError("Error creating lab_gear_location", err.Error())
+		return
+	}
+
+	locationToState(created, &plan)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *locationResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state locationModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	l, err := r.client.GetLocation(ctx, state.ID.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Error reading lab_gear_location", err.Error())
+		return
+	}
+	if l == nil {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	locationToState(l, &state)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func (r *locationResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan locationModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	var state locationModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updated, err := r.client.UpdateLocation(ctx, apiclient.Location{
+		ID:       state.ID.ValueString(),
+		Name:     plan.Name.ValueString(),
+		Kind:     plan.Kind.ValueString(),
+		ParentID: plan.ParentID.ValueString(),
+		HeightU:  plan.HeightU.ValueInt64(),
+	})
+	if err != nil {
+		resp.Diagnostics.AddError("Error updating lab_gear_location", err.Error())
+		return
+	}
+
+	locationToState(updated, &plan)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *locationResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state locationModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if err := r.client.DeleteLocation(ctx, state.ID.ValueString()); err != nil {
+		resp.Diagnostics.AddError("Error deleting lab_gear_location", err.Error())
+	}
+}
+
+// ImportState enables: terraform import lab_gear_location.rack1 <uuid>
+func (r *locationResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	l, err := r.client.GetLocation(ctx, req.ID)
+	if err != nil {
+		resp.Diagnostics.AddError("Error importing lab_gear_location", err.Error())
+		return
+	}
+	if l == nil {
+		resp.Diagnostics.AddError("Location not found",
+			fmt.Sprintf("No location with ID %q exists in the lab_gear service.", req.ID))
+		return
+	}
+
+	var state locationModel
+	locationToState(l, &state)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+// locationToState copies API response fields into the Terraform state model.
+func locationToState(l *apiclient.Location, s *locationModel) {
+	s.ID = types.StringValue(l.ID)
+	s.Name = types.StringValue(l.Name)
+	s.Kind = types.StringValue(l.Kind)
+	s.ParentID = optionalStringValue(l.ParentID)
+	s.HeightU = types.Int64Value(l.HeightU)
+}
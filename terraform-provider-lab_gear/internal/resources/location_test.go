@@ -0,0 +1,262 @@
+package resources_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	resourceschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/apiclient"
+	"github.com/tphummel/lab_gear/terraform-provider-lab_gear/internal/resources"
+)
+
+// testLocationModel mirrors locationModel for decoding state in tests.
+type testLocationModel struct {
+	ID       types.String `tfsdk:"id"`
+	Name     types.String `tfsdk:"name"`
+	Kind     types.String `tfsdk:"kind"`
+	ParentID types.String `tfsdk:"parent_id"`
+	HeightU  types.Int64  `tfsdk:"height_u"`
+}
+
+// buildLocationPlan constructs a tfsdk.Plan for the location schema. An empty
+// parentID is null and a zero heightU is unknown, as when omitted in config.
+func buildLocationPlan(t *testing.T, schm resourceschema.Schema, name, kind, parentID string, heightU int64) tfsdk.Plan {
+	t.Helper()
+	ctx := context.Background()
+	parent := tftypes.NewValue(tftypes.String, nil)
+	if parentID != "" {
+		parent = tftypes.NewValue(tftypes.String, parentID)
+	}
+	height := tftypes.NewValue(tftypes.Number, tftypes.UnknownValue)
+	if heightU != 0 {
+		height = tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(heightU))
+	}
+	raw := tftypes.NewValue(schm.Type().TerraformType(ctx), map[string]tftypes.Value{
+		"id":        tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"name":      tftypes.NewValue(tftypes.String, name),
+		"kind":      tftypes.NewValue(tftypes.String, kind),
+		"parent_id": parent,
+		"height_u":  height,
+	})
+	return tfsdk.Plan{Schema: schm, Raw: raw}
+}
+
+// buildLocationState constructs a tfsdk.State populated with a known location.
+func buildLocationState(t *testing.T, schm resourceschema.Schema, l apiclient.Location) tfsdk.State {
+	t.Helper()
+	ctx := context.Background()
+	var parentID any
+	if l.ParentID != "" {
+		parentID = l.ParentID
+	}
+	raw := tftypes.NewValue(schm.Type().TerraformType(ctx), map[string]tftypes.Value{
+		"id":        tftypes.NewValue(tftypes.String, l.ID),
+		"name":      tftypes.NewValue(tftypes.String, l.Name),
+		"kind":      tftypes.NewValue(tftypes.String, l.Kind),
+		"parent_id": tftypes.NewValue(tftypes.String, parentID),
+		"height_u":  tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(l.HeightU)),
+	})
+	return tfsdk.State{Schema: schm, Raw: raw}
+}
+
+// writeLocation encodes l as JSON with statusCode.
+func writeLocation(w http.ResponseWriter, statusCode int, l apiclient.Location) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(l)
+}
+
+func TestLocationResource_Metadata(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewLocationResource()
+	var resp resource.MetadataResponse
+	r.Metadata(ctx, resource.MetadataRequest{ProviderTypeName: "lab_gear"}, &resp)
+	if resp.TypeName != "lab_gear_location" {
+		t.Errorf("TypeName: got %q, want lab_gear_location", resp.TypeName)
+	}
+}
+
+func TestLocationResource_Create_Rack(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewLocationResource()
+	schm := getSchema(t, r)
+
+	var got apiclient.Location
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/api/v1/locations" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+		}
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		body := got
+		body.ID = "uuid-rack"
+		writeLocation(w, http.StatusCreated, body)
+	})
+	configureResource(t, r, client)
+
+	plan := buildLocationPlan(t, schm, "rack1", "rack", "uuid-room", 42)
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: plan}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+	if got.Kind != "rack" || got.ParentID != "uuid-room" || got.HeightU != 42 {
+		t.Errorf("request: got %+v", got)
+	}
+
+	var state testLocationModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if state.ID.ValueString() != "uuid-rack" || state.HeightU.ValueInt64() != 42 || state.ParentID.ValueString() != "uuid-room" {
+		t.Errorf("state: got %+v", state)
+	}
+}
+
+func TestLocationResource_Create_SiteHasNullParent(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewLocationResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		writeLocation(w, http.StatusCreated, apiclient.Location{ID: "uuid-site", Name: "home", Kind: "site"})
+	})
+	configureResource(t, r, client)
+
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: buildLocationPlan(t, schm, "home", "site", "", 0)}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+	var state testLocationModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if !state.ParentID.IsNull() {
+		t.Errorf("ParentID: got %v, want null", state.ParentID)
+	}
+	if state.HeightU.ValueInt64() != 0 {
+		t.Errorf("HeightU: got %v, want 0", state.HeightU)
+	}
+}
+
+func TestLocationResource_Create_APIError(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewLocationResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+	configureResource(t, r, client)
+
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: buildLocationPlan(t, schm, "home", "site", "", 0)}, resp)
+	if !resp.Diagnostics.HasError() {
+		t.Error("Create: expected error diagnostic on 409")
+	}
+}
+
+func TestLocationResource_Read_NotFound_RemovesResource(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewLocationResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	configureResource(t, r, client)
+
+	l := apiclient.Location{ID: "uuid-gone", Name: "home", Kind: "site"}
+	resp := &resource.ReadResponse{State: buildLocationState(t, schm, l)}
+	r.Read(ctx, resource.ReadRequest{State: buildLocationState(t, schm, l)}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read: unexpected error: %v", resp.Diagnostics)
+	}
+	if !resp.State.Raw.IsNull() {
+		t.Error("Read: expected state to be removed on 404")
+	}
+}
+
+func TestLocationResource_Update_Success(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewLocationResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut || req.URL.Path != "/api/v1/locations/uuid-rack" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+		}
+		var body apiclient.Location
+		json.NewDecoder(req.Body).Decode(&body)
+		writeLocation(w, http.StatusOK, body)
+	})
+	configureResource(t, r, client)
+
+	prior := apiclient.Location{ID: "uuid-rack", Name: "rack1", Kind: "rack", ParentID: "uuid-room", HeightU: 42}
+	resp := &resource.UpdateResponse{State: buildLocationState(t, schm, prior)}
+	r.Update(ctx, resource.UpdateRequest{
+		Plan:  buildLocationPlan(t, schm, "rack1", "rack", "uuid-room", 48),
+		State: buildLocationState(t, schm, prior),
+	}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Update: unexpected error: %v", resp.Diagnostics)
+	}
+	var state testLocationModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Update: state.Get: %v", diags)
+	}
+	if state.ID.ValueString() != "uuid-rack" || state.HeightU.ValueInt64() != 48 {
+		t.Errorf("state: got %+v", state)
+	}
+}
+
+func TestLocationResource_Delete_Success(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewLocationResource()
+	schm := getSchema(t, r)
+
+	var deleted bool
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodDelete && req.URL.Path == "/api/v1/locations/uuid-site" {
+			deleted = true
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	configureResource(t, r, client)
+
+	l := apiclient.Location{ID: "uuid-site", Name: "home", Kind: "site"}
+	resp := &resource.DeleteResponse{}
+	r.Delete(ctx, resource.DeleteRequest{State: buildLocationState(t, schm, l)}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Delete: unexpected error: %v", resp.Diagnostics)
+	}
+	if !deleted {
+		t.Error("Delete: DELETE request not sent")
+	}
+}
+
+func TestLocationResource_ImportState_NotFound(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewLocationResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	configureResource(t, r, client)
+
+	resp := &resource.ImportStateResponse{State: emptyState(schm)}
+	r.(resource.ResourceWithImportState).ImportState(ctx, resource.ImportStateRequest{ID: "missing"}, resp)
+	if !resp.Diagnostics.HasError() {
+		t.Error("ImportState: expected error diagnostic for unknown ID")
+	}
+}
@@ -2,8 +2,11 @@ package resources
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
@@ -18,17 +21,42 @@ type machineResource struct {
 
 // machineModel maps the Terraform schema attributes to Go values.
 type machineModel struct {
-	ID        types.String  `tfsdk:"id"`
-	Name      types.String  `tfsdk:"name"`
-	Kind      types.String  `tfsdk:"kind"`
-	Make      types.String  `tfsdk:"make"`
-	Model     types.String  `tfsdk:"model"`
-	CPU       types.String  `tfsdk:"cpu"`
-	RAMGB     types.Int64   `tfsdk:"ram_gb"`
-	StorageTB types.Float64 `tfsdk:"storage_tb"`
-	Location  types.String  `tfsdk:"location"`
-	Serial    types.String  `tfsdk:"serial"`
-	Notes     types.String  `tfsdk:"notes"`
+	ID                types.String  `tfsdk:"id"`
+	Name              types.String  `tfsdk:"name"`
+	Kind              types.String  `tfsdk:"kind"`
+	Make              types.String  `tfsdk:"make"`
+	Model             types.String  `tfsdk:"model"`
+	CPU               types.String  `tfsdk:"cpu"`
+	CPUCores          types.Int64   `tfsdk:"cpu_cores"`
+	RAMGB             types.Int64   `tfsdk:"ram_gb"`
+	StorageTB         types.Float64 `tfsdk:"storage_tb"`
+	Location          types.String  `tfsdk:"location"`
+	Serial            types.String  `tfsdk:"serial"`
+	Notes             types.String  `tfsdk:"notes"`
+	Tags              types.Set     `tfsdk:"tags"`
+	Labels            types.Map     `tfsdk:"labels"`
+	ParentID          types.String  `tfsdk:"parent_id"`
+	LocationID        types.String  `tfsdk:"location_id"`
+	RackU             types.Int64   `tfsdk:"rack_u"`
+	UHeight           types.Int64   `tfsdk:"u_height"`
+	DeriveCapacity    types.Bool    `tfsdk:"derive_capacity"`
+	PurchaseDate      types.String  `tfsdk:"purchase_date"`
+	Vendor            types.String  `tfsdk:"vendor"`
+	Price             types.Float64 `tfsdk:"price"`
+	Currency          types.String  `tfsdk:"currency"`
+	WarrantyEnd       types.String  `tfsdk:"warranty_end"`
+	LifetimeYears     types.Int64   `tfsdk:"lifetime_years"`
+	RatedWatts        types.Int64   `tfsdk:"rated_watts"`
+	IdleWatts         types.Int64   `tfsdk:"idle_watts"`
+	PeakWatts         types.Int64   `tfsdk:"peak_watts"`
+	UPSID             types.String  `tfsdk:"ups_id"`
+	Circuit           types.String  `tfsdk:"circuit"`
+	ReservedCores     types.Int64   `tfsdk:"reserved_cores"`
+	ReservedRAMGB     types.Int64   `tfsdk:"reserved_ram_gb"`
+	ReservedStorageTB types.Float64 `tfsdk:"reserved_storage_tb"`
+	Status            types.String  `tfsdk:"status"`
+	StatusChangedAt   types.String  `tfsdk:"status_changed_at"`
+	Revision          types.Int64   `tfsdk:"revision"`
 }
 
 // NewMachineResource is the factory function registered with the provider.
@@ -60,6 +88,11 @@ func (r *machineResource) Schema(_ context.Context, _ resource.SchemaRequest, re
 				Optional:    true,
 				Computed:    true,
 			},
+			"cpu_cores": schema.Int64Attribute{
+				Description: "Number of CPU cores.",
+				Optional:    true,
+				Computed:    true,
+			},
 			"ram_gb": schema.Int64Attribute{
 				Description: "RAM in gigabytes.",
 				Optional:    true,
@@ -85,6 +118,123 @@ func (r *machineResource) Schema(_ context.Context, _ resource.SchemaRequest, re
 				Optional:    true,
 				Computed:    true,
 			},
+			"tags": schema.SetAttribute{
+				Description: "Free-form tags (e.g. gpu-passthrough).",
+				ElementType: types.StringType,
+				Optional:    true,
+				Computed:    true,
+			},
+			"labels": schema.MapAttribute{
+				Description: "Key/value labels (e.g. env = \"prod\").",
+				ElementType: types.StringType,
+				Optional:    true,
+				Computed:    true,
+			},
+			"parent_id": schema.StringAttribute{
+				Description: "ID of the machine this one is placed in or runs on (e.g. the chassis of a blade). Referencing another lab_gear_machine's id makes Terraform create the parent first and destroy it last.",
+				Optional:    true,
+			},
+			"location_id": schema.StringAttribute{
+				Description: "ID of the lab_gear_location (site, room, or rack) the machine is in.",
+				Optional:    true,
+			},
+			"rack_u": schema.Int64Attribute{
+				Description: "Lowest rack unit the machine occupies, counting from 1 at the bottom. Requires location_id to be a rack; 0 means not rack-mounted.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"u_height": schema.Int64Attribute{
+				Description: "Number of rack units the machine spans. Defaults to 1 when rack_u is set.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"derive_capacity": schema.BoolAttribute{
+				Description: "When true the server computes ram_gb and storage_tb from the machine's DIMM and disk components, overriding any configured values.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"purchase_date": schema.StringAttribute{
+				Description: "Purchase date as YYYY-MM-DD.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"vendor": schema.StringAttribute{
+				Description: "Where the machine was bought.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"price": schema.Float64Attribute{
+				Description: "Purchase price in currency.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"currency": schema.StringAttribute{
+				Description: "Upper-case ISO 4217 code of the price (e.g. USD). Required when price is set.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"warranty_end": schema.StringAttribute{
+				Description: "Last day of the warranty as YYYY-MM-DD.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"lifetime_years": schema.Int64Attribute{
+				Description: "Expected years in service, used to depreciate the price in the cost report.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"rated_watts": schema.Int64Attribute{
+				Description: "Nameplate power rating in watts, used when idle_watts or peak_watts is unset.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"idle_watts": schema.Int64Attribute{
+				Description: "Measured draw in watts when idle.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"peak_watts": schema.Int64Attribute{
+				Description: "Measured draw in watts at full load. UPS budgets are checked against it.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"ups_id": schema.StringAttribute{
+				Description: "ID of the lab_gear_ups feeding the machine. The server rejects it if the UPS's capacity would be exceeded at peak.",
+				Optional:    true,
+			},
+			"circuit": schema.StringAttribute{
+				Description: "Name of the circuit feeding the machine directly. Conflicts with ups_id.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"reserved_cores": schema.Int64Attribute{
+				Description: "CPU cores already spoken for on a hypervisor host, subtracted from cpu_cores in the capacity report.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"reserved_ram_gb": schema.Int64Attribute{
+				Description: "RAM in gigabytes already spoken for on a hypervisor host.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"reserved_storage_tb": schema.Float64Attribute{
+				Description: "Storage in terabytes already spoken for on a hypervisor host.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"status": schema.StringAttribute{
+				Description: "Lifecycle status: planned, ordered, active, maintenance, retired, sold. The server rejects changes its transition table does not allow (e.g. retired to planned). New machines default to active.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"status_changed_at": schema.StringAttribute{
+				Description: "When the status last changed (RFC 3339).",
+				Computed:    true,
+			},
+			"revision": schema.Int64Attribute{
+				Description: "Server revision of the machine, used to reject updates if it changed outside Terraform.",
+				Computed:    true,
+			},
 		},
 	}
 }
@@ -112,16 +262,39 @@ func (r *machineResource) Create(ctx context.Context, req resource.CreateRequest
 	}
 
 	created, err := r.client.CreateMachine(ctx, apiclient.Machine{
-		Name:      plan.Name.ValueString(),
-		Kind:      plan.Kind.ValueString(),
-		Make:      plan.Make.ValueString(),
-		Model:     plan.Model.ValueString(),
-		CPU:       plan.CPU.ValueString(),
-		RAMGB:     plan.RAMGB.ValueInt64(),
-		StorageTB: plan.StorageTB.ValueFloat64(),
-		Location:  plan.Location.ValueString(),
-		Serial:    plan.Serial.ValueString(),
-		Notes:     plan.Notes.ValueString(),
+		Name:              plan.Name.ValueString(),
+		Kind:              plan.Kind.ValueString(),
+		Make:              plan.Make.ValueString(),
+		Model:             plan.Model.ValueString(),
+		CPU:               plan.CPU.ValueString(),
+		CPUCores:          plan.CPUCores.ValueInt64(),
+		RAMGB:             plan.RAMGB.ValueInt64(),
+		StorageTB:         plan.StorageTB.ValueFloat64(),
+		Location:          plan.Location.ValueString(),
+		Serial:            plan.Serial.ValueString(),
+		Notes:             plan.Notes.ValueString(),
+		Tags:              tagsFromModel(ctx, plan.Tags, &resp.Diagnostics),
+		Labels:            labelsFromModel(ctx, plan.Labels, &resp.Diagnostics),
+		ParentID:          plan.ParentID.ValueString(),
+		LocationID:        plan.LocationID.ValueString(),
+		RackU:             plan.RackU.ValueInt64(),
+		UHeight:           plan.UHeight.ValueInt64(),
+		DeriveCapacity:    plan.DeriveCapacity.ValueBool(),
+		PurchaseDate:      plan.PurchaseDate.ValueString(),
+		Vendor:            plan.Vendor.ValueString(),
+		Price:             plan.Price.ValueFloat64(),
+		Currency:          plan.Currency.ValueString(),
+		WarrantyEnd:       plan.WarrantyEnd.ValueString(),
+		LifetimeYears:     plan.LifetimeYears.ValueInt64(),
+		RatedWatts:        plan.RatedWatts.ValueInt64(),
+		IdleWatts:         plan.IdleWatts.ValueInt64(),
+		PeakWatts:         plan.PeakWatts.ValueInt64(),
+		UPSID:             plan.UPSID.ValueString(),
+		Circuit:           plan.Circuit.ValueString(),
+		ReservedCores:     plan.ReservedCores.ValueInt64(),
+		ReservedRAMGB:     plan.ReservedRAMGB.ValueInt64(),
+		ReservedStorageTB: plan.ReservedStorageTB.ValueFloat64(),
+		Status:            plan.Status.ValueString(),
 	})
 	if err != nil {
 		resp.Diagnostics.AddError("Error creating lab_gear_machine", err.Error())
@@ -164,18 +337,47 @@ func (r *machineResource) Update(ctx context.Context, req resource.UpdateRequest
 	}
 
 	updated, err := r.client.UpdateMachine(ctx, apiclient.Machine{
-		ID:        state.ID.ValueString(),
-		Name:      plan.Name.ValueString(),
-		Kind:      plan.Kind.ValueString(),
-		Make:      plan.Make.ValueString(),
-		Model:     plan.Model.ValueString(),
-		CPU:       plan.CPU.ValueString(),
-		RAMGB:     plan.RAMGB.ValueInt64(),
-		StorageTB: plan.StorageTB.ValueFloat64(),
-		Location:  plan.Location.ValueString(),
-		Serial:    plan.Serial.ValueString(),
-		Notes:     plan.Notes.ValueString(),
+		ID:                state.ID.ValueString(),
+		Name:              plan.Name.ValueString(),
+		Kind:              plan.Kind.ValueString(),
+		Make:              plan.Make.ValueString(),
+		Model:             plan.Model.ValueString(),
+		CPU:               plan.CPU.ValueString(),
+		CPUCores:          plan.CPUCores.ValueInt64(),
+		RAMGB:             plan.RAMGB.ValueInt64(),
+		StorageTB:         plan.StorageTB.ValueFloat64(),
+		Location:          plan.Location.ValueString(),
+		Serial:            plan.Serial.ValueString(),
+		Notes:             plan.Notes.ValueString(),
+		Tags:              tagsFromModel(ctx, plan.Tags, &resp.Diagnostics),
+		Labels:            labelsFromModel(ctx, plan.Labels, &resp.Diagnostics),
+		ParentID:          plan.ParentID.ValueString(),
+		LocationID:        plan.LocationID.ValueString(),
+		RackU:             plan.RackU.ValueInt64(),
+		UHeight:           plan.UHeight.ValueInt64(),
+		DeriveCapacity:    plan.DeriveCapacity.ValueBool(),
+		PurchaseDate:      plan.PurchaseDate.ValueString(),
+		Vendor:            plan.Vendor.ValueString(),
+		Price:             plan.Price.ValueFloat64(),
+		Currency:          plan.Currency.ValueString(),
+		WarrantyEnd:       plan.WarrantyEnd.ValueString(),
+		LifetimeYears:     plan.LifetimeYears.ValueInt64(),
+		RatedWatts:        plan.RatedWatts.ValueInt64(),
+		IdleWatts:         plan.IdleWatts.ValueInt64(),
+		PeakWatts:         plan.PeakWatts.ValueInt64(),
+		UPSID:             plan.UPSID.ValueString(),
+		Circuit:           plan.Circuit.ValueString(),
+		ReservedCores:     plan.ReservedCores.ValueInt64(),
+		ReservedRAMGB:     plan.ReservedRAMGB.ValueInt64(),
+		ReservedStorageTB: plan.ReservedStorageTB.ValueFloat64(),
+		Status:            plan.Status.ValueString(),
+		Revision:          state.Revision.ValueInt64(),
 	})
+	if errors.Is(err, apiclient.ErrModified) {
+		resp.Diagnostics.AddError("lab_gear_machine changed outside Terraform",
+			fmt.Sprintf("Machine %q was modified after this plan was made. Refresh and plan again before applying.", state.ID.ValueString()))
+		return
+	}
 	if err != nil {
 		resp.Diagnostics.AddError("Error updating lab_gear_machine", err.Error())
 		return
@@ -224,9 +426,83 @@ func machineToState(m *apiclient.Machine, s *machineModel) {
 	s.Make = types.StringValue(m.Make)
 	s.Model = types.StringValue(m.Model)
 	s.CPU = types.StringValue(m.CPU)
+	s.CPUCores = types.Int64Value(m.CPUCores)
 	s.RAMGB = types.Int64Value(m.RAMGB)
 	s.StorageTB = types.Float64Value(m.StorageTB)
 	s.Location = types.StringValue(m.Location)
 	s.Serial = types.StringValue(m.Serial)
 	s.Notes = types.StringValue(m.Notes)
+	s.Tags = tagsValue(m.Tags)
+	s.Labels = labelsValue(m.Labels)
+	s.ParentID = optionalStringValue(m.ParentID)
+	s.LocationID = optionalStringValue(m.LocationID)
+	s.RackU = types.Int64Value(m.RackU)
+	s.UHeight = types.Int64Value(m.UHeight)
+	s.DeriveCapacity = types.BoolValue(m.DeriveCapacity)
+	s.PurchaseDate = types.StringValue(m.PurchaseDate)
+	s.Vendor = types.StringValue(m.Vendor)
+	s.Price = types.Float64Value(m.Price)
+	s.Currency = types.StringValue(m.Currency)
+	s.WarrantyEnd = types.StringValue(m.WarrantyEnd)
+	s.LifetimeYears = types.Int64Value(m.LifetimeYears)
+	s.RatedWatts = types.Int64Value(m.RatedWatts)
+	s.IdleWatts = types.Int64Value(m.IdleWatts)
+	s.PeakWatts = types.Int64Value(m.PeakWatts)
+	s.UPSID = optionalStringValue(m.UPSID)
+	s.Circuit = types.StringValue(m.Circuit)
+	s.ReservedCores = types.Int64Value(m.ReservedCores)
+	s.ReservedRAMGB = types.Int64Value(m.ReservedRAMGB)
+	s.ReservedStorageTB = types.Float64Value(m.ReservedStorageTB)
+	s.Status = types.StringValue(m.Status)
+	s.StatusChangedAt = types.StringValue(m.StatusChangedAt)
+	s.Revision = types.Int64Value(m.Revision)
+}
+
+// optionalStringValue converts an optional ID from the API, where empty
+// means unset, to a string attribute that is null when unset.
+func optionalStringValue(s string) types.String {
+	if s == "" {
+		return types.StringNull()
+	}
+	return types.StringValue(s)
+}
+
+// tagsFromModel converts a tags attribute to the API form. A null or unknown
+// value (the attribute was left unset) yields no tags.
+func tagsFromModel(ctx context.Context, v types.Set, diags *diag.Diagnostics) []string {
+	tags := []string{}
+	if v.IsNull() || v.IsUnknown() {
+		return tags
+	}
+	diags.Append(v.ElementsAs(ctx, &tags, false)...)
+	return tags
+}
+
+// labelsFromModel converts a labels attribute to the API form. A null or
+// unknown value (the attribute was left unset) yields no labels.
+func labelsFromModel(ctx context.Context, v types.Map, diags *diag.Diagnostics) map[string]string {
+	labels := map[string]string{}
+	if v.IsNull() || v.IsUnknown() {
+		return labels
+	}
+	diags.Append(v.ElementsAs(ctx, &labels, false)...)
+	return labels
+}
+
+// tagsValue converts API tags to a Terraform set of strings.
+func tagsValue(tags []string) types.Set {
+	elems := make([]attr.Value, len(tags))
+	for i, t := range tags {
+		elems[i] = types.StringValue(t)
+	}
+	return types.SetValueMust(types.StringType, elems)
+}
+
+// labelsValue converts API labels to a Terraform map of strings.
+func labelsValue(labels map[string]string) types.Map {
+	elems := make(map[string]attr.Value, len(labels))
+	for k, v := range labels {
+		elems[k] = types.StringValue(v)
+	}
+	return types.MapValueMust(types.StringType, elems)
 }
@@ -3,11 +3,13 @@ package resources_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	resourceschema "github.com/hashicorp/terraform-plugin-framework/resource/schema"
 	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
@@ -19,17 +21,42 @@ import (
 
 // testMachineModel mirrors machineModel for decoding state in tests.
 type testMachineModel struct {
-	ID        types.String  `tfsdk:"id"`
-	Name      types.String  `tfsdk:"name"`
-	Kind      types.String  `tfsdk:"kind"`
-	Make      types.String  `tfsdk:"make"`
-	Model     types.String  `tfsdk:"model"`
-	CPU       types.String  `tfsdk:"cpu"`
-	RAMGB     types.Int64   `tfsdk:"ram_gb"`
-	StorageTB types.Float64 `tfsdk:"storage_tb"`
-	Location  types.String  `tfsdk:"location"`
-	Serial    types.String  `tfsdk:"serial"`
-	Notes     types.String  `tfsdk:"notes"`
+	ID                types.String  `tfsdk:"id"`
+	Name              types.String  `tfsdk:"name"`
+	Kind              types.String  `tfsdk:"kind"`
+	Make              types.String  `tfsdk:"make"`
+	Model             types.String  `tfsdk:"model"`
+	CPU               types.String  `tfsdk:"cpu"`
+	CPUCores          types.Int64   `tfsdk:"cpu_cores"`
+	RAMGB             types.Int64   `tfsdk:"ram_gb"`
+	StorageTB         types.Float64 `tfsdk:"storage_tb"`
+	Location          types.String  `tfsdk:"location"`
+	Serial            types.String  `tfsdk:"serial"`
+	Notes             types.String  `tfsdk:"notes"`
+	Tags              types.Set     `tfsdk:"tags"`
+	Labels            types.Map     `tfsdk:"labels"`
+	ParentID          types.String  `tfsdk:"parent_id"`
+	LocationID        types.String  `tfsdk:"location_id"`
+	RackU             types.Int64   `tfsdk:"rack_u"`
+	UHeight           types.Int64   `tfsdk:"u_height"`
+	DeriveCapacity    types.Bool    `tfsdk:"derive_capacity"`
+	PurchaseDate      types.String  `tfsdk:"purchase_date"`
+	Vendor            types.String  `tfsdk:"vendor"`
+	Price             types.Float64 `tfsdk:"price"`
+	Currency          types.String  `tfsdk:"currency"`
+	WarrantyEnd       types.String  `tfsdk:"warranty_end"`
+	LifetimeYears     types.Int64   `tfsdk:"lifetime_years"`
+	RatedWatts        types.Int64   `tfsdk:"rated_watts"`
+	IdleWatts         types.Int64   `tfsdk:"idle_watts"`
+	PeakWatts         types.Int64   `tfsdk:"peak_watts"`
+	UPSID             types.String  `tfsdk:"ups_id"`
+	Circuit           types.String  `tfsdk:"circuit"`
+	ReservedCores     types.Int64   `tfsdk:"reserved_cores"`
+	ReservedRAMGB     types.Int64   `tfsdk:"reserved_ram_gb"`
+	ReservedStorageTB types.Float64 `tfsdk:"reserved_storage_tb"`
+	Status            types.String  `tfsdk:"status"`
+	StatusChangedAt   types.String  `tfsdk:"status_changed_at"`
+	Revision          types.Int64   `tfsdk:"revision"`
 }
 
 // getSchema retrieves the machine resource schema.
@@ -49,17 +76,42 @@ func buildPlan(t *testing.T, schm resourceschema.Schema, name, kind, make, model
 	ctx := context.Background()
 	schemaType := schm.Type().TerraformType(ctx)
 	raw := tftypes.NewValue(schemaType, map[string]tftypes.Value{
-		"id":         tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
-		"name":       tftypes.NewValue(tftypes.String, name),
-		"kind":       tftypes.NewValue(tftypes.String, kind),
-		"make":       tftypes.NewValue(tftypes.String, make),
-		"model":      tftypes.NewValue(tftypes.String, model),
-		"cpu":        tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
-		"ram_gb":     tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
-		"storage_tb": tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
-		"location":   tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
-		"serial":     tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
-		"notes":      tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"id":                  tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"name":                tftypes.NewValue(tftypes.String, name),
+		"kind":                tftypes.NewValue(tftypes.String, kind),
+		"make":                tftypes.NewValue(tftypes.String, make),
+		"model":               tftypes.NewValue(tftypes.String, model),
+		"cpu":                 tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"cpu_cores":           tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"ram_gb":              tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"storage_tb":          tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"location":            tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"serial":              tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"notes":               tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"tags":                tftypes.NewValue(tftypes.Set{ElementType: tftypes.String}, tftypes.UnknownValue),
+		"labels":              tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, tftypes.UnknownValue),
+		"parent_id":           tftypes.NewValue(tftypes.String, nil),
+		"location_id":         tftypes.NewValue(tftypes.String, nil),
+		"rack_u":              tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"u_height":            tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"derive_capacity":     tftypes.NewValue(tftypes.Bool, tftypes.UnknownValue),
+		"purchase_date":       tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"vendor":              tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"price":               tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"currency":            tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"warranty_end":        tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"lifetime_years":      tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"rated_watts":         tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"idle_watts":          tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"peak_watts":          tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"ups_id":              tftypes.NewValue(tftypes.String, nil),
+		"circuit":             tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"reserved_cores":      tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"reserved_ram_gb":     tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"reserved_storage_tb": tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
+		"status":              tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"status_changed_at":   tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"revision":            tftypes.NewValue(tftypes.Number, tftypes.UnknownValue),
 	})
 	return tfsdk.Plan{Schema: schm, Raw: raw}
 }
@@ -69,22 +121,75 @@ func buildState(t *testing.T, schm resourceschema.Schema, m apiclient.Machine) t
 	t.Helper()
 	ctx := context.Background()
 	schemaType := schm.Type().TerraformType(ctx)
+	var parentID, locationID, upsID any
+	if m.ParentID != "" {
+		parentID = m.ParentID
+	}
+	if m.LocationID != "" {
+		locationID = m.LocationID
+	}
+	if m.UPSID != "" {
+		upsID = m.UPSID
+	}
 	raw := tftypes.NewValue(schemaType, map[string]tftypes.Value{
-		"id":         tftypes.NewValue(tftypes.String, m.ID),
-		"name":       tftypes.NewValue(tftypes.String, m.Name),
-		"kind":       tftypes.NewValue(tftypes.String, m.Kind),
-		"make":       tftypes.NewValue(tftypes.String, m.Make),
-		"model":      tftypes.NewValue(tftypes.String, m.Model),
-		"cpu":        tftypes.NewValue(tftypes.String, m.CPU),
-		"ram_gb":     tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.RAMGB)),
-		"storage_tb": tftypes.NewValue(tftypes.Number, big.NewFloat(m.StorageTB)),
-		"location":   tftypes.NewValue(tftypes.String, m.Location),
-		"serial":     tftypes.NewValue(tftypes.String, m.Serial),
-		"notes":      tftypes.NewValue(tftypes.String, m.Notes),
+		"id":                  tftypes.NewValue(tftypes.String, m.ID),
+		"name":                tftypes.NewValue(tftypes.String, m.Name),
+		"kind":                tftypes.NewValue(tftypes.String, m.Kind),
+		"make":                tftypes.NewValue(tftypes.String, m.Make),
+		"model":               tftypes.NewValue(tftypes.String, m.Model),
+		"cpu":                 tftypes.NewValue(tftypes.String, m.CPU),
+		"cpu_cores":           tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.CPUCores)),
+		"ram_gb":              tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.RAMGB)),
+		"storage_tb":          tftypes.NewValue(tftypes.Number, big.NewFloat(m.StorageTB)),
+		"location":            tftypes.NewValue(tftypes.String, m.Location),
+		"serial":              tftypes.NewValue(tftypes.String, m.Serial),
+		"notes":               tftypes.NewValue(tftypes.String, m.Notes),
+		"tags":                tagsTF(m.Tags),
+		"labels":              labelsTF(m.Labels),
+		"parent_id":           tftypes.NewValue(tftypes.String, parentID),
+		"location_id":         tftypes.NewValue(tftypes.String, locationID),
+		"rack_u":              tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.RackU)),
+		"u_height":            tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.UHeight)),
+		"derive_capacity":     tftypes.NewValue(tftypes.Bool, m.DeriveCapacity),
+		"purchase_date":       tftypes.NewValue(tftypes.String, m.PurchaseDate),
+		"vendor":              tftypes.NewValue(tftypes.String, m.Vendor),
+		"price":               tftypes.NewValue(tftypes.Number, big.NewFloat(m.Price)),
+		"currency":            tftypes.NewValue(tftypes.String, m.Currency),
+		"warranty_end":        tftypes.NewValue(tftypes.String, m.WarrantyEnd),
+		"lifetime_years":      tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.LifetimeYears)),
+		"rated_watts":         tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.RatedWatts)),
+		"idle_watts":          tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.IdleWatts)),
+		"peak_watts":          tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.PeakWatts)),
+		"ups_id":              tftypes.NewValue(tftypes.String, upsID),
+		"circuit":             tftypes.NewValue(tftypes.String, m.Circuit),
+		"reserved_cores":      tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.ReservedCores)),
+		"reserved_ram_gb":     tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.ReservedRAMGB)),
+		"reserved_storage_tb": tftypes.NewValue(tftypes.Number, big.NewFloat(m.ReservedStorageTB)),
+		"status":              tftypes.NewValue(tftypes.String, m.Status),
+		"status_changed_at":   tftypes.NewValue(tftypes.String, m.StatusChangedAt),
+		"revision":            tftypes.NewValue(tftypes.Number, new(big.Float).SetInt64(m.Revision)),
 	})
 	return tfsdk.State{Schema: schm, Raw: raw}
 }
 
+// tagsTF converts tags to a tftypes set of strings.
+func tagsTF(tags []string) tftypes.Value {
+	elems := make([]tftypes.Value, len(tags))
+	for i, t := range tags {
+		elems[i] = tftypes.NewValue(tftypes.String, t)
+	}
+	return tftypes.NewValue(tftypes.Set{ElementType: tftypes.String}, elems)
+}
+
+// labelsTF converts labels to a tftypes map of strings.
+func labelsTF(labels map[string]string) tftypes.Value {
+	elems := make(map[string]tftypes.Value, len(labels))
+	for k, v := range labels {
+		elems[k] = tftypes.NewValue(tftypes.String, v)
+	}
+	return tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, elems)
+}
+
 // emptyState returns a null-initialised state with the schema set.
 func emptyState(schm resourceschema.Schema) tfsdk.State {
 	ctx := context.Background()
@@ -161,7 +266,7 @@ func TestMachineResource_Schema_ComputedFields(t *testing.T) {
 	r := resources.NewMachineResource()
 	schm := getSchema(t, r)
 
-	computed := []string{"id", "cpu", "ram_gb", "storage_tb", "location", "serial", "notes"}
+	computed := []string{"id", "cpu", "cpu_cores", "ram_gb", "storage_tb", "location", "serial", "notes", "tags", "labels", "rack_u", "u_height", "derive_capacity", "purchase_date", "vendor", "price", "currency", "warranty_end", "lifetime_years", "rated_watts", "idle_watts", "peak_watts", "circuit", "reserved_cores", "reserved_ram_gb", "reserved_storage_tb", "status", "status_changed_at", "revision"}
 	for _, attr := range computed {
 		a, ok := schm.Attributes[attr]
 		if !ok {
@@ -261,6 +366,294 @@ func TestMachineResource_Create_Success(t *testing.T) {
 	}
 }
 
+func TestMachineResource_Create_TagsAndLabels(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		var body apiclient.Machine
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if fmt.Sprint(body.Tags) != "[gpu-passthrough]" || body.Labels["env"] != "prod" {
+			t.Errorf("request: got tags %v labels %v", body.Tags, body.Labels)
+		}
+		body.ID = "uuid-tags-1"
+		writeMachine(w, http.StatusCreated, body)
+	})
+	configureResource(t, r, client)
+
+	plan := buildPlan(t, schm, "pve1", "proxmox", "Dell", "R640")
+	plan.SetAttribute(ctx, path.Root("tags"), []string{"gpu-passthrough"})
+	plan.SetAttribute(ctx, path.Root("labels"), map[string]string{"env": "prod"})
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: plan}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+
+	var state testMachineModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	var tags []string
+	state.Tags.ElementsAs(ctx, &tags, false)
+	if fmt.Sprint(tags) != "[gpu-passthrough]" {
+		t.Errorf("Tags: got %v", tags)
+	}
+	var labels map[string]string
+	state.Labels.ElementsAs(ctx, &labels, false)
+	if labels["env"] != "prod" {
+		t.Errorf("Labels: got %v", labels)
+	}
+}
+
+func TestMachineResource_Create_ParentID(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	var gotParent string
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		var body apiclient.Machine
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		gotParent = body.ParentID
+		body.ID = "uuid-child"
+		writeMachine(w, http.StatusCreated, body)
+	})
+	configureResource(t, r, client)
+
+	plan := buildPlan(t, schm, "pi01", "sbc", "Raspberry Pi", "4B")
+	plan.SetAttribute(ctx, path.Root("parent_id"), "uuid-nas")
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: plan}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+	if gotParent != "uuid-nas" {
+		t.Errorf("request parent_id: got %q, want uuid-nas", gotParent)
+	}
+
+	var state testMachineModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if state.ParentID.ValueString() != "uuid-nas" {
+		t.Errorf("ParentID: got %v", state.ParentID)
+	}
+}
+
+func TestMachineResource_Create_Power(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	var got apiclient.Machine
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		body := got
+		body.ID = "uuid-pve"
+		writeMachine(w, http.StatusCreated, body)
+	})
+	configureResource(t, r, client)
+
+	plan := buildPlan(t, schm, "pve1", "proxmox", "Dell", "R640")
+	plan.SetAttribute(ctx, path.Root("ups_id"), "uuid-ups")
+	plan.SetAttribute(ctx, path.Root("idle_watts"), int64(120))
+	plan.SetAttribute(ctx, path.Root("peak_watts"), int64(350))
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: plan}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+	if got.UPSID != "uuid-ups" || got.IdleWatts != 120 || got.PeakWatts != 350 || got.RatedWatts != 0 || got.Circuit != "" {
+		t.Errorf("request: got %+v", got)
+	}
+
+	var state testMachineModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if state.UPSID.ValueString() != "uuid-ups" || state.PeakWatts.ValueInt64() != 350 ||
+		state.RatedWatts.IsUnknown() || state.Circuit.IsUnknown() {
+		t.Errorf("state: got ups_id=%v peak_watts=%v rated_watts=%v circuit=%v", state.UPSID, state.PeakWatts, state.RatedWatts, state.Circuit)
+	}
+}
+
+func TestMachineResource_Create_RackPlacement(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	var got apiclient.Machine
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		body := got
+		body.ID = "uuid-racked"
+		body.UHeight = 1 // server default when rack_u is set
+		writeMachine(w, http.StatusCreated, body)
+	})
+	configureResource(t, r, client)
+
+	plan := buildPlan(t, schm, "pve1", "proxmox", "Dell", "R640")
+	plan.SetAttribute(ctx, path.Root("location_id"), "uuid-rack")
+	plan.SetAttribute(ctx, path.Root("rack_u"), int64(12))
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: plan}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+	if got.LocationID != "uuid-rack" || got.RackU != 12 || got.UHeight != 0 {
+		t.Errorf("request: got location_id=%q rack_u=%d u_height=%d", got.LocationID, got.RackU, got.UHeight)
+	}
+
+	var state testMachineModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if state.LocationID.ValueString() != "uuid-rack" || state.RackU.ValueInt64() != 12 || state.UHeight.ValueInt64() != 1 {
+		t.Errorf("state: got location_id=%v rack_u=%v u_height=%v", state.LocationID, state.RackU, state.UHeight)
+	}
+}
+
+func TestMachineResource_Create_DeriveCapacity(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	var got apiclient.Machine
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		body := got
+		body.ID = "uuid-derived"
+		body.RAMGB, body.StorageTB = 128, 7.68 // summed from components
+		writeMachine(w, http.StatusCreated, body)
+	})
+	configureResource(t, r, client)
+
+	plan := buildPlan(t, schm, "pve2", "proxmox", "Dell", "R740")
+	plan.SetAttribute(ctx, path.Root("derive_capacity"), true)
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: plan}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+	if !got.DeriveCapacity {
+		t.Errorf("request: derive_capacity not sent")
+	}
+
+	var state testMachineModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if !state.DeriveCapacity.ValueBool() || state.RAMGB.ValueInt64() != 128 || state.StorageTB.ValueFloat64() != 7.68 {
+		t.Errorf("state: got derive_capacity=%v ram_gb=%v storage_tb=%v", state.DeriveCapacity, state.RAMGB, state.StorageTB)
+	}
+}
+
+func TestMachineResource_Read_NoParentIsNull(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	m := apiclient.Machine{ID: "uuid-root", Name: "nas01", Kind: "nas", Make: "Synology", Model: "DS920+"}
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		writeMachine(w, http.StatusOK, m)
+	})
+	configureResource(t, r, client)
+
+	resp := &resource.ReadResponse{State: buildState(t, schm, m)}
+	r.Read(ctx, resource.ReadRequest{State: buildState(t, schm, m)}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read: unexpected error: %v", resp.Diagnostics)
+	}
+	var state testMachineModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Read: state.Get: %v", diags)
+	}
+	if !state.ParentID.IsNull() {
+		t.Errorf("ParentID: got %v, want null so an unset attribute shows no diff", state.ParentID)
+	}
+	if !state.LocationID.IsNull() {
+		t.Errorf("LocationID: got %v, want null", state.LocationID)
+	}
+}
+
+func TestMachineResource_Create_UnsetTagsAreEmpty(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		writeMachine(w, http.StatusCreated, apiclient.Machine{ID: "uuid-tags-2", Name: "pve1", Tags: []string{}, Labels: map[string]string{}})
+	})
+	configureResource(t, r, client)
+
+	resp := &resource.CreateResponse{State: emptyState(schm)}
+	r.Create(ctx, resource.CreateRequest{Plan: buildPlan(t, schm, "pve1", "proxmox", "Dell", "R640")}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Create: unexpected error: %v", resp.Diagnostics)
+	}
+
+	var state testMachineModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Create: state.Get: %v", diags)
+	}
+	if state.Tags.IsNull() || state.Tags.IsUnknown() || len(state.Tags.Elements()) != 0 {
+		t.Errorf("Tags: got %v, want empty set", state.Tags)
+	}
+	if state.Labels.IsNull() || state.Labels.IsUnknown() || len(state.Labels.Elements()) != 0 {
+		t.Errorf("Labels: got %v, want empty map", state.Labels)
+	}
+}
+
+func TestMachineResource_Update_SendsStatus(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	current := apiclient.Machine{ID: "uuid-st", Name: "pve1", Kind: "proxmox", Make: "Dell", Model: "R640", Status: "active", Revision: 2}
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		var body apiclient.Machine
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if body.Status != "retired" {
+			t.Errorf("request status: got %q, want retired", body.Status)
+		}
+		body.ID = current.ID
+		body.StatusChangedAt = "2026-03-01T09:15:00Z"
+		body.Revision = 3
+		writeMachine(w, http.StatusOK, body)
+	})
+	configureResource(t, r, client)
+
+	plan := buildPlan(t, schm, "pve1", "proxmox", "Dell", "R640")
+	plan.SetAttribute(ctx, path.Root("status"), "retired")
+	resp := &resource.UpdateResponse{State: buildState(t, schm, current)}
+	r.Update(ctx, resource.UpdateRequest{Plan: plan, State: buildState(t, schm, current)}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Update: unexpected error: %v", resp.Diagnostics)
+	}
+
+	var state testMachineModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Update: state.Get: %v", diags)
+	}
+	if state.Status.ValueString() != "retired" || state.StatusChangedAt.ValueString() != "2026-03-01T09:15:00Z" {
+		t.Errorf("state: status %q changed at %q", state.Status.ValueString(), state.StatusChangedAt.ValueString())
+	}
+}
+
 func TestMachineResource_Create_APIError(t *testing.T) {
 	ctx := context.Background()
 	r := resources.NewMachineResource()
@@ -409,6 +802,65 @@ func TestMachineResource_Update_Success(t *testing.T) {
 	}
 }
 
+func TestMachineResource_Update_SendsRevision(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	original := apiclient.Machine{
+		ID: "uuid-update-2", Name: "nas01", Kind: "nas", Make: "Synology", Model: "DS920+", Revision: 4,
+	}
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if got := req.Header.Get("If-Match"); got != `"4"` {
+			t.Errorf("If-Match: got %q, want %q", got, `"4"`)
+		}
+		updated := original
+		updated.Model = "DS923+"
+		updated.Revision = 5
+		writeMachine(w, http.StatusOK, updated)
+	})
+	configureResource(t, r, client)
+
+	plan := buildPlan(t, schm, "nas01", "nas", "Synology", "DS923+")
+	currentState := buildState(t, schm, original)
+	resp := &resource.UpdateResponse{State: currentState}
+	r.Update(ctx, resource.UpdateRequest{Plan: plan, State: currentState}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Update: unexpected error: %v", resp.Diagnostics)
+	}
+
+	var state testMachineModel
+	if diags := resp.State.Get(ctx, &state); diags.HasError() {
+		t.Fatalf("Update: state.Get: %v", diags)
+	}
+	if state.Revision.ValueInt64() != 5 {
+		t.Errorf("Revision: got %d, want 5", state.Revision.ValueInt64())
+	}
+}
+
+func TestMachineResource_Update_ModifiedOutsideTerraform(t *testing.T) {
+	ctx := context.Background()
+	r := resources.NewMachineResource()
+	schm := getSchema(t, r)
+
+	client := newMockServer(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+	})
+	configureResource(t, r, client)
+
+	plan := buildPlan(t, schm, "nas01", "nas", "Synology", "DS923+")
+	currentState := buildState(t, schm, apiclient.Machine{ID: "uuid-stale", Revision: 2})
+	resp := &resource.UpdateResponse{State: currentState}
+	r.Update(ctx, resource.UpdateRequest{Plan: plan, State: currentState}, resp)
+
+	if !resp.Diagnostics.HasError() {
+		t.Fatal("Update: expected error on 412, got none")
+	}
+	if got := resp.Diagnostics[0].Summary(); got != "lab_gear_machine changed outside Terraform" {
+		t.Errorf("diagnostic summary: got %q", got)
+	}
+}
+
 func TestMachineResource_Update_APIError(t *testing.T) {
 	ctx := context.Background()
 	r := resources.NewMachineResource()